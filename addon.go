@@ -2,6 +2,7 @@ package gonnect
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,16 +10,76 @@ import (
 	"text/template"
 
 	"github.com/go-enjin/be/pkg/log"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/entitlement"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/i18n"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/internaltoken"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/notify"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/retention"
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
 )
 
+// LifecycleFunc is called by the lifecycle handlers with the store
+// transaction the tenant was persisted in, returning an error rolls back the
+// tenant changes and fails the lifecycle request. The complete lifecycle
+// payload is returned by store.LifecyclePayloadFromContext(ctx)
+type LifecycleFunc func(ctx context.Context, tx store.TenantStore, tenant *store.Tenant) error
+
 type Addon struct {
 	Config          *Profile
 	CurrentProfile  string
-	Store           *store.Store
+	Store           store.TenantStore
 	AddonDescriptor map[string]interface{}
 	Key             *string
 	Name            *string
+	OnInstalled     LifecycleFunc
+	OnUninstalled   LifecycleFunc
+	// LifecyclePolicy decides how failures of OnInstalled and OnUninstalled
+	// are answered, LifecycleFail by default
+	LifecyclePolicy LifecyclePolicy
+	// LifecycleRetries receives the failed callbacks of the
+	// LifecycleRetryLater policy
+	LifecycleRetries LifecycleRetryQueue
+	// SiteCollisionPolicy decides how an install is answered whose baseUrl
+	// belongs to a tenant with another clientKey, CollisionKeepBoth by
+	// default. The collision is published as notify.EventSiteCollision
+	SiteCollisionPolicy SiteCollisionPolicy
+	// UnknownTenantPolicy decides how requests of tenants missing from the
+	// store are answered, UnknownTenantUnauthorized by default
+	UnknownTenantPolicy UnknownTenantPolicy
+	// ResolveTenant resolves the unknown tenants of the UnknownTenantResolve
+	// policy
+	ResolveTenant TenantResolver
+	// ReinstallPage is executed with ReinstallPageData for the
+	// UnknownTenantReinstallPage policy, DefaultReinstallPage when nil
+	ReinstallPage Template
+	// IdentityLinker maps the authenticated users to the users of the
+	// application, see PrincipalFromContext
+	IdentityLinker IdentityLinker
+	// Notifier receives the lifecycle events of tenants, usually created with
+	// notify.New(profile.Notifications...), notifications are disabled when nil
+	Notifier *notify.Notifier
+	// Translations are served for the translations block of the descriptor
+	// when set, see routes.RegisterRoutes
+	Translations *i18n.Bundle
+	// Entitlements maps the capability sets of tenants to features, see
+	// middleware.NewRequireEntitlementMiddleware
+	Entitlements *entitlement.Plan
+	// Retention schedules the deletion of uninstalled tenants when set
+	Retention *retention.Workflow
+	// AdminAuth authorizes the operator routes created without their own
+	// AuthorizeFunc, all such requests are denied when nil
+	AdminAuth AdminAuthFunc
+	// Impersonation authorizes every request made as a user of a tenant with
+	// the ACT_AS_USER scope, all of them are allowed when nil and recorded in
+	// the audit log either way
+	Impersonation ImpersonationFunc
+	// InternalTokens issues and verifies the tokens of calls between the
+	// services of the add-on, see middleware.NewInternalAuthMiddleware
+	InternalTokens *internaltoken.Signer
+	// ProductDescriptors are the descriptor fields served to a host product,
+	// such as its modules and scopes, keyed by product type like "jira" or
+	// "confluence" in any case, see ProductDescriptor
+	ProductDescriptors map[string]map[string]interface{}
 }
 
 func readAddonDescriptor(descriptorReader io.Reader, baseUrl string) (map[string]interface{}, error) {
@@ -53,7 +114,7 @@ func readAddonDescriptor(descriptorReader io.Reader, baseUrl string) (map[string
 	return descriptor, nil
 }
 
-func NewCustomAddon(config *Profile, currentProfile string, addonDescriptor map[string]interface{}, s *store.Store) (a *Addon, err error) {
+func NewCustomAddon(config *Profile, currentProfile string, addonDescriptor map[string]interface{}, s store.TenantStore) (a *Addon, err error) {
 	log.InfoF("Initializing new Addon with profile: %v", currentProfile)
 	log.DebugF("Using Addon Profile: %v", config)
 	log.DebugF("Using Addon descriptor: %v", addonDescriptor)
@@ -70,6 +131,12 @@ func NewCustomAddon(config *Profile, currentProfile string, addonDescriptor map[
 		return
 	}
 
+	if s == nil && config != nil && config.SingleTenant != nil {
+		if s, err = config.OpenStore(); err != nil {
+			return nil, err
+		}
+	}
+
 	a = &Addon{
 		Config:          config,
 		Store:           s,
@@ -78,6 +145,24 @@ func NewCustomAddon(config *Profile, currentProfile string, addonDescriptor map[
 		Name:            &name,
 		Key:             &key,
 	}
+	a.logApiMigrationWarnings()
+	if err = config.ValidateCrypto(); err != nil {
+		return nil, err
+	}
+	if err = config.ValidateEphemeralTenants(); err != nil {
+		return nil, err
+	}
+	if err = config.ValidateSessionTokens(currentProfile); err != nil {
+		return nil, err
+	}
+	if config != nil && config.Admin != nil {
+		if a.AdminAuth, err = config.Admin.AuthFunc(); err != nil {
+			return nil, err
+		}
+	}
+	if config != nil && config.InternalTokens != nil {
+		a.InternalTokens = &internaltoken.Signer{Issuer: key, Secrets: config.InternalTokens.Secrets, Expiry: config.InternalTokens.Expiry}
+	}
 
 	log.DebugF("addon successfully initialized")
 	return
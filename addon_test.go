@@ -118,7 +118,7 @@ func TestNewAddon(t *testing.T) {
 				t.Errorf("Expected addon.Config to be %+v, but got %+v", testCase.addon.Config, addon.Config)
 			}
 
-			if addon.Store == nil || testCase.addon.Store == nil || !cmp.Equal(*addon.Store, *testCase.addon.Store, cmpopts.IgnoreUnexported(gorm.DB{}, sync.RWMutex{})) {
+			if addon.Store == nil || testCase.addon.Store == nil || !cmp.Equal(addon.Store, testCase.addon.Store, cmpopts.IgnoreUnexported(gorm.DB{}, sync.RWMutex{})) {
 				t.Errorf("Expected addon.Config to be %+v, but got %+v", testCase.addon.Store, addon.Store)
 			}
 
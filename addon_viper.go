@@ -20,8 +20,8 @@ package gonnect
 // 	}
 //
 // 	log.DebugF("Creating new store")
-// 	var s *store.Store
-// 	if s, err = store.New(config.Store.Type, config.Store.DatabaseUrl); err != nil {
+// 	var s store.TenantStore
+// 	if s, err = config.OpenStore(); err != nil {
 // 		log.ErrorF("Could not create new store: %s\n", err)
 // 		return
 // 	}
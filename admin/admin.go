@@ -0,0 +1,210 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+// AuthorizeFunc decides whether a request may use the admin API
+type AuthorizeFunc = gonnect.AdminAuthFunc
+
+// Authorized reports whether authorize allows the request, falling back to
+// the AdminAuth of the add-on when authorize is nil
+func Authorized(addon *gonnect.Addon, authorize AuthorizeFunc, r *http.Request) bool {
+	if authorize == nil {
+		authorize = addon.AdminAuth
+	}
+	return authorize != nil && authorize(r)
+}
+
+// Handler serves the operator API of an add-on, it is meant to be mounted
+// on an internal path, for example mux.Mount("/admin", admin.NewHandler(...))
+type Handler struct {
+	addon     *gonnect.Addon
+	authorize AuthorizeFunc
+	router    chi.Router
+}
+
+// NewHandler returns the admin API of the add-on, every request is rejected
+// unless authorize, or the AdminAuth of the add-on when nil, allows it
+func NewHandler(addon *gonnect.Addon, authorize AuthorizeFunc) *Handler {
+	h := &Handler{addon: addon, authorize: authorize}
+	r := chi.NewRouter()
+	r.Get("/tenants/{clientKey}/history", h.history)
+	r.Get("/drift", h.drift)
+	r.Get("/ratelimits", h.rateLimits)
+	r.Get("/tenants/{clientKey}/ratelimit", h.rateLimit)
+	r.Post("/tenants/{clientKey}/revoke-secret", h.revokeSecret)
+	r.Post("/tenants/{clientKey}/revoke-tokens", h.revokeTokens)
+	h.router = r
+	return h
+}
+
+// Router returns the admin API router so additional routes can be added
+func (h *Handler) Router() chi.Router {
+	return h.router
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !Authorized(h.addon, h.authorize, r) {
+		util.SendError(w, r, h.addon, http.StatusForbidden, "admin access denied")
+		return
+	}
+	h.router.ServeHTTP(w, r)
+}
+
+func sendJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	historian, ok := h.addon.Store.(store.Historian)
+	if !ok {
+		util.SendError(w, r, h.addon, http.StatusNotImplemented, "tenant store does not keep history")
+		return
+	}
+	clientKey := chi.URLParam(r, "clientKey")
+	if _, err := h.addon.Store.Get(clientKey); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			util.SendError(w, r, h.addon, http.StatusNotFound, "tenant not found")
+			return
+		}
+		util.SendError(w, r, h.addon, http.StatusInternalServerError, err.Error())
+		return
+	}
+	history, err := historian.History(clientKey)
+	if err != nil {
+		util.SendError(w, r, h.addon, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if history == nil {
+		history = []store.TenantSnapshot{}
+	}
+	sendJSON(w, history)
+}
+
+func (h *Handler) drift(w http.ResponseWriter, r *http.Request) {
+	drifts, err := h.addon.ScanDrift(r.Context())
+	if err != nil {
+		util.SendError(w, r, h.addon, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if drifts == nil {
+		drifts = []gonnect.ScopeDrift{}
+	}
+	sendJSON(w, drifts)
+}
+
+// rateLimits lists the outbound rate limit state of the tenants, the most
+// throttled first, only throttled tenants unless ?all=true
+func (h *Handler) rateLimits(w http.ResponseWriter, r *http.Request) {
+	all := r.URL.Query().Get("all") == "true"
+	states := []hostrequest.RateLimitState{}
+	for _, state := range hostrequest.DefaultRateLimits.All() {
+		if all || state.Throttled() {
+			states = append(states, state)
+		}
+	}
+	sendJSON(w, states)
+}
+
+func (h *Handler) rateLimit(w http.ResponseWriter, r *http.Request) {
+	state, ok := hostrequest.DefaultRateLimits.Get(chi.URLParam(r, "clientKey"))
+	if !ok {
+		util.SendError(w, r, h.addon, http.StatusNotFound, "no host requests of the tenant seen")
+		return
+	}
+	sendJSON(w, state)
+}
+
+// AuditSecretRevoked is recorded when an operator revoked the shared secret
+// of a tenant
+const AuditSecretRevoked = "tenant.secret_revoked"
+
+// revokeSecret invalidates the shared secret of a tenant suspected to have
+// leaked, its requests are rejected until the add-on is installed again
+func (h *Handler) revokeSecret(w http.ResponseWriter, r *http.Request) {
+	revoker, ok := h.addon.Store.(store.SecretRevoker)
+	if !ok {
+		util.SendError(w, r, h.addon, http.StatusNotImplemented, "tenant store cannot revoke secrets")
+		return
+	}
+	clientKey := chi.URLParam(r, "clientKey")
+	if err := revoker.RevokeSecret(clientKey); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			util.SendError(w, r, h.addon, http.StatusNotFound, "tenant not found")
+			return
+		}
+		util.SendError(w, r, h.addon, http.StatusInternalServerError, err.Error())
+		return
+	}
+	audit.Record(r.Context(), audit.Event{
+		Type:      AuditSecretRevoked,
+		ClientKey: clientKey,
+		Message:   "shared secret revoked by an operator, the tenant has to install the add-on again",
+		Fields:    map[string]string{"remoteAddr": r.RemoteAddr},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AuditTokensRevoked is recorded when an operator revoked session tokens of
+// a tenant
+const AuditTokensRevoked = "tenant.tokens_revoked"
+
+// revokeTokens revokes the session token of the jti parameter, or all
+// session tokens of the tenant issued before the issuedBefore parameter
+// (RFC 3339), which defaults to now
+func (h *Handler) revokeTokens(w http.ResponseWriter, r *http.Request) {
+	revoker, ok := h.addon.Store.(store.TokenRevoker)
+	if !ok {
+		util.SendError(w, r, h.addon, http.StatusNotImplemented, "tenant store cannot revoke tokens")
+		return
+	}
+	clientKey := chi.URLParam(r, "clientKey")
+	if _, err := h.addon.Store.Get(clientKey); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			util.SendError(w, r, h.addon, http.StatusNotFound, "tenant not found")
+			return
+		}
+		util.SendError(w, r, h.addon, http.StatusInternalServerError, err.Error())
+		return
+	}
+	fields := map[string]string{"remoteAddr": r.RemoteAddr}
+	var err error
+	if jti := r.FormValue("jti"); jti != "" {
+		fields["jti"] = jti
+		err = revoker.RevokeToken(clientKey, jti)
+	} else {
+		before := time.Now()
+		if value := r.FormValue("issuedBefore"); value != "" {
+			if before, err = time.Parse(time.RFC3339, value); err != nil {
+				util.SendError(w, r, h.addon, http.StatusBadRequest, "issuedBefore is not an RFC 3339 time")
+				return
+			}
+		}
+		fields["issuedBefore"] = before.UTC().Format(time.RFC3339)
+		err = revoker.RevokeTokensIssuedBefore(clientKey, before)
+	}
+	if err != nil {
+		util.SendError(w, r, h.addon, http.StatusInternalServerError, err.Error())
+		return
+	}
+	audit.Record(r.Context(), audit.Event{
+		Type:      AuditTokensRevoked,
+		ClientKey: clientKey,
+		Message:   "session tokens revoked by an operator",
+		Fields:    fields,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,258 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func newTestAddon(t *testing.T) *gonnect.Addon {
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	s, err := store.NewFrom(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &gonnect.Addon{Store: s}
+}
+
+func TestHistory(t *testing.T) {
+	addon := newTestAddon(t)
+	for _, secret := range []string{"first", "second"} {
+		if _, err := addon.Store.Set(&store.Tenant{ClientKey: "key", BaseURL: "https://example.atlassian.net", SharedSecret: secret, AddonInstalled: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := NewHandler(addon, func(r *http.Request) bool {
+		return r.Header.Get("X-Admin") == "yes"
+	})
+
+	testCases := []struct {
+		path           string
+		admin          bool
+		expectedStatus int
+		expectedLength int
+	}{
+		{path: "/tenants/key/history", admin: false, expectedStatus: http.StatusForbidden},
+		{path: "/tenants/key/history", admin: true, expectedStatus: http.StatusOK, expectedLength: 1},
+		{path: "/tenants/unknown/history", admin: true, expectedStatus: http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, testCase.path, nil)
+		if testCase.admin {
+			req.Header.Set("X-Admin", "yes")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.expectedStatus {
+			t.Errorf("Expected status of %s to be %v, but got %v", testCase.path, testCase.expectedStatus, rec.Code)
+			continue
+		}
+		if testCase.expectedStatus != http.StatusOK {
+			continue
+		}
+		var history []store.TenantSnapshot
+		if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != testCase.expectedLength {
+			t.Errorf("Expected history length to be %v, but got %v", testCase.expectedLength, len(history))
+		}
+	}
+}
+
+func TestDrift(t *testing.T) {
+	addon := newTestAddon(t)
+	addon.AddonDescriptor = map[string]interface{}{
+		"scopes": []interface{}{"read", "write"},
+		"modules": map[string]interface{}{
+			"generalPages": []interface{}{map[string]interface{}{"key": "main"}},
+		},
+	}
+	tenants := []*store.Tenant{
+		{ClientKey: "current", BaseURL: "https://current.atlassian.net", SharedSecret: "s", AddonInstalled: true, InstalledScopes: []string{"READ", "WRITE"}, InstalledModules: []string{"generalPages:main"}},
+		{ClientKey: "outdated", BaseURL: "https://outdated.atlassian.net", SharedSecret: "s", AddonInstalled: true, InstalledScopes: []string{"READ"}, InstalledModules: []string{"generalPages:main"}},
+		{ClientKey: "unrecorded", BaseURL: "https://unrecorded.atlassian.net", SharedSecret: "s", AddonInstalled: true},
+	}
+	for _, tenant := range tenants {
+		if _, err := addon.Store.Set(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/drift", nil)
+	rec := httptest.NewRecorder()
+	NewHandler(addon, func(r *http.Request) bool { return true }).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status to be %v, but got %v", http.StatusOK, rec.Code)
+	}
+	var drifts []gonnect.ScopeDrift
+	if err := json.Unmarshal(rec.Body.Bytes(), &drifts); err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 || drifts[0].ClientKey != "outdated" || !drifts[0].NeedsConsent() {
+		t.Errorf("Expected only outdated to need consent, but got %+v", drifts)
+	}
+	if got := metrics.Get("tenants_needing_consent"); got != 1 {
+		t.Errorf("Expected tenants_needing_consent to be %v, but got %v", 1, got)
+	}
+}
+
+func TestRevokeSecret(t *testing.T) {
+	addon := newTestAddon(t)
+	if _, err := addon.Store.Set(&store.Tenant{ClientKey: "key", BaseURL: "https://example.atlassian.net", SharedSecret: "leaked", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(addon, func(r *http.Request) bool { return true })
+
+	testCases := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{path: "/tenants/key/revoke-secret", expectedStatus: http.StatusNoContent},
+		{path: "/tenants/unknown/revoke-secret", expectedStatus: http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, testCase.path, nil))
+		if rec.Code != testCase.expectedStatus {
+			t.Errorf("Expected status of %s to be %v, but got %v", testCase.path, testCase.expectedStatus, rec.Code)
+		}
+	}
+
+	tenant, err := addon.Store.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.SharedSecret != "" || tenant.AddonInstalled {
+		t.Errorf("Expected the secret to be revoked, but got %+v", tenant)
+	}
+}
+
+func TestRevokeTokens(t *testing.T) {
+	addon := newTestAddon(t)
+	if _, err := addon.Store.Set(&store.Tenant{ClientKey: "key", BaseURL: "https://example.atlassian.net", SharedSecret: "secret", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(addon, func(r *http.Request) bool { return true })
+
+	testCases := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{path: "/tenants/key/revoke-tokens?jti=token-id", expectedStatus: http.StatusNoContent},
+		{path: "/tenants/key/revoke-tokens?issuedBefore=2026-01-02T03:04:05Z", expectedStatus: http.StatusNoContent},
+		{path: "/tenants/key/revoke-tokens?issuedBefore=yesterday", expectedStatus: http.StatusBadRequest},
+		{path: "/tenants/unknown/revoke-tokens", expectedStatus: http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, testCase.path, nil))
+		if rec.Code != testCase.expectedStatus {
+			t.Errorf("Expected status of %s to be %v, but got %v", testCase.path, testCase.expectedStatus, rec.Code)
+		}
+	}
+
+	revoker := addon.Store.(store.TokenRevoker)
+	if revoked, err := revoker.TokenRevoked("key", "token-id", time.Now()); err != nil || !revoked {
+		t.Errorf("Expected the token to be revoked, but got %v, %v", revoked, err)
+	}
+	if revoked, err := revoker.TokenRevoked("key", "other-id", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil || !revoked {
+		t.Errorf("Expected the tokens issued before to be revoked, but got %v, %v", revoked, err)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	addon := newTestAddon(t)
+	handler := NewHandler(addon, nil)
+
+	allowlist, err := gonnect.AdminIPAllowlist("10.0.0.0/8", "::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = gonnect.AdminIPAllowlist("not-an-ip"); err == nil {
+		t.Errorf("Expected an invalid address to be rejected")
+	}
+
+	testCases := []struct {
+		name           string
+		auth           gonnect.AdminAuthFunc
+		authorization  string
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{name: "no auth configured", expectedStatus: http.StatusForbidden},
+		{name: "valid token", auth: gonnect.AdminBearerTokens("secret"), authorization: "Bearer secret", expectedStatus: http.StatusOK},
+		{name: "invalid token", auth: gonnect.AdminBearerTokens("secret"), authorization: "Bearer guess", expectedStatus: http.StatusForbidden},
+		{name: "allowed range", auth: allowlist, remoteAddr: "10.1.2.3:4567", expectedStatus: http.StatusOK},
+		{name: "allowed address", auth: allowlist, remoteAddr: "[::1]:4567", expectedStatus: http.StatusOK},
+		{name: "other address", auth: allowlist, remoteAddr: "192.0.2.1:4567", expectedStatus: http.StatusForbidden},
+		{name: "all checks", auth: gonnect.AdminAuthAll(allowlist, gonnect.AdminBearerTokens("secret")), authorization: "Bearer secret", remoteAddr: "192.0.2.1:4567", expectedStatus: http.StatusForbidden},
+		{name: "no checks", auth: gonnect.AdminAuthAll(), expectedStatus: http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		addon.AdminAuth = testCase.auth
+		req := httptest.NewRequest(http.MethodGet, "/drift", nil)
+		req.Header.Set("Authorization", testCase.authorization)
+		if testCase.remoteAddr != "" {
+			req.RemoteAddr = testCase.remoteAddr
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.expectedStatus {
+			t.Errorf("%s: Expected status to be %v, but got %v", testCase.name, testCase.expectedStatus, rec.Code)
+		}
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	addon := newTestAddon(t)
+	defer func(tracker *hostrequest.RateLimitTracker) { hostrequest.DefaultRateLimits = tracker }(hostrequest.DefaultRateLimits)
+	hostrequest.DefaultRateLimits = hostrequest.NewRateLimitTracker(time.Minute)
+	hostrequest.DefaultRateLimits.Backoff("throttled", time.Minute)
+	hostrequest.DefaultRateLimits.Observe("quiet", &http.Response{StatusCode: http.StatusOK, Header: http.Header{"X-Ratelimit-Remaining": {"10"}}})
+
+	handler := NewHandler(addon, func(r *http.Request) bool { return true })
+	get := func(target string, out interface{}) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code
+	}
+
+	var states []hostrequest.RateLimitState
+	if code := get("/ratelimits", &states); code != http.StatusOK || len(states) != 1 || states[0].ClientKey != "throttled" {
+		t.Errorf("Expected only the throttled tenant, but got %d %+v", code, states)
+	}
+	if code := get("/ratelimits?all=true", &states); code != http.StatusOK || len(states) != 2 {
+		t.Errorf("Expected all tenants, but got %d %+v", code, states)
+	}
+	var state hostrequest.RateLimitState
+	if code := get("/tenants/quiet/ratelimit", &state); code != http.StatusOK || state.Remaining != 10 {
+		t.Errorf("Expected the state of quiet, but got %d %+v", code, state)
+	}
+	if code := get("/tenants/unknown/ratelimit", &state); code != http.StatusNotFound {
+		t.Errorf("Expected status to be %v, but got %v", http.StatusNotFound, code)
+	}
+}
@@ -0,0 +1,272 @@
+// Package admingrpc serves the TenantAdmin gRPC service of adminpb, an
+// operator API for platform teams which uses the same store and
+// authorization hook as the HTTP admin API
+package admingrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/admin"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/admin/adminpb"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// Server implements adminpb.TenantAdminServer
+type Server struct {
+	adminpb.UnimplementedTenantAdminServer
+	addon     *gonnect.Addon
+	authorize admin.AuthorizeFunc
+}
+
+// NewServer returns the TenantAdmin service of the add-on, every call is
+// rejected unless authorize, or the AdminAuth of the add-on when nil, allows
+// it. The call is passed to authorize as an http request with the gRPC
+// metadata as headers, so the AuthorizeFunc of the HTTP admin API can be
+// shared.
+func NewServer(addon *gonnect.Addon, authorize admin.AuthorizeFunc) *Server {
+	return &Server{addon: addon, authorize: authorize}
+}
+
+// Register registers the TenantAdmin service with the gRPC server
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	adminpb.RegisterTenantAdminServer(registrar, s)
+}
+
+// httpRequest presents an incoming gRPC call as an http request
+func httpRequest(ctx context.Context) *http.Request {
+	method, _ := grpc.Method(ctx)
+	r := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: method},
+		RequestURI: method,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     http.Header{},
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, values := range md {
+			for _, v := range values {
+				r.Header.Add(k, v)
+			}
+		}
+	}
+	r.Host = r.Header.Get(":authority")
+	if p, ok := peer.FromContext(ctx); ok {
+		if p.Addr != nil {
+			r.RemoteAddr = p.Addr.String()
+		}
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	return r.WithContext(ctx)
+}
+
+func (s *Server) authorized(ctx context.Context) error {
+	if !admin.Authorized(s.addon, s.authorize, httpRequest(ctx)) {
+		return status.Error(codes.PermissionDenied, "admin access denied")
+	}
+	return nil
+}
+
+// toStatus converts store errors into gRPC status errors, unexpected errors
+// are reported like 5xx responses of the HTTP admin API
+func toStatus(ctx context.Context, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return status.Error(codes.NotFound, "tenant not found")
+	}
+	errorreport.Report(ctx, errorreport.Event{
+		Kind:   errorreport.KindResponse,
+		Err:    err,
+		Fields: map[string]string{"grpcCode": codes.Internal.String()},
+	})
+	return status.Error(codes.Internal, err.Error())
+}
+
+func unsupported(capability string) error {
+	return status.Errorf(codes.Unimplemented, "tenant store does not support %s", capability)
+}
+
+func toTenant(tenant *store.Tenant, labels map[string]string) *adminpb.Tenant {
+	pb := &adminpb.Tenant{
+		ClientKey:         tenant.ClientKey,
+		BaseUrl:           tenant.BaseURL,
+		ProductType:       tenant.ProductType,
+		Description:       tenant.Description,
+		AddonInstalled:    tenant.AddonInstalled,
+		SecretFingerprint: tenant.SecretFingerprint(),
+		Labels:            labels,
+	}
+	if !tenant.CreatedAt.IsZero() {
+		pb.CreatedAt = timestamppb.New(tenant.CreatedAt)
+	}
+	if !tenant.UpdatedAt.IsZero() {
+		pb.UpdatedAt = timestamppb.New(tenant.UpdatedAt)
+	}
+	if tenant.LastSeenAt != nil {
+		pb.LastSeenAt = timestamppb.New(*tenant.LastSeenAt)
+	}
+	return pb
+}
+
+func (s *Server) labels(clientKey string) (map[string]string, error) {
+	if labeler, ok := s.addon.Store.(store.Labeler); ok {
+		return labeler.Labels(clientKey)
+	}
+	return nil, nil
+}
+
+func (s *Server) GetTenant(ctx context.Context, req *adminpb.GetTenantRequest) (*adminpb.Tenant, error) {
+	if err := s.authorized(ctx); err != nil {
+		return nil, err
+	}
+	tenant, err := s.addon.Store.Get(req.GetClientKey())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	labels, err := s.labels(tenant.ClientKey)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return toTenant(tenant, labels), nil
+}
+
+func (s *Server) ListTenants(ctx context.Context, req *adminpb.ListTenantsRequest) (*adminpb.ListTenantsResponse, error) {
+	if err := s.authorized(ctx); err != nil {
+		return nil, err
+	}
+	labeler, ok := s.addon.Store.(store.Labeler)
+	if !ok {
+		return nil, unsupported("listing tenants")
+	}
+	tenants, err := labeler.List(store.ListFilter{Installed: req.Installed, Labels: req.GetLabels()})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	response := &adminpb.ListTenantsResponse{}
+	for _, tenant := range tenants {
+		labels, err := labeler.Labels(tenant.ClientKey)
+		if err != nil {
+			return nil, toStatus(ctx, err)
+		}
+		response.Tenants = append(response.Tenants, toTenant(tenant, labels))
+	}
+	return response, nil
+}
+
+func (s *Server) PutTenant(ctx context.Context, req *adminpb.PutTenantRequest) (*adminpb.Tenant, error) {
+	if err := s.authorized(ctx); err != nil {
+		return nil, err
+	}
+	if req.GetClientKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_key is required")
+	}
+	existing, err := s.addon.Store.Get(req.GetClientKey())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, toStatus(ctx, err)
+	}
+	if existing == nil && (req.GetBaseUrl() == "" || req.GetSharedSecret() == "") {
+		return nil, status.Error(codes.InvalidArgument, "base_url and shared_secret are required for new tenants")
+	}
+	tenant := &store.Tenant{
+		ClientKey:    req.GetClientKey(),
+		BaseURL:      req.GetBaseUrl(),
+		ProductType:  req.GetProductType(),
+		Description:  req.GetDescription(),
+		SharedSecret: req.GetSharedSecret(),
+	}
+	if req.AddonInstalled != nil {
+		tenant.AddonInstalled = req.GetAddonInstalled()
+	} else if existing != nil {
+		tenant.AddonInstalled = existing.AddonInstalled
+	}
+	if _, err = s.addon.Store.Set(tenant); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return s.GetTenant(ctx, &adminpb.GetTenantRequest{ClientKey: tenant.ClientKey})
+}
+
+func (s *Server) DeleteTenant(ctx context.Context, req *adminpb.DeleteTenantRequest) (*adminpb.DeleteTenantResponse, error) {
+	if err := s.authorized(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.addon.Store.Delete(req.GetClientKey()); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return &adminpb.DeleteTenantResponse{}, nil
+}
+
+func (s *Server) GetLicense(ctx context.Context, req *adminpb.GetLicenseRequest) (*adminpb.License, error) {
+	if err := s.authorized(ctx); err != nil {
+		return nil, err
+	}
+	tenant, err := s.addon.Store.Get(req.GetClientKey())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	info, err := hostrequest.New(s.addon, tenant).AddonInfo(ctx)
+	if err != nil {
+		var hostErr *hostrequest.Error
+		if errors.As(err, &hostErr) {
+			return nil, status.Errorf(codes.Unavailable, "license lookup failed: %v", err)
+		}
+		return nil, toStatus(ctx, err)
+	}
+	license := &adminpb.License{State: info.State}
+	if info.License != nil {
+		license.Active = info.License.Active
+		license.Type = info.License.Type
+		license.Evaluation = info.License.Evaluation
+		license.SupportEntitlementNumber = info.License.SupportEntitlementNumber
+	}
+	return license, nil
+}
+
+func (s *Server) ListKillSwitches(ctx context.Context, req *adminpb.ListKillSwitchesRequest) (*adminpb.ListKillSwitchesResponse, error) {
+	if err := s.authorized(ctx); err != nil {
+		return nil, err
+	}
+	switcher, ok := s.addon.Store.(store.KillSwitcher)
+	if !ok {
+		return nil, unsupported("kill switches")
+	}
+	if _, err := s.addon.Store.Get(req.GetClientKey()); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	names, err := switcher.KillSwitches(req.GetClientKey())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return &adminpb.ListKillSwitchesResponse{Names: names}, nil
+}
+
+func (s *Server) SetKillSwitch(ctx context.Context, req *adminpb.SetKillSwitchRequest) (*adminpb.ListKillSwitchesResponse, error) {
+	if err := s.authorized(ctx); err != nil {
+		return nil, err
+	}
+	switcher, ok := s.addon.Store.(store.KillSwitcher)
+	if !ok {
+		return nil, unsupported("kill switches")
+	}
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := switcher.SetKillSwitch(req.GetClientKey(), req.GetName(), req.GetOn()); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return s.ListKillSwitches(ctx, &adminpb.ListKillSwitchesRequest{ClientKey: req.GetClientKey()})
+}
@@ -0,0 +1,112 @@
+package admingrpc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/admin/adminpb"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func newTestClient(t *testing.T) adminpb.TenantAdminClient {
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	s, err := store.NewFrom(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addon := &gonnect.Addon{Store: s}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	NewServer(addon, func(r *http.Request) bool {
+		return r.Header.Get("authorization") == "Bearer operator"
+	}).Register(server)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return adminpb.NewTenantAdminClient(conn)
+}
+
+func TestTenantAdmin(t *testing.T) {
+	client := newTestClient(t)
+
+	_, err := client.GetTenant(context.Background(), &adminpb.GetTenantRequest{ClientKey: "key"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected %v without credentials, but got %v", codes.PermissionDenied, err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer operator")
+	if _, err = client.GetTenant(ctx, &adminpb.GetTenantRequest{ClientKey: "key"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected %v for an unknown tenant, but got %v", codes.NotFound, err)
+	}
+
+	tenant, err := client.PutTenant(ctx, &adminpb.PutTenantRequest{ClientKey: "key", BaseUrl: "https://example.atlassian.net", SharedSecret: "secret", AddonInstalled: boolPtr(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.SecretFingerprint != store.Fingerprint([]byte("secret")) || !tenant.AddonInstalled {
+		t.Errorf("Expected an installed tenant with the secret fingerprint, but got %+v", tenant)
+	}
+
+	switches, err := client.SetKillSwitch(ctx, &adminpb.SetKillSwitchRequest{ClientKey: "key", Name: "sync", On: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(switches.Names) != 1 || switches.Names[0] != "sync" {
+		t.Errorf("Expected kill switches to be %v, but got %v", []string{"sync"}, switches.Names)
+	}
+
+	list, err := client.ListTenants(ctx, &adminpb.ListTenantsRequest{Labels: map[string]string{store.KillSwitchLabelPrefix + "sync": ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Tenants) != 1 || list.Tenants[0].ClientKey != "key" {
+		t.Errorf("Expected the tenant with the kill switch to be listed, but got %+v", list.Tenants)
+	}
+
+	if switches, err = client.SetKillSwitch(ctx, &adminpb.SetKillSwitchRequest{ClientKey: "key", Name: "sync", On: false}); err != nil {
+		t.Fatal(err)
+	}
+	if len(switches.Names) != 0 {
+		t.Errorf("Expected no kill switches, but got %v", switches.Names)
+	}
+
+	if _, err = client.DeleteTenant(ctx, &adminpb.DeleteTenantRequest{ClientKey: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetTenant(ctx, &adminpb.GetTenantRequest{ClientKey: "key"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected %v after deleting the tenant, but got %v", codes.NotFound, err)
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
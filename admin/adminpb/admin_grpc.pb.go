@@ -0,0 +1,337 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.24.4
+// source: admin.proto
+
+package adminpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	TenantAdmin_GetTenant_FullMethodName        = "/gonnect.admin.v1.TenantAdmin/GetTenant"
+	TenantAdmin_ListTenants_FullMethodName      = "/gonnect.admin.v1.TenantAdmin/ListTenants"
+	TenantAdmin_PutTenant_FullMethodName        = "/gonnect.admin.v1.TenantAdmin/PutTenant"
+	TenantAdmin_DeleteTenant_FullMethodName     = "/gonnect.admin.v1.TenantAdmin/DeleteTenant"
+	TenantAdmin_GetLicense_FullMethodName       = "/gonnect.admin.v1.TenantAdmin/GetLicense"
+	TenantAdmin_ListKillSwitches_FullMethodName = "/gonnect.admin.v1.TenantAdmin/ListKillSwitches"
+	TenantAdmin_SetKillSwitch_FullMethodName    = "/gonnect.admin.v1.TenantAdmin/SetKillSwitch"
+)
+
+// TenantAdminClient is the client API for TenantAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TenantAdminClient interface {
+	GetTenant(ctx context.Context, in *GetTenantRequest, opts ...grpc.CallOption) (*Tenant, error)
+	ListTenants(ctx context.Context, in *ListTenantsRequest, opts ...grpc.CallOption) (*ListTenantsResponse, error)
+	// PutTenant creates the tenant or updates its non-empty fields
+	PutTenant(ctx context.Context, in *PutTenantRequest, opts ...grpc.CallOption) (*Tenant, error)
+	DeleteTenant(ctx context.Context, in *DeleteTenantRequest, opts ...grpc.CallOption) (*DeleteTenantResponse, error)
+	// GetLicense looks up the license of the add-on in the host product of
+	// the tenant
+	GetLicense(ctx context.Context, in *GetLicenseRequest, opts ...grpc.CallOption) (*License, error)
+	ListKillSwitches(ctx context.Context, in *ListKillSwitchesRequest, opts ...grpc.CallOption) (*ListKillSwitchesResponse, error)
+	SetKillSwitch(ctx context.Context, in *SetKillSwitchRequest, opts ...grpc.CallOption) (*ListKillSwitchesResponse, error)
+}
+
+type tenantAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTenantAdminClient(cc grpc.ClientConnInterface) TenantAdminClient {
+	return &tenantAdminClient{cc}
+}
+
+func (c *tenantAdminClient) GetTenant(ctx context.Context, in *GetTenantRequest, opts ...grpc.CallOption) (*Tenant, error) {
+	out := new(Tenant)
+	err := c.cc.Invoke(ctx, TenantAdmin_GetTenant_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tenantAdminClient) ListTenants(ctx context.Context, in *ListTenantsRequest, opts ...grpc.CallOption) (*ListTenantsResponse, error) {
+	out := new(ListTenantsResponse)
+	err := c.cc.Invoke(ctx, TenantAdmin_ListTenants_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tenantAdminClient) PutTenant(ctx context.Context, in *PutTenantRequest, opts ...grpc.CallOption) (*Tenant, error) {
+	out := new(Tenant)
+	err := c.cc.Invoke(ctx, TenantAdmin_PutTenant_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tenantAdminClient) DeleteTenant(ctx context.Context, in *DeleteTenantRequest, opts ...grpc.CallOption) (*DeleteTenantResponse, error) {
+	out := new(DeleteTenantResponse)
+	err := c.cc.Invoke(ctx, TenantAdmin_DeleteTenant_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tenantAdminClient) GetLicense(ctx context.Context, in *GetLicenseRequest, opts ...grpc.CallOption) (*License, error) {
+	out := new(License)
+	err := c.cc.Invoke(ctx, TenantAdmin_GetLicense_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tenantAdminClient) ListKillSwitches(ctx context.Context, in *ListKillSwitchesRequest, opts ...grpc.CallOption) (*ListKillSwitchesResponse, error) {
+	out := new(ListKillSwitchesResponse)
+	err := c.cc.Invoke(ctx, TenantAdmin_ListKillSwitches_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tenantAdminClient) SetKillSwitch(ctx context.Context, in *SetKillSwitchRequest, opts ...grpc.CallOption) (*ListKillSwitchesResponse, error) {
+	out := new(ListKillSwitchesResponse)
+	err := c.cc.Invoke(ctx, TenantAdmin_SetKillSwitch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TenantAdminServer is the server API for TenantAdmin service.
+// All implementations must embed UnimplementedTenantAdminServer
+// for forward compatibility
+type TenantAdminServer interface {
+	GetTenant(context.Context, *GetTenantRequest) (*Tenant, error)
+	ListTenants(context.Context, *ListTenantsRequest) (*ListTenantsResponse, error)
+	// PutTenant creates the tenant or updates its non-empty fields
+	PutTenant(context.Context, *PutTenantRequest) (*Tenant, error)
+	DeleteTenant(context.Context, *DeleteTenantRequest) (*DeleteTenantResponse, error)
+	// GetLicense looks up the license of the add-on in the host product of
+	// the tenant
+	GetLicense(context.Context, *GetLicenseRequest) (*License, error)
+	ListKillSwitches(context.Context, *ListKillSwitchesRequest) (*ListKillSwitchesResponse, error)
+	SetKillSwitch(context.Context, *SetKillSwitchRequest) (*ListKillSwitchesResponse, error)
+	mustEmbedUnimplementedTenantAdminServer()
+}
+
+// UnimplementedTenantAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedTenantAdminServer struct {
+}
+
+func (UnimplementedTenantAdminServer) GetTenant(context.Context, *GetTenantRequest) (*Tenant, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTenant not implemented")
+}
+func (UnimplementedTenantAdminServer) ListTenants(context.Context, *ListTenantsRequest) (*ListTenantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTenants not implemented")
+}
+func (UnimplementedTenantAdminServer) PutTenant(context.Context, *PutTenantRequest) (*Tenant, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutTenant not implemented")
+}
+func (UnimplementedTenantAdminServer) DeleteTenant(context.Context, *DeleteTenantRequest) (*DeleteTenantResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTenant not implemented")
+}
+func (UnimplementedTenantAdminServer) GetLicense(context.Context, *GetLicenseRequest) (*License, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLicense not implemented")
+}
+func (UnimplementedTenantAdminServer) ListKillSwitches(context.Context, *ListKillSwitchesRequest) (*ListKillSwitchesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListKillSwitches not implemented")
+}
+func (UnimplementedTenantAdminServer) SetKillSwitch(context.Context, *SetKillSwitchRequest) (*ListKillSwitchesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetKillSwitch not implemented")
+}
+func (UnimplementedTenantAdminServer) mustEmbedUnimplementedTenantAdminServer() {}
+
+// UnsafeTenantAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TenantAdminServer will
+// result in compilation errors.
+type UnsafeTenantAdminServer interface {
+	mustEmbedUnimplementedTenantAdminServer()
+}
+
+func RegisterTenantAdminServer(s grpc.ServiceRegistrar, srv TenantAdminServer) {
+	s.RegisterService(&TenantAdmin_ServiceDesc, srv)
+}
+
+func _TenantAdmin_GetTenant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTenantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TenantAdminServer).GetTenant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TenantAdmin_GetTenant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TenantAdminServer).GetTenant(ctx, req.(*GetTenantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TenantAdmin_ListTenants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTenantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TenantAdminServer).ListTenants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TenantAdmin_ListTenants_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TenantAdminServer).ListTenants(ctx, req.(*ListTenantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TenantAdmin_PutTenant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutTenantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TenantAdminServer).PutTenant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TenantAdmin_PutTenant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TenantAdminServer).PutTenant(ctx, req.(*PutTenantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TenantAdmin_DeleteTenant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTenantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TenantAdminServer).DeleteTenant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TenantAdmin_DeleteTenant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TenantAdminServer).DeleteTenant(ctx, req.(*DeleteTenantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TenantAdmin_GetLicense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLicenseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TenantAdminServer).GetLicense(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TenantAdmin_GetLicense_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TenantAdminServer).GetLicense(ctx, req.(*GetLicenseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TenantAdmin_ListKillSwitches_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListKillSwitchesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TenantAdminServer).ListKillSwitches(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TenantAdmin_ListKillSwitches_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TenantAdminServer).ListKillSwitches(ctx, req.(*ListKillSwitchesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TenantAdmin_SetKillSwitch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetKillSwitchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TenantAdminServer).SetKillSwitch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TenantAdmin_SetKillSwitch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TenantAdminServer).SetKillSwitch(ctx, req.(*SetKillSwitchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TenantAdmin_ServiceDesc is the grpc.ServiceDesc for TenantAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TenantAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gonnect.admin.v1.TenantAdmin",
+	HandlerType: (*TenantAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetTenant",
+			Handler:    _TenantAdmin_GetTenant_Handler,
+		},
+		{
+			MethodName: "ListTenants",
+			Handler:    _TenantAdmin_ListTenants_Handler,
+		},
+		{
+			MethodName: "PutTenant",
+			Handler:    _TenantAdmin_PutTenant_Handler,
+		},
+		{
+			MethodName: "DeleteTenant",
+			Handler:    _TenantAdmin_DeleteTenant_Handler,
+		},
+		{
+			MethodName: "GetLicense",
+			Handler:    _TenantAdmin_GetLicense_Handler,
+		},
+		{
+			MethodName: "ListKillSwitches",
+			Handler:    _TenantAdmin_ListKillSwitches_Handler,
+		},
+		{
+			MethodName: "SetKillSwitch",
+			Handler:    _TenantAdmin_SetKillSwitch_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
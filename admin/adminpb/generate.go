@@ -0,0 +1,5 @@
+// Package adminpb holds the generated code of the TenantAdmin gRPC service
+// defined in admin.proto
+package adminpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative admin.proto
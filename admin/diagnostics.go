@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/middleware"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+// ResponseCacheStats describes the default host request response cache
+type ResponseCacheStats struct {
+	Enabled   bool `json:"enabled"`
+	ItemCount *int `json:"itemCount,omitempty"`
+}
+
+// Diagnostics is the response of the runtime diagnostics page
+type Diagnostics struct {
+	Time            time.Time                         `json:"time"`
+	GoVersion       string                            `json:"goVersion"`
+	NumCPU          int                               `json:"numCpu"`
+	Goroutines      int                               `json:"goroutines"`
+	HeapAlloc       uint64                            `json:"heapAlloc"`
+	HeapObjects     uint64                            `json:"heapObjects"`
+	NumGC           uint32                            `json:"numGc"`
+	ResponseCache   ResponseCacheStats                `json:"responseCache"`
+	InstallKeys     []middleware.InstallKeyCacheEntry `json:"installKeys"`
+	InstallKeyCache middleware.InstallKeyCacheStats   `json:"installKeyCache"`
+	StorePool       *sql.DBStats                      `json:"storePool,omitempty"`
+	StoreError      string                            `json:"storeError,omitempty"`
+}
+
+// NewDiagnosticsHandler returns the pprof endpoints and a runtime diagnostics
+// page, meant to be mounted on an internal path, for example
+// mux.Mount("/debug", admin.NewDiagnosticsHandler(...)). The diagnostics page
+// is served at the root and pprof below /pprof/. Every request is rejected
+// unless authorize, or the AdminAuth of the add-on when nil, allows it.
+func NewDiagnosticsHandler(addon *gonnect.Addon, authorize AuthorizeFunc) http.Handler {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !Authorized(addon, authorize, r) {
+				util.SendError(w, r, addon, http.StatusForbidden, "admin access denied")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		sendJSON(w, collectDiagnostics(addon))
+	})
+	// pprof.Index resolves profiles from the path after /debug/pprof/
+	r.Get("/pprof/*", func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = "/debug/pprof/" + chi.URLParam(r, "*")
+		pprof.Index(w, r)
+	})
+	r.Get("/pprof/cmdline", pprof.Cmdline)
+	r.Get("/pprof/profile", pprof.Profile)
+	r.Get("/pprof/symbol", pprof.Symbol)
+	r.Post("/pprof/symbol", pprof.Symbol)
+	r.Get("/pprof/trace", pprof.Trace)
+	return r
+}
+
+func collectDiagnostics(addon *gonnect.Addon) (diagnostics Diagnostics) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	diagnostics = Diagnostics{
+		Time:            time.Now(),
+		GoVersion:       runtime.Version(),
+		NumCPU:          runtime.NumCPU(),
+		Goroutines:      runtime.NumGoroutine(),
+		HeapAlloc:       memStats.HeapAlloc,
+		HeapObjects:     memStats.HeapObjects,
+		NumGC:           memStats.NumGC,
+		InstallKeys:     middleware.InstallKeyCacheEntries(),
+		InstallKeyCache: middleware.InstallKeyFallbackCache.Stats(),
+	}
+	if diagnostics.InstallKeys == nil {
+		diagnostics.InstallKeys = []middleware.InstallKeyCacheEntry{}
+	}
+
+	if cache := hostrequest.DefaultResponseCache; cache != nil {
+		diagnostics.ResponseCache.Enabled = true
+		if counter, ok := cache.(interface{ ItemCount() int }); ok {
+			count := counter.ItemCount()
+			diagnostics.ResponseCache.ItemCount = &count
+		}
+	}
+
+	if statter, ok := addon.Store.(store.PoolStatter); ok {
+		if stats, err := statter.PoolStats(); err != nil {
+			diagnostics.StoreError = err.Error()
+		} else {
+			diagnostics.StorePool = &stats
+		}
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiagnosticsHandler(t *testing.T) {
+	addon := newTestAddon(t)
+	allowed := false
+	handler := NewDiagnosticsHandler(addon, func(r *http.Request) bool { return allowed })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected status to be %v, but got %v", http.StatusForbidden, rec.Code)
+	}
+
+	allowed = true
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status to be %v, but got %v (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var diagnostics Diagnostics
+	if err := json.Unmarshal(rec.Body.Bytes(), &diagnostics); err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics.Goroutines == 0 {
+		t.Errorf("Expected goroutines to be reported")
+	}
+	if diagnostics.StorePool == nil || diagnostics.StorePool.MaxOpenConnections != 1 {
+		t.Errorf("Expected store pool stats with one max open connection, but got %+v (%s)", diagnostics.StorePool, diagnostics.StoreError)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/pprof/goroutine?debug=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status to be %v, but got %v (%s)", http.StatusOK, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+// JWTDebugTenant describes the tenant a token would be verified against, the
+// shared secret is only shown as a fingerprint
+type JWTDebugTenant struct {
+	ClientKey         string `json:"clientKey"`
+	BaseURL           string `json:"baseUrl"`
+	AddonInstalled    bool   `json:"addonInstalled"`
+	SecretFingerprint string `json:"secretFingerprint,omitempty"`
+}
+
+// JWTDebugResult is the response of the JWT introspection endpoint
+type JWTDebugResult struct {
+	Header           map[string]interface{} `json:"header,omitempty"`
+	Claims           map[string]interface{} `json:"claims,omitempty"`
+	DecodeError      string                 `json:"decodeError,omitempty"`
+	Tenant           *JWTDebugTenant        `json:"tenant,omitempty"`
+	TenantError      string                 `json:"tenantError,omitempty"`
+	SignatureValid   bool                   `json:"signatureValid"`
+	SignatureError   string                 `json:"signatureError,omitempty"`
+	ClaimsError      string                 `json:"claimsError,omitempty"`
+	CanonicalRequest string                 `json:"canonicalRequest,omitempty"`
+	ExpectedQsh      string                 `json:"expectedQsh,omitempty"`
+	QshMatches       bool                   `json:"qshMatches"`
+}
+
+type jwtDebugHandler struct {
+	addon     *gonnect.Addon
+	authorize AuthorizeFunc
+}
+
+// NewJWTDebugHandler returns the JWT introspection endpoint, usually mounted
+// at /debug/jwt. It decodes the submitted token parameter, verifies it with
+// the shared secret of its issuer and computes the canonical request and
+// expected qsh for the method and url parameters. The endpoint responds with
+// 404 unless DebugJWT is enabled in the profile and requires authorize, or
+// the AdminAuth of the add-on when nil, to allow the request.
+func NewJWTDebugHandler(addon *gonnect.Addon, authorize AuthorizeFunc) http.Handler {
+	return jwtDebugHandler{addon: addon, authorize: authorize}
+}
+
+func (h jwtDebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.addon.Config == nil || !h.addon.Config.DebugJWT {
+		http.NotFound(w, r)
+		return
+	}
+	if !Authorized(h.addon, h.authorize, r) {
+		util.SendError(w, r, h.addon, http.StatusForbidden, "admin access denied")
+		return
+	}
+	tokenStr := r.FormValue("token")
+	if tokenStr == "" {
+		util.SendError(w, r, h.addon, http.StatusBadRequest, "token parameter is required")
+		return
+	}
+	method := r.FormValue("method")
+	if method == "" {
+		method = http.MethodGet
+	}
+	sendJSON(w, h.inspect(tokenStr, method, r.FormValue("url")))
+}
+
+func (h jwtDebugHandler) inspect(tokenStr, method, target string) (result JWTDebugResult) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, _, err := parser.ParseUnverified(tokenStr, jwt.MapClaims{})
+	if err != nil {
+		result.DecodeError = err.Error()
+		return
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	result.Header, result.Claims = token.Header, claims
+	if err = claims.Valid(); err != nil {
+		result.ClaimsError = err.Error()
+	}
+
+	if target != "" {
+		if req, err := http.NewRequest(method, target, nil); err != nil {
+			result.DecodeError = fmt.Sprintf("invalid url: %v", err)
+		} else {
+			result.CanonicalRequest = atlasjwt.CreateCanonicalRequest(req, false, h.addon.BaseUrlFor(req))
+			result.ExpectedQsh = atlasjwt.CreateQueryStringHash(req, false, h.addon.BaseUrlFor(req))
+			result.QshMatches = claims["qsh"] == result.ExpectedQsh
+		}
+	}
+
+	clientKey, _ := claims["iss"].(string)
+	tenant, err := h.addon.Store.Get(clientKey)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			result.TenantError = fmt.Sprintf("no tenant with clientKey %q", clientKey)
+		} else {
+			result.TenantError = err.Error()
+		}
+		return
+	}
+	result.Tenant = &JWTDebugTenant{
+		ClientKey:         tenant.ClientKey,
+		BaseURL:           tenant.BaseURL,
+		AddonInstalled:    tenant.AddonInstalled,
+		SecretFingerprint: tenant.SecretFingerprint(),
+	}
+
+	secret := tenant.SecretBytes()
+	defer store.Zero(secret)
+	verifier := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}, SkipClaimsValidation: true}
+	if _, err = verifier.Parse(tokenStr, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}); err != nil {
+		result.SignatureError = err.Error()
+	} else {
+		result.SignatureValid = true
+	}
+	return
+}
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestJWTDebugHandler(t *testing.T) {
+	addon := newTestAddon(t)
+	addon.Config = &gonnect.Profile{BaseUrl: "https://addon.example.com", DebugJWT: true}
+	if _, err := addon.Store.Set(&store.Tenant{ClientKey: "key", BaseURL: "https://example.atlassian.net", SharedSecret: "secret", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", "/page?b=2&a=1", nil), false, addon.Config.BaseUrl)
+	sign := func(secret string) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": "key", "qsh": qsh}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	testCases := []struct {
+		token          string
+		target         string
+		signatureValid bool
+		qshMatches     bool
+	}{
+		{token: sign("secret"), target: "/page?a=1&b=2", signatureValid: true, qshMatches: true},
+		{token: sign("other"), target: "/page?a=1", signatureValid: false, qshMatches: false},
+	}
+	handler := NewJWTDebugHandler(addon, func(r *http.Request) bool { return true })
+	for _, testCase := range testCases {
+		form := url.Values{"token": {testCase.token}, "method": {"GET"}, "url": {testCase.target}}
+		req := httptest.NewRequest("POST", "/debug/jwt", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status to be %v, but got %v (%s)", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var result JWTDebugResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.SignatureValid != testCase.signatureValid {
+			t.Errorf("Expected signatureValid to be %v, but got %v (%s)", testCase.signatureValid, result.SignatureValid, result.SignatureError)
+		}
+		if result.QshMatches != testCase.qshMatches {
+			t.Errorf("Expected qshMatches to be %v, but got %v (%s)", testCase.qshMatches, result.QshMatches, result.CanonicalRequest)
+		}
+		if result.Tenant == nil || result.Tenant.SecretFingerprint != store.Fingerprint([]byte("secret")) {
+			t.Errorf("Expected tenant with the secret fingerprint, but got %+v", result.Tenant)
+		}
+		if strings.Contains(rec.Body.String(), `"secret"`) {
+			t.Errorf("Expected the shared secret not to be revealed, but got %s", rec.Body.String())
+		}
+	}
+
+	addon.Config.DebugJWT = false
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/jwt?token=x", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status when disabled to be %v, but got %v", http.StatusNotFound, rec.Code)
+	}
+}
@@ -0,0 +1,114 @@
+package gonnect
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AdminAuthFunc decides whether a request may use the operator routes of the
+// add-on: the admin API, the JWT debug tool and pprof
+type AdminAuthFunc func(r *http.Request) bool
+
+// AdminAuthConfiguration builds the AdminAuthFunc of the add-on, requests
+// have to satisfy every configured check
+type AdminAuthConfiguration struct {
+	// BearerTokens are accepted in the Authorization header
+	BearerTokens []string
+	// AllowedIPs are addresses or CIDR ranges requests have to come from
+	AllowedIPs []string
+}
+
+// AuthFunc returns the configured checks, requests are denied when none
+// are configured
+func (c *AdminAuthConfiguration) AuthFunc() (AdminAuthFunc, error) {
+	var checks []AdminAuthFunc
+	if len(c.BearerTokens) > 0 {
+		checks = append(checks, AdminBearerTokens(c.BearerTokens...))
+	}
+	if len(c.AllowedIPs) > 0 {
+		allowlist, err := AdminIPAllowlist(c.AllowedIPs...)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, allowlist)
+	}
+	return AdminAuthAll(checks...), nil
+}
+
+// AdminBearerTokens allows requests with an "Authorization: Bearer" header
+// carrying one of tokens
+func AdminBearerTokens(tokens ...string) AdminAuthFunc {
+	return func(r *http.Request) bool {
+		header := r.Header.Get("Authorization")
+		if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+			return false
+		}
+		presented := []byte(strings.TrimSpace(header[7:]))
+		allowed := false
+		for _, token := range tokens {
+			if token != "" && subtle.ConstantTimeCompare(presented, []byte(token)) == 1 {
+				allowed = true
+			}
+		}
+		return allowed
+	}
+}
+
+// AdminIPAllowlist allows requests whose remote address is one of addresses,
+// which are IPs or CIDR ranges. The remote address is the peer of the
+// connection, proxies have to rewrite it for the allowlist to apply to the
+// original client.
+func AdminIPAllowlist(addresses ...string) (AdminAuthFunc, error) {
+	var networks []*net.IPNet
+	for _, address := range addresses {
+		if !strings.Contains(address, "/") {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid admin IP address %q", address)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin IP range %q: %w", address, err)
+		}
+		networks = append(networks, network)
+	}
+	return func(r *http.Request) bool {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return false
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// AdminAuthAll allows requests allowed by every one of checks, and denies
+// all requests when there are none
+func AdminAuthAll(checks ...AdminAuthFunc) AdminAuthFunc {
+	return func(r *http.Request) bool {
+		for _, check := range checks {
+			if !check(r) {
+				return false
+			}
+		}
+		return len(checks) > 0
+	}
+}
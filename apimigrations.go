@@ -0,0 +1,77 @@
+package gonnect
+
+import (
+	"github.com/go-enjin/be/pkg/log"
+)
+
+const (
+	ApiMigrationSignedInstall = "signed-install"
+	ApiMigrationGdpr          = "gdpr"
+	ApiMigrationContextQsh    = "context-qsh"
+)
+
+// ApiMigrations is the apiMigrations block of the descriptor, a nil flag is
+// not declared and left to the default of the host product
+type ApiMigrations struct {
+	SignedInstall *bool `json:"signed-install,omitempty"`
+	Gdpr          *bool `json:"gdpr,omitempty"`
+	ContextQsh    *bool `json:"context-qsh,omitempty"`
+}
+
+// ApiMigrations returns the apiMigrations declared by the descriptor
+func (a *Addon) ApiMigrations() (migrations ApiMigrations) {
+	block, _ := a.AddonDescriptor["apiMigrations"].(map[string]interface{})
+	flag := func(name string) *bool {
+		if value, ok := block[name].(bool); ok {
+			return &value
+		}
+		return nil
+	}
+	migrations.SignedInstall = flag(ApiMigrationSignedInstall)
+	migrations.Gdpr = flag(ApiMigrationGdpr)
+	migrations.ContextQsh = flag(ApiMigrationContextQsh)
+	return
+}
+
+// SetApiMigrations replaces the apiMigrations block of the served descriptor
+func (a *Addon) SetApiMigrations(migrations ApiMigrations) {
+	block := map[string]interface{}{}
+	set := func(name string, value *bool) {
+		if value != nil {
+			block[name] = *value
+		}
+	}
+	set(ApiMigrationSignedInstall, migrations.SignedInstall)
+	set(ApiMigrationGdpr, migrations.Gdpr)
+	set(ApiMigrationContextQsh, migrations.ContextQsh)
+	if len(block) == 0 {
+		delete(a.AddonDescriptor, "apiMigrations")
+		return
+	}
+	a.AddonDescriptor["apiMigrations"] = block
+}
+
+// CheckApiMigrations returns warnings for declared apiMigrations which the
+// configuration of the addon contradicts
+func (a *Addon) CheckApiMigrations() (warnings []string) {
+	migrations := a.ApiMigrations()
+	signed := migrations.SignedInstall != nil && *migrations.SignedInstall
+	if signed && !a.Config.SignedInstall {
+		warnings = append(warnings, "descriptor declares the signed-install api migration but SignedInstall is disabled, install hooks are accepted without verifying their asymmetric signature")
+	} else if !signed && a.Config.SignedInstall {
+		warnings = append(warnings, "SignedInstall is enabled but the descriptor does not declare the signed-install api migration, install hooks will not be signed with the install keys")
+	}
+	if migrations.Gdpr != nil && !*migrations.Gdpr {
+		warnings = append(warnings, "descriptor opts out of the gdpr api migration, which is no longer supported by Atlassian")
+	}
+	if migrations.ContextQsh != nil && !*migrations.ContextQsh {
+		warnings = append(warnings, "descriptor opts out of the context-qsh api migration, which is no longer supported by Atlassian")
+	}
+	return
+}
+
+func (a *Addon) logApiMigrationWarnings() {
+	for _, warning := range a.CheckApiMigrations() {
+		log.WarnF("%s", warning)
+	}
+}
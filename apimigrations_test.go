@@ -0,0 +1,92 @@
+package gonnect
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckApiMigrations(t *testing.T) {
+	enabled, disabled := true, false
+	testCases := []struct {
+		name          string
+		migrations    map[string]interface{}
+		signedInstall bool
+		expected      ApiMigrations
+		warnings      []string
+	}{
+		{
+			name:          "applied",
+			migrations:    map[string]interface{}{"signed-install": true, "gdpr": true, "context-qsh": true},
+			signedInstall: true,
+			expected:      ApiMigrations{SignedInstall: &enabled, Gdpr: &enabled, ContextQsh: &enabled},
+		},
+		{
+			name:     "skipped",
+			expected: ApiMigrations{},
+		},
+		{
+			name:       "ignored values",
+			migrations: map[string]interface{}{"gdpr": "yes", "unknown": true},
+			expected:   ApiMigrations{},
+		},
+		{
+			name:       "failed signed install",
+			migrations: map[string]interface{}{"signed-install": true},
+			expected:   ApiMigrations{SignedInstall: &enabled},
+			warnings:   []string{"SignedInstall is disabled"},
+		},
+		{
+			name:          "undeclared signed install",
+			signedInstall: true,
+			expected:      ApiMigrations{},
+			warnings:      []string{"does not declare the signed-install"},
+		},
+		{
+			name:       "failed opt outs",
+			migrations: map[string]interface{}{"signed-install": false, "gdpr": false, "context-qsh": false},
+			expected:   ApiMigrations{SignedInstall: &disabled, Gdpr: &disabled, ContextQsh: &disabled},
+			warnings:   []string{"gdpr api migration", "context-qsh api migration"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		descriptor := map[string]interface{}{"key": "addon"}
+		if testCase.migrations != nil {
+			descriptor["apiMigrations"] = testCase.migrations
+		}
+		addon := &Addon{Config: NewProfile("https://addon.example.com", "sqlite3", "", testCase.signedInstall), AddonDescriptor: descriptor}
+
+		if migrations := addon.ApiMigrations(); !reflect.DeepEqual(migrations, testCase.expected) {
+			t.Errorf("%s: Expected the migrations %+v, but got %+v", testCase.name, testCase.expected, migrations)
+		}
+		warnings := addon.CheckApiMigrations()
+		if len(warnings) != len(testCase.warnings) {
+			t.Errorf("%s: Expected %d warnings, but got %v", testCase.name, len(testCase.warnings), warnings)
+			continue
+		}
+		for i, warning := range testCase.warnings {
+			if !strings.Contains(warnings[i], warning) {
+				t.Errorf("%s: Expected the warning %q, but got %q", testCase.name, warning, warnings[i])
+			}
+		}
+	}
+}
+
+func TestSetApiMigrations(t *testing.T) {
+	enabled := true
+	addon := &Addon{AddonDescriptor: map[string]interface{}{"key": "addon"}}
+
+	addon.SetApiMigrations(ApiMigrations{SignedInstall: &enabled})
+	if block := addon.AddonDescriptor["apiMigrations"]; !reflect.DeepEqual(block, map[string]interface{}{"signed-install": true}) {
+		t.Errorf("Expected only the declared migration in the descriptor, but got %v", block)
+	}
+	if migrations := addon.ApiMigrations(); migrations.SignedInstall == nil || !*migrations.SignedInstall {
+		t.Errorf("Expected the set migration to be read back, but got %+v", migrations)
+	}
+
+	addon.SetApiMigrations(ApiMigrations{})
+	if block, ok := addon.AddonDescriptor["apiMigrations"]; ok {
+		t.Errorf("Expected no apiMigrations block without migrations, but got %v", block)
+	}
+}
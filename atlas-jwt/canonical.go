@@ -0,0 +1,184 @@
+package atlasjwt
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// queryParam is a decoded query parameter, its key and value are the offsets
+// of the bytes in the scratch buffer of the canonicalizer
+type queryParam struct {
+	key, value [2]int
+}
+
+// canonicalizer builds canonical requests in reused buffers, the query
+// parameters are decoded from the raw query and sorted in place instead of
+// being parsed into url.Values
+type canonicalizer struct {
+	buf     bytes.Buffer
+	scratch []byte
+	params  []queryParam
+}
+
+var canonicalizers = sync.Pool{
+	New: func() interface{} {
+		return &canonicalizer{}
+	},
+}
+
+func getCanonicalizer() *canonicalizer {
+	c := canonicalizers.Get().(*canonicalizer)
+	c.buf.Reset()
+	c.scratch = c.scratch[:0]
+	c.params = c.params[:0]
+	return c
+}
+
+func putCanonicalizer(c *canonicalizer) {
+	canonicalizers.Put(c)
+}
+
+func (c *canonicalizer) writeRequest(req *http.Request, checkBodyForParam bool, baseUrlString string) {
+	c.buf.WriteString(strings.ToUpper(req.Method))
+	c.buf.WriteString(CANONICAL_QUERY_SEPARATOR)
+	c.buf.WriteString(canonicalizeUri(req, baseUrlString))
+	c.buf.WriteString(CANONICAL_QUERY_SEPARATOR)
+
+	parsed := c.parseQuery(req.URL.RawQuery)
+	if checkBodyForParam && parsed == 0 && (strings.ToUpper(req.Method) == "POST" || strings.ToUpper(req.Method) == "PUT") {
+		// the parameters of form bodies are rare, they are parsed by the
+		// straightforward canonicalization
+		c.buf.WriteString(canonicalizeQueryString(req, checkBodyForParam))
+		return
+	}
+	c.writeQuery()
+}
+
+func (c *canonicalizer) bytes(offsets [2]int) []byte {
+	return c.scratch[offsets[0]:offsets[1]]
+}
+
+// parseQuery decodes the parameters of rawQuery like url.ParseQuery, except
+// for the jwt parameter, and returns the number of parameters decoded
+// including it
+func (c *canonicalizer) parseQuery(rawQuery string) (parsed int) {
+	for rawQuery != "" {
+		var pair string
+		pair, rawQuery, _ = strings.Cut(rawQuery, "&")
+		// like url.ParseQuery, pairs with semicolons are invalid and empty
+		// pairs are skipped
+		if pair == "" || strings.Contains(pair, ";") {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		mark := len(c.scratch)
+		keyOffsets, ok := c.unescape(key)
+		if !ok {
+			c.scratch = c.scratch[:mark]
+			continue
+		}
+		valueOffsets, ok := c.unescape(value)
+		if !ok {
+			c.scratch = c.scratch[:mark]
+			continue
+		}
+		parsed++
+		if k := c.bytes(keyOffsets); string(k) == "jwt" || string(k) == "__proto__" {
+			c.scratch = c.scratch[:mark]
+			continue
+		}
+		c.params = append(c.params, queryParam{key: keyOffsets, value: valueOffsets})
+	}
+	return parsed
+}
+
+// unescape appends the query unescaped s to the scratch buffer, it fails on
+// invalid percent-encodings like url.QueryUnescape
+func (c *canonicalizer) unescape(s string) ([2]int, bool) {
+	start := len(c.scratch)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '+':
+			c.scratch = append(c.scratch, ' ')
+		case '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return [2]int{}, false
+			}
+			c.scratch = append(c.scratch, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+		default:
+			c.scratch = append(c.scratch, s[i])
+		}
+	}
+	return [2]int{start, len(c.scratch)}, true
+}
+
+// writeQuery writes the parameters sorted by key and value, the values of
+// repeated keys are joined with commas
+func (c *canonicalizer) writeQuery() {
+	sort.Sort(c)
+	for idx, param := range c.params {
+		if idx > 0 {
+			if bytes.Equal(c.bytes(param.key), c.bytes(c.params[idx-1].key)) {
+				c.buf.WriteByte(',')
+				writeEscaped(&c.buf, c.bytes(param.value))
+				continue
+			}
+			c.buf.WriteString(CANONICAL_QUERY_SEPARATOR)
+		}
+		writeEscaped(&c.buf, c.bytes(param.key))
+		c.buf.WriteByte('=')
+		writeEscaped(&c.buf, c.bytes(param.value))
+	}
+}
+
+func (c *canonicalizer) Len() int {
+	return len(c.params)
+}
+
+func (c *canonicalizer) Less(i, j int) bool {
+	a, b := c.params[i], c.params[j]
+	if cmp := bytes.Compare(c.bytes(a.key), c.bytes(b.key)); cmp != 0 {
+		return cmp < 0
+	}
+	return bytes.Compare(c.bytes(a.value), c.bytes(b.value)) < 0
+}
+
+func (c *canonicalizer) Swap(i, j int) {
+	c.params[i], c.params[j] = c.params[j], c.params[i]
+}
+
+// writeEscaped percent-encodes all but the unreserved characters of RFC 3986,
+// unlike url.QueryEscape spaces are encoded as %20
+func writeEscaped(buf *bytes.Buffer, value []byte) {
+	const upperhex = "0123456789ABCDEF"
+	for _, c := range value {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(upperhex[c>>4])
+			buf.WriteByte(upperhex[c&15])
+		}
+	}
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !race
+
+package atlasjwt
+
+import (
+	"net/http"
+	"testing"
+)
+
+// the race detector allocates, the allocations are only counted without it
+func TestQueryStringHashAllocations(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://addon.example.com/page?issueKey=TEST-1&projectKey=TEST&lic=active&tz=Europe%2FBerlin&loc=en-US&jwt=token", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qsh := CreateQueryStringHash(req, false, "https://addon.example.com")
+	if !VerifyQueryStringHash(req, false, "https://addon.example.com", qsh) {
+		t.Fatalf("Expected %s to verify", qsh)
+	}
+	if VerifyQueryStringHash(req, false, "https://addon.example.com", "mismatch") {
+		t.Errorf("Expected a mismatching qsh to fail")
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		VerifyQueryStringHash(req, false, "https://addon.example.com", qsh)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, but got %v", allocs)
+	}
+}
@@ -0,0 +1,39 @@
+package atlasjwt
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// straightforwardCanonicalRequest is the canonical request built with
+// url.Values, the canonicalizer has to produce the same string
+func straightforwardCanonicalRequest(req *http.Request, baseUrl string) string {
+	return req.Method + CANONICAL_QUERY_SEPARATOR + canonicalizeUri(req, baseUrl) + CANONICAL_QUERY_SEPARATOR + canonicalizeQueryString(req, false)
+}
+
+func FuzzCanonicalQueryString(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"a=1",
+		"b=2&a=3&a=1",
+		"q=a+b&r=a%20b&s=a%2Bb",
+		"q=~user&r=%7Euser",
+		"a=&b&=c",
+		"jwt=abc&__proto__=x&a=1",
+		"a=%zz&b=1",
+		"a=1;b=2&c=3",
+		"a=%",
+		"k%C3%BC=%C3%BC&k=*!'()",
+		"&&a=1&&",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		req := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/path", RawQuery: rawQuery}}
+		expected := straightforwardCanonicalRequest(req, "")
+		if actual := CreateCanonicalRequest(req, false, ""); actual != expected {
+			t.Errorf("raw query %q: Expected %q, but got %q", rawQuery, expected, actual)
+		}
+	})
+}
@@ -7,18 +7,43 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"sync/atomic"
 )
 
 const CANONICAL_QUERY_SEPARATOR = "&"
 
-func canonicalizeUri(req *http.Request, baseUrlString string) string {
-	path := req.URL.Path
+type parsedBase struct {
+	url  string
+	path string
+}
+
+// lastBase caches the path of the base url, the add-on mostly verifies
+// requests below the same base url
+var lastBase atomic.Pointer[parsedBase]
+
+// basePath returns the escaped path of baseUrlString without the trailing
+// slash
+func basePath(baseUrlString string) string {
+	if last := lastBase.Load(); last != nil && last.url == baseUrlString {
+		return last.path
+	}
 	//TODO: Handle error here
 	baseUrl, _ := url.Parse(baseUrlString)
-	baseUrlPath := baseUrl.Path
+	base := &parsedBase{url: baseUrlString}
+	if baseUrl != nil {
+		base.path = strings.TrimSuffix(baseUrl.EscapedPath(), "/")
+	}
+	lastBase.Store(base)
+	return base.path
+}
 
-	// If path and baseUrlPath have the same path, trim the path
-	if strings.HasPrefix(path, baseUrlPath) {
+func canonicalizeUri(req *http.Request, baseUrlString string) string {
+	// the path is hashed as it is sent, percent-encoded
+	path := req.URL.EscapedPath()
+	baseUrlPath := basePath(baseUrlString)
+
+	// If path is below baseUrlPath, trim the path
+	if path == baseUrlPath || strings.HasPrefix(path, baseUrlPath+"/") {
 		path = strings.TrimPrefix(path, baseUrlPath)
 	}
 
@@ -32,7 +57,7 @@ func canonicalizeUri(req *http.Request, baseUrlString string) string {
 	// If the separator is not URL encoded then the following URLs have the same query-string-hash:
 	//   https://djtest9.jira-dev.com/rest/api/2/project&a=b?x=y
 	//   https://djtest9.jira-dev.com/rest/api/2/project?a=b&x=y
-	strings.ReplaceAll(path, CANONICAL_QUERY_SEPARATOR, url.QueryEscape(CANONICAL_QUERY_SEPARATOR))
+	path = strings.ReplaceAll(path, CANONICAL_QUERY_SEPARATOR, "%26")
 
 	if !strings.HasPrefix(path, "/") {
 		path = "/" + path
@@ -45,6 +70,9 @@ func canonicalizeUri(req *http.Request, baseUrlString string) string {
 	return path
 }
 
+// canonicalizeQueryString is the straightforward canonicalization of the
+// query parameters, the canonicalizer computes the same string without
+// allocating and falls back to it for parameters in form bodies
 func canonicalizeQueryString(req *http.Request, checkBodyForParam bool) string {
 	queryParams := req.URL.Query()
 
@@ -68,7 +96,7 @@ func canonicalizeQueryString(req *http.Request, checkBodyForParam bool) string {
 			continue
 		}
 
-		param := queryParams[key]
+		param := append([]string(nil), queryParams[key]...)
 		sort.Strings(param)
 		for idx, value := range param {
 			param[idx] = strings.Replace(url.QueryEscape(value), "+", "%20", -1)
@@ -79,17 +107,38 @@ func canonicalizeQueryString(req *http.Request, checkBodyForParam bool) string {
 	return strings.Join(sortedQueryStrings, "&")
 }
 
+// CreateCanonicalRequest returns the canonical request string the query
+// string hash (qsh) claim is computed from
+func CreateCanonicalRequest(req *http.Request, checkBodyForParam bool, baseUrlString string) string {
+	c := getCanonicalizer()
+	defer putCanonicalizer(c)
+	c.writeRequest(req, checkBodyForParam, baseUrlString)
+	return c.buf.String()
+}
+
 func CreateQueryStringHash(req *http.Request, checkBodyForParam bool, baseUrlString string) string {
-	createCanonicalRequest := func() string {
-		return strings.ToUpper(req.Method) +
-			CANONICAL_QUERY_SEPARATOR +
-			canonicalizeUri(req, baseUrlString) +
-			CANONICAL_QUERY_SEPARATOR +
-			canonicalizeQueryString(req, checkBodyForParam)
-	}
+	c := getCanonicalizer()
+	defer putCanonicalizer(c)
+	c.writeRequest(req, checkBodyForParam, baseUrlString)
+	sum := sha256.Sum256(c.buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
 
-	s := createCanonicalRequest()
-	h := sha256.New()
-	h.Write([]byte(s))
-	return hex.EncodeToString(h.Sum(nil))
+// VerifyQueryStringHash reports whether qsh is the query string hash of req,
+// unlike comparing it to CreateQueryStringHash it does not allocate
+func VerifyQueryStringHash(req *http.Request, checkBodyForParam bool, baseUrlString string, qsh string) bool {
+	var expected [2 * sha256.Size]byte
+	if len(qsh) != len(expected) {
+		return false
+	}
+	c := getCanonicalizer()
+	defer putCanonicalizer(c)
+	c.writeRequest(req, checkBodyForParam, baseUrlString)
+	sum := sha256.Sum256(c.buf.Bytes())
+	hex.Encode(expected[:], sum[:])
+	var diff byte
+	for i := range expected {
+		diff |= expected[i] ^ qsh[i]
+	}
+	return diff == 0
 }
@@ -49,3 +49,14 @@ func TestCreateQueryStringHash(t *testing.T) {
 	}
 
 }
+
+func BenchmarkCreateQueryStringHash(b *testing.B) {
+	req, err := http.NewRequest("GET", "/hello-world?lic=none&tz=Australia%2FSydney&cp=%2Fjira&user_key=&loc=en-US&user_id=&xdm_e=http%3A%2F%2Fstorm%3A2990&xdm_c=channel-servlet-hello-world&xdm_p=1", http.NoBody)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		CreateQueryStringHash(req, false, "")
+	}
+}
@@ -0,0 +1,15 @@
+package qshtest_test
+
+import (
+	"net/http"
+	"testing"
+
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt/qshtest"
+)
+
+func TestConformance(t *testing.T) {
+	qshtest.Run(t, func(req *http.Request, baseUrl string) string {
+		return atlasjwt.CreateCanonicalRequest(req, false, baseUrl)
+	})
+}
@@ -0,0 +1,96 @@
+package atlasjwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// DefaultSignExpiry is the lifetime of the tokens of SignRequest
+const DefaultSignExpiry = 3 * time.Minute
+
+// SignOptions configures the token of SignRequest
+type SignOptions struct {
+	// Issuer is the key of the add-on as installed by the tenant, see
+	// Addon.TenantKey
+	Issuer string
+	// Expiry is the lifetime of the token, DefaultSignExpiry when zero
+	Expiry time.Duration
+	// Subject is the optional sub claim, e.g. the account id of a user
+	Subject string
+	// Query passes the token as the jwt query parameter instead of the
+	// Authorization header, e.g. for urls opened by browsers
+	Query bool
+}
+
+// SignRequest signs an outbound request to the host product of the tenant
+// with a JWT of the shared secret, so that requests sent with other http
+// clients are authenticated like those of hostrequest. Urls without a host
+// are resolved against the base url of the tenant, the query string hash is
+// computed from the path below the base url. Requests to other hosts are not
+// signed, the token would hand the secret of the tenant to them
+func SignRequest(req *http.Request, tenant *store.Tenant, opts SignOptions) error {
+	if opts.Issuer == "" {
+		return errors.New("signing a request requires the issuer")
+	}
+	if opts.Expiry <= 0 {
+		opts.Expiry = DefaultSignExpiry
+	}
+	baseUrl, err := url.Parse(tenant.BaseURL)
+	if err != nil {
+		return err
+	}
+
+	// relative urls are below the base url, the hash of the path is computed
+	// before the base url is prepended
+	qsh := CreateQueryStringHash(req, false, tenant.BaseURL)
+	if req.URL.Host == "" {
+		qsh = CreateQueryStringHash(req, false, "")
+		req.URL.Host = baseUrl.Host
+		req.URL.Scheme = baseUrl.Scheme
+		// the escaped paths are joined, escaped slashes are no separators
+		req.URL.RawPath = path.Join(baseUrl.EscapedPath(), req.URL.EscapedPath())
+		if req.URL.Path, err = url.PathUnescape(req.URL.RawPath); err != nil {
+			return err
+		}
+	} else if !strings.EqualFold(req.URL.Host, baseUrl.Host) || !strings.EqualFold(req.URL.Scheme, baseUrl.Scheme) {
+		return fmt.Errorf("cannot sign a request to %s://%s for the tenant %s", req.URL.Scheme, req.URL.Host, tenant.BaseURL)
+	}
+
+	now := time.Now()
+	claims := struct {
+		QueryStringHash string `json:"qsh"`
+		jwt.StandardClaims
+	}{
+		QueryStringHash: qsh,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    opts.Issuer,
+			Subject:   opts.Subject,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(opts.Expiry).Unix(),
+		},
+	}
+	secret := tenant.SecretBytes()
+	signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	store.Zero(secret)
+	if err != nil {
+		return err
+	}
+
+	if opts.Query {
+		query := req.URL.Query()
+		query.Set("jwt", signedToken)
+		req.URL.RawQuery = query.Encode()
+		return nil
+	}
+	req.Header.Set("Authorization", "JWT "+signedToken)
+	return nil
+}
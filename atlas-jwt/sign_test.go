@@ -0,0 +1,61 @@
+package atlasjwt
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestSignRequest(t *testing.T) {
+	tenant := &store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: "https://example.atlassian.net/wiki"}
+	relative, _ := http.NewRequest(http.MethodGet, "/rest/api/content?limit=1", nil)
+	absolute, _ := http.NewRequest(http.MethodGet, "https://example.atlassian.net/wiki/rest/api/content?limit=1", nil)
+
+	for _, req := range []*http.Request{relative, absolute} {
+		if err := SignRequest(req, tenant, SignOptions{Issuer: "com.example.test", Subject: "account-id"}); err != nil {
+			t.Fatal(err)
+		}
+		if req.URL.String() != "https://example.atlassian.net/wiki/rest/api/content?limit=1" {
+			t.Errorf("Expected the url to be resolved against the base url, but got %s", req.URL)
+		}
+		claims := jwt.MapClaims{}
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "JWT ")
+		if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil }); err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := http.NewRequest(http.MethodGet, "/rest/api/content?limit=1", nil)
+		if claims["qsh"] != CreateQueryStringHash(expected, false, "") || claims["iss"] != "com.example.test" || claims["sub"] != "account-id" {
+			t.Errorf("Unexpected claims %v", claims)
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/download/attachments/1/file.png", nil)
+	if err := SignRequest(req, tenant, SignOptions{Issuer: "com.example.test", Query: true}); err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Query().Get("jwt") == "" || req.Header.Get("Authorization") != "" {
+		t.Errorf("Expected the token in the query, but got %s", req.URL)
+	}
+	if err := SignRequest(req, tenant, SignOptions{}); err == nil {
+		t.Errorf("Expected an error without an issuer")
+	}
+
+	escaped, _ := http.NewRequest(http.MethodGet, "/rest/api/content/a%2F..%2Fb", nil)
+	if err := SignRequest(escaped, tenant, SignOptions{Issuer: "com.example.test"}); err != nil {
+		t.Fatal(err)
+	}
+	if escaped.URL.String() != "https://example.atlassian.net/wiki/rest/api/content/a%2F..%2Fb" {
+		t.Errorf("Expected the escaped path to be kept, but got %s", escaped.URL)
+	}
+
+	for _, target := range []string{"https://attacker.example.com/rest/api/content", "http://example.atlassian.net/wiki/rest/api/content"} {
+		foreign, _ := http.NewRequest(http.MethodGet, target, nil)
+		if err := SignRequest(foreign, tenant, SignOptions{Issuer: "com.example.test"}); err == nil || foreign.Header.Get("Authorization") != "" {
+			t.Errorf("Expected the request to %s not to be signed, but got %v", target, err)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package atlasoauth2
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
-	"log"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -36,7 +37,9 @@ func createTokenForAccountId(tenant *store.Tenant, accountId string) (string, er
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(tenant.SharedSecret))
+	secret := tenant.SecretBytes()
+	signedToken, err := token.SignedString(secret)
+	store.Zero(secret)
 
 	if err != nil {
 		return "", err
@@ -45,13 +48,28 @@ func createTokenForAccountId(tenant *store.Tenant, accountId string) (string, er
 	return signedToken, nil
 }
 
+// GetAccessToken returns an access token to act as the user, the string
+// cannot be zeroed, see GetAccessTokenBytes
 func GetAccessToken(tenant *store.Tenant, userAccountId string, scopes []string) (string, error) {
+	token, err := GetAccessTokenBytes(tenant, userAccountId, scopes)
+	if err != nil {
+		return "", err
+	}
+	defer store.Zero(token)
+	return string(token), nil
+}
+
+// GetAccessTokenBytes returns an access token to act as the user, the
+// caller zeroes it with store.Zero after use. The response of the
+// authorization server is zeroed once the token was copied from it, the
+// copies made to send the token, e.g. its Authorization header, are not
+func GetAccessTokenBytes(tenant *store.Tenant, userAccountId string, scopes []string) ([]byte, error) {
 	// TODO: We should probably use an oauth2 library - for now though, lets keep it "simple"
 	// TODO: Add Caching
 
 	jwtToken, err := createTokenForAccountId(tenant, userAccountId)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	reader := strings.NewReader(strings.ReplaceAll(url.Values(map[string][]string{
@@ -60,11 +78,9 @@ func GetAccessToken(tenant *store.Tenant, userAccountId string, scopes []string)
 		"scope":      {strings.ToUpper(strings.Join(scopes, " "))},
 	}).Encode(), "+", "%20"))
 
-	log.Print(jwtToken)
-
 	req, err := http.NewRequest("POST", AUTHORIZATION_SERVER_URL+"/oauth2/token", reader)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req.Header.Set("Accept", "application/json")
@@ -72,25 +88,40 @@ func GetAccessToken(tenant *store.Tenant, userAccountId string, scopes []string)
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return "", errors.New(res.Status)
+		return nil, errors.New(res.Status)
 	}
 
-	responseBody := make(map[string]interface{})
-
-	err = json.NewDecoder(res.Body).Decode(&responseBody)
+	body, err := io.ReadAll(res.Body)
+	defer store.Zero(body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return parseTokenResponse(body)
+}
 
-	log.Printf("%+v\n", responseBody)
-
-	if val, ok := responseBody["token_type"]; !ok || val != "Bearer" {
-		return "", errors.New("response body did not contain a bearer token")
+// parseTokenResponse returns the bearer access token of the token response
+// body, in a slice not shared with body
+func parseTokenResponse(body []byte) ([]byte, error) {
+	var response struct {
+		TokenType   string          `json:"token_type"`
+		AccessToken json.RawMessage `json:"access_token"`
 	}
-
-	return responseBody["access_token"].(string), nil
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if response.TokenType != "Bearer" {
+		return nil, errors.New("response body did not contain a bearer token")
+	}
+	// access tokens hold no characters escaped in JSON
+	raw := response.AccessToken
+	if len(raw) < 3 || raw[0] != '"' || raw[len(raw)-1] != '"' || bytes.ContainsAny(raw, "\\") {
+		return nil, errors.New("response body did not contain a valid access token")
+	}
+	// the RawMessage is a copy of the token in body
+	return raw[1 : len(raw)-1], nil
 }
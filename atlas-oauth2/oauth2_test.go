@@ -0,0 +1,34 @@
+package atlasoauth2
+
+import (
+	"testing"
+)
+
+func TestParseTokenResponse(t *testing.T) {
+	body := []byte(`{"token_type":"Bearer","access_token":"access-token","expires_in":900}`)
+	token, err := parseTokenResponse(body)
+	if err != nil || string(token) != "access-token" {
+		t.Fatalf("Expected the token %q, but got %q (%v)", "access-token", token, err)
+	}
+	// zeroing the response leaves the token intact and the other way round
+	clear(body)
+	if string(token) != "access-token" {
+		t.Errorf("Expected the token not to share the response body, but got %q", token)
+	}
+
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{name: "other token type", body: `{"token_type":"MAC","access_token":"access-token"}`},
+		{name: "empty token", body: `{"token_type":"Bearer","access_token":""}`},
+		{name: "number token", body: `{"token_type":"Bearer","access_token":42}`},
+		{name: "escaped token", body: `{"token_type":"Bearer","access_token":"access\u002dtoken"}`},
+		{name: "invalid json", body: `not json`},
+	}
+	for _, testCase := range testCases {
+		if token, err := parseTokenResponse([]byte(testCase.body)); err == nil {
+			t.Errorf("%s: Expected an error, but got the token %q", testCase.name, token)
+		}
+	}
+}
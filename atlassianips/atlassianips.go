@@ -0,0 +1,192 @@
+// Package atlassianips fetches the IP ranges published by Atlassian, used to
+// check the origin of requests from Atlassian products and to configure
+// firewall or WAF rules for their inbound and outbound traffic
+package atlassianips
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// URL is the IP range document published by Atlassian
+const URL = "https://ip-ranges.atlassian.com/"
+
+// DefaultTTL is how long fetched ranges are used before they are fetched
+// again
+const DefaultTTL = 24 * time.Hour
+
+const (
+	DirectionIngress = "ingress"
+	DirectionEgress  = "egress"
+)
+
+// Range is a single entry of the IP range document
+type Range struct {
+	CIDR      string     `json:"cidr"`
+	Region    []string   `json:"region,omitempty"`
+	Product   []string   `json:"product,omitempty"`
+	Direction []string   `json:"direction,omitempty"`
+	Network   *net.IPNet `json:"-"`
+}
+
+func matches(values []string, value string) bool {
+	if value == "" || len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ranges is an IP range document fetched on first use and cached for TTL,
+// the previous ranges are kept while fetching fails
+type Ranges struct {
+	URL       string
+	Client    *http.Client
+	TTL       time.Duration
+	mutex     sync.Mutex
+	ranges    []Range
+	syncToken string
+	fetchedAt time.Time
+}
+
+func New(url string) *Ranges {
+	return &Ranges{URL: url, TTL: DefaultTTL}
+}
+
+// Default are the ranges published by Atlassian
+var Default = New(URL)
+
+func (r *Ranges) fetch(ctx context.Context) (ranges []Range, syncToken string, err error) {
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("fetching IP ranges from %s: %s", r.URL, response.Status)
+		return
+	}
+	var document struct {
+		SyncToken json.Number `json:"syncToken"`
+		Items     []Range     `json:"items"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&document); err != nil {
+		err = fmt.Errorf("decoding IP ranges from %s: %w", r.URL, err)
+		return
+	}
+	for _, item := range document.Items {
+		if _, item.Network, err = net.ParseCIDR(item.CIDR); err == nil {
+			ranges = append(ranges, item)
+		}
+	}
+	if len(ranges) == 0 {
+		err = fmt.Errorf("no IP ranges found at %s", r.URL)
+		return
+	}
+	return ranges, document.SyncToken.String(), nil
+}
+
+// Refresh fetches the ranges, they are kept unchanged when it fails
+func (r *Ranges) Refresh(ctx context.Context) error {
+	ranges, syncToken, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.ranges, r.syncToken, r.fetchedAt = ranges, syncToken, time.Now()
+	return nil
+}
+
+// Ranges returns the cached ranges, refreshing them once they expired
+func (r *Ranges) Ranges(ctx context.Context) ([]Range, error) {
+	r.mutex.Lock()
+	ranges, fresh := r.ranges, time.Since(r.fetchedAt) < r.TTL
+	r.mutex.Unlock()
+	if ranges != nil && fresh {
+		return ranges, nil
+	}
+	if err := r.Refresh(ctx); err != nil {
+		if ranges != nil {
+			log.WarnF("using cached IP ranges, fetching %s failed: %v", r.URL, err)
+			return ranges, nil
+		}
+		return nil, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.ranges, nil
+}
+
+// SyncToken returns the version of the cached ranges, it changes whenever
+// Atlassian publishes new ranges
+func (r *Ranges) SyncToken() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.syncToken
+}
+
+// Contains reports whether ip is within any of the ranges
+func (r *Ranges) Contains(ip net.IP) (bool, error) {
+	ranges, err := r.Ranges(context.Background())
+	if err != nil {
+		return false, err
+	}
+	for _, item := range ranges {
+		if item.Network.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CIDRs returns the ranges of the product and direction, an empty product
+// or direction matches all ranges
+func (r *Ranges) CIDRs(ctx context.Context, product, direction string) ([]string, error) {
+	ranges, err := r.Ranges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var cidrs []string
+	for _, item := range ranges {
+		if matches(item.Product, product) && matches(item.Direction, direction) {
+			cidrs = append(cidrs, item.CIDR)
+		}
+	}
+	return cidrs, nil
+}
+
+// Contains reports whether ip is within the Default ranges
+func Contains(ip net.IP) (bool, error) {
+	return Default.Contains(ip)
+}
+
+// Refresh fetches the Default ranges
+func Refresh(ctx context.Context) error {
+	return Default.Refresh(ctx)
+}
+
+// CIDRs returns the Default ranges of the product and direction
+func CIDRs(ctx context.Context, product, direction string) ([]string, error) {
+	return Default.CIDRs(ctx, product, direction)
+}
@@ -0,0 +1,60 @@
+package atlassianips
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const document = `{
+  "syncToken": 1700000000,
+  "items": [
+    {"network": "104.192.136.0", "mask_len": 21, "cidr": "104.192.136.0/21", "region": ["us-east-1"], "product": ["jira", "confluence"], "direction": ["ingress", "egress"]},
+    {"network": "13.52.5.0", "mask_len": 25, "cidr": "13.52.5.0/25", "region": ["us-west-1"], "product": ["bitbucket"], "direction": ["egress"]},
+    {"cidr": "2401:1d80::/32", "product": ["jira"], "direction": ["egress"]}
+  ]
+}`
+
+func TestRanges(t *testing.T) {
+	failing := false
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(document))
+	}))
+	defer server.Close()
+
+	ranges := New(server.URL)
+	for ip, expected := range map[string]bool{"104.192.140.1": true, "2401:1d80::1": true, "192.0.2.1": false} {
+		if ok, err := ranges.Contains(net.ParseIP(ip)); err != nil || ok != expected {
+			t.Errorf("Expected %s to be contained %v, but got %v (%v)", ip, expected, ok, err)
+		}
+	}
+	if fetches != 1 || ranges.SyncToken() != "1700000000" {
+		t.Errorf("Expected a single fetch of sync token 1700000000, but got %v fetches of %q", fetches, ranges.SyncToken())
+	}
+
+	cidrs, err := ranges.CIDRs(context.Background(), "jira", DirectionEgress)
+	if err != nil || len(cidrs) != 2 || cidrs[0] != "104.192.136.0/21" || cidrs[1] != "2401:1d80::/32" {
+		t.Errorf("Expected the egress ranges of jira, but got %v (%v)", cidrs, err)
+	}
+
+	// expired ranges are kept while the document cannot be fetched
+	failing = true
+	ranges.TTL = 0
+	if ok, err := ranges.Contains(net.ParseIP("13.52.5.1")); err != nil || !ok {
+		t.Errorf("Expected the cached ranges to be used, but got %v (%v)", ok, err)
+	}
+	if err = ranges.Refresh(context.Background()); err == nil {
+		t.Errorf("Expected Refresh to fail")
+	}
+	if _, err = New(server.URL).Contains(net.ParseIP("13.52.5.1")); err == nil {
+		t.Errorf("Expected Contains to fail without cached ranges")
+	}
+}
@@ -0,0 +1,55 @@
+// Package audit records security relevant events of the add-on, such as
+// rejected installations, separately from the regular debug logging
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// Event is a single audit log entry
+type Event struct {
+	Time      time.Time         `json:"time"`
+	Type      string            `json:"type"`
+	ClientKey string            `json:"clientKey,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// Sink receives the recorded audit events
+type Sink interface {
+	Record(ctx context.Context, event Event)
+}
+
+// SinkFunc adapts a function to the Sink interface
+type SinkFunc func(ctx context.Context, event Event)
+
+func (f SinkFunc) Record(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+// LogSink writes audit events as JSON to the application log
+type LogSink struct{}
+
+func (LogSink) Record(ctx context.Context, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.ErrorF("error encoding audit event %s: %v", event.Type, err)
+		return
+	}
+	log.InfoF("audit: %s", data)
+}
+
+// DefaultSink receives all events passed to Record
+var DefaultSink Sink = LogSink{}
+
+// Record timestamps the event and passes it to the DefaultSink
+func Record(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	DefaultSink.Record(ctx, event)
+}
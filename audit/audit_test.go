@@ -0,0 +1,25 @@
+package audit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	var recorded []Event
+	defer func(sink Sink) { DefaultSink = sink }(DefaultSink)
+	DefaultSink = SinkFunc(func(ctx context.Context, event Event) {
+		recorded = append(recorded, event)
+	})
+
+	Record(context.Background(), Event{Type: "test", ClientKey: "key"})
+	if len(recorded) != 1 {
+		t.Fatalf("Expected %v recorded events, but got %v", 1, len(recorded))
+	}
+	if recorded[0].Time.IsZero() {
+		t.Errorf("Expected recorded event to be timestamped")
+	}
+	if recorded[0].Type != "test" || recorded[0].ClientKey != "key" {
+		t.Errorf("Expected recorded event to be %+v, but got %+v", Event{Type: "test", ClientKey: "key"}, recorded[0])
+	}
+}
@@ -0,0 +1,64 @@
+// Command gonnect is the command line tool of the add-on framework:
+//
+//	gonnect new [-key key] [-name name] [-module path] [-base-url url] [-replace dir] [-force] dir
+//
+// generates a working Jira issue glance and Confluence macro example app
+// into dir, see package scaffold
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/scaffold"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gonnect new [flags] dir")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "new" {
+		usage()
+	}
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	opts := scaffold.Options{}
+	flags.StringVar(&opts.Key, "key", "", "app key, the name of dir when empty")
+	flags.StringVar(&opts.Name, "name", "", "app name, the key when empty")
+	flags.StringVar(&opts.Module, "module", "", "Go module path, example.com/<key> when empty")
+	flags.StringVar(&opts.BaseUrl, "base-url", "", "public url of the app, http://localhost:8080 when empty")
+	flags.StringVar(&opts.GonnectVersion, "version", "", "required framework version, resolved by go mod tidy when empty")
+	flags.StringVar(&opts.Replace, "replace", "", "local directory replacing the framework module")
+	flags.BoolVar(&opts.Force, "force", false, "overwrite existing files")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gonnect new [flags] dir")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[2:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	dir := flags.Arg(0)
+	if opts.Key == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts.Key = filepath.Base(abs)
+	}
+
+	written, err := scaffold.Generate(dir, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, name := range written {
+		fmt.Println(filepath.Join(dir, name))
+	}
+	fmt.Printf("\ncd %s && go mod tidy && go run . -product jira\n", dir)
+}
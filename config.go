@@ -2,6 +2,10 @@ package gonnect
 
 import (
 	"errors"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/notify"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
 )
 
 var ErrConfigNoProfileSelected = errors.New("No Profile selected; Set CurrentProfile in the config file or set GONNECT_PROFILE")
@@ -16,6 +20,247 @@ type Profile struct {
 	BaseUrl       string
 	Store         StoreConfiguration
 	SignedInstall bool
+	InstallKeys   *InstallKeysConfiguration
+	// LegacyLifecycleResponses answers the lifecycle callbacks with 200 "OK"
+	// and plain text errors like earlier releases, instead of 204 and JSON
+	// errors
+	LegacyLifecycleResponses bool
+	// AuthTimeout limits the verification of a request including fetching
+	// the install keys, it ends with the request when zero
+	AuthTimeout time.Duration
+	// ValidateContextParams rejects requests whose context query parameters,
+	// such as pageId, spaceKey or issueKey, differ from the context claim of
+	// the JWT, see middleware.ContextClaimParams
+	ValidateContextParams bool
+	// StrictTokenSources rejects requests with 400 whose authorization
+	// header, jwt query parameter, form body and TokenCookie hold different
+	// tokens, otherwise the token of the first of them is used
+	StrictTokenSources bool
+	// TokenCookie is the name of a cookie the JWT is read from when the
+	// request holds no other token, for apps persisting the context token
+	// client-side. Cookies are sent along with cross-site form posts, apps
+	// accepting them on unsafe requests should apply the CSRF middleware
+	TokenCookie string
+	// DebugJWT enables the JWT introspection endpoint of the admin package
+	DebugJWT bool
+	// AuthTrace logs the auth decision trail of requests
+	AuthTrace *AuthTraceConfiguration
+	// Notifications are the external URLs receiving tenant lifecycle events,
+	// see Addon.Notifier
+	Notifications []notify.Target
+	// SingleTenant serves a statically configured tenant without a database,
+	// Store is ignored when it is set
+	SingleTenant *SingleTenantConfiguration
+	// DevTunnel exposes the add-on through a public tunnel during local
+	// development, see devtunnel.Setup
+	DevTunnel *DevTunnelConfiguration
+	// DevInstall installs the add-on on a development site on startup, see
+	// devinstall.Setup
+	DevInstall *DevInstallConfiguration
+	// Environments are additional app identities served by this deployment
+	// depending on the Host header, see Addon.DescriptorFor
+	Environments []EnvironmentConfiguration
+	// Admin restricts the operator routes, see Addon.AdminAuth
+	Admin *AdminAuthConfiguration
+	// LifecycleIPs restricts the lifecycle callbacks to the published IP
+	// ranges of Atlassian
+	LifecycleIPs *LifecycleIPConfiguration
+	// InternalTokens authenticate the calls between the services of the
+	// add-on, see Addon.InternalTokens
+	InternalTokens *InternalTokenConfiguration
+	// HostCallAudit records the requests sent to the host products in the
+	// audit log, see hostrequest.AuditHostCall
+	HostCallAudit *HostCallAuditConfiguration
+	// SessionTokens configures the verification of the session tokens the
+	// add-on issues, see middleware.NewTokenMiddleware
+	SessionTokens *SessionTokenConfiguration
+	// Crypto restricts the cryptography of the add-on, e.g. to FIPS approved
+	// key sizes
+	Crypto *CryptoConfiguration
+	// InstallHosts restricts the base urls of the installing tenants, see
+	// Profile.ValidateInstallBaseUrl
+	InstallHosts *InstallHostConfiguration
+	// EphemeralTenants accepts reinstalls without verifying them and expires
+	// idle tenants. Otherwise installed tenants have to sign their reinstalls
+	// with their shared secret, unlike before this setting existed, while
+	// uninstalled tenants and revoked secrets install like new tenants
+	EphemeralTenants *EphemeralTenantConfiguration
+	// LatencyBudgets are the latency objectives of the routes, see
+	// middleware.NewLatencyBudgetMiddleware
+	LatencyBudgets *LatencyBudgetConfiguration
+}
+
+// LatencyBudgetConfiguration are the latency budgets of the routes. Connect
+// pages are loaded in iframes of the host product, users perceive their
+// latency as the one of the product
+type LatencyBudgetConfiguration struct {
+	// Default is the budget of the routes without their own, requests of
+	// these routes are not tracked when zero
+	Default time.Duration
+	// Routes are the budgets of chi route patterns, e.g. "/glance" or
+	// "/api/issues/{key}"
+	Routes map[string]time.Duration
+	// Auth is the budget of the authentication of a request, which is part
+	// of the budget of its route, not tracked separately when zero
+	Auth time.Duration
+	// Objective is the fraction of the requests meeting their budget, 0.99
+	// when zero
+	Objective float64
+	// Window is the period of the burn rates, five minutes when zero
+	Window time.Duration
+}
+
+// HostCallAuditConfiguration samples the requests to the host products
+// which are recorded in the audit log, failed requests are always recorded
+type HostCallAuditConfiguration struct {
+	Enabled bool
+	// SampleRate is the fraction of the successful requests recorded, all of
+	// them when zero
+	SampleRate float64
+}
+
+// SessionTokenConfiguration restricts the session tokens accepted by the
+// token middleware
+type SessionTokenConfiguration struct {
+	// DisableVerification serves token routes without authentication, for
+	// local development only, see Profile.ValidateSessionTokens
+	DisableVerification bool
+	// MaxAge rejects session tokens issued longer ago, regardless of their
+	// expiry, no limit when zero
+	MaxAge time.Duration
+	// SigningAlgorithm and SigningKey sign the session tokens with a key of
+	// the add-on instead of the shared secret of the tenant: HS256 with a
+	// secret, RS256 or ES256 with a PEM encoded private key
+	SigningAlgorithm string
+	SigningKey       string
+}
+
+// InternalTokenConfiguration are the add-on keys of the internal tokens
+type InternalTokenConfiguration struct {
+	// Secrets verify the tokens and the first one signs them, previous
+	// secrets are kept while rotating
+	Secrets []string
+	// Expiry of the issued tokens, five minutes when zero
+	Expiry time.Duration
+}
+
+// LifecycleIPConfiguration rejects /installed and /uninstalled calls which
+// do not originate from the published Atlassian IP ranges, in addition to
+// the JWT verification
+type LifecycleIPConfiguration struct {
+	Enabled bool
+	// RangesUrl is the IP range JSON, the Atlassian ranges when empty
+	RangesUrl string
+	// ExtraRanges are additional allowed IPs or CIDR ranges, e.g. of a local
+	// Atlassian instance
+	ExtraRanges []string
+	// TrustForwardedFor takes the client IP from the last X-Forwarded-For
+	// address, for deployments behind a proxy appending it
+	TrustForwardedFor bool
+}
+
+// DevInstallConfiguration is the development site the add-on is installed on
+// through the UPM REST api
+type DevInstallConfiguration struct {
+	Enabled bool
+	SiteUrl string
+	// Username is the email of a site administrator
+	Username string
+	ApiToken string
+}
+
+// DevTunnelConfiguration selects the tunnel of the local dev loop
+type DevTunnelConfiguration struct {
+	Enabled bool
+	// Provider is detect (a running ngrok agent), ngrok or cloudflared
+	Provider string
+	// Command is the path of the provider binary, looked up in the PATH when
+	// empty
+	Command string
+	// Port is the local port the add-on listens on
+	Port int
+}
+
+// SingleTenantConfiguration is the tenant of a single-customer deployment
+type SingleTenantConfiguration struct {
+	ClientKey    string
+	SharedSecret string
+	BaseUrl      string
+	ProductType  string
+}
+
+// OpenStore returns the tenant store of the profile, a StaticStore in single
+// tenant mode and a database store otherwise. NewCustomAddon opens it when no
+// store is given in single tenant mode
+func (p *Profile) OpenStore() (store.TenantStore, error) {
+	if c := p.SingleTenant; c != nil {
+		s, err := store.NewStatic(store.Tenant{
+			ClientKey:    c.ClientKey,
+			SharedSecret: c.SharedSecret,
+			BaseURL:      c.BaseUrl,
+			ProductType:  c.ProductType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	s, err := store.NewWithOptions(p.Store.Type, p.Store.DatabaseUrl, p.Store.Options())
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AuthTraceConfiguration enables logging the full decision trail of the
+// authentication middleware, with secrets redacted
+type AuthTraceConfiguration struct {
+	Enabled bool
+	// ClientKeys limits the tracing to requests of these tenants
+	ClientKeys []string
+}
+
+// Traces reports whether requests of the tenant are traced
+func (c *AuthTraceConfiguration) Traces(clientKey string) bool {
+	if c == nil || !c.Enabled {
+		return false
+	}
+	if len(c.ClientKeys) == 0 {
+		return true
+	}
+	for _, key := range c.ClientKeys {
+		if key == clientKey {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallKeysConfiguration configures the keys accepted for signed installs,
+// when any keys are pinned install JWTs signed with other keys are rejected
+// even if the key CDN serves them
+type InstallKeysConfiguration struct {
+	// PinnedKeyIds are the accepted key ids (kid)
+	PinnedKeyIds []string
+	// PinnedPublicKeys are the accepted PEM encoded RSA public keys
+	PinnedPublicKeys []string
+	// BundlePath is a JSON file mapping key ids to PEM encoded public keys,
+	// or a directory of PEM files named by key id, which is consulted before
+	// the key CDN and reloaded whenever it changes
+	BundlePath string
+	// Offline never contacts the key CDN, only keys from the bundle are used
+	Offline bool
+	// FetchTimeout limits each attempt to fetch a key from the key CDN, 5s
+	// when zero
+	FetchTimeout time.Duration
+	// FetchAttempts is the number of attempts to fetch a key from the key
+	// CDN when it fails or times out, 3 when zero
+	FetchAttempts int
+}
+
+// Pinned reports whether any install keys are pinned
+func (c *InstallKeysConfiguration) Pinned() bool {
+	return c != nil && (len(c.PinnedKeyIds) > 0 || len(c.PinnedPublicKeys) > 0)
 }
 
 func NewProfile(baseUrl, dbType, dbUri string, signedInstall bool) *Profile {
@@ -32,6 +277,27 @@ func NewProfile(baseUrl, dbType, dbUri string, signedInstall bool) *Profile {
 type StoreConfiguration struct {
 	Type        string
 	DatabaseUrl string
+	// LogLevel of the gorm logger: silent, error, warn or info
+	LogLevel        string
+	SlowThreshold   time.Duration
+	PrepareStmt     bool
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Options returns the store options configured for the connection
+func (c StoreConfiguration) Options() store.Options {
+	return store.Options{
+		LogLevel:        store.ParseLogLevel(c.LogLevel),
+		SlowThreshold:   c.SlowThreshold,
+		PrepareStmt:     c.PrepareStmt,
+		MaxOpenConns:    c.MaxOpenConns,
+		MaxIdleConns:    c.MaxIdleConns,
+		ConnMaxLifetime: c.ConnMaxLifetime,
+		ConnMaxIdleTime: c.ConnMaxIdleTime,
+	}
 }
 
 func NewConfiguration(dbType, dbUrl string) StoreConfiguration {
@@ -0,0 +1,16 @@
+package confluence
+
+import (
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+)
+
+const CONTENT_API_PATH = "/rest/api"
+
+// Confluence provides typed helpers for the Confluence REST API
+type Confluence struct {
+	host *hostrequest.HostRequest
+}
+
+func New(host *hostrequest.HostRequest) *Confluence {
+	return &Confluence{host: host}
+}
@@ -0,0 +1,219 @@
+package confluence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/descriptor"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+)
+
+// MacroContext passes the parameters identifying the body of a macro to the
+// url of a dynamic content macro, see MacroFromRequest
+var MacroContext = descriptor.Context{
+	"macroId":     "macro.id",
+	"pageId":      "page.id",
+	"pageVersion": "page.version",
+}
+
+// ErrMacroNotFound is returned when the page storage has no macro with the
+// macro id
+var ErrMacroNotFound = errors.New("macro not found in the page storage")
+
+// DefaultMacroSaveRetries is the number of times SaveMacro retries when the
+// page was changed concurrently
+const DefaultMacroSaveRetries = 3
+
+// Macro is a macro of a page as returned by the macro body API
+type Macro struct {
+	Name       string            `json:"name"`
+	Body       string            `json:"body"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+// MacroBody returns the macro macroId of the version of the page, the
+// current version is fetched when version is zero
+func (c *Confluence) MacroBody(ctx context.Context, pageId string, version int, macroId string) (*Macro, error) {
+	if version <= 0 {
+		content, err := c.storage(ctx, pageId)
+		if err != nil {
+			return nil, err
+		}
+		version = content.Version.Number
+	}
+	path := fmt.Sprintf("%s/content/%s/history/%d/macro/id/%s", CONTENT_API_PATH, url.PathEscape(pageId), version, url.PathEscape(macroId))
+	macro := &Macro{}
+	if err := c.host.DoJSON(ctx, http.MethodGet, path, nil, nil, macro); err != nil {
+		var hostErr *hostrequest.Error
+		if errors.As(err, &hostErr) && hostErr.StatusCode == http.StatusNotFound {
+			return nil, ErrMacroNotFound
+		}
+		return nil, err
+	}
+	return macro, nil
+}
+
+// MacroFromRequest returns the macro rendered by a request of a dynamic
+// content macro whose url passes the MacroContext
+func (c *Confluence) MacroFromRequest(r *http.Request) (*Macro, error) {
+	values := MacroContext.Values(r)
+	if values["pageId"] == "" || values["macroId"] == "" {
+		return nil, fmt.Errorf("macro request without pageId and macroId")
+	}
+	version, _ := strconv.Atoi(values["pageVersion"])
+	return c.MacroBody(r.Context(), values["pageId"], version, values["macroId"])
+}
+
+type contentVersion struct {
+	Number  int    `json:"number"`
+	Message string `json:"message,omitempty"`
+}
+
+type contentStorage struct {
+	Value          string `json:"value"`
+	Representation string `json:"representation"`
+}
+
+type storageContent struct {
+	Id      string         `json:"id"`
+	Type    string         `json:"type"`
+	Title   string         `json:"title"`
+	Status  string         `json:"status,omitempty"`
+	Version contentVersion `json:"version"`
+	Body    struct {
+		Storage contentStorage `json:"storage"`
+	} `json:"body"`
+}
+
+func (c *Confluence) storage(ctx context.Context, pageId string) (*storageContent, error) {
+	content := &storageContent{}
+	query := url.Values{"expand": {"body.storage,version"}}
+	path := fmt.Sprintf("%s/content/%s", CONTENT_API_PATH, url.PathEscape(pageId))
+	if err := c.host.DoJSON(ctx, http.MethodGet, path, query, nil, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// SaveMacro saves the body and parameters of the macro macroId, as edited in
+// a custom macro editor, by replacing them in the page storage and updating
+// the page to a new version. The parameters are kept when params is nil and
+// a body is only written when body is not empty, rich text bodies are in the
+// storage format. Concurrent changes of the page are retried
+func (c *Confluence) SaveMacro(ctx context.Context, pageId, macroId string, params map[string]string, body string) error {
+	var err error
+	for attempt := 0; attempt < DefaultMacroSaveRetries; attempt++ {
+		var content *storageContent
+		if content, err = c.storage(ctx, pageId); err != nil {
+			return err
+		}
+		var storage string
+		if storage, err = replaceMacro(content.Body.Storage.Value, macroId, params, body); err != nil {
+			return err
+		}
+		update := map[string]interface{}{
+			"id":      content.Id,
+			"type":    content.Type,
+			"title":   content.Title,
+			"version": contentVersion{Number: content.Version.Number + 1, Message: "Updated macro " + macroId},
+			"body":    map[string]interface{}{"storage": contentStorage{Value: storage, Representation: "storage"}},
+		}
+		if content.Status != "" {
+			update["status"] = content.Status
+		}
+		path := fmt.Sprintf("%s/content/%s", CONTENT_API_PATH, url.PathEscape(pageId))
+		err = c.host.DoJSON(ctx, http.MethodPut, path, nil, update, nil)
+		var hostErr *hostrequest.Error
+		if err == nil || !errors.As(err, &hostErr) || hostErr.StatusCode != http.StatusConflict {
+			return err
+		}
+	}
+	return err
+}
+
+const (
+	macroStart     = "<ac:structured-macro"
+	macroEnd       = "</ac:structured-macro>"
+	richBodyStart  = "<ac:rich-text-body>"
+	richBodyEnd    = "</ac:rich-text-body>"
+	plainBodyStart = "<ac:plain-text-body>"
+	plainBodyEnd   = "</ac:plain-text-body>"
+)
+
+// replaceMacro replaces the parameters and body of the macro macroId in the
+// storage format of a page
+func replaceMacro(storage, macroId string, params map[string]string, body string) (string, error) {
+	idx := strings.Index(storage, `ac:macro-id="`+macroId+`"`)
+	if idx < 0 {
+		return "", ErrMacroNotFound
+	}
+	start := strings.LastIndex(storage[:idx], macroStart)
+	if start < 0 {
+		return "", ErrMacroNotFound
+	}
+	open := start + strings.Index(storage[start:], ">") + 1
+	if strings.HasSuffix(storage[:open], "/>") {
+		return "", fmt.Errorf("macro %s has no content", macroId)
+	}
+	// the end of the macro, skipping the macros nested in its body
+	end, depth := open, 1
+	for depth > 0 {
+		next := strings.Index(storage[end:], macroEnd)
+		if next < 0 {
+			return "", fmt.Errorf("macro %s is not closed", macroId)
+		}
+		nested := strings.Index(storage[end:], macroStart)
+		if nested >= 0 && nested < next {
+			depth += 1
+			end += nested + len(macroStart)
+			continue
+		}
+		depth -= 1
+		end += next + len(macroEnd)
+	}
+	inner := storage[open : end-len(macroEnd)]
+
+	// the parameters precede the body, the body of the macro itself is closed
+	// last as nested macros are within it
+	bodyStart, bodyEnd, plain := len(inner), len(inner), false
+	if i := strings.Index(inner, richBodyStart); i >= 0 {
+		bodyStart, bodyEnd = i, strings.LastIndex(inner, richBodyEnd)+len(richBodyEnd)
+	}
+	if i := strings.Index(inner, plainBodyStart); i >= 0 && i < bodyStart {
+		bodyStart, bodyEnd, plain = i, strings.LastIndex(inner, plainBodyEnd)+len(plainBodyEnd), true
+	}
+	header, bodyElement, trailer := inner[:bodyStart], inner[bodyStart:bodyEnd], inner[bodyEnd:]
+
+	if params != nil {
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var b strings.Builder
+		for _, name := range names {
+			b.WriteString(`<ac:parameter ac:name="` + escapeXML(name) + `">` + escapeXML(params[name]) + `</ac:parameter>`)
+		}
+		header = b.String()
+	}
+	if body != "" {
+		if plain {
+			bodyElement = plainBodyStart + "<![CDATA[" + strings.ReplaceAll(body, "]]>", "]]]]><![CDATA[>") + "]]>" + plainBodyEnd
+		} else {
+			bodyElement = richBodyStart + body + richBodyEnd
+		}
+	}
+	return storage[:open] + header + bodyElement + trailer + macroEnd + storage[end:], nil
+}
+
+var xmlEscaper = strings.NewReplacer(`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&quot;", `'`, "&#39;")
+
+func escapeXML(value string) string {
+	return xmlEscaper.Replace(value)
+}
@@ -0,0 +1,104 @@
+package confluence
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestReplaceMacro(t *testing.T) {
+	storage := `<p>before</p><ac:structured-macro ac:name="note" ac:macro-id="outer"><ac:parameter ac:name="title">Old</ac:parameter>` +
+		`<ac:rich-text-body><p>old</p><ac:structured-macro ac:name="code" ac:macro-id="inner"><ac:plain-text-body><![CDATA[x]]></ac:plain-text-body></ac:structured-macro></ac:rich-text-body>` +
+		`</ac:structured-macro><p>after</p>`
+
+	testCases := []struct {
+		name     string
+		macroId  string
+		params   map[string]string
+		body     string
+		expected string
+	}{
+		{
+			name:    "rich text body and parameters",
+			macroId: "outer",
+			params:  map[string]string{"title": "A & B"},
+			body:    "<p>new</p>",
+			expected: `<p>before</p><ac:structured-macro ac:name="note" ac:macro-id="outer"><ac:parameter ac:name="title">A &amp; B</ac:parameter>` +
+				`<ac:rich-text-body><p>new</p></ac:rich-text-body></ac:structured-macro><p>after</p>`,
+		},
+		{
+			name:    "nested plain text body",
+			macroId: "inner",
+			body:    "a]]>b",
+			expected: `<p>before</p><ac:structured-macro ac:name="note" ac:macro-id="outer"><ac:parameter ac:name="title">Old</ac:parameter>` +
+				`<ac:rich-text-body><p>old</p><ac:structured-macro ac:name="code" ac:macro-id="inner"><ac:plain-text-body><![CDATA[a]]]]><![CDATA[>b]]></ac:plain-text-body></ac:structured-macro></ac:rich-text-body>` +
+				`</ac:structured-macro><p>after</p>`,
+		},
+	}
+	for _, testCase := range testCases {
+		replaced, err := replaceMacro(storage, testCase.macroId, testCase.params, testCase.body)
+		if err != nil {
+			t.Errorf("%s: %v", testCase.name, err)
+			continue
+		}
+		if replaced != testCase.expected {
+			t.Errorf("%s: Expected %s, but got %s", testCase.name, testCase.expected, replaced)
+		}
+	}
+	if _, err := replaceMacro(storage, "missing", nil, "body"); err != ErrMacroNotFound {
+		t.Errorf("Expected ErrMacroNotFound, but got %v", err)
+	}
+}
+
+func TestSaveMacro(t *testing.T) {
+	puts := 0
+	var saved map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/macro/id/m1"):
+			_, _ = w.Write([]byte(`{"name":"note","body":"<p>old</p>","parameters":{"title":"Old"}}`))
+		case r.Method == http.MethodGet:
+			_, _ = w.Write([]byte(`{"id":"42","type":"page","title":"Page","version":{"number":3},"body":{"storage":{"value":"<ac:structured-macro ac:macro-id=\"m1\"><ac:rich-text-body><p>old</p></ac:rich-text-body></ac:structured-macro>"}}}`))
+		case r.Method == http.MethodPut:
+			puts += 1
+			if puts == 1 {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			_ = json.NewDecoder(r.Body).Decode(&saved)
+		}
+	}))
+	defer server.Close()
+
+	key := "com.example.test"
+	host := hostrequest.New(&gonnect.Addon{Key: &key}, &store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: server.URL})
+	c := New(host)
+
+	req := httptest.NewRequest(http.MethodGet, "/macro?pageId=42&pageVersion=3&macroId=m1", nil)
+	macro, err := c.MacroFromRequest(req)
+	if err != nil || macro.Body != "<p>old</p>" || macro.Parameters["title"] != "Old" {
+		t.Errorf("Expected the macro body, but got %+v, %v", macro, err)
+	}
+
+	if err = c.SaveMacro(context.Background(), "42", "m1", nil, "<p>new</p>"); err != nil {
+		t.Fatal(err)
+	}
+	if puts != 2 {
+		t.Errorf("Expected the conflicting update to be retried, but got %d updates", puts)
+	}
+	storage := saved["body"].(map[string]interface{})["storage"].(map[string]interface{})
+	expected := `<ac:structured-macro ac:macro-id="m1"><ac:rich-text-body><p>new</p></ac:rich-text-body></ac:structured-macro>`
+	if storage["value"] != expected || storage["representation"] != "storage" {
+		t.Errorf("Expected storage %s, but got %v", expected, storage)
+	}
+	if version := saved["version"].(map[string]interface{}); version["number"] != float64(4) {
+		t.Errorf("Expected version 4, but got %v", version["number"])
+	}
+}
@@ -0,0 +1,229 @@
+package confluence
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+)
+
+const (
+	DefaultSearchLimit      = 25
+	DefaultSearchBackoff    = 500 * time.Millisecond
+	DefaultSearchMaxRetries = 3
+)
+
+type SearchOptions struct {
+	// Limit is the page size requested from Confluence
+	Limit int
+	// MaxResults stops the search after this many results, zero means all
+	MaxResults int
+	// Expand lists the expansion parameters (e.g. "content.space")
+	Expand                []string
+	IncludeArchivedSpaces bool
+	// Backoff is the initial delay before retrying a rate limited request, it
+	// is doubled for every attempt unless the host sent a Retry-After header
+	Backoff    time.Duration
+	MaxRetries int
+}
+
+type SearchResult struct {
+	Title                 string          `json:"title"`
+	Excerpt               string          `json:"excerpt"`
+	Url                   string          `json:"url"`
+	EntityType            string          `json:"entityType"`
+	LastModified          string          `json:"lastModified"`
+	FriendlyLastModified  string          `json:"friendlyLastModified"`
+	IconCssClass          string          `json:"iconCssClass,omitempty"`
+	Content               json.RawMessage `json:"content,omitempty"`
+	Space                 json.RawMessage `json:"space,omitempty"`
+	User                  json.RawMessage `json:"user,omitempty"`
+	ResultGlobalContainer json.RawMessage `json:"resultGlobalContainer,omitempty"`
+}
+
+type searchResponse struct {
+	Results   []SearchResult `json:"results"`
+	Start     int            `json:"start"`
+	Limit     int            `json:"limit"`
+	Size      int            `json:"size"`
+	TotalSize int            `json:"totalSize"`
+	Links     struct {
+		Next string `json:"next"`
+	} `json:"_links"`
+}
+
+// SearchResults holds all results of a completed search
+type SearchResults struct {
+	Results   []SearchResult
+	TotalSize int
+}
+
+// SearchIterator streams the results of a CQL search, fetching the next page
+// only when the current one is consumed
+type SearchIterator struct {
+	c       *Confluence
+	ctx     context.Context
+	cql     string
+	opts    SearchOptions
+	page    []SearchResult
+	current SearchResult
+	cursor  string
+	total   int
+	seen    int
+	started bool
+	done    bool
+	err     error
+}
+
+// Search runs the CQL query and collects all results, following the cursor
+// pagination until exhausted or opts.MaxResults is reached
+func (c *Confluence) Search(ctx context.Context, cql string, opts SearchOptions) (results *SearchResults, err error) {
+	it := c.Stream(ctx, cql, opts)
+	results = &SearchResults{}
+	for it.Next() {
+		results.Results = append(results.Results, it.Result())
+	}
+	if err = it.Err(); err != nil {
+		return nil, err
+	}
+	results.TotalSize = it.TotalSize()
+	return
+}
+
+// Stream returns an iterator over the results of the CQL query
+func (c *Confluence) Stream(ctx context.Context, cql string, opts SearchOptions) *SearchIterator {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultSearchLimit
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultSearchBackoff
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = DefaultSearchMaxRetries
+	}
+	return &SearchIterator{c: c, ctx: ctx, cql: cql, opts: opts}
+}
+
+// Next advances the iterator, returning false when there are no more results
+// or an error occurred
+func (it *SearchIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.opts.MaxResults > 0 && it.seen >= it.opts.MaxResults {
+		return false
+	}
+	for len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil {
+			return false
+		}
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	it.seen += 1
+	return true
+}
+
+// Result returns the current result
+func (it *SearchIterator) Result() SearchResult {
+	return it.current
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *SearchIterator) Err() error {
+	return it.err
+}
+
+// TotalSize returns the total number of results reported by Confluence, it is
+// only known after the first call to Next
+func (it *SearchIterator) TotalSize() int {
+	return it.total
+}
+
+// Channel streams the remaining results into a channel which is closed when
+// the iteration stops, check Err afterwards
+func (it *SearchIterator) Channel() <-chan SearchResult {
+	ch := make(chan SearchResult)
+	go func() {
+		defer close(ch)
+		for it.Next() {
+			select {
+			case ch <- it.Result():
+			case <-it.ctx.Done():
+				it.err = it.ctx.Err()
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func (it *SearchIterator) query() url.Values {
+	query := url.Values{}
+	query.Set("cql", it.cql)
+	query.Set("limit", strconv.Itoa(it.opts.Limit))
+	if len(it.opts.Expand) > 0 {
+		query.Set("expand", strings.Join(it.opts.Expand, ","))
+	}
+	if it.opts.IncludeArchivedSpaces {
+		query.Set("includeArchivedSpaces", "true")
+	}
+	if it.cursor != "" {
+		query.Set("cursor", it.cursor)
+	}
+	return query
+}
+
+func (it *SearchIterator) fetch() (err error) {
+	response := &searchResponse{}
+	if err = it.c.doWithBackoff(it.ctx, it.opts, CONTENT_API_PATH+"/search", it.query(), response); err != nil {
+		return
+	}
+
+	if !it.started {
+		it.started = true
+		it.total = response.TotalSize
+	}
+	it.page = response.Results
+
+	it.cursor = ""
+	if response.Links.Next != "" {
+		if next, err := url.Parse(response.Links.Next); err == nil {
+			it.cursor = next.Query().Get("cursor")
+		}
+	}
+	it.done = it.cursor == "" || len(response.Results) == 0
+	return
+}
+
+func (c *Confluence) doWithBackoff(ctx context.Context, opts SearchOptions, path string, query url.Values, out interface{}) (err error) {
+	delay := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err = c.host.DoJSON(ctx, http.MethodGet, path, query, nil, out)
+
+		wait, retry := hostrequest.RetryDelay(err)
+		if err == nil || !retry || attempt >= opts.MaxRetries {
+			return
+		}
+		if wait <= 0 {
+			wait = delay
+		}
+		log.DebugF("confluence search rate limited, retrying in %v", wait)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,70 @@
+package confluence
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestSearch(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		cursor, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		next := ""
+		if cursor < 2 {
+			next = fmt.Sprintf(`/rest/api/search?cql=type%%3Dpage&cursor=%d`, cursor+1)
+		}
+		_, _ = fmt.Fprintf(w, `{"results":[{"title":"page-%d-a"},{"title":"page-%d-b"}],"totalSize":6,"_links":{"next":"%s"}}`, cursor, cursor, next)
+	}))
+	defer server.Close()
+
+	key := "com.example.test"
+	host := hostrequest.New(&gonnect.Addon{Key: &key}, &store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: server.URL})
+	c := New(host)
+
+	testCases := []struct {
+		opts     SearchOptions
+		expected []string
+	}{
+		{
+			opts:     SearchOptions{Backoff: time.Millisecond},
+			expected: []string{"page-0-a", "page-0-b", "page-1-a", "page-1-b", "page-2-a", "page-2-b"},
+		},
+		{
+			opts:     SearchOptions{MaxResults: 3},
+			expected: []string{"page-0-a", "page-0-b", "page-1-a"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		results, err := c.Search(context.Background(), "type=page", testCase.opts)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if results.TotalSize != 6 {
+			t.Errorf("Expected total size to be 6, but got %d", results.TotalSize)
+		}
+		titles := make([]string, len(results.Results))
+		for idx, result := range results.Results {
+			titles[idx] = result.Title
+		}
+		if fmt.Sprint(titles) != fmt.Sprint(testCase.expected) {
+			t.Errorf("Expected results to be %v, but got %v", testCase.expected, titles)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package gonnect
+
+import (
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// MinFIPSHMACKeyBytes is the shortest HMAC key accepted in FIPS mode,
+	// 112 bits
+	MinFIPSHMACKeyBytes = 14
+	// MinFIPSRSABits is the smallest RSA signing key accepted in FIPS mode
+	MinFIPSRSABits = 2048
+)
+
+// CryptoConfiguration selects the cryptography of the add-on. Built with a
+// BoringCrypto or FIPS toolchain, the HMAC-SHA256 verification of the JWTs,
+// the RS256 and ES256 session signing and the AES-GCM encryption at rest use
+// the validated module of the toolchain, see store.Encryption for replacing
+// the AEAD. Building with the fips tag leaves out the helpers of primitives
+// which are not approved, such as middleware.SHA1Signature
+type CryptoConfiguration struct {
+	// FIPS restricts the keys to the approved sizes, which is checked when
+	// the add-on is created, and rejects requests of tenants whose shared
+	// secret is shorter than MinFIPSHMACKeyBytes
+	FIPS bool
+}
+
+// FIPS reports whether the profile is restricted to approved cryptography
+func (p *Profile) FIPS() bool {
+	return p != nil && p.Crypto != nil && p.Crypto.FIPS
+}
+
+// ValidateCrypto checks the session signing key and the internal token
+// secrets against the restrictions of FIPS mode, it returns nil without it
+func (p *Profile) ValidateCrypto() error {
+	if !p.FIPS() {
+		return nil
+	}
+	if config := p.SessionTokens; config != nil && config.SigningKey != "" {
+		switch config.SigningAlgorithm {
+		case "", "HS256":
+			if len(config.SigningKey) < MinFIPSHMACKeyBytes {
+				return fmt.Errorf("FIPS mode requires HS256 session signing keys of at least %d bytes", MinFIPSHMACKeyBytes)
+			}
+		case "RS256":
+			key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(config.SigningKey))
+			if err != nil {
+				return fmt.Errorf("invalid RS256 session signing key: %w", err)
+			}
+			if bits := key.N.BitLen(); bits < MinFIPSRSABits {
+				return fmt.Errorf("FIPS mode requires RS256 session signing keys of at least %d bits, got %d", MinFIPSRSABits, bits)
+			}
+		case "ES256":
+			// P-256 is approved
+		default:
+			return fmt.Errorf("unsupported session signing algorithm %q", config.SigningAlgorithm)
+		}
+	}
+	if config := p.InternalTokens; config != nil {
+		for i, secret := range config.Secrets {
+			if len(secret) < MinFIPSHMACKeyBytes {
+				return fmt.Errorf("FIPS mode requires internal token secrets of at least %d bytes, secret %d is shorter", MinFIPSHMACKeyBytes, i)
+			}
+		}
+	}
+	return nil
+}
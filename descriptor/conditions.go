@@ -0,0 +1,264 @@
+// Package descriptor provides typed builders for parts of the add-on
+// descriptor which the host product only validates when the add-on is
+// installed, such as module conditions and the context parameters of module
+// urls, so that typos are caught before the descriptor is served
+package descriptor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Product is a host product with its own set of conditions and context
+// parameters
+type Product string
+
+const (
+	Jira       Product = "jira"
+	Confluence Product = "confluence"
+)
+
+// Condition is an entry of the conditions of a module, either a single
+// condition or a composition of conditions with And or Or
+type Condition struct {
+	Condition string            `json:"condition,omitempty"`
+	Invert    bool              `json:"invert,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	And       []Condition       `json:"and,omitempty"`
+	Or        []Condition       `json:"or,omitempty"`
+}
+
+// Cond returns the condition name
+func Cond(name string) Condition {
+	return Condition{Condition: name}
+}
+
+// Not returns the inverted condition name
+func Not(name string) Condition {
+	return Condition{Condition: name, Invert: true}
+}
+
+// And returns a condition which is true when all conditions are
+func And(conditions ...Condition) Condition {
+	return Condition{And: conditions}
+}
+
+// Or returns a condition which is true when any of the conditions is
+func Or(conditions ...Condition) Condition {
+	return Condition{Or: conditions}
+}
+
+// With returns a copy of the condition with the param set
+func (c Condition) With(key, value string) Condition {
+	params := make(map[string]string, len(c.Params)+1)
+	for k, v := range c.Params {
+		params[k] = v
+	}
+	params[key] = value
+	c.Params = params
+	return c
+}
+
+// Inverted returns a copy of the condition with invert toggled
+func (c Condition) Inverted() Condition {
+	c.Invert = !c.Invert
+	return c
+}
+
+// Value returns the condition as a generic descriptor value, to be used in a
+// descriptor read into a map
+func (c Condition) Value() map[string]interface{} {
+	data, _ := json.Marshal(c)
+	value := map[string]interface{}{}
+	_ = json.Unmarshal(data, &value)
+	return value
+}
+
+// Conditions returns the conditions as a generic descriptor value
+func Conditions(conditions ...Condition) []interface{} {
+	values := make([]interface{}, len(conditions))
+	for i, c := range conditions {
+		values[i] = c.Value()
+	}
+	return values
+}
+
+// isRemoteCondition reports whether name is an add-on remote condition,
+// which are urls relative to the base url of the add-on
+func isRemoteCondition(name string) bool {
+	return strings.HasPrefix(name, "/") || strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://")
+}
+
+// Validate checks that the condition is well formed and only uses conditions
+// known to the product, any condition name is accepted for other products
+func (c Condition) Validate(product Product) error {
+	composed := len(c.And) + len(c.Or)
+	switch {
+	case c.Condition == "" && composed == 0:
+		return fmt.Errorf("condition without a name or composed conditions")
+	case c.Condition != "" && composed > 0:
+		return fmt.Errorf("condition %s cannot also compose conditions", c.Condition)
+	case len(c.And) > 0 && len(c.Or) > 0:
+		return fmt.Errorf("condition cannot compose with both and and or")
+	}
+	for _, nested := range append(c.And, c.Or...) {
+		if err := nested.Validate(product); err != nil {
+			return err
+		}
+	}
+	if c.Condition == "" || isRemoteCondition(c.Condition) {
+		return nil
+	}
+	known, ok := productConditions[product]
+	if !ok || known[c.Condition] {
+		return nil
+	}
+	if suggestion := closest(c.Condition, known); suggestion != "" {
+		return fmt.Errorf("unknown %s condition %q, did you mean %q?", product, c.Condition, suggestion)
+	}
+	return fmt.Errorf("unknown %s condition %q", product, c.Condition)
+}
+
+var commonConditions = []string{
+	"addon_is_licensed",
+	"addon_property_contains_all",
+	"addon_property_contains_any",
+	"addon_property_contains_context",
+	"addon_property_equal_to",
+	"addon_property_equal_to_context",
+	"addon_property_exists",
+	"entity_property_contains_all",
+	"entity_property_contains_any",
+	"entity_property_contains_context",
+	"entity_property_equal_to",
+	"entity_property_equal_to_context",
+	"entity_property_exists",
+	"feature_flag",
+	"user_is_admin",
+	"user_is_logged_in",
+	"user_is_sysadmin",
+}
+
+var productConditions = map[Product]map[string]bool{
+	Jira: conditionSet(
+		"can_attach_file_to_issue",
+		"can_manage_attachments",
+		"can_use_application",
+		"has_global_permission",
+		"has_issue_permission",
+		"has_project_permission",
+		"has_selected_project_permission",
+		"has_sub_tasks_available",
+		"has_voted_for_issue",
+		"is_admin_mode",
+		"is_issue_assigned_to_current_user",
+		"is_issue_editable",
+		"is_issue_reported_by_current_user",
+		"is_issue_unresolved",
+		"is_sub_task",
+		"is_watching_issue",
+		"jira_expression",
+		"linking_enabled",
+		"not_version_context",
+		"servicedesk.is_agent",
+		"servicedesk.is_customer",
+		"sub_tasks_enabled",
+		"time_tracking_enabled",
+		"user_has_issue_history",
+		"user_is_project_admin",
+		"user_is_the_logged_in_user",
+		"voting_enabled",
+		"watching_enabled",
+	),
+	Confluence: conditionSet(
+		"active_theme",
+		"can_edit_space_styles",
+		"can_signup",
+		"content_has_any_permissions_set",
+		"content_property_contains_all",
+		"content_property_contains_any",
+		"content_property_contains_context",
+		"content_property_equal_to",
+		"content_property_equal_to_context",
+		"content_property_exists",
+		"create_content",
+		"email_address_confirmed",
+		"favourite_page",
+		"favourite_space",
+		"following_target_user",
+		"has_attachment",
+		"has_blog_post",
+		"has_page",
+		"has_space",
+		"has_template",
+		"latest_version",
+		"not_personal_space",
+		"printable_version",
+		"showing_page_attachments",
+		"space_function_permission",
+		"space_property_contains_all",
+		"space_property_contains_any",
+		"space_property_contains_context",
+		"space_property_equal_to",
+		"space_property_equal_to_context",
+		"space_property_exists",
+		"space_sidebar",
+		"target_user_has_personal_blog",
+		"target_user_has_personal_space",
+		"threaded_comments",
+		"tiny_url_supported",
+		"user_can_create_personal_space",
+		"user_can_use_confluence",
+		"user_favouriting_target_user_personal_space",
+		"user_has_personal_blog",
+		"user_has_personal_space",
+		"user_is_confluence_administrator",
+		"user_logged_in_editable",
+		"user_watching_page",
+		"user_watching_space",
+		"user_watching_space_for_content_type",
+		"viewing_content",
+		"viewing_own_profile",
+	),
+}
+
+func conditionSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names)+len(commonConditions))
+	for _, name := range append(names, commonConditions...) {
+		set[name] = true
+	}
+	return set
+}
+
+// closest returns the known name within an edit distance of two of name
+func closest(name string, known map[string]bool) (match string) {
+	best := 3
+	for candidate := range known {
+		if d := distance(name, candidate); d < best || (d == best && match != "" && candidate < match) {
+			best, match = d, candidate
+		}
+	}
+	return
+}
+
+// distance is the levenshtein distance of a and b
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,121 @@
+package descriptor
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var commonContextParameters = []string{
+	"user.accountId",
+	"user.accountType",
+	"user.locale",
+	"user.timeZone",
+}
+
+var productContextParameters = map[Product]map[string]bool{
+	Jira: parameterSet(
+		"board.id", "board.mode", "board.screen", "board.type",
+		"component.id",
+		"dashboard.id", "dashboardItem.id", "dashboardItem.key", "dashboardItem.viewType",
+		"issue.id", "issue.key", "issuetype.id",
+		"postFunction.config", "postFunction.id",
+		"profileUser.accountId",
+		"project.id", "project.key",
+		"servicedesk.requestId", "servicedesk.requestKey", "servicedesk.requestTypeId", "servicedesk.serviceDeskId",
+		"sprint.id", "sprint.state",
+		"version.id",
+	),
+	Confluence: parameterSet(
+		"content.id", "content.plugin", "content.type", "content.version",
+		"macro.body", "macro.hash", "macro.id", "macro.truncated",
+		"output.type",
+		"page.id", "page.title", "page.type", "page.version",
+		"space.id", "space.key",
+		"target.user.accountId",
+	),
+}
+
+func parameterSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names)+len(commonContextParameters))
+	for _, name := range append(names, commonContextParameters...) {
+		set[name] = true
+	}
+	return set
+}
+
+// contextVariable matches the context parameter placeholders of module urls
+var contextVariable = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// ContextURL builds a module url passing context parameters of the host
+// product as query parameters
+type ContextURL struct {
+	Path   string
+	params [][2]string
+}
+
+// URL returns a ContextURL for path, relative to the base url of the add-on
+func URL(path string) ContextURL {
+	return ContextURL{Path: path}
+}
+
+// With returns a copy passing the context parameter as the query parameter
+// name, e.g. With("issueKey", "issue.key") adds issueKey={issue.key}
+func (u ContextURL) With(name, contextParameter string) ContextURL {
+	u.params = append(append([][2]string{}, u.params...), [2]string{name, contextParameter})
+	return u
+}
+
+// String returns the url with its context parameter placeholders
+func (u ContextURL) String() string {
+	if len(u.params) == 0 {
+		return u.Path
+	}
+	query := make([]string, len(u.params))
+	for i, param := range u.params {
+		query[i] = url.QueryEscape(param[0]) + "={" + param[1] + "}"
+	}
+	separator := "?"
+	if strings.Contains(u.Path, "?") {
+		separator = "&"
+	}
+	return u.Path + separator + strings.Join(query, "&")
+}
+
+// Build validates the context parameters for product and returns the url
+func (u ContextURL) Build(product Product) (string, error) {
+	s := u.String()
+	if err := ValidateURL(product, s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// ValidateURL checks that the context parameters used by a module url are
+// known to the product, any parameter is accepted for other products
+func ValidateURL(product Product, moduleURL string) error {
+	known, ok := productContextParameters[product]
+	if !ok {
+		return nil
+	}
+	var unknown []string
+	for _, match := range contextVariable.FindAllStringSubmatch(moduleURL, -1) {
+		name := strings.TrimSpace(match[1])
+		// entity and add-on properties are referenced by their own keys
+		if known[name] || strings.Contains(name, ".properties.") || strings.HasPrefix(name, "ac.") {
+			continue
+		}
+		if suggestion := closest(name, known); suggestion != "" {
+			unknown = append(unknown, fmt.Sprintf("%q (did you mean %q?)", name, suggestion))
+		} else {
+			unknown = append(unknown, fmt.Sprintf("%q", name))
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("url %s uses unknown %s context parameters %s", moduleURL, product, strings.Join(unknown, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package descriptor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConditionValidate(t *testing.T) {
+	testCases := []struct {
+		condition     Condition
+		product       Product
+		expectedError string
+	}{
+		{condition: Cond("user_is_logged_in"), product: Jira},
+		{condition: Not("is_issue_unresolved"), product: Jira},
+		{condition: And(Cond("user_is_logged_in"), Or(Cond("has_page"), Cond("has_blog_post"))), product: Confluence},
+		{condition: Cond("has_project_permission").With("permission", "BROWSE_PROJECTS"), product: Jira},
+		{condition: Cond("/condition/licensed"), product: Jira},
+		{condition: Cond("anything"), product: Product("bitbucket")},
+		{condition: Cond("user_is_loged_in"), product: Jira, expectedError: `did you mean "user_is_logged_in"`},
+		{condition: Cond("has_page"), product: Jira, expectedError: `unknown jira condition "has_page"`},
+		{condition: And(Cond("user_is_logged_in"), Cond("is_isue_editable")), product: Jira, expectedError: `did you mean "is_issue_editable"`},
+		{condition: Condition{}, product: Jira, expectedError: "without a name"},
+		{condition: Condition{Condition: "user_is_logged_in", And: []Condition{Cond("is_sub_task")}}, product: Jira, expectedError: "cannot also compose"},
+	}
+	for _, testCase := range testCases {
+		err := testCase.condition.Validate(testCase.product)
+		if testCase.expectedError == "" && err != nil {
+			t.Errorf("%+v: Expected no error, but got %v", testCase.condition, err)
+		} else if testCase.expectedError != "" && (err == nil || !strings.Contains(err.Error(), testCase.expectedError)) {
+			t.Errorf("%+v: Expected an error containing %q, but got %v", testCase.condition, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestConditionValue(t *testing.T) {
+	value := Not("is_sub_task").With("a", "b").Value()
+	expected := map[string]interface{}{"condition": "is_sub_task", "invert": true, "params": map[string]interface{}{"a": "b"}}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected the value %v, but got %v", expected, value)
+	}
+}
+
+func TestContextURL(t *testing.T) {
+	built, err := URL("/issue-panel").With("issueKey", "issue.key").With("project", "project.id").Build(Jira)
+	if err != nil || built != "/issue-panel?issueKey={issue.key}&project={project.id}" {
+		t.Errorf("Expected the url with its context parameters, but got %s, %v", built, err)
+	}
+	if _, err = URL("/page?x=1").With("space", "space.ky").Build(Confluence); err == nil || !strings.Contains(err.Error(), `did you mean "space.key"`) {
+		t.Errorf("Expected a suggestion, but got %v", err)
+	}
+	if err = ValidateURL(Jira, "/panel?prop={issue.properties.my-key}&ac={ac.custom}"); err != nil {
+		t.Errorf("Expected property parameters to be valid, but got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	d := map[string]interface{}{
+		"modules": map[string]interface{}{
+			"generalPages": []interface{}{
+				map[string]interface{}{
+					"key":        "page",
+					"url":        "/page?space={space.key}",
+					"conditions": Conditions(Cond("has_space"), Cond("user_is_loged_in")),
+				},
+			},
+			"webPanels": []interface{}{
+				map[string]interface{}{"key": "panel", "url": "/panel?page={page.idd}"},
+			},
+		},
+	}
+	errs := Validate(d, Confluence)
+	if len(errs) != 2 ||
+		!strings.HasPrefix(errs[0].Error(), "modules.generalPages[0].conditions[1]:") ||
+		!strings.HasPrefix(errs[1].Error(), "modules.webPanels[0].url:") {
+		t.Errorf("Expected the errors of the condition and url, but got %v", errs)
+	}
+}
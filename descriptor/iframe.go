@@ -0,0 +1,210 @@
+package descriptor
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Module is a typed descriptor module
+type Module interface {
+	ModuleType() string
+	ModuleKey() string
+	// Entry returns the module as it is added to the descriptor, path is the
+	// route serving the module and empty for modules without one
+	Entry(path string) map[string]interface{}
+}
+
+// Context maps query parameters of a module url to the context parameters of
+// the host product passed in them, e.g. "issueKey": "issue.key"
+type Context map[string]string
+
+// URL returns the url of path passing the context parameters
+func (c Context) URL(path string) ContextURL {
+	u := URL(path)
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		u = u.With(name, c[name])
+	}
+	return u
+}
+
+// Values returns the context parameters passed to a request of the module,
+// keyed by their query parameter
+func (c Context) Values(r *http.Request) map[string]string {
+	query := r.URL.Query()
+	values := make(map[string]string, len(c))
+	for name := range c {
+		if value := query.Get(name); value != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+func name(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return map[string]interface{}{"value": value}
+}
+
+func entry(key string, fields map[string]interface{}) map[string]interface{} {
+	fields["key"] = key
+	for k, v := range fields {
+		if v == nil || v == "" || v == 0 {
+			delete(fields, k)
+		}
+	}
+	return fields
+}
+
+func conditions(list []Condition) interface{} {
+	if len(list) == 0 {
+		return nil
+	}
+	return Conditions(list...)
+}
+
+// Layout is the size of a web panel
+type Layout struct {
+	Width  string `json:"width,omitempty"`
+	Height string `json:"height,omitempty"`
+}
+
+// WebPanel is an iframe shown within a page of the host product
+type WebPanel struct {
+	Key        string
+	Name       string
+	Location   string
+	Weight     int
+	Layout     *Layout
+	Context    Context
+	Conditions []Condition
+}
+
+func (p WebPanel) ModuleType() string { return "webPanels" }
+
+func (p WebPanel) ModuleKey() string { return p.Key }
+
+func (p WebPanel) Entry(path string) map[string]interface{} {
+	fields := map[string]interface{}{
+		"name":       name(p.Name),
+		"url":        p.Context.URL(path).String(),
+		"location":   p.Location,
+		"weight":     p.Weight,
+		"conditions": conditions(p.Conditions),
+	}
+	if p.Layout != nil {
+		fields["layout"] = p.Layout
+	}
+	return entry(p.Key, fields)
+}
+
+const (
+	DialogSmall      = "small"
+	DialogMedium     = "medium"
+	DialogLarge      = "large"
+	DialogXLarge     = "x-large"
+	DialogFullscreen = "fullscreen"
+)
+
+// DialogOptions are the options of a dialog module or of a web item opening
+// an iframe dialog
+type DialogOptions struct {
+	Size   string `json:"size,omitempty"`
+	Width  string `json:"width,omitempty"`
+	Height string `json:"height,omitempty"`
+	// Chrome shows the header and the submit and cancel buttons
+	Chrome bool                   `json:"chrome"`
+	Header map[string]interface{} `json:"header,omitempty"`
+	// SubmitText and CancelText label the buttons of the chrome
+	SubmitText    map[string]interface{} `json:"submitText,omitempty"`
+	CancelText    map[string]interface{} `json:"cancelText,omitempty"`
+	CloseOnEscape *bool                  `json:"closeOnEscape,omitempty"`
+}
+
+// DialogHeader returns the header option of a dialog
+func DialogHeader(value string) map[string]interface{} {
+	return map[string]interface{}{"value": value}
+}
+
+// Dialog is an iframe dialog opened by web items targeting it or by
+// AP.dialog.create({key: ...})
+type Dialog struct {
+	Key     string
+	Options DialogOptions
+	Context Context
+}
+
+func (d Dialog) ModuleType() string { return "dialogs" }
+
+func (d Dialog) ModuleKey() string { return d.Key }
+
+func (d Dialog) Entry(path string) map[string]interface{} {
+	return entry(d.Key, map[string]interface{}{
+		"url":     d.Context.URL(path).String(),
+		"options": d.Options,
+	})
+}
+
+const (
+	TargetPage         = "page"
+	TargetDialog       = "dialog"
+	TargetInlineDialog = "inlinedialog"
+	TargetDialogModule = "dialogmodule"
+)
+
+// WebItem is a link or button of the host product, it opens its url as a
+// page, a dialog or an inline dialog, or the dialog module DialogKey
+type WebItem struct {
+	Key      string
+	Name     string
+	Location string
+	Weight   int
+	Tooltip  string
+	// Target is TargetPage when empty, or TargetDialogModule when DialogKey
+	// is set
+	Target string
+	// TargetOptions are the options of the dialog or inline dialog, e.g.
+	// DialogOptions or {"onHover": true} for inline dialogs
+	TargetOptions interface{}
+	DialogKey     string
+	Context       Context
+	Conditions    []Condition
+}
+
+func (i WebItem) ModuleType() string { return "webItems" }
+
+func (i WebItem) ModuleKey() string { return i.Key }
+
+func (i WebItem) Entry(path string) map[string]interface{} {
+	fields := map[string]interface{}{
+		"name":       name(i.Name),
+		"location":   i.Location,
+		"weight":     i.Weight,
+		"conditions": conditions(i.Conditions),
+	}
+	fields["tooltip"] = name(i.Tooltip)
+	target := map[string]interface{}{"type": i.Target}
+	switch {
+	case i.DialogKey != "":
+		target = map[string]interface{}{"type": TargetDialogModule, "options": map[string]interface{}{"key": i.DialogKey}}
+	case path != "":
+		fields["url"] = i.Context.URL(path).String()
+		fields["context"] = "addon"
+		if i.Target == "" {
+			target["type"] = TargetPage
+		}
+		if i.TargetOptions != nil {
+			target["options"] = i.TargetOptions
+		}
+	}
+	if target["type"] != "" && target["type"] != TargetPage {
+		fields["target"] = target
+	}
+	return entry(i.Key, fields)
+}
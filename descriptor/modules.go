@@ -0,0 +1,85 @@
+package descriptor
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ModuleURL is the url of a descriptor module which the add-on serves
+type ModuleURL struct {
+	Type string
+	Key  string
+	URL  string
+	// Event is the event of webhooks, e.g. "jira:issue_created"
+	Event string
+}
+
+// Method returns the method the product requests the url with, POST for
+// webhooks and GET for pages, panels and dialogs
+func (m ModuleURL) Method() string {
+	if m.Type == "webhooks" {
+		return http.MethodPost
+	}
+	return http.MethodGet
+}
+
+var contextParameter = regexp.MustCompile(`\{[^}]*\}`)
+
+// Path returns the path of the url without the query, context parameters
+// within the path are replaced by a placeholder segment
+func (m ModuleURL) Path() string {
+	path, _, _ := strings.Cut(m.URL, "?")
+	return contextParameter.ReplaceAllString(path, "_")
+}
+
+// ModuleURLs returns the urls of all modules of a descriptor read into a
+// map which are served by the add-on, absolute urls are only included when
+// they are below the baseUrl of the descriptor
+func ModuleURLs(descriptor map[string]interface{}) (urls []ModuleURL) {
+	baseUrl, _ := descriptor["baseUrl"].(string)
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+	add := func(moduleType string, module interface{}) {
+		m, ok := module.(map[string]interface{})
+		if !ok {
+			return
+		}
+		url, _ := m["url"].(string)
+		if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+			if baseUrl == "" || !strings.HasPrefix(url, baseUrl+"/") {
+				return
+			}
+			url = strings.TrimPrefix(url, baseUrl)
+		}
+		if !strings.HasPrefix(url, "/") {
+			return
+		}
+		key, _ := m["key"].(string)
+		event, _ := m["event"].(string)
+		urls = append(urls, ModuleURL{Type: moduleType, Key: key, URL: url, Event: event})
+	}
+	modules, _ := descriptor["modules"].(map[string]interface{})
+	for moduleType, list := range modules {
+		if entries, ok := list.([]interface{}); ok {
+			for _, module := range entries {
+				add(moduleType, module)
+			}
+		} else {
+			add(moduleType, list)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		if urls[i].Type != urls[j].Type {
+			return urls[i].Type < urls[j].Type
+		}
+		if urls[i].Key != urls[j].Key {
+			return urls[i].Key < urls[j].Key
+		}
+		if urls[i].Event != urls[j].Event {
+			return urls[i].Event < urls[j].Event
+		}
+		return urls[i].URL < urls[j].URL
+	})
+	return
+}
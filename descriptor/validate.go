@@ -0,0 +1,69 @@
+package descriptor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Validate checks the conditions and urls of all modules of a descriptor read
+// into a map, as the product would when the add-on is installed
+func Validate(descriptor map[string]interface{}, product Product) (errs []error) {
+	modules, _ := descriptor["modules"].(map[string]interface{})
+	types := make([]string, 0, len(modules))
+	for moduleType := range modules {
+		types = append(types, moduleType)
+	}
+	sort.Strings(types)
+	for _, moduleType := range types {
+		errs = append(errs, validateValue("modules."+moduleType, modules[moduleType], product)...)
+	}
+	return
+}
+
+func validateValue(path string, value interface{}, product Product) (errs []error) {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, item := range v {
+			errs = append(errs, validateValue(fmt.Sprintf("%s[%d]", path, i), item, product)...)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			switch item := v[key].(type) {
+			case string:
+				if key == "url" {
+					if err := ValidateURL(product, item); err != nil {
+						errs = append(errs, fmt.Errorf("%s.url: %w", path, err))
+					}
+				}
+			case []interface{}:
+				if key == "conditions" {
+					errs = append(errs, validateConditions(path+".conditions", item, product)...)
+					continue
+				}
+				errs = append(errs, validateValue(path+"."+key, item, product)...)
+			default:
+				errs = append(errs, validateValue(path+"."+key, item, product)...)
+			}
+		}
+	}
+	return
+}
+
+func validateConditions(path string, conditions []interface{}, product Product) (errs []error) {
+	for i, value := range conditions {
+		data, _ := json.Marshal(value)
+		var c Condition
+		if err := json.Unmarshal(data, &c); err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d]: %w", path, i, err))
+		} else if err = c.Validate(product); err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d]: %w", path, i, err))
+		}
+	}
+	return
+}
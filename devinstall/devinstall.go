@@ -0,0 +1,237 @@
+// Package devinstall installs the add-on on a cloud development site through
+// the REST api of the Universal Plugin Manager (UPM), so that a local dev
+// loop does not need the "Upload app" dialog. It authenticates with the
+// email and an api token of a site administrator and requires development
+// mode to be enabled on the site.
+package devinstall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/devtunnel"
+)
+
+const UPM_PATH = "/rest/plugins/1.0/"
+const UPM_TOKEN_HEADER = "upm-token"
+
+// DefaultTimeout limits how long Install waits for UPM to finish installing
+var DefaultTimeout = 2 * time.Minute
+
+// MinPollInterval is the least time between checks of a pending install
+// when UPM asks for a shorter interval or none
+var MinPollInterval = 500 * time.Millisecond
+
+// Client talks to the UPM of a single site
+type Client struct {
+	SiteURL  string
+	Username string
+	APIToken string
+	Client   *http.Client
+	// PollInterval between checks of a pending install, the interval asked
+	// for by UPM, at least MinPollInterval, is used when zero
+	PollInterval time.Duration
+}
+
+func New(siteURL, username, apiToken string) *Client {
+	return &Client{
+		SiteURL:  strings.TrimSuffix(siteURL, "/"),
+		Username: username,
+		APIToken: apiToken,
+		Client:   http.DefaultClient,
+	}
+}
+
+func (c *Client) request(ctx context.Context, method, path, accept, contentType string, body io.Reader) (*http.Response, error) {
+	if !strings.HasPrefix(path, "http") {
+		path = c.SiteURL + path
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.Username, c.APIToken)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func responseError(resp *http.Response, action string) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s: upm responded %s: %s", action, resp.Status, strings.TrimSpace(string(data)))
+}
+
+// Token returns the upm token required to modify the installed apps
+func (c *Client) Token(ctx context.Context) (string, error) {
+	resp, err := c.request(ctx, http.MethodGet, UPM_PATH+"?os_authType=basic", "application/vnd.atl.plugins.installed+json", "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(resp, "requesting upm token")
+	}
+	token := resp.Header.Get(UPM_TOKEN_HEADER)
+	if token == "" {
+		return "", fmt.Errorf("requesting upm token: no %s header, is %s an administrator?", UPM_TOKEN_HEADER, c.Username)
+	}
+	return token, nil
+}
+
+type pendingTask struct {
+	// Key is set once the task completed and UPM redirected to the app
+	Key       string `json:"key"`
+	PingAfter int    `json:"pingAfter"`
+	Status    struct {
+		Done         bool   `json:"done"`
+		ContentType  string `json:"contentType"`
+		ErrorMessage string `json:"errorMessage"`
+		SubCode      string `json:"subCode"`
+	} `json:"status"`
+	Links struct {
+		Self string `json:"self"`
+	} `json:"links"`
+}
+
+func (t *pendingTask) err() error {
+	if t.Status.ErrorMessage != "" || t.Status.SubCode != "" || strings.Contains(t.Status.ContentType, "err+json") {
+		return fmt.Errorf("upm install failed: %s %s", t.Status.SubCode, t.Status.ErrorMessage)
+	}
+	return nil
+}
+
+// Install installs or updates the app from the descriptor at descriptorURL
+// and waits until UPM finished
+func (c *Client) Install(ctx context.Context, descriptorURL, name string) error {
+	token, err := c.Token(ctx)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(map[string]string{"pluginUri": descriptorURL, "pluginName": name})
+	resp, err := c.request(ctx, http.MethodPost, UPM_PATH+"?token="+url.QueryEscape(token),
+		"application/json", "application/vnd.atl.plugins.install.uri+json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return responseError(resp, "installing "+descriptorURL)
+	}
+	var task pendingTask
+	if err = json.NewDecoder(resp.Body).Decode(&task); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+	for {
+		if err = task.err(); err != nil {
+			return err
+		} else if task.Key != "" || task.Status.Done || task.Links.Self == "" {
+			return nil
+		}
+		interval := c.PollInterval
+		if interval <= 0 {
+			interval = time.Duration(task.PingAfter) * time.Millisecond
+			if interval < MinPollInterval {
+				interval = MinPollInterval
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for upm to install %s: %w", descriptorURL, ctx.Err())
+		case <-time.After(interval):
+		}
+		if task, err = c.pending(ctx, task.Links.Self); err != nil {
+			return err
+		}
+	}
+}
+
+// pending returns the pending install task at self, which has to be on the
+// site: the request carries the credentials of the administrator
+func (c *Client) pending(ctx context.Context, self string) (task pendingTask, err error) {
+	if err = c.onSite(self); err != nil {
+		err = fmt.Errorf("checking pending install: %w", err)
+		return
+	}
+	resp, err := c.request(ctx, http.MethodGet, self, "application/json", "", nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = responseError(resp, "checking pending install")
+		return
+	}
+	err = json.NewDecoder(resp.Body).Decode(&task)
+	return
+}
+
+// onSite checks the link is a path on the site or an absolute url with the
+// scheme and host of the site
+func (c *Client) onSite(link string) error {
+	target, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if target.Scheme == "" && target.Host == "" && strings.HasPrefix(target.Path, "/") {
+		return nil
+	}
+	site, err := url.Parse(c.SiteURL)
+	if err != nil {
+		return err
+	}
+	if target.Scheme != site.Scheme || target.Host != site.Host {
+		return fmt.Errorf("%s is not on the site %s", link, c.SiteURL)
+	}
+	return nil
+}
+
+// Uninstall removes the app with key from the site
+func (c *Client) Uninstall(ctx context.Context, key string) error {
+	resp, err := c.request(ctx, http.MethodDelete, UPM_PATH+url.PathEscape(key)+"-key", "", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(resp, "uninstalling "+key)
+	}
+	return nil
+}
+
+// Setup installs the current descriptor of the addon on the site configured
+// by the DevInstall of its profile, it does nothing when that is not
+// enabled. Call it once the routes are served and after devtunnel.Setup.
+func Setup(ctx context.Context, addon *gonnect.Addon) error {
+	c := addon.Config.DevInstall
+	if c == nil || !c.Enabled {
+		return nil
+	}
+	descriptorURL := devtunnel.DescriptorURL(addon)
+	log.InfoF("installing %s on %s", descriptorURL, c.SiteUrl)
+	if err := New(c.SiteUrl, c.Username, c.ApiToken).Install(ctx, descriptorURL, *addon.Name); err != nil {
+		return err
+	}
+	log.InfoF("installed %s on %s", *addon.Key, c.SiteUrl)
+	return nil
+}
@@ -0,0 +1,183 @@
+package devinstall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestInstall(t *testing.T) {
+	polls := 0
+	var installed map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, token, _ := r.BasicAuth(); user != "admin@example.com" || token != "api-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == UPM_PATH:
+			w.Header().Set(UPM_TOKEN_HEADER, "upm-123")
+			_, _ = w.Write([]byte(`{"plugins":[]}`))
+		case r.Method == http.MethodPost && r.URL.Path == UPM_PATH:
+			if r.URL.Query().Get("token") != "upm-123" || r.Header.Get("Content-Type") != "application/vnd.atl.plugins.install.uri+json" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_ = json.NewDecoder(r.Body).Decode(&installed)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"pingAfter":10,"status":{"done":false},"links":{"self":"/rest/plugins/1.0/pending/1"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == UPM_PATH+"pending/1":
+			if polls++; polls < 2 {
+				_, _ = w.Write([]byte(`{"pingAfter":10,"status":{"done":false},"links":{"self":"/rest/plugins/1.0/pending/1"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"key":"addon","enabled":true}`))
+		case r.Method == http.MethodDelete && r.URL.Path == UPM_PATH+"addon-key":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/", "admin@example.com", "api-token")
+	c.PollInterval = time.Millisecond
+	if err := c.Install(context.Background(), "https://addon.example.com/atlassian-connect.json", "Addon"); err != nil {
+		t.Fatal(err)
+	}
+	if installed["pluginUri"] != "https://addon.example.com/atlassian-connect.json" || polls != 2 {
+		t.Errorf("Expected the descriptor to be installed after 2 polls, but got %v after %d polls", installed, polls)
+	}
+	if err := c.Uninstall(context.Background(), "addon"); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(server.URL, "admin@example.com", "wrong").Install(context.Background(), "https://addon.example.com", "Addon"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected an unauthorized error, but got %v", err)
+	}
+}
+
+func TestInstallFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set(UPM_TOKEN_HEADER, "upm-123")
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"status":{"done":true,"contentType":"application/vnd.atl.plugins.task.install.err+json","subCode":"upm.pluginInstall.error.descriptor.not.from.marketplace"}}`))
+	}))
+	defer server.Close()
+
+	err := New(server.URL, "admin", "token").Install(context.Background(), "https://addon.example.com", "Addon")
+	if err == nil || !strings.Contains(err.Error(), "not.from.marketplace") {
+		t.Errorf("Expected the upm sub code in the error, but got %v", err)
+	}
+}
+
+func TestInstallPolling(t *testing.T) {
+	foreign := 0
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		foreign += 1
+	}))
+	defer other.Close()
+
+	polls := 0
+	var self string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == UPM_PATH:
+			w.Header().Set(UPM_TOKEN_HEADER, "upm-123")
+		case r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"status":{"done":false},"links":{"self":"` + self + `"}}`))
+		default:
+			if polls++; polls < 3 {
+				_, _ = w.Write([]byte(`{"status":{"done":false},"links":{"self":"` + self + `"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"key":"addon"}`))
+		}
+	}))
+	defer server.Close()
+
+	defer func(interval time.Duration) { MinPollInterval = interval }(MinPollInterval)
+	MinPollInterval = 20 * time.Millisecond
+
+	testCases := []struct {
+		self        string
+		valid       bool
+		expectedMin time.Duration
+	}{
+		{self: "/rest/plugins/1.0/pending/1", valid: true, expectedMin: 2 * MinPollInterval},
+		{self: server.URL + "/rest/plugins/1.0/pending/1", valid: true, expectedMin: 2 * MinPollInterval},
+		{self: other.URL + "/rest/plugins/1.0/pending/1"},
+		{self: "//" + strings.TrimPrefix(other.URL, "http://") + "/pending/1"},
+	}
+	for _, testCase := range testCases {
+		self, polls, foreign = testCase.self, 0, 0
+		started := time.Now()
+		err := New(server.URL, "admin@example.com", "api-token").Install(context.Background(), "https://addon.example.com/atlassian-connect.json", "Addon")
+		if (err == nil) != testCase.valid {
+			t.Errorf("Expected the install polling %s to succeed %v, but got %v", testCase.self, testCase.valid, err)
+		}
+		if elapsed := time.Since(started); elapsed < testCase.expectedMin {
+			t.Errorf("Expected polling %s to take at least %v without an interval, but got %v", testCase.self, testCase.expectedMin, elapsed)
+		}
+		if foreign != 0 {
+			t.Errorf("Expected no requests to other hosts for %s, but got %d", testCase.self, foreign)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != UPM_PATH+"addon-key" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"key":"addon","version":"1.0","enabled":true,"modules":[
+			{"key":"addon__main-page","enabled":true},
+			{"key":"old-panel","enabled":true}
+		]}`))
+	}))
+	defer server.Close()
+
+	profile := gonnect.NewProfile("https://addon.example.com", "sqlite3", "", false)
+	addon, err := gonnect.NewCustomAddon(profile, "dev", map[string]interface{}{
+		"key":    "addon",
+		"name":   "Addon",
+		"scopes": []interface{}{"read", "write"},
+		"modules": map[string]interface{}{
+			"generalPages": []interface{}{map[string]interface{}{"key": "main-page"}},
+			"webhooks":     []interface{}{map[string]interface{}{"key": "issue-created"}},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(server.URL, "admin", "token")
+	drift, err := c.Diff(context.Background(), addon, &store.Tenant{ClientKey: "a", BaseURL: server.URL, InstalledScopes: []string{"READ"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift == nil || !drift.NeedsConsent() ||
+		!reflect.DeepEqual(drift.AddedScopes, []string{"WRITE"}) ||
+		!reflect.DeepEqual(drift.AddedModules, []string{"webhooks:issue-created"}) ||
+		!reflect.DeepEqual(drift.RemovedModules, []string{"old-panel"}) {
+		t.Errorf("Expected the added scope and modules and the removed module, but got %+v", drift)
+	}
+
+	*addon.Key = "missing"
+	if _, err = c.Diff(context.Background(), addon, nil); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an add-on which is not installed, but got %v", err)
+	}
+}
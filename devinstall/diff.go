@@ -0,0 +1,88 @@
+package devinstall
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// PluginModule is a module of an app as listed by UPM
+type PluginModule struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Plugin is an installed app as listed by UPM
+type Plugin struct {
+	Key     string         `json:"key"`
+	Version string         `json:"version"`
+	Enabled bool           `json:"enabled"`
+	Modules []PluginModule `json:"modules"`
+}
+
+// Plugin looks up the installed app with key, it returns store.ErrNotFound
+// when the app is not installed
+func (c *Client) Plugin(ctx context.Context, key string) (*Plugin, error) {
+	resp, err := c.request(ctx, http.MethodGet, UPM_PATH+url.PathEscape(key)+"-key", "application/vnd.atl.plugins.plugin+json", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, store.ErrNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp, "looking up "+key)
+	}
+	plugin := &Plugin{}
+	if err = json.NewDecoder(resp.Body).Decode(plugin); err != nil {
+		return nil, err
+	}
+	return plugin, nil
+}
+
+// Diff compares the descriptor served by the addon with the app installed on
+// the site of the client. UPM lists the module keys of the installed version
+// but not its scopes, those are taken from the scopes the tenant granted on
+// install when it is given. Installed modules which the served descriptor
+// does not declare are reported by key only, as UPM omits the module type.
+// The returned drift is nil when nothing changed.
+func (c *Client) Diff(ctx context.Context, addon *gonnect.Addon, tenant *store.Tenant) (*gonnect.ScopeDrift, error) {
+	plugin, err := c.Plugin(ctx, *addon.Key)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]bool, len(plugin.Modules))
+	for _, module := range plugin.Modules {
+		// connect modules may be listed with the app key as prefix
+		installed[strings.TrimPrefix(module.Key, *addon.Key+"__")] = true
+	}
+	var modules []string
+	for _, module := range addon.DescriptorModules() {
+		key := module[strings.Index(module, ":")+1:]
+		if installed[key] {
+			modules = append(modules, module)
+			delete(installed, key)
+		}
+	}
+	for key := range installed {
+		modules = append(modules, key)
+	}
+	sort.Strings(modules)
+
+	scopes := addon.DescriptorScopes()
+	clientKey, baseURL := "", c.SiteURL
+	if tenant != nil {
+		clientKey, baseURL = tenant.ClientKey, tenant.BaseURL
+		if tenant.InstalledScopes != nil {
+			scopes = tenant.InstalledScopes
+		}
+	}
+	return addon.Diff(clientKey, baseURL, scopes, modules), nil
+}
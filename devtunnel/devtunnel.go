@@ -0,0 +1,234 @@
+// Package devtunnel exposes a locally running add-on through a public tunnel
+// for development, like the local dev loop of atlassian-connect-express. It
+// detects or starts an ngrok or cloudflared tunnel, rewrites the base url of
+// the addon and its served descriptor and prints the url to install from.
+package devtunnel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+const (
+	ProviderDetect      = "detect"
+	ProviderNgrok       = "ngrok"
+	ProviderCloudflared = "cloudflared"
+)
+
+// ErrNoTunnel is returned when no public https tunnel could be found
+var ErrNoTunnel = errors.New("no public https tunnel found")
+
+// NgrokAPI is the url of the tunnel list of the local ngrok agent
+var NgrokAPI = "http://127.0.0.1:4040/api/tunnels"
+
+// StartTimeout limits how long a started tunnel may take to report its url
+var StartTimeout = 30 * time.Second
+
+// Output receives the installation instructions printed by Setup
+var Output io.Writer = os.Stdout
+
+var cloudflaredURL = regexp.MustCompile(`https://[a-zA-Z0-9-]+\.trycloudflare\.com`)
+
+// Tunnel is a public url forwarding to the add-on, Close stops the tunnel
+// process if it was started by this package
+type Tunnel struct {
+	URL string
+	cmd *exec.Cmd
+}
+
+func (t *Tunnel) Close() error {
+	if t == nil || t.cmd == nil || t.cmd.Process == nil {
+		return nil
+	}
+	_ = t.cmd.Process.Kill()
+	return t.cmd.Wait()
+}
+
+// Detect returns the public https url of a running ngrok agent forwarding to
+// port, or of any of its tunnels when port is zero
+func Detect(ctx context.Context, port int) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, NgrokAPI, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoTunnel, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: ngrok api responded %s", ErrNoTunnel, resp.Status)
+	}
+	var list struct {
+		Tunnels []struct {
+			PublicURL string `json:"public_url"`
+			Config    struct {
+				Addr string `json:"addr"`
+			} `json:"config"`
+		} `json:"tunnels"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+	for _, tunnel := range list.Tunnels {
+		if !strings.HasPrefix(tunnel.PublicURL, "https://") {
+			continue
+		}
+		if port == 0 || strings.HasSuffix(tunnel.Config.Addr, ":"+strconv.Itoa(port)) {
+			return tunnel.PublicURL, nil
+		}
+	}
+	return "", ErrNoTunnel
+}
+
+// Ngrok starts "ngrok http port" and waits for its public url
+func Ngrok(ctx context.Context, command string, port int) (*Tunnel, error) {
+	if command == "" {
+		command = ProviderNgrok
+	}
+	cmd := exec.Command(command, "http", strconv.Itoa(port), "--log", "stdout")
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	t := &Tunnel{cmd: cmd}
+	ctx, cancel := context.WithTimeout(ctx, StartTimeout)
+	defer cancel()
+	for {
+		url, err := Detect(ctx, port)
+		if err == nil {
+			t.URL = url
+			return t, nil
+		}
+		select {
+		case <-ctx.Done():
+			_ = t.Close()
+			return nil, fmt.Errorf("waiting for ngrok: %w", err)
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// Cloudflared starts a quick tunnel of "cloudflared tunnel --url" and waits
+// for the trycloudflare.com url it logs
+func Cloudflared(ctx context.Context, command string, port int) (*Tunnel, error) {
+	if command == "" {
+		command = ProviderCloudflared
+	}
+	cmd := exec.Command(command, "tunnel", "--url", "http://localhost:"+strconv.Itoa(port))
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	t := &Tunnel{cmd: cmd}
+	found := make(chan string, 1)
+	go func() {
+		url := ScanCloudflared(stderr)
+		found <- url
+		// keep draining so cloudflared does not block on a full pipe
+		_, _ = io.Copy(io.Discard, stderr)
+	}()
+	ctx, cancel := context.WithTimeout(ctx, StartTimeout)
+	defer cancel()
+	select {
+	case url := <-found:
+		if url != "" {
+			t.URL = url
+			return t, nil
+		}
+		_ = t.Close()
+		return nil, fmt.Errorf("%w: cloudflared exited", ErrNoTunnel)
+	case <-ctx.Done():
+		_ = t.Close()
+		return nil, fmt.Errorf("waiting for cloudflared: %w", ctx.Err())
+	}
+}
+
+// ScanCloudflared returns the first quick tunnel url in the cloudflared log,
+// or an empty string when the log ends without one
+func ScanCloudflared(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if url := cloudflaredURL.FindString(scanner.Text()); url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
+// Open returns a tunnel of the provider forwarding to port. ProviderDetect
+// only looks for a running ngrok agent, while ngrok and cloudflared start
+// command, the provider binary from the PATH when empty.
+func Open(ctx context.Context, provider, command string, port int) (*Tunnel, error) {
+	switch provider {
+	case "", ProviderDetect:
+		url, err := Detect(ctx, port)
+		if err != nil {
+			return nil, err
+		}
+		return &Tunnel{URL: url}, nil
+	case ProviderNgrok:
+		if url, err := Detect(ctx, port); err == nil {
+			return &Tunnel{URL: url}, nil
+		}
+		return Ngrok(ctx, command, port)
+	case ProviderCloudflared:
+		return Cloudflared(ctx, command, port)
+	}
+	return nil, fmt.Errorf("unknown tunnel provider %q", provider)
+}
+
+// Apply makes url the base url of the addon: it replaces Config.BaseUrl and
+// every descriptor value starting with the previous base url
+func Apply(addon *gonnect.Addon, url string) {
+	url = strings.TrimSuffix(url, "/")
+	if addon.AddonDescriptor != nil {
+		addon.AddonDescriptor = gonnect.RebaseDescriptor(addon.AddonDescriptor, addon.Config.BaseUrl, url)
+	}
+	addon.Config.BaseUrl = url
+}
+
+// DescriptorURL returns the url the add-on is installed from
+func DescriptorURL(addon *gonnect.Addon) string {
+	return strings.TrimSuffix(addon.Config.BaseUrl, "/") + "/atlassian-connect.json"
+}
+
+// Setup opens the tunnel configured by the DevTunnel of the addon profile,
+// applies it and prints the descriptor url to install the add-on from. It
+// returns a nil tunnel when no dev tunnel is configured. Call it before the
+// routes are served, and Close the tunnel on shutdown.
+func Setup(ctx context.Context, addon *gonnect.Addon) (*Tunnel, error) {
+	c := addon.Config.DevTunnel
+	if c == nil || !c.Enabled {
+		return nil, nil
+	}
+	if addon.Key == nil {
+		return nil, errors.New("dev tunnel requires the key of the add-on")
+	}
+	t, err := Open(ctx, c.Provider, c.Command, c.Port)
+	if err != nil {
+		return nil, err
+	}
+	log.InfoF("serving %s through dev tunnel %s", addon.Config.BaseUrl, t.URL)
+	Apply(addon, t.URL)
+	_, _ = fmt.Fprintf(Output, "\nAdd-on %s is reachable at %s\nInstall it via \"Upload app\" in the Manage apps page of your development site with:\n\n    %s\n\n",
+		*addon.Key, t.URL, DescriptorURL(addon))
+	return t, nil
+}
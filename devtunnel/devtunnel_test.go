@@ -0,0 +1,111 @@
+package devtunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+func TestDetect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"tunnels":[
+			{"public_url":"http://plain.ngrok.io","config":{"addr":"http://localhost:3000"}},
+			{"public_url":"https://other.ngrok.io","config":{"addr":"http://localhost:8080"}},
+			{"public_url":"https://addon.ngrok.io","config":{"addr":"http://localhost:3000"}}
+		]}`))
+	}))
+	defer server.Close()
+	defer func(api string) { NgrokAPI = api }(NgrokAPI)
+	NgrokAPI = server.URL
+
+	testCases := []struct {
+		port          int
+		expected      string
+		expectedError error
+	}{
+		{port: 0, expected: "https://other.ngrok.io"},
+		{port: 3000, expected: "https://addon.ngrok.io"},
+		{port: 4000, expectedError: ErrNoTunnel},
+	}
+	for _, testCase := range testCases {
+		url, err := Detect(context.Background(), testCase.port)
+		if url != testCase.expected || !errors.Is(err, testCase.expectedError) {
+			t.Errorf("port %d: Expected %q, %v, but got %q, %v", testCase.port, testCase.expected, testCase.expectedError, url, err)
+		}
+	}
+}
+
+func TestScanCloudflared(t *testing.T) {
+	log := `2023-01-01T00:00:00Z INF Requesting new quick Tunnel on trycloudflare.com...
+2023-01-01T00:00:01Z INF |  https://fancy-words-here.trycloudflare.com                                              |
+`
+	testCases := []struct {
+		log      string
+		expected string
+	}{
+		{log: log, expected: "https://fancy-words-here.trycloudflare.com"},
+		{log: "ERR failed\n", expected: ""},
+	}
+	for _, testCase := range testCases {
+		if url := ScanCloudflared(strings.NewReader(testCase.log)); url != testCase.expected {
+			t.Errorf("Expected the url %q, but got %q", testCase.expected, url)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"tunnels":[{"public_url":"https://addon.ngrok.io","config":{"addr":"http://localhost:3000"}}]}`))
+	}))
+	defer server.Close()
+	defer func(api string) { NgrokAPI = api }(NgrokAPI)
+	NgrokAPI = server.URL
+	var out bytes.Buffer
+	defer func(w io.Writer) { Output = w }(Output)
+	Output = &out
+
+	profile := gonnect.NewProfile("http://localhost:3000", "sqlite3", "", false)
+	profile.DevTunnel = &gonnect.DevTunnelConfiguration{Enabled: true, Port: 3000}
+	addon, err := gonnect.NewCustomAddon(profile, "dev", map[string]interface{}{
+		"key":     "addon",
+		"name":    "Addon",
+		"baseUrl": "http://localhost:3000",
+		"links":   map[string]interface{}{"self": "http://localhost:3000/atlassian-connect.json"},
+		"icons":   []interface{}{"http://localhost:3000/icon.png", "https://cdn.example.com/icon.png"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel, err := Setup(context.Background(), addon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+
+	if profile.BaseUrl != "https://addon.ngrok.io" || addon.AddonDescriptor["baseUrl"] != "https://addon.ngrok.io" {
+		t.Errorf("Expected the base url to be rewritten, but got %s, %v", profile.BaseUrl, addon.AddonDescriptor["baseUrl"])
+	}
+	if self := addon.AddonDescriptor["links"].(map[string]interface{})["self"]; self != "https://addon.ngrok.io/atlassian-connect.json" {
+		t.Errorf("Expected the nested url to be rewritten, but got %v", self)
+	}
+	icons := addon.AddonDescriptor["icons"].([]interface{})
+	if icons[0] != "https://addon.ngrok.io/icon.png" || icons[1] != "https://cdn.example.com/icon.png" {
+		t.Errorf("Expected only the local icon to be rewritten, but got %v", icons)
+	}
+	if !strings.Contains(out.String(), "https://addon.ngrok.io/atlassian-connect.json") {
+		t.Errorf("Expected the installation url to be printed, but got %s", out.String())
+	}
+
+	addon.Key = nil
+	if tunnel, err := Setup(context.Background(), addon); err == nil || tunnel != nil {
+		t.Errorf("Expected add-ons without a key to fail, but got %v", err)
+	}
+}
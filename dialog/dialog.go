@@ -0,0 +1,85 @@
+// Package dialog drives Connect dialogs from the server: a dialog form is
+// submitted to the add-on, which either closes the dialog passing data to
+// the opener or returns validation errors to show within the dialog
+package dialog
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// AllJS is the Connect JavaScript API loaded by the pages of this package
+const AllJS = "https://connect-cdn.atl-paas.net/all.js"
+
+// Result is the response to a dialog submission
+type Result struct {
+	// Close closes the dialog, Data is passed to the close callback of the
+	// opener
+	Close bool        `json:"close"`
+	Data  interface{} `json:"data,omitempty"`
+	// Errors are validation errors keyed by form field
+	Errors  map[string]string `json:"errors,omitempty"`
+	Message string            `json:"message,omitempty"`
+}
+
+var closeTemplate = template.Must(template.New("close").Parse(`<!DOCTYPE html>
+<html>
+<head><script src="{{.AllJS}}"></script></head>
+<body><script>AP.dialog.close({{.Data}});</script></body>
+</html>
+`))
+
+// Close responds with a page closing the dialog it is loaded in, data is
+// passed to the close callback of the opener
+func Close(w http.ResponseWriter, data interface{}) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return closeTemplate.Execute(w, map[string]interface{}{"AllJS": AllJS, "Data": data})
+}
+
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json") || r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+}
+
+// Respond responds to a dialog submission, submissions of the Script are
+// answered with the result as JSON and plain form posts with the Close page
+// or, when the result does not close the dialog, with 422 and the result
+func Respond(w http.ResponseWriter, r *http.Request, result Result) error {
+	if result.Close && !wantsJSON(r) {
+		return Close(w, result.Data)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !result.Close && len(result.Errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	return json.NewEncoder(w).Encode(result)
+}
+
+// Script binds the submit button of the dialog chrome to the form with the
+// data-dialog-submit attribute: the form is posted with a context JWT and
+// the dialog is closed when the Result says so, otherwise a
+// "dialog-result" event carrying the Result is dispatched on the form to
+// show the errors
+const Script = `(function () {
+  AP.dialog.disableCloseOnSubmit();
+  AP.dialog.getButton("submit").bind(function () {
+    var form = document.querySelector("form[data-dialog-submit]");
+    if (!form) { return; }
+    AP.context.getToken(function (token) {
+      fetch(form.action, {
+        method: "POST",
+        body: new URLSearchParams(new FormData(form)),
+        headers: {"Accept": "application/json", "Authorization": "JWT " + token}
+      }).then(function (response) {
+        return response.json();
+      }).then(function (result) {
+        if (result.close) {
+          AP.dialog.close(result.data);
+        } else {
+          form.dispatchEvent(new CustomEvent("dialog-result", {detail: result}));
+        }
+      });
+    });
+  });
+})();`
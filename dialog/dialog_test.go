@@ -0,0 +1,45 @@
+package dialog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRespond(t *testing.T) {
+	testCases := []struct {
+		name         string
+		accept       string
+		result       Result
+		expectedCode int
+		expectedBody string
+	}{
+		{name: "form post closing", result: Result{Close: true, Data: map[string]string{"title": "</script>"}}, expectedCode: http.StatusOK, expectedBody: `AP.dialog.close({"title":"\u003c/script\u003e"});`},
+		{name: "script closing", accept: "application/json", result: Result{Close: true, Data: "done"}, expectedCode: http.StatusOK, expectedBody: `{"close":true,"data":"done"}`},
+		{name: "validation errors", accept: "application/json", result: Result{Errors: map[string]string{"title": "required"}}, expectedCode: http.StatusUnprocessableEntity, expectedBody: `{"close":false,"errors":{"title":"required"}}`},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/dialog", nil)
+		if testCase.accept != "" {
+			req.Header.Set("Accept", testCase.accept)
+		}
+		rec := httptest.NewRecorder()
+		if err := Respond(rec, req, testCase.result); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s: Expected status %v, but got %v", testCase.name, testCase.expectedCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), testCase.expectedBody) {
+			t.Errorf("%s: Expected body to contain %s, but got %s", testCase.name, testCase.expectedBody, rec.Body.String())
+		}
+		if testCase.accept != "" {
+			var result Result
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Errorf("%s: Expected a JSON result, but got %v", testCase.name, err)
+			}
+		}
+	}
+}
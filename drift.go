@@ -0,0 +1,162 @@
+package gonnect
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// ScopeDrift describes how the served descriptor differs from the descriptor
+// a tenant installed
+type ScopeDrift struct {
+	ClientKey      string   `json:"clientKey"`
+	BaseURL        string   `json:"baseUrl"`
+	AddedScopes    []string `json:"addedScopes,omitempty"`
+	RemovedScopes  []string `json:"removedScopes,omitempty"`
+	AddedModules   []string `json:"addedModules,omitempty"`
+	RemovedModules []string `json:"removedModules,omitempty"`
+}
+
+// NeedsConsent reports whether the tenant has to re-consent because the
+// descriptor requests scopes it did not grant
+func (d ScopeDrift) NeedsConsent() bool {
+	return len(d.AddedScopes) > 0
+}
+
+// DescriptorScopes returns the upper cased, sorted scopes of the descriptor
+func (a *Addon) DescriptorScopes() []string {
+	return descriptorScopes(a.AddonDescriptor)
+}
+
+// ProductScopes returns the scopes of the descriptor of the product, see
+// ProductDescriptor
+func (a *Addon) ProductScopes(product string) []string {
+	return descriptorScopes(a.descriptorOf(product))
+}
+
+func descriptorScopes(descriptor map[string]interface{}) []string {
+	scopes := []string{}
+	if list, ok := descriptor["scopes"].([]interface{}); ok {
+		for _, scope := range list {
+			if s, ok := scope.(string); ok {
+				scopes = append(scopes, strings.ToUpper(s))
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// DescriptorModules returns the sorted "<moduleType>:<key>" identifiers of
+// the descriptor modules
+func (a *Addon) DescriptorModules() []string {
+	return descriptorModules(a.AddonDescriptor)
+}
+
+// ProductModules returns the modules of the descriptor of the product, see
+// ProductDescriptor
+func (a *Addon) ProductModules(product string) []string {
+	return descriptorModules(a.descriptorOf(product))
+}
+
+func descriptorModules(descriptor map[string]interface{}) []string {
+	modules := []string{}
+	addModule := func(moduleType string, module interface{}) {
+		if m, ok := module.(map[string]interface{}); ok {
+			if key, ok := m["key"].(string); ok {
+				modules = append(modules, moduleType+":"+key)
+			}
+		}
+	}
+	if types, ok := descriptor["modules"].(map[string]interface{}); ok {
+		for moduleType, list := range types {
+			if entries, ok := list.([]interface{}); ok {
+				for _, module := range entries {
+					addModule(moduleType, module)
+				}
+			} else {
+				addModule(moduleType, list)
+			}
+		}
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+func difference(a, b []string) (missing []string) {
+	present := make(map[string]bool, len(b))
+	for _, value := range b {
+		present[value] = true
+	}
+	for _, value := range a {
+		if !present[value] {
+			missing = append(missing, value)
+		}
+	}
+	return
+}
+
+// CheckDrift compares the descriptor served to the product of the tenant
+// with the one it installed, it returns nil if they match or nothing was
+// recorded for the tenant, which is the case for installations predating the
+// recording
+func (a *Addon) CheckDrift(tenant *store.Tenant) *ScopeDrift {
+	if tenant.InstalledScopes == nil && tenant.InstalledModules == nil {
+		return nil
+	}
+	return a.diff(tenant.ProductType, tenant.ClientKey, tenant.BaseURL, tenant.InstalledScopes, tenant.InstalledModules)
+}
+
+// Diff compares the served descriptor with the installed scopes and
+// "<moduleType>:<key>" modules of a tenant, it returns nil if they match
+func (a *Addon) Diff(clientKey, baseURL string, installedScopes, installedModules []string) *ScopeDrift {
+	return a.diff("", clientKey, baseURL, installedScopes, installedModules)
+}
+
+func (a *Addon) diff(product, clientKey, baseURL string, installedScopes, installedModules []string) *ScopeDrift {
+	scopes, modules := a.ProductScopes(product), a.ProductModules(product)
+	drift := &ScopeDrift{
+		ClientKey:      clientKey,
+		BaseURL:        baseURL,
+		AddedScopes:    difference(scopes, installedScopes),
+		RemovedScopes:  difference(installedScopes, scopes),
+		AddedModules:   difference(modules, installedModules),
+		RemovedModules: difference(installedModules, modules),
+	}
+	if len(drift.AddedScopes)+len(drift.RemovedScopes)+len(drift.AddedModules)+len(drift.RemovedModules) == 0 {
+		return nil
+	}
+	return drift
+}
+
+// ScanDrift checks all installed tenants for descriptor drift and updates the
+// tenants_descriptor_drift and tenants_needing_consent gauges
+func (a *Addon) ScanDrift(ctx context.Context) (drifts []ScopeDrift, err error) {
+	iterator, ok := a.Store.(store.Iterator)
+	if !ok {
+		return nil, fmt.Errorf("tenant store %T cannot list tenants", a.Store)
+	}
+	var needsConsent int64
+	err = iterator.ForEach(ctx, func(tenant *store.Tenant) error {
+		if !tenant.AddonInstalled {
+			return nil
+		}
+		if drift := a.CheckDrift(tenant); drift != nil {
+			drifts = append(drifts, *drift)
+			if drift.NeedsConsent() {
+				needsConsent++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.Set("tenants_descriptor_drift", int64(len(drifts)))
+	metrics.Set("tenants_needing_consent", needsConsent)
+	return
+}
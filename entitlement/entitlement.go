@@ -0,0 +1,72 @@
+// Package entitlement maps the entitlement tiers of tenants, the app
+// editions purchased through the marketplace, to the features of the add-on
+package entitlement
+
+// Plan orders the tiers of the add-on from the lowest to the highest, each
+// tier includes the features of the tiers below it
+type Plan struct {
+	// Default is the tier of tenants without entitlement details, e.g. those
+	// installed before editions were introduced
+	Default  string
+	tiers    []string
+	features map[string]map[string]bool
+}
+
+func NewPlan() *Plan {
+	return &Plan{features: make(map[string]map[string]bool)}
+}
+
+// Tier adds a tier above the previously added ones with its features
+func (p *Plan) Tier(name string, features ...string) *Plan {
+	set := make(map[string]bool, len(features))
+	if len(p.tiers) > 0 {
+		for feature := range p.features[p.tiers[len(p.tiers)-1]] {
+			set[feature] = true
+		}
+	}
+	for _, feature := range features {
+		set[feature] = true
+	}
+	if p.Default == "" && len(p.tiers) == 0 {
+		p.Default = name
+	}
+	p.tiers = append(p.tiers, name)
+	p.features[name] = set
+	return p
+}
+
+// Tiers returns the tiers from the lowest to the highest
+func (p *Plan) Tiers() []string {
+	return append([]string(nil), p.tiers...)
+}
+
+func (p *Plan) rank(tier string) int {
+	if tier == "" {
+		tier = p.Default
+	}
+	for i, name := range p.tiers {
+		if name == tier {
+			return i
+		}
+	}
+	return -1
+}
+
+// Has reports whether tier includes the feature
+func (p *Plan) Has(tier, feature string) bool {
+	if tier == "" {
+		tier = p.Default
+	}
+	return p.features[tier][feature]
+}
+
+// Allows reports whether tier satisfies required, which is either a tier
+// of the plan that tier has to reach or a feature tier has to include
+func (p *Plan) Allows(tier, required string) bool {
+	if rank := p.rank(tier); rank >= 0 {
+		if requiredRank := p.rank(required); requiredRank >= 0 && required != "" {
+			return rank >= requiredRank
+		}
+	}
+	return p.Has(tier, required)
+}
@@ -0,0 +1,34 @@
+package entitlement
+
+import (
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	plan := NewPlan().
+		Tier("standard", "pages").
+		Tier("premium", "reports").
+		Tier("enterprise", "audit")
+
+	testCases := []struct {
+		tier, required string
+		expected       bool
+	}{
+		{"standard", "standard", true},
+		{"standard", "premium", false},
+		{"premium", "premium", true},
+		{"enterprise", "premium", true},
+		{"", "standard", true},
+		{"", "reports", false},
+		{"premium", "pages", true},
+		{"premium", "audit", false},
+		{"enterprise", "audit", true},
+		{"unknown", "pages", false},
+		{"unknown", "standard", false},
+	}
+	for _, testCase := range testCases {
+		if allowed := plan.Allows(testCase.tier, testCase.required); allowed != testCase.expected {
+			t.Errorf("tier %q requiring %q: Expected %v, but got %v", testCase.tier, testCase.required, testCase.expected, allowed)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package gonnect
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// EnvironmentConfiguration is a distinct app identity served by the same
+// deployment, requests with a matching Host header get a descriptor with its
+// BaseUrl, Key and Name instead of the profile ones
+type EnvironmentConfiguration struct {
+	// Host is matched against the Host header of requests, including the
+	// port if one is given
+	Host    string
+	BaseUrl string
+	Key     string
+	Name    string
+}
+
+// Environment returns the environment configured for host or nil
+func (p *Profile) Environment(host string) *EnvironmentConfiguration {
+	for i, env := range p.Environments {
+		if strings.EqualFold(env.Host, host) {
+			return &p.Environments[i]
+		}
+		if hostname, _, err := net.SplitHostPort(host); err == nil && strings.EqualFold(env.Host, hostname) {
+			return &p.Environments[i]
+		}
+	}
+	return nil
+}
+
+// BaseUrlFor returns the base url of the app identity serving r
+func (a *Addon) BaseUrlFor(r *http.Request) string {
+	if env := a.Config.Environment(r.Host); env != nil && env.BaseUrl != "" {
+		return env.BaseUrl
+	}
+	return a.Config.BaseUrl
+}
+
+// KeyFor returns the app key of the identity serving r
+func (a *Addon) KeyFor(r *http.Request) string {
+	if env := a.Config.Environment(r.Host); env != nil && env.Key != "" {
+		return env.Key
+	}
+	return *a.Key
+}
+
+// TenantKey returns the app key the tenant installed, which is the issuer of
+// the JWTs exchanged with it
+func (a *Addon) TenantKey(tenant *store.Tenant) string {
+	if tenant != nil && tenant.AddonKey != "" {
+		return tenant.AddonKey
+	}
+	return *a.Key
+}
+
+// DescriptorFor returns the descriptor served to r, the one of the product
+// parameter when given, see DescriptorForProduct
+func (a *Addon) DescriptorFor(r *http.Request) map[string]interface{} {
+	return a.DescriptorForProduct(r, r.URL.Query().Get("product"))
+}
+
+// DescriptorForProduct returns the descriptor of the product served to r, a
+// copy with the base url, key and name of the environment when one matches
+// its Host header. Products without their own descriptor get the
+// AddonDescriptor
+func (a *Addon) DescriptorForProduct(r *http.Request, product string) map[string]interface{} {
+	descriptor := a.descriptorOf(product)
+	env := a.Config.Environment(r.Host)
+	if env == nil {
+		return descriptor
+	}
+	if env.BaseUrl != "" {
+		descriptor = RebaseDescriptor(descriptor, a.Config.BaseUrl, env.BaseUrl)
+	} else {
+		descriptor = RebaseDescriptor(descriptor, "", "")
+	}
+	if env.Key != "" {
+		descriptor["key"] = env.Key
+	}
+	if env.Name != "" {
+		descriptor["name"] = env.Name
+	}
+	return descriptor
+}
+
+// RebaseDescriptor returns a deep copy of descriptor with baseUrl set to to
+// and every string value starting with the base url from rebased onto to
+func RebaseDescriptor(descriptor map[string]interface{}, from, to string) map[string]interface{} {
+	from, to = strings.TrimSuffix(from, "/"), strings.TrimSuffix(to, "/")
+	rebased := rebase(descriptor, from, to).(map[string]interface{})
+	if to != "" {
+		rebased["baseUrl"] = to
+	}
+	return rebased
+}
+
+func rebase(value interface{}, from, to string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if from != "" && (v == from || strings.HasPrefix(v, from+"/")) {
+			return to + strings.TrimPrefix(v, from)
+		}
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = rebase(item, from, to)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = rebase(item, from, to)
+		}
+		return copied
+	}
+	return value
+}
@@ -0,0 +1,108 @@
+package gonnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// EphemeralTenantConfiguration treats the tenants like an auth session table
+// complementing the users of the application, rather than as the record of
+// the installations:
+//
+//   - installs are accepted for stored tenants without verifying them
+//     against the stored shared secret, e.g. while migrating deployments
+//     whose stores differ
+//   - tenants expire TTL after they were last seen and are then answered
+//     like unknown tenants, see Addon.UnknownTenantPolicy
+//
+// Signed installs are still verified with the install keys of Atlassian when
+// Profile.SignedInstall is set.
+//
+// Without the ephemeral tenant mode, reinstalls of an installed tenant have to
+// be signed with its stored shared secret, unsigned reinstalls were always
+// accepted before. Tenants which were uninstalled or whose secret was revoked
+// are installed like new ones.
+type EphemeralTenantConfiguration struct {
+	Enabled bool
+	// TTL is the time after the last authenticated request, or the last
+	// install, a tenant expires. Tenants do not expire when zero. The last
+	// request is only recorded once per store.TouchInterval, shorter TTLs are
+	// rejected
+	TTL time.Duration
+}
+
+// Ephemeral reports whether p enables the ephemeral tenant mode
+func (p *Profile) Ephemeral() bool {
+	return p != nil && p.EphemeralTenants != nil && p.EphemeralTenants.Enabled
+}
+
+// ValidateEphemeralTenants checks the TTL of the ephemeral tenant mode is not
+// shorter than store.TouchInterval, tenants in use would expire between the
+// writes of their LastSeenAt
+func (p *Profile) ValidateEphemeralTenants() error {
+	if !p.Ephemeral() || p.EphemeralTenants.TTL <= 0 {
+		return nil
+	}
+	if p.EphemeralTenants.TTL < store.TouchInterval {
+		return fmt.Errorf("the ephemeral tenant TTL %v is shorter than the touch interval %v", p.EphemeralTenants.TTL, store.TouchInterval)
+	}
+	return nil
+}
+
+// TenantExpired reports whether tenant expired at now in the ephemeral tenant
+// mode of p. Tenants are not expired within store.TouchInterval of when they
+// were last seen, even with a shorter TTL
+func (p *Profile) TenantExpired(tenant *store.Tenant, now time.Time) bool {
+	if !p.Ephemeral() || p.EphemeralTenants.TTL <= 0 {
+		return false
+	}
+	ttl := p.EphemeralTenants.TTL
+	if ttl < store.TouchInterval {
+		ttl = store.TouchInterval
+	}
+	seen := tenant.UpdatedAt
+	if tenant.LastSeenAt != nil && tenant.LastSeenAt.After(seen) {
+		seen = *tenant.LastSeenAt
+	}
+	return !seen.IsZero() && now.Sub(seen) > ttl
+}
+
+// PurgeExpiredTenants deletes the expired tenants of the ephemeral tenant
+// mode and returns how many were deleted
+func (a *Addon) PurgeExpiredTenants(ctx context.Context) (purged int, err error) {
+	if !a.Config.Ephemeral() {
+		return 0, errors.New("ephemeral tenants are not enabled")
+	}
+	iterator, ok := a.Store.(store.Iterator)
+	if !ok {
+		return 0, fmt.Errorf("tenant store %T cannot list tenants", a.Store)
+	}
+	now := time.Now()
+	var expired []string
+	err = iterator.ForEach(ctx, func(tenant *store.Tenant) error {
+		if a.Config.TenantExpired(tenant, now) {
+			expired = append(expired, tenant.ClientKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	for _, clientKey := range expired {
+		if err = a.Store.Delete(clientKey); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return
+		}
+		purged++
+	}
+	err = nil
+	if purged > 0 {
+		log.InfoF("purged %d expired ephemeral tenants", purged)
+	}
+	return
+}
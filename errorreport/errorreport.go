@@ -0,0 +1,67 @@
+// Package errorreport forwards unexpected failures, such as 5xx responses,
+// recovered panics and failed background jobs, to a single ErrorReporter so
+// error aggregation services can be integrated in one place
+package errorreport
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Kind is the path an error was reported from
+type Kind string
+
+const (
+	KindResponse   Kind = "response"
+	KindPanic      Kind = "panic"
+	KindBackground Kind = "background"
+	// KindLifecycle are failed lifecycle callbacks which did not fail the
+	// lifecycle request
+	KindLifecycle Kind = "lifecycle"
+)
+
+// Event is a single reported error with the tenant context it occurred in
+type Event struct {
+	Time      time.Time
+	Kind      Kind
+	Err       error
+	ClientKey string
+	// Request is set for errors reported while serving a request
+	Request *http.Request
+	// Stack is the goroutine stack of recovered panics
+	Stack  []byte
+	Fields map[string]string
+}
+
+// ErrorReporter receives the reported errors
+type ErrorReporter interface {
+	Report(ctx context.Context, event Event)
+}
+
+// ErrorReporterFunc adapts a function to the ErrorReporter interface
+type ErrorReporterFunc func(ctx context.Context, event Event)
+
+func (f ErrorReporterFunc) Report(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+// NopReporter discards all reported errors
+type NopReporter struct{}
+
+func (NopReporter) Report(ctx context.Context, event Event) {}
+
+// DefaultReporter receives all errors passed to Report
+var DefaultReporter ErrorReporter = NopReporter{}
+
+// Report timestamps the event, fills in the clientKey of the request context
+// when it is missing and passes it to the DefaultReporter
+func Report(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.ClientKey == "" && ctx != nil {
+		event.ClientKey, _ = ctx.Value("clientKey").(string)
+	}
+	DefaultReporter.Report(ctx, event)
+}
@@ -0,0 +1,27 @@
+package errorreport
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	var reported []Event
+	defer func(reporter ErrorReporter) { DefaultReporter = reporter }(DefaultReporter)
+	DefaultReporter = ErrorReporterFunc(func(ctx context.Context, event Event) {
+		reported = append(reported, event)
+	})
+
+	ctx := context.WithValue(context.Background(), "clientKey", "key")
+	Report(ctx, Event{Kind: KindBackground, Err: errors.New("failed")})
+	if len(reported) != 1 {
+		t.Fatalf("Expected %v reported errors, but got %v", 1, len(reported))
+	}
+	if reported[0].Time.IsZero() {
+		t.Errorf("Expected reported error to be timestamped")
+	}
+	if reported[0].ClientKey != "key" {
+		t.Errorf("Expected clientKey to be %q, but got %q", "key", reported[0].ClientKey)
+	}
+}
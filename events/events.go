@@ -0,0 +1,135 @@
+// Package events is a lightweight in-process event bus for the internal
+// events of gonnect, such as lifecycle changes, tenant store writes and
+// authentication failures. Bridges forward the events to external brokers so
+// larger applications can consume them asynchronously.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+const (
+	TopicInstalled      = "lifecycle.installed"
+	TopicUninstalled    = "lifecycle.uninstalled"
+	TopicSecretRotated  = "lifecycle.secret_rotated"
+	TopicBaseURLChanged = "lifecycle.base_url_changed"
+	TopicTenantSaved    = "tenant.saved"
+	TopicTenantDeleted  = "tenant.deleted"
+	TopicSecretRevoked  = "tenant.secret_revoked"
+	TopicAuthFailure    = "auth.failure"
+)
+
+// Event is a single published event, secrets are never included
+type Event struct {
+	Topic     string            `json:"topic"`
+	Time      time.Time         `json:"time"`
+	ClientKey string            `json:"clientKey,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Data      interface{}       `json:"data,omitempty"`
+}
+
+// Handler receives the events of a subscription, it is called synchronously
+// by Publish and should hand off slow work
+type Handler func(ctx context.Context, event Event)
+
+type subscription struct {
+	id      uint64
+	pattern string
+	handler Handler
+}
+
+// matches reports whether topic matches the subscription pattern, which is
+// either "*" for all topics, a prefix ending in ".*" or an exact topic
+func (s subscription) matches(topic string) bool {
+	if s.pattern == "*" || s.pattern == topic {
+		return true
+	}
+	return strings.HasSuffix(s.pattern, ".*") && strings.HasPrefix(topic, s.pattern[:len(s.pattern)-1])
+}
+
+// Bus delivers published events to the matching subscribers
+type Bus struct {
+	mutex         sync.RWMutex
+	nextId        uint64
+	subscriptions []subscription
+}
+
+// Subscribe registers handler for the topics matching pattern and returns a
+// function removing the subscription again
+func (b *Bus) Subscribe(pattern string, handler Handler) (unsubscribe func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextId++
+	id := b.nextId
+	b.subscriptions = append(b.subscriptions, subscription{id: id, pattern: pattern, handler: handler})
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		for i, s := range b.subscriptions {
+			if s.id == id {
+				b.subscriptions = append(b.subscriptions[:i:i], b.subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish timestamps the event and passes it to all matching subscribers
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	b.mutex.RLock()
+	var handlers []Handler
+	for _, s := range b.subscriptions {
+		if s.matches(event.Topic) {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	b.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(ctx, event)
+	}
+}
+
+// DefaultBus is the bus used by gonnect and by the package level functions
+var DefaultBus = &Bus{}
+
+// Subscribe registers handler on the DefaultBus
+func Subscribe(pattern string, handler Handler) (unsubscribe func()) {
+	return DefaultBus.Subscribe(pattern, handler)
+}
+
+// Publish publishes the event on the DefaultBus
+func Publish(ctx context.Context, event Event) {
+	DefaultBus.Publish(ctx, event)
+}
+
+// Publisher sends raw messages to an external broker, *nats.Conn implements
+// it directly while Kafka producers need a small adapter. Publish should not
+// block on the broker as it is called while serving requests.
+type Publisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// Bridge forwards the events matching pattern from bus to publisher as JSON,
+// the subject is the topic with prefix prepended. It returns a function
+// removing the bridge again.
+func Bridge(bus *Bus, pattern, prefix string, publisher Publisher) (unsubscribe func()) {
+	return bus.Subscribe(pattern, func(ctx context.Context, event Event) {
+		data, err := json.Marshal(event)
+		if err != nil {
+			log.ErrorF("error encoding event %s: %v", event.Topic, err)
+			return
+		}
+		if err = publisher.Publish(prefix+event.Topic, data); err != nil {
+			log.ErrorF("error forwarding event %s: %v", event.Topic, err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	bus := &Bus{}
+	var all, tenant, exact []string
+	bus.Subscribe("*", func(ctx context.Context, event Event) { all = append(all, event.Topic) })
+	unsubscribe := bus.Subscribe("tenant.*", func(ctx context.Context, event Event) { tenant = append(tenant, event.Topic) })
+	bus.Subscribe(TopicInstalled, func(ctx context.Context, event Event) { exact = append(exact, event.Topic) })
+
+	for _, topic := range []string{TopicInstalled, TopicTenantSaved, TopicAuthFailure} {
+		bus.Publish(context.Background(), Event{Topic: topic})
+	}
+	unsubscribe()
+	bus.Publish(context.Background(), Event{Topic: TopicTenantDeleted})
+
+	if len(all) != 4 {
+		t.Errorf("Expected %v events for *, but got %v", 4, all)
+	}
+	if len(tenant) != 1 || tenant[0] != TopicTenantSaved {
+		t.Errorf("Expected only %s for tenant.*, but got %v", TopicTenantSaved, tenant)
+	}
+	if len(exact) != 1 || exact[0] != TopicInstalled {
+		t.Errorf("Expected only %s for %s, but got %v", TopicInstalled, TopicInstalled, exact)
+	}
+}
+
+type publisherFunc func(subject string, data []byte) error
+
+func (f publisherFunc) Publish(subject string, data []byte) error {
+	return f(subject, data)
+}
+
+func TestBridge(t *testing.T) {
+	bus := &Bus{}
+	var subjects []string
+	Bridge(bus, "auth.*", "gonnect.", publisherFunc(func(subject string, data []byte) error {
+		var event Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Error(err)
+		}
+		if event.Time.IsZero() {
+			t.Errorf("Expected forwarded event to be timestamped")
+		}
+		subjects = append(subjects, subject)
+		return nil
+	}))
+	bus.Publish(context.Background(), Event{Topic: TopicAuthFailure})
+	bus.Publish(context.Background(), Event{Topic: TopicTenantSaved})
+	if len(subjects) != 1 || subjects[0] != "gonnect."+TopicAuthFailure {
+		t.Errorf("Expected subjects to be %v, but got %v", []string{"gonnect." + TopicAuthFailure}, subjects)
+	}
+}
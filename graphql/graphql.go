@@ -0,0 +1,199 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+)
+
+const GATEWAY_PATH = "/gateway/api/graphql"
+
+// Client calls the Atlassian GraphQL gateway of a tenant site, either as the
+// addon or on behalf of a user
+type Client struct {
+	host      *hostrequest.HostRequest
+	accountId string
+}
+
+// New returns a Client authenticating as the addon
+func New(host *hostrequest.HostRequest) *Client {
+	return &Client{host: host}
+}
+
+// AsUser returns a copy of the Client which authenticates on behalf of the
+// given user account, this requires the ACT_AS_USER scope
+func (c *Client) AsUser(accountId string) *Client {
+	return &Client{host: c.host, accountId: accountId}
+}
+
+// Request is a GraphQL query or mutation with its variables
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// NewRequest is a small helper for building a Request from a query and
+// alternating variable name and value pairs
+func NewRequest(query string, variables ...interface{}) Request {
+	request := Request{Query: query}
+	if len(variables) > 0 {
+		request.Variables = make(map[string]interface{}, len(variables)/2)
+		for idx := 0; idx+1 < len(variables); idx += 2 {
+			request.Variables[fmt.Sprint(variables[idx])] = variables[idx+1]
+		}
+	}
+	return request
+}
+
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is a single error reported by the gateway
+type Error struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e Error) Error() string {
+	if len(e.Path) > 0 {
+		parts := make([]string, len(e.Path))
+		for idx, p := range e.Path {
+			parts[idx] = fmt.Sprint(p)
+		}
+		return strings.Join(parts, ".") + ": " + e.Message
+	}
+	return e.Message
+}
+
+// StatusCode returns the http status code the gateway attributed to this
+// error, or zero if not present
+func (e Error) StatusCode() int {
+	if code, ok := e.Extensions["statusCode"].(float64); ok {
+		return int(code)
+	}
+	return 0
+}
+
+// ErrorType returns the gateway classification of this error, for example
+// "UNAUTHORIZED" or "NOT_FOUND", or an empty string if not present
+func (e Error) ErrorType() string {
+	for _, key := range []string{"errorType", "classification"} {
+		if value, ok := e.Extensions[key].(string); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// Errors is returned when the gateway responds with a non-empty errors list,
+// the data of a partial response is still decoded
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for idx, err := range e {
+		messages[idx] = err.Error()
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+type response struct {
+	Data       json.RawMessage        `json:"data"`
+	Errors     Errors                 `json:"errors,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Do sends the request to the gateway and decodes the data field into out,
+// if out is not nil
+func (c *Client) Do(ctx context.Context, request Request, out interface{}) (err error) {
+	var body []byte
+	if body, err = json.Marshal(request); err != nil {
+		return
+	}
+
+	var req *http.Request
+	if req, err = c.newRequest(ctx, body); err != nil {
+		return
+	}
+
+	var res *http.Response
+	if c.accountId != "" {
+		if req, err = c.host.AsUser(req, c.accountId); err != nil {
+			return
+		}
+		res, err = c.host.Send(req)
+	} else {
+		res, err = c.host.Do(req)
+	}
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	var data []byte
+	if data, err = ioutil.ReadAll(res.Body); err != nil {
+		return
+	}
+
+	decoded := response{}
+	if e := json.Unmarshal(data, &decoded); e != nil || (decoded.Data == nil && len(decoded.Errors) == 0) {
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return &hostrequest.Error{
+				Method:     req.Method,
+				URL:        req.URL.String(),
+				StatusCode: res.StatusCode,
+				Status:     res.Status,
+				Header:     res.Header,
+				Body:       data,
+			}
+		}
+		if e != nil {
+			return e
+		}
+	}
+
+	if out != nil && len(decoded.Data) > 0 && string(decoded.Data) != "null" {
+		if err = json.Unmarshal(decoded.Data, out); err != nil {
+			return
+		}
+	}
+
+	if len(decoded.Errors) > 0 {
+		return decoded.Errors
+	}
+	return
+}
+
+// Query is a shorthand for Do(ctx, NewRequest(query, variables...), out)
+func (c *Client) Query(ctx context.Context, query string, out interface{}, variables ...interface{}) error {
+	return c.Do(ctx, NewRequest(query, variables...), out)
+}
+
+// newRequest builds the gateway request, the gateway lives at the root of the
+// site and not below the product context path (e.g. /wiki)
+func (c *Client) newRequest(ctx context.Context, body []byte) (req *http.Request, err error) {
+	var baseUrl *url.URL
+	if baseUrl, err = url.Parse(c.host.Tenant().BaseURL); err != nil {
+		return
+	}
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, GATEWAY_PATH, bytes.NewReader(body)); err != nil {
+		return
+	}
+	req.URL.Scheme = baseUrl.Scheme
+	req.URL.Host = baseUrl.Host
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	return
+}
@@ -0,0 +1,79 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestDo(t *testing.T) {
+	testCases := []struct {
+		status      int
+		body        string
+		expectName  string
+		expectType  string
+		expectError bool
+	}{
+		{
+			status:     200,
+			body:       `{"data":{"me":{"name":"test"}}}`,
+			expectName: "test",
+		},
+		{
+			status:      200,
+			body:        `{"data":{"me":null},"errors":[{"message":"denied","path":["me"],"extensions":{"errorType":"UNAUTHORIZED","statusCode":401}}]}`,
+			expectType:  "UNAUTHORIZED",
+			expectError: true,
+		},
+		{
+			status:      502,
+			body:        `bad gateway`,
+			expectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != GATEWAY_PATH {
+				t.Errorf("Expected path to be %s, but got %s", GATEWAY_PATH, r.URL.Path)
+			}
+			w.WriteHeader(testCase.status)
+			_, _ = w.Write([]byte(testCase.body))
+		}))
+
+		key := "com.example.test"
+		host := hostrequest.New(&gonnect.Addon{Key: &key}, &store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: server.URL + "/wiki"})
+
+		out := struct {
+			Me *struct {
+				Name string `json:"name"`
+			} `json:"me"`
+		}{}
+		err := New(host).Query(context.Background(), `query { me { name } }`, &out)
+		server.Close()
+
+		if err != nil {
+			if !testCase.expectError {
+				t.Error(err)
+			}
+			var gqlErrors Errors
+			if testCase.expectType != "" && (!errors.As(err, &gqlErrors) || gqlErrors[0].ErrorType() != testCase.expectType) {
+				t.Errorf("Expected error type to be %s, but got %v", testCase.expectType, err)
+			}
+			continue
+		} else if testCase.expectError {
+			t.Error("Expected error, but got no error")
+			continue
+		}
+
+		if out.Me == nil || out.Me.Name != testCase.expectName {
+			t.Errorf("Expected name to be %s, but got %+v", testCase.expectName, out.Me)
+		}
+	}
+}
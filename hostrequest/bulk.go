@@ -0,0 +1,207 @@
+package hostrequest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+const (
+	DefaultBulkConcurrency = 4
+	DefaultBulkMaxRetries  = 5
+	DefaultBulkBackoff     = time.Second
+)
+
+type BulkOptions struct {
+	// Concurrency is the number of workers calling the host concurrently
+	Concurrency int
+	// MaxRetries is the number of times a rate limited call is retried
+	MaxRetries int
+	// Backoff is the initial delay after a rate limited call without a
+	// Retry-After header, it doubles with every consecutive retry
+	Backoff time.Duration
+	// StopOnError cancels the remaining operations after the first failure
+	StopOnError bool
+}
+
+// BulkError is the failure of a single bulk operation
+type BulkError struct {
+	Index int
+	Err   error
+}
+
+func (e BulkError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e BulkError) Unwrap() error {
+	return e.Err
+}
+
+// BulkErrors aggregates all failed bulk operations, ordered by index
+type BulkErrors []BulkError
+
+func (e BulkErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	messages := make([]string, 0, 3)
+	for idx := 0; idx < len(e) && idx < 3; idx++ {
+		messages = append(messages, e[idx].Error())
+	}
+	if len(e) > 3 {
+		messages = append(messages, fmt.Sprintf("and %d more", len(e)-3))
+	}
+	return fmt.Sprintf("%d bulk operations failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+// RetryDelay reports whether err is a rate limited (429) or unavailable (503)
+// host response and the delay requested by its Retry-After header, if any
+func RetryDelay(err error) (delay time.Duration, retry bool) {
+	var hostErr *Error
+	if !errors.As(err, &hostErr) {
+		return
+	}
+	if hostErr.StatusCode != http.StatusTooManyRequests && hostErr.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+	retry = true
+	if seconds, e := strconv.Atoi(hostErr.Header.Get("Retry-After")); e == nil && seconds > 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	return
+}
+
+// throttle pauses all workers of a bulk run while the host is rate limiting
+type throttle struct {
+	sync.Mutex
+	until time.Time
+}
+
+func (t *throttle) pause(d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	if until := time.Now().Add(d); until.After(t.until) {
+		t.until = until
+	}
+}
+
+func (t *throttle) wait(ctx context.Context) error {
+	t.Lock()
+	d := time.Until(t.until)
+	t.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// Bulk calls fn for every index in [0, count) using a bounded pool of workers.
+// Rate limited calls are retried and pause all workers for the requested
+// delay. All failures are returned as BulkErrors, joined with the error of
+// ctx when it is done before every index was started.
+func (h HostRequest) Bulk(ctx context.Context, count int, fn func(ctx context.Context, h HostRequest, idx int) error, opts BulkOptions) error {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultBulkConcurrency
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = DefaultBulkMaxRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBulkBackoff
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		failures BulkErrors
+		gate     throttle
+	)
+	indexes := make(chan int)
+
+	worker := func() {
+		defer wg.Done()
+		for idx := range indexes {
+			err := h.bulkCall(ctx, &gate, fn, idx, opts)
+			if err == nil {
+				continue
+			}
+			mutex.Lock()
+			failures = append(failures, BulkError{Index: idx, Err: err})
+			mutex.Unlock()
+			if opts.StopOnError {
+				cancel()
+			}
+		}
+	}
+
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go worker()
+	}
+
+	fed := 0
+feed:
+	for ; fed < count && ctx.Err() == nil; fed++ {
+		select {
+		case <-ctx.Done():
+			break feed
+		case indexes <- fed:
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	var canceled error
+	if fed < count {
+		canceled = parent.Err()
+	}
+	if len(failures) == 0 {
+		return canceled
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Index < failures[j].Index })
+	if canceled != nil {
+		return errors.Join(failures, canceled)
+	}
+	return failures
+}
+
+func (h HostRequest) bulkCall(ctx context.Context, gate *throttle, fn func(ctx context.Context, h HostRequest, idx int) error, idx int, opts BulkOptions) (err error) {
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		if err = gate.wait(ctx); err != nil {
+			return
+		}
+		if err = fn(ctx, h, idx); err == nil {
+			return
+		}
+		delay, retry := RetryDelay(err)
+		if !retry || attempt >= opts.MaxRetries {
+			return
+		}
+		if delay <= 0 {
+			delay = backoff
+			backoff *= 2
+		}
+		log.DebugF("bulk operation %d for %s rate limited, pausing for %v", idx, h.ClientKey, delay)
+		gate.pause(delay)
+		DefaultRateLimits.Backoff(h.ClientKey, delay)
+	}
+}
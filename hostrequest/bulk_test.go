@@ -0,0 +1,70 @@
+package hostrequest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulk(t *testing.T) {
+	var calls, active, maxActive int32
+	rateLimited := int32(0)
+
+	fn := func(ctx context.Context, h HostRequest, idx int) error {
+		atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		switch {
+		case idx == 3 && atomic.CompareAndSwapInt32(&rateLimited, 0, 1):
+			return &Error{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		case idx == 7 || idx == 2:
+			return errors.New("failed")
+		}
+		return nil
+	}
+
+	err := HostRequest{ClientKey: "client-key"}.Bulk(context.Background(), 20, fn, BulkOptions{Concurrency: 3, Backoff: time.Millisecond})
+
+	var failures BulkErrors
+	if !errors.As(err, &failures) {
+		t.Fatalf("Expected BulkErrors, but got %v", err)
+	}
+	if len(failures) != 2 || failures[0].Index != 2 || failures[1].Index != 7 {
+		t.Errorf("Expected operations 2 and 7 to fail, but got %v", failures)
+	}
+	if calls != 21 {
+		t.Errorf("Expected 21 calls including one retry, but got %d", calls)
+	}
+	if maxActive > 3 {
+		t.Errorf("Expected at most 3 concurrent calls, but got %d", maxActive)
+	}
+}
+
+func TestBulkCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int32
+	fn := func(ctx context.Context, h HostRequest, idx int) error {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			cancel()
+		}
+		return nil
+	}
+
+	err := HostRequest{ClientKey: "client-key"}.Bulk(ctx, 20, fn, BulkOptions{Concurrency: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancellation of the context, but got %v", err)
+	}
+	if calls >= 20 {
+		t.Errorf("Expected the remaining operations to be skipped, but got %d calls", calls)
+	}
+}
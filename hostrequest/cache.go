@@ -0,0 +1,171 @@
+package hostrequest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// DefaultResponseCache is used by all HostRequests which do not have their
+// own Cache configured, caching is disabled while this is nil
+var DefaultResponseCache ResponseCache
+
+// ResponseCache stores host product responses, keys are already scoped to
+// the tenant
+type ResponseCache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, response *CachedResponse)
+}
+
+type CachedResponse struct {
+	StatusCode   int
+	Header       http.Header
+	Body         []byte
+	ETag         string
+	LastModified string
+	Expires      time.Time
+}
+
+// Fresh reports whether the response can be served without revalidation
+func (c *CachedResponse) Fresh() bool {
+	return time.Now().Before(c.Expires)
+}
+
+func (c *CachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(c.StatusCode) + " " + http.StatusText(c.StatusCode),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// MemoryCache is an in-process ResponseCache, entries are evicted after
+// retention regardless of their freshness
+type MemoryCache struct {
+	cache *cache.Cache
+}
+
+func NewMemoryCache(retention, cleanupInterval time.Duration) *MemoryCache {
+	return &MemoryCache{cache: cache.New(retention, cleanupInterval)}
+}
+
+func (m *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	if v, ok := m.cache.Get(key); ok {
+		return v.(*CachedResponse), true
+	}
+	return nil, false
+}
+
+func (m *MemoryCache) Set(key string, response *CachedResponse) {
+	m.cache.SetDefault(key, response)
+}
+
+// ItemCount returns the number of cached responses, including expired ones
+// which have not been cleaned up yet
+func (m *MemoryCache) ItemCount() int {
+	return m.cache.ItemCount()
+}
+
+func (h HostRequest) responseCache() ResponseCache {
+	if h.Cache != nil {
+		return h.Cache
+	}
+	return DefaultResponseCache
+}
+
+func cacheKey(clientKey string, req *http.Request) string {
+	return clientKey + " " + req.Method + " " + req.URL.String()
+}
+
+// parseCacheControl returns whether the response may be stored and for how
+// long it is fresh
+func parseCacheControl(header http.Header) (store bool, maxAge time.Duration) {
+	store = true
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store":
+			return false, 0
+		case directive == "no-cache":
+			maxAge = 0
+			return
+		case strings.HasPrefix(directive, "max-age="):
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && seconds > 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return
+}
+
+// doCached serves GET requests from the cache when fresh, revalidates stale
+// entries with conditional requests and stores cacheable responses
+func (h HostRequest) doCached(c ResponseCache, req *http.Request) (*http.Response, error) {
+	key := cacheKey(h.ClientKey, req)
+
+	cached, found := c.Get(key)
+	if found && cached.Fresh() {
+		return cached.response(req), nil
+	}
+	if found {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	res, err := h.Send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if found && res.StatusCode == http.StatusNotModified {
+		_ = res.Body.Close()
+		_, maxAge := parseCacheControl(res.Header)
+		// the entry may be read concurrently, the revalidated one replaces it
+		revalidated := *cached
+		revalidated.Expires = time.Now().Add(maxAge)
+		c.Set(key, &revalidated)
+		return revalidated.response(req), nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return res, nil
+	}
+
+	store, maxAge := parseCacheControl(res.Header)
+	etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+	if !store || (maxAge == 0 && etag == "" && lastModified == "") {
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	cached = &CachedResponse{
+		StatusCode:   res.StatusCode,
+		Header:       res.Header.Clone(),
+		Body:         body,
+		ETag:         etag,
+		LastModified: lastModified,
+		Expires:      time.Now().Add(maxAge),
+	}
+	c.Set(key, cached)
+	return cached.response(req), nil
+}
@@ -0,0 +1,75 @@
+package hostrequest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestDoCached(t *testing.T) {
+	hits, revalidated := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits += 1
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				revalidated += 1
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	defer server.Close()
+
+	key := "com.example.test"
+	host := New(&gonnect.Addon{Key: &key}, &store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: server.URL})
+	host.Cache = NewMemoryCache(time.Minute, time.Minute)
+
+	testCases := []struct {
+		path        string
+		hits        int
+		revalidated int
+	}{
+		{path: "/max-age", hits: 1, revalidated: 0},
+		{path: "/etag", hits: 3, revalidated: 2},
+		{path: "/no-store", hits: 3, revalidated: 0},
+	}
+
+	for _, testCase := range testCases {
+		hits, revalidated = 0, 0
+		for i := 0; i < 3; i++ {
+			out := map[string]string{}
+			if err := host.DoJSON(context.Background(), http.MethodGet, testCase.path, nil, nil, &out); err != nil {
+				t.Error(err)
+			} else if out["path"] != testCase.path {
+				t.Errorf("Expected path to be %s, but got %s", testCase.path, out["path"])
+			}
+		}
+		if hits != testCase.hits || revalidated != testCase.revalidated {
+			t.Errorf("Expected %s to hit the host %d times with %d revalidations, but got %d and %d",
+				testCase.path, testCase.hits, testCase.revalidated, hits, revalidated)
+		}
+	}
+	// revalidations replace the entry instead of changing the one which may
+	// be read concurrently
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/etag", nil)
+	entry, _ := host.Cache.Get(cacheKey(host.ClientKey, req))
+	expires := entry.Expires
+	if err := host.DoJSON(context.Background(), http.MethodGet, "/etag", nil, nil, &map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if revalidatedEntry, _ := host.Cache.Get(cacheKey(host.ClientKey, req)); revalidatedEntry == entry || !entry.Expires.Equal(expires) {
+		t.Errorf("Expected the revalidation to replace the cached entry, but it was modified")
+	}
+}
@@ -0,0 +1,91 @@
+package hostrequest
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
+)
+
+// AuditHostCall is the audit event of a request sent to the host product,
+// see gonnect.HostCallAuditConfiguration
+const AuditHostCall = "host.call"
+
+// actingUserContextKey holds the account id of the requests made by AsUser
+const actingUserContextKey = "hostRequestActingUser"
+
+// Send sends a request signed with AsAddon or AsUser to the host product,
+// bypassing the response cache. The response is tracked by DefaultRateLimits
+// and the call recorded in the audit log when configured
+func (h HostRequest) Send(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := h.client().Do(req)
+	h.recordCall(req, res, err, time.Since(start))
+	if err == nil {
+		DefaultRateLimits.Observe(h.ClientKey, res)
+	}
+	return res, err
+}
+
+// recordCall records a sampled request in the audit log, failed requests
+// are always recorded
+func (h HostRequest) recordCall(req *http.Request, res *http.Response, err error, duration time.Duration) {
+	if h.Addon == nil || h.Addon.Config == nil {
+		return
+	}
+	config := h.Addon.Config.HostCallAudit
+	if config == nil || !config.Enabled {
+		return
+	}
+	failed := err != nil || res.StatusCode >= 400
+	if !failed && config.SampleRate > 0 && rand.Float64() >= config.SampleRate {
+		return
+	}
+	event := audit.Event{
+		Type:      AuditHostCall,
+		ClientKey: h.ClientKey,
+		Fields: map[string]string{
+			"method":     req.Method,
+			"path":       PathTemplate(req.URL.Path),
+			"durationMs": strconv.FormatInt(duration.Milliseconds(), 10),
+		},
+	}
+	if accountId, _ := req.Context().Value(actingUserContextKey).(string); accountId != "" {
+		event.Fields["actingUser"] = accountId
+	}
+	if err != nil {
+		event.Message = err.Error()
+	} else {
+		event.Fields["status"] = strconv.Itoa(res.StatusCode)
+	}
+	audit.Record(req.Context(), event)
+}
+
+// withActingUser marks req as made as the user accountId for the audit log
+func withActingUser(req *http.Request, accountId string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), actingUserContextKey, accountId))
+}
+
+var apiVersion = regexp.MustCompile(`^(v[0-9]+|[0-9]+(\.[0-9]+)?)$`)
+
+// PathTemplate returns path with the segments holding ids or keys replaced
+// by {id}, e.g. /rest/api/3/issue/{id}/comment for the comments of an issue,
+// so the audit log does not hold the content identifiers of the tenants. API
+// versions following an "api" or "agile" segment are kept
+func PathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if i > 0 && apiVersion.MatchString(segment) && (strings.HasSuffix(segments[i-1], "api") || segments[i-1] == "agile") {
+			continue
+		}
+		if strings.ContainsAny(segment, "0123456789") || len(segment) > 32 {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,134 @@
+package hostrequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// Error is returned by Do and DoJSON when the host product responds with a
+// non-2xx status code
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// New constructs a HostRequest for the given tenant, for use outside of an
+// authenticated http request (background jobs, schedulers, etc)
+func New(addon *gonnect.Addon, tenant *store.Tenant) *HostRequest {
+	return &HostRequest{
+		Addon:     addon,
+		ClientKey: tenant.ClientKey,
+		tenant:    tenant,
+	}
+}
+
+// Tenant returns the tenant this HostRequest is acting for
+func (h HostRequest) Tenant() *store.Tenant {
+	return h.tenant
+}
+
+func (h HostRequest) client() *http.Client {
+	if h.HttpClient != nil {
+		return h.HttpClient
+	}
+	return http.DefaultClient
+}
+
+// Do signs the request as the addon and sends it to the host product, GET
+// requests are served from and stored in the response cache when configured
+func (h HostRequest) Do(req *http.Request) (*http.Response, error) {
+	req, err := h.AsAddon(req)
+	if err != nil {
+		return nil, err
+	}
+	if c := h.responseCache(); c != nil && req.Method == http.MethodGet {
+		return h.doCached(c, req)
+	}
+	return h.Send(req)
+}
+
+// NewRequest creates a new request for the given path relative to the host
+// product base url, with the given query and optional JSON body
+func (h HostRequest) NewRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	uri := &url.URL{Path: path}
+	// segments escaped with url.PathEscape are sent as they are
+	if unescaped, err := url.PathUnescape(path); err == nil && unescaped != path {
+		uri.Path, uri.RawPath = unescaped, path
+	}
+	if len(query) > 0 {
+		uri.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// DoJSON sends a JSON request as the addon and decodes the JSON response into
+// out, if out is not nil
+func (h HostRequest) DoJSON(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	req, err := h.NewRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	return h.DoRequestJSON(req, out)
+}
+
+// DoRequestJSON sends the prepared request as the addon and decodes the JSON
+// response into out, if out is not nil
+func (h HostRequest) DoRequestJSON(req *http.Request, out interface{}) error {
+	res, err := h.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(res.Body)
+		return &Error{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     res.Header,
+			Body:       data,
+		}
+	}
+
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -2,23 +2,24 @@ package hostrequest
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"path/filepath"
-	"time"
-
-	"github.com/golang-jwt/jwt"
 
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
 	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
 	atlasoauth2 "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-oauth2"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
 )
 
 type HostRequest struct {
-	Addon     *gonnect.Addon
-	ClientKey string
-	tenant    *store.Tenant
+	Addon      *gonnect.Addon
+	ClientKey  string
+	HttpClient *http.Client
+	Cache      ResponseCache
+	tenant     *store.Tenant
 }
 
 func FromRequest(r *http.Request) (*HostRequest, error) {
@@ -52,51 +53,89 @@ func (h HostRequest) modifyRequest(req *http.Request) (*http.Request, error) {
 	if req.URL.Host == "" {
 		req.URL.Host = baseUrl.Host
 		req.URL.Scheme = baseUrl.Scheme
-		req.URL.Path = filepath.Join(baseUrl.Path, req.URL.Path)
+		req.URL.RawPath = filepath.Join(baseUrl.EscapedPath(), req.URL.EscapedPath())
+		if req.URL.Path, err = url.PathUnescape(req.URL.RawPath); err != nil {
+			return nil, err
+		}
 	}
 	return req, nil
 }
 
 func (h HostRequest) AsAddon(req *http.Request) (*http.Request, error) {
-	// The qsh must only read contain the path after /wiki/
-	// We therefore generate the claims first and prepend the baseUrl later
-	claims := struct {
-		QueryStringHash string `json:"qsh"`
-		jwt.StandardClaims
-	}{
-		QueryStringHash: atlasjwt.CreateQueryStringHash(req, false, ""),
-		StandardClaims: jwt.StandardClaims{
-			Issuer:    *h.Addon.Key,
-			IssuedAt:  time.Now().Unix(),
-			ExpiresAt: time.Now().Add(3 * time.Minute).Unix(),
-		},
+	// The qsh must only read contain the path after /wiki/, SignRequest
+	// computes it before prepending the baseUrl
+	if err := atlasjwt.SignRequest(req, h.tenant, atlasjwt.SignOptions{Issuer: h.Addon.TenantKey(h.tenant)}); err != nil {
+		return nil, err
 	}
+	// TODO: User-Agent
+	return req, nil
+}
+
+// ErrImpersonationDenied is returned by AsUser when the Impersonation policy
+// of the add-on denies the call
+var ErrImpersonationDenied = errors.New("impersonation denied")
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(h.tenant.SharedSecret))
+const (
+	AuditImpersonation       = "tenant.impersonation"
+	AuditImpersonationDenied = "tenant.impersonation_denied"
+	AuditImpersonationFailed = "tenant.impersonation_failed"
+)
+
+// accessToken fetches the access tokens of AsUser, replaced in tests
+var accessToken = atlasoauth2.GetAccessTokenBytes
+
+// authorizeImpersonation applies the Impersonation policy of the add-on to a
+// request as the user accountId, denied requests are recorded in the audit
+// log
+func (h HostRequest) authorizeImpersonation(req *http.Request, accountId string) error {
+	var err error
+	if h.Addon.Impersonation != nil {
+		err = h.Addon.Impersonation(req.Context(), h.tenant, accountId, req.Method+" "+req.URL.Path)
+	}
 	if err != nil {
-		return nil, err
+		h.recordImpersonation(req, accountId, AuditImpersonationDenied, err)
+		return fmt.Errorf("%w: %v", ErrImpersonationDenied, err)
 	}
+	return nil
+}
 
-	_, _ = h.modifyRequest(req)
-
-	req.Header.Set("Authorization", "JWT "+signedToken)
-	// TODO: User-Agent
-	return req, nil
+// recordImpersonation records the outcome of a request as the user accountId
+// in the audit log, with the path template of the request
+func (h HostRequest) recordImpersonation(req *http.Request, accountId, eventType string, err error) {
+	event := audit.Event{
+		Type:      eventType,
+		ClientKey: h.tenant.ClientKey,
+		Fields:    map[string]string{"accountId": accountId, "operation": req.Method + " " + PathTemplate(req.URL.Path)},
+	}
+	if err != nil {
+		event.Message = err.Error()
+	}
+	audit.Record(req.Context(), event)
 }
 
+// AsUser authorizes req with an access token of the user accountId, the
+// call has to be allowed by the Impersonation policy of the add-on. The
+// impersonation is recorded in the audit log once the token was issued, or
+// as failed when it was not
 func (h HostRequest) AsUser(req *http.Request, accountId string) (*http.Request, error) {
+	if err := h.authorizeImpersonation(req, accountId); err != nil {
+		return nil, err
+	}
 	iScopes := h.Addon.AddonDescriptor["scopes"].([]interface{})
 	scopes := make([]string, len(iScopes))
 	for idx, val := range iScopes {
 		scopes[idx] = val.(string)
 	}
-	token, err := atlasoauth2.GetAccessToken(h.tenant, accountId, scopes)
+	token, err := accessToken(h.tenant, accountId, scopes)
 	if err != nil {
+		h.recordImpersonation(req, accountId, AuditImpersonationFailed, err)
 		return nil, err
 	}
+	defer store.Zero(token)
+	h.recordImpersonation(req, accountId, AuditImpersonation, nil)
 	_, _ = h.modifyRequest(req)
-	req.Header.Set("Authorization", "Bearer "+token)
+	// the header value is a copy of the token which lives as long as req
+	req.Header.Set("Authorization", "Bearer "+string(token))
 	// TODO: User-Agent
-	return req, nil
+	return withActingUser(req, accountId), nil
 }
@@ -1 +1,168 @@
 package hostrequest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestImpersonationPolicy(t *testing.T) {
+	var recorded []audit.Event
+	defer func(sink audit.Sink) { audit.DefaultSink = sink }(audit.DefaultSink)
+	audit.DefaultSink = audit.SinkFunc(func(ctx context.Context, event audit.Event) {
+		recorded = append(recorded, event)
+	})
+	defer func(fetch func(*store.Tenant, string, []string) ([]byte, error)) { accessToken = fetch }(accessToken)
+	accessToken = func(tenant *store.Tenant, accountId string, scopes []string) ([]byte, error) {
+		if accountId == "unknown" {
+			return nil, errors.New("400 Bad Request")
+		}
+		return []byte("access-token"), nil
+	}
+
+	key := "com.example.test"
+	addon := &gonnect.Addon{Key: &key, AddonDescriptor: map[string]interface{}{"scopes": []interface{}{"read", "act_as_user"}}}
+	addon.Impersonation = func(ctx context.Context, tenant *store.Tenant, accountId, operation string) error {
+		if accountId == "denied" || operation == "PUT /rest/api/3/user" {
+			return errors.New("not allowed for " + tenant.ClientKey)
+		}
+		return nil
+	}
+	host := New(addon, &store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: "https://example.atlassian.net"})
+
+	testCases := []struct {
+		name          string
+		method        string
+		path          string
+		accountId     string
+		expectedError string
+		expectedEvent audit.Event
+	}{
+		{
+			name:          "denied",
+			method:        http.MethodPut,
+			path:          "/rest/api/3/user",
+			accountId:     "allowed",
+			expectedError: "impersonation denied: not allowed for client-key",
+			expectedEvent: audit.Event{Type: AuditImpersonationDenied, Message: "not allowed for client-key", Fields: map[string]string{"accountId": "allowed", "operation": "PUT /rest/api/3/user"}},
+		},
+		{
+			name:          "allowed",
+			method:        http.MethodGet,
+			path:          "/rest/api/3/issue/TEST-1",
+			accountId:     "allowed",
+			expectedEvent: audit.Event{Type: AuditImpersonation, Fields: map[string]string{"accountId": "allowed", "operation": "GET /rest/api/3/issue/{id}"}},
+		},
+		{
+			name:          "token failed",
+			method:        http.MethodGet,
+			path:          "/rest/api/3/myself",
+			accountId:     "unknown",
+			expectedError: "400 Bad Request",
+			expectedEvent: audit.Event{Type: AuditImpersonationFailed, Message: "400 Bad Request", Fields: map[string]string{"accountId": "unknown", "operation": "GET /rest/api/3/myself"}},
+		},
+	}
+	for _, testCase := range testCases {
+		recorded = nil
+		req := httptest.NewRequest(testCase.method, testCase.path, nil)
+		authorized, err := host.AsUser(req, testCase.accountId)
+		var message string
+		if err != nil {
+			message = err.Error()
+		}
+		if message != testCase.expectedError {
+			t.Errorf("%s: Expected the error %q, but got %q", testCase.name, testCase.expectedError, message)
+		}
+		if testCase.name == "denied" && !errors.Is(err, ErrImpersonationDenied) {
+			t.Errorf("%s: Expected ErrImpersonationDenied, but got %v", testCase.name, err)
+		}
+		if err == nil && authorized.Header.Get("Authorization") != "Bearer access-token" {
+			t.Errorf("%s: Expected the request to be authorized as the user, but got %q", testCase.name, authorized.Header.Get("Authorization"))
+		}
+		if err != nil && req.Header.Get("Authorization") != "" {
+			t.Errorf("%s: Expected the failed request not to be authorized, but got %q", testCase.name, req.Header.Get("Authorization"))
+		}
+		if len(recorded) != 1 {
+			t.Errorf("%s: Expected one audit event, but got %+v", testCase.name, recorded)
+			continue
+		}
+		event, expected := recorded[0], testCase.expectedEvent
+		if event.Type != expected.Type || event.ClientKey != "client-key" || event.Message != expected.Message || event.Fields["accountId"] != expected.Fields["accountId"] || event.Fields["operation"] != expected.Fields["operation"] {
+			t.Errorf("%s: Expected the audit event %+v, but got %+v", testCase.name, expected, event)
+		}
+	}
+}
+
+func TestHostCallAudit(t *testing.T) {
+	var recorded []audit.Event
+	defer func(sink audit.Sink) { audit.DefaultSink = sink }(audit.DefaultSink)
+	audit.DefaultSink = audit.SinkFunc(func(ctx context.Context, event audit.Event) {
+		recorded = append(recorded, event)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	key := "com.example.test"
+	addon := &gonnect.Addon{Key: &key, Config: &gonnect.Profile{}}
+	host := New(addon, &store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: server.URL})
+	call := func(path string) {
+		_ = host.DoJSON(context.Background(), http.MethodGet, path, nil, nil, nil)
+	}
+
+	call("/rest/api/3/issue/TEST-1")
+	if len(recorded) != 0 {
+		t.Fatalf("Expected no audit events when disabled, but got %+v", recorded)
+	}
+
+	addon.Config.HostCallAudit = &gonnect.HostCallAuditConfiguration{Enabled: true}
+	call("/rest/api/3/issue/TEST-1")
+	if len(recorded) != 1 {
+		t.Fatalf("Expected the call to be audited, but got %+v", recorded)
+	}
+	event := recorded[0]
+	if event.Type != AuditHostCall || event.ClientKey != "client-key" || event.Fields["method"] != "GET" ||
+		event.Fields["path"] != "/rest/api/3/issue/{id}" || event.Fields["status"] != "200" || event.Fields["durationMs"] == "" {
+		t.Errorf("Expected the audit event of the call by path template, but got %+v", event)
+	}
+
+	// failed calls are recorded regardless of the sampling
+	addon.Config.HostCallAudit.SampleRate = 1e-9
+	recorded = nil
+	call("/rest/api/3/issue/TEST-1")
+	call("/rest/api/3/issue/TEST-1/missing")
+	if len(recorded) != 1 || recorded[0].Fields["status"] != "404" {
+		t.Errorf("Expected only the failed call to be audited, but got %+v", recorded)
+	}
+}
+
+func TestPathTemplate(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/rest/api/3/issue/TEST-1/comment/10010", expected: "/rest/api/3/issue/{id}/comment/{id}"},
+		{path: "/rest/agile/1.0/board/12/sprint", expected: "/rest/agile/1.0/board/{id}/sprint"},
+		{path: "/wiki/api/v2/pages/123", expected: "/wiki/api/v2/pages/{id}"},
+		{path: "/rest/servicedeskapi/request/12", expected: "/rest/servicedeskapi/request/{id}"},
+		{path: "/rest/api/3/user", expected: "/rest/api/3/user"},
+		{path: "/rest/api/3/user/5b10ac8d82e05b22cc7d4ef5", expected: "/rest/api/3/user/{id}"},
+	}
+	for _, testCase := range testCases {
+		if template := PathTemplate(testCase.path); template != testCase.expected {
+			t.Errorf("Expected the template of %s to be %s, but got %s", testCase.path, testCase.expected, template)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package hosttest is a test double of the host product for code using
+// hostrequest. It records the requests of a HostRequest and serves canned
+// responses, registered with Respond or loaded from fixture files whose
+// contents are templates of the tenant values:
+//
+//	func TestSync(t *testing.T) {
+//		tenant := &store.Tenant{ClientKey: "client", SharedSecret: "secret", BaseURL: "https://example.atlassian.net"}
+//		host := hosttest.New(tenant)
+//		if err := host.LoadFixtures(os.DirFS("testdata"), "*.json"); err != nil {
+//			t.Fatal(err)
+//		}
+//		if err := sync(ctx, host.HostRequest(addon)); err != nil {
+//			t.Fatal(err)
+//		}
+//		if requests := host.Requests(); len(requests) != 2 {
+//			t.Errorf("expected 2 host requests, got %d", len(requests))
+//		}
+//	}
+package hosttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// Fixture is a canned response of the host product, fixture files hold a
+// single fixture or an array of them as JSON
+type Fixture struct {
+	// Method matches any method when empty
+	Method string `json:"method,omitempty"`
+	// Path is matched against the request path below the base url of the
+	// tenant, with the wildcards of path.Match
+	Path   string            `json:"path"`
+	Status int               `json:"status,omitempty"`
+	Header map[string]string `json:"header,omitempty"`
+	// Body is the response body, as it is when it is a JSON string and
+	// encoded as JSON otherwise
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+func (f Fixture) matches(method, requestPath string) bool {
+	if f.Method != "" && !strings.EqualFold(f.Method, method) {
+		return false
+	}
+	matched, err := path.Match(f.Path, requestPath)
+	return err == nil && matched
+}
+
+func (f Fixture) response(req *http.Request) *http.Response {
+	status := f.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	var body []byte
+	var text string
+	if err := json.Unmarshal(f.Body, &text); err == nil {
+		body = []byte(text)
+	} else {
+		body = f.Body
+	}
+	header := http.Header{}
+	if len(body) > 0 {
+		header.Set("Content-Type", "application/json")
+	}
+	for name, value := range f.Header {
+		header.Set(name, value)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// Request is a request recorded by the Host
+type Request struct {
+	Method string
+	// Path is the request path below the base url of the tenant
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+	// Matched is false for requests without a fixture, which were answered
+	// with 404
+	Matched bool
+}
+
+// JSON decodes the body of the request into v
+func (r Request) JSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Host records the requests to the host product of a tenant and serves the
+// fixtures, the last registered fixture matching a request is served
+type Host struct {
+	Tenant   *store.Tenant
+	mutex    sync.Mutex
+	fixtures []Fixture
+	requests []Request
+}
+
+func New(tenant *store.Tenant) *Host {
+	return &Host{Tenant: tenant}
+}
+
+// HostRequest returns a HostRequest of the tenant sending its requests to h
+func (h *Host) HostRequest(addon *gonnect.Addon) *hostrequest.HostRequest {
+	host := hostrequest.New(addon, h.Tenant)
+	host.HttpClient = h.Client()
+	return host
+}
+
+// Client returns an http client sending its requests to h
+func (h *Host) Client() *http.Client {
+	return &http.Client{Transport: h}
+}
+
+// Respond registers a fixture with a JSON body, body is encoded unless it is
+// a string
+func (h *Host) Respond(method, path string, status int, body interface{}) {
+	var data []byte
+	switch v := body.(type) {
+	case nil:
+	case string:
+		data, _ = json.Marshal(v)
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			panic(fmt.Sprintf("hosttest: encoding the body of %s %s: %v", method, path, err))
+		}
+	}
+	h.Add(Fixture{Method: method, Path: path, Status: status, Body: data})
+}
+
+// Add registers fixtures
+func (h *Host) Add(fixtures ...Fixture) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.fixtures = append(h.fixtures, fixtures...)
+}
+
+// LoadFixtures registers the fixtures of the files of fsys matching pattern.
+// The files are executed as text/template with the Tenant, e.g.
+// {{.BaseURL}} or {{.ClientKey}}
+func (h *Host) LoadFixtures(fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no fixtures match %s", pattern)
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		fixtures, err := h.parseFixtures(name, data)
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", name, err)
+		}
+		h.Add(fixtures...)
+	}
+	return nil
+}
+
+func (h *Host) parseFixtures(name string, data []byte) ([]Fixture, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, h.Tenant); err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(buf.Bytes())
+	if len(data) > 0 && data[0] == '[' {
+		var fixtures []Fixture
+		err = json.Unmarshal(data, &fixtures)
+		return fixtures, err
+	}
+	var fixture Fixture
+	err = json.Unmarshal(data, &fixture)
+	return []Fixture{fixture}, err
+}
+
+// Requests returns the recorded requests in the order they were sent
+func (h *Host) Requests() []Request {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]Request(nil), h.requests...)
+}
+
+// Unmatched returns the recorded requests without a fixture
+func (h *Host) Unmatched() (unmatched []Request) {
+	for _, req := range h.Requests() {
+		if !req.Matched {
+			unmatched = append(unmatched, req)
+		}
+	}
+	return
+}
+
+// Reset drops the recorded requests, the fixtures are kept
+func (h *Host) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.requests = nil
+}
+
+// RoundTrip records req and answers it with the matching fixture, requests
+// to other hosts than the base url of the tenant fail
+func (h *Host) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestPath := req.URL.Path
+	if h.Tenant != nil && h.Tenant.BaseURL != "" {
+		base := strings.TrimSuffix(h.Tenant.BaseURL, "/")
+		prefix := req.URL.Scheme + "://" + req.URL.Host
+		if !strings.HasPrefix(base+"/", prefix+"/") {
+			return nil, fmt.Errorf("hosttest: request to %s outside of the tenant %s", req.URL.Redacted(), base)
+		}
+		// the context path of the base url, e.g. /wiki
+		if contextPath := strings.TrimPrefix(base, prefix); contextPath != "" && strings.HasPrefix(requestPath, contextPath+"/") {
+			requestPath = strings.TrimPrefix(requestPath, contextPath)
+		}
+	}
+	recorded := Request{Method: req.Method, Path: requestPath, Query: req.URL.RawQuery, Header: req.Header.Clone()}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		recorded.Body = body
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var res *http.Response
+	for i := len(h.fixtures) - 1; i >= 0; i-- {
+		if h.fixtures[i].matches(req.Method, requestPath) {
+			res = h.fixtures[i].response(req)
+			recorded.Matched = true
+			break
+		}
+	}
+	if res == nil {
+		body, _ := json.Marshal(map[string][]string{"errorMessages": {fmt.Sprintf("no fixture for %s %s", req.Method, requestPath)}})
+		res = Fixture{Status: http.StatusNotFound, Body: body}.response(req)
+	}
+	h.requests = append(h.requests, recorded)
+	return res, nil
+}
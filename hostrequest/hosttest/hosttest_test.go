@@ -0,0 +1,78 @@
+package hosttest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestHost(t *testing.T) {
+	key := "com.example.test"
+	addon := &gonnect.Addon{Key: &key}
+	host := New(&store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: "https://example.atlassian.net/wiki"})
+	if err := host.LoadFixtures(os.DirFS("testdata"), "*.json"); err != nil {
+		t.Fatal(err)
+	}
+	client := host.HostRequest(addon)
+	ctx := context.Background()
+
+	var issue struct {
+		Key    string `json:"key"`
+		Self   string `json:"self"`
+		Fields struct {
+			Summary string `json:"summary"`
+		} `json:"fields"`
+	}
+	if err := client.DoJSON(ctx, http.MethodGet, "/rest/api/3/issue/TEST-1", nil, nil, &issue); err != nil {
+		t.Fatal(err)
+	}
+	if issue.Self != "https://example.atlassian.net/wiki/rest/api/3/issue/10001" || issue.Fields.Summary != "Installed for client-key" {
+		t.Errorf("Expected the tenant values in the fixture, but got %+v", issue)
+	}
+
+	if err := client.DoJSON(ctx, http.MethodPut, "/rest/api/content/12", nil, map[string]string{"title": "Page"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var hostErr *hostrequest.Error
+	if err := client.DoJSON(ctx, http.MethodGet, "/rest/api/content/404", nil, nil, nil); !errors.As(err, &hostErr) || hostErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the 404 fixture, but got %v", err)
+	}
+
+	host.Respond(http.MethodGet, "/rest/api/3/myself", http.StatusOK, map[string]string{"accountId": "account"})
+	var myself struct {
+		AccountId string `json:"accountId"`
+	}
+	if err := client.DoJSON(ctx, http.MethodGet, "/rest/api/3/myself", nil, nil, &myself); err != nil || myself.AccountId != "account" {
+		t.Errorf("Expected the registered response, but got %+v %v", myself, err)
+	}
+	if err := client.DoJSON(ctx, http.MethodDelete, "/rest/api/3/issue/TEST-1", nil, nil, nil); !errors.As(err, &hostErr) || hostErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected unmatched requests to be answered with 404, but got %v", err)
+	}
+
+	requests := host.Requests()
+	if len(requests) != 5 {
+		t.Fatalf("Expected 5 recorded requests, but got %d", len(requests))
+	}
+	put := requests[1]
+	var page map[string]string
+	if put.Method != http.MethodPut || put.Path != "/rest/api/content/12" || put.JSON(&page) != nil || page["title"] != "Page" {
+		t.Errorf("Expected the recorded page update, but got %+v", put)
+	}
+	if !strings.HasPrefix(put.Header.Get("Authorization"), "JWT ") {
+		t.Errorf("Expected the request to be signed as the add-on, but got %q", put.Header.Get("Authorization"))
+	}
+	if unmatched := host.Unmatched(); len(unmatched) != 1 || unmatched[0].Method != http.MethodDelete {
+		t.Errorf("Expected the delete to be unmatched, but got %+v", unmatched)
+	}
+	host.Reset()
+	if requests = host.Requests(); len(requests) != 0 {
+		t.Errorf("Expected no requests after a reset, but got %d", len(requests))
+	}
+}
@@ -0,0 +1,37 @@
+package hostrequest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// License is the license of the add-on in the host product of a tenant
+type License struct {
+	Active                   bool   `json:"active"`
+	Type                     string `json:"type"`
+	Evaluation               bool   `json:"evaluation"`
+	SupportEntitlementNumber string `json:"supportEntitlementNumber,omitempty"`
+}
+
+// AddonInfo is the state of the add-on in the host product of a tenant
+type AddonInfo struct {
+	Key     string   `json:"key"`
+	Version string   `json:"version"`
+	State   string   `json:"state"`
+	License *License `json:"license,omitempty"`
+}
+
+// AddonInfo looks up the state and license of the add-on in the host product
+func (h HostRequest) AddonInfo(ctx context.Context) (*AddonInfo, error) {
+	if h.Addon == nil || h.Addon.Key == nil {
+		return nil, errors.New("add-on key is not configured")
+	}
+	info := &AddonInfo{}
+	path := "/rest/atlassian-connect/1/addons/" + url.PathEscape(h.Addon.TenantKey(h.tenant))
+	if err := h.DoJSON(ctx, http.MethodGet, path, nil, nil, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,172 @@
+package hostrequest
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+)
+
+// DefaultRateLimitWindow is the period the rate limited responses of a tenant
+// are counted in
+const DefaultRateLimitWindow = 15 * time.Minute
+
+// RateLimitState is the outbound rate limit state of a tenant as seen in the
+// responses of its host product
+type RateLimitState struct {
+	ClientKey string `json:"clientKey"`
+	// Limit and Remaining are the budget of the last X-RateLimit headers,
+	// Remaining is -1 when the host did not send them
+	Limit     int  `json:"limit,omitempty"`
+	Remaining int  `json:"remaining"`
+	NearLimit bool `json:"nearLimit,omitempty"`
+	// BackoffUntil is set while the calls of the tenant are paused after a
+	// rate limited response
+	BackoffUntil *time.Time `json:"backoffUntil,omitempty"`
+	// RateLimited is the number of 429 responses within the window
+	RateLimited     int        `json:"rateLimited"`
+	LastRateLimited *time.Time `json:"lastRateLimited,omitempty"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// Throttled reports whether the tenant is backing off or was rate limited
+// within the window
+func (s RateLimitState) Throttled() bool {
+	return s.BackoffUntil != nil || s.RateLimited > 0
+}
+
+type rateLimitEntry struct {
+	limit, remaining int
+	nearLimit        bool
+	backoffUntil     time.Time
+	rateLimited      []time.Time
+	updated          time.Time
+}
+
+// RateLimitTracker keeps the outbound rate limit state of every tenant, see
+// DefaultRateLimits
+type RateLimitTracker struct {
+	Window  time.Duration
+	mutex   sync.Mutex
+	tenants map[string]*rateLimitEntry
+}
+
+// DefaultRateLimits tracks the responses of all host requests
+var DefaultRateLimits = NewRateLimitTracker(DefaultRateLimitWindow)
+
+func NewRateLimitTracker(window time.Duration) *RateLimitTracker {
+	return &RateLimitTracker{Window: window, tenants: map[string]*rateLimitEntry{}}
+}
+
+func (t *RateLimitTracker) entry(clientKey string) *rateLimitEntry {
+	entry, ok := t.tenants[clientKey]
+	if !ok {
+		entry = &rateLimitEntry{remaining: -1}
+		t.tenants[clientKey] = entry
+	}
+	return entry
+}
+
+// Observe records the rate limit headers and status of a host response of
+// the tenant
+func (t *RateLimitTracker) Observe(clientKey string, res *http.Response) {
+	now := time.Now()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	entry := t.entry(clientKey)
+	entry.updated = now
+	if remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining")); err == nil {
+		entry.remaining = remaining
+		entry.limit, _ = strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	}
+	entry.nearLimit = res.Header.Get("X-RateLimit-NearLimit") == "true"
+	if res.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	metrics.Add("host_rate_limited", 1)
+	entry.rateLimited = append(entry.rateLimited, now)
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		if until := now.Add(time.Duration(seconds) * time.Second); until.After(entry.backoffUntil) {
+			entry.backoffUntil = until
+		}
+	}
+}
+
+// Backoff records that the calls of the tenant are paused for d
+func (t *RateLimitTracker) Backoff(clientKey string, d time.Duration) {
+	now := time.Now()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	entry := t.entry(clientKey)
+	entry.updated = now
+	if until := now.Add(d); until.After(entry.backoffUntil) {
+		entry.backoffUntil = until
+	}
+}
+
+func (t *RateLimitTracker) state(clientKey string, entry *rateLimitEntry, now time.Time) RateLimitState {
+	// the 429 responses before the window are dropped
+	cutoff := now.Add(-t.Window)
+	kept := entry.rateLimited[:0]
+	for _, at := range entry.rateLimited {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	entry.rateLimited = kept
+
+	state := RateLimitState{
+		ClientKey:   clientKey,
+		Limit:       entry.limit,
+		Remaining:   entry.remaining,
+		NearLimit:   entry.nearLimit,
+		RateLimited: len(kept),
+		UpdatedAt:   entry.updated,
+	}
+	if entry.backoffUntil.After(now) {
+		until := entry.backoffUntil
+		state.BackoffUntil = &until
+	}
+	if len(kept) > 0 {
+		last := kept[len(kept)-1]
+		state.LastRateLimited = &last
+	}
+	return state
+}
+
+// Get returns the rate limit state of the tenant, false when no host request
+// of it was seen
+func (t *RateLimitTracker) Get(clientKey string) (RateLimitState, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	entry, ok := t.tenants[clientKey]
+	if !ok {
+		return RateLimitState{}, false
+	}
+	return t.state(clientKey, entry, time.Now()), true
+}
+
+// All returns the rate limit state of every tenant seen, the most throttled
+// tenants first
+func (t *RateLimitTracker) All() []RateLimitState {
+	now := time.Now()
+	t.mutex.Lock()
+	states := make([]RateLimitState, 0, len(t.tenants))
+	for clientKey, entry := range t.tenants {
+		states = append(states, t.state(clientKey, entry, now))
+	}
+	t.mutex.Unlock()
+	sort.Slice(states, func(i, j int) bool {
+		if (states[i].BackoffUntil != nil) != (states[j].BackoffUntil != nil) {
+			return states[i].BackoffUntil != nil
+		}
+		if states[i].RateLimited != states[j].RateLimited {
+			return states[i].RateLimited > states[j].RateLimited
+		}
+		return states[i].ClientKey < states[j].ClientKey
+	})
+	return states
+}
@@ -0,0 +1,67 @@
+package hostrequest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestRateLimitTracker(t *testing.T) {
+	throttled := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "100")
+		if throttled {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "42")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	defer func(tracker *RateLimitTracker) { DefaultRateLimits = tracker }(DefaultRateLimits)
+	DefaultRateLimits = NewRateLimitTracker(time.Minute)
+
+	key := "com.example.test"
+	addon := &gonnect.Addon{Key: &key}
+	throttledHost := New(addon, &store.Tenant{ClientKey: "throttled", SharedSecret: "secret", BaseURL: server.URL})
+	quietHost := New(addon, &store.Tenant{ClientKey: "quiet", SharedSecret: "secret", BaseURL: server.URL})
+
+	if _, ok := DefaultRateLimits.Get("throttled"); ok {
+		t.Fatal("Expected no state before the first request")
+	}
+	for i := 0; i < 2; i++ {
+		if _, retry := RetryDelay(throttledHost.DoJSON(context.Background(), http.MethodGet, "/rest/api/3/myself", nil, nil, nil)); !retry {
+			t.Fatal("Expected a rate limited response")
+		}
+	}
+	throttled = false
+	if err := quietHost.DoJSON(context.Background(), http.MethodGet, "/rest/api/3/myself", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	state, ok := DefaultRateLimits.Get("throttled")
+	if !ok || state.Remaining != 0 || state.Limit != 100 || state.RateLimited != 2 || state.LastRateLimited == nil || !state.Throttled() {
+		t.Fatalf("Expected the throttled state of the tenant, but got %+v", state)
+	}
+	if state.BackoffUntil == nil || time.Until(*state.BackoffUntil) < 25*time.Second {
+		t.Errorf("Expected the Retry-After backoff, but got %v", state.BackoffUntil)
+	}
+	all := DefaultRateLimits.All()
+	if len(all) != 2 || all[0].ClientKey != "throttled" || all[1].ClientKey != "quiet" || all[1].Remaining != 42 || all[1].Throttled() {
+		t.Errorf("Expected the states of both tenants, but got %+v", all)
+	}
+
+	// rate limited responses expire with the window
+	DefaultRateLimits.Window = time.Nanosecond
+	if state, _ := DefaultRateLimits.Get("throttled"); state.RateLimited != 0 {
+		t.Errorf("Expected the rate limited responses to expire, but got %d", state.RateLimited)
+	}
+}
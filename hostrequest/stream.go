@@ -0,0 +1,210 @@
+package hostrequest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+// streamRequestHeaders are forwarded to the host product, for range and
+// conditional requests of the browser
+var streamRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// streamResponseHeaders are copied from the response of the host product
+var streamResponseHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Content-Disposition",
+	"Accept-Ranges", "ETag", "Last-Modified",
+}
+
+// streamInlineTypes are the content types browsers display inline, the
+// others are served as downloads so uploaded HTML or SVG cannot run in the
+// origin of the add-on
+var streamInlineTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "image/bmp", "application/pdf"}
+
+// ErrStreamInterrupted is returned by Stream when the response was written
+// partially
+var ErrStreamInterrupted = errors.New("stream interrupted")
+
+// ErrStreamWithoutUser is returned by Stream without the accountId of a user,
+// streams as the add-on are made with StreamAsAddon
+var ErrStreamWithoutUser = errors.New("stream requested without a user")
+
+// JiraAttachmentPath returns the path of the content of a Jira attachment
+func JiraAttachmentPath(attachmentId string) string {
+	return "/rest/api/3/attachment/content/" + url.PathEscape(attachmentId)
+}
+
+// ConfluenceAttachmentPath returns the path of the download of a Confluence
+// attachment
+func ConfluenceAttachmentPath(contentId, attachmentId string) string {
+	return "/rest/api/content/" + url.PathEscape(contentId) + "/child/attachment/" + url.PathEscape(attachmentId) + "/download"
+}
+
+// Stream streams the GET response of path, such as an attachment, from the
+// host product to w without buffering it. The range and conditional headers
+// of r are forwarded so browsers can seek in media and revalidate, the
+// request is made as the user accountId so the permissions of the user apply,
+// which requires the ACT_AS_USER scope. Responses other than 2xx, 304 and 416
+// are returned as *Error without writing to w.
+//
+// The content is sandboxed by its Content-Security-Policy and only the
+// streamInlineTypes are displayed inline, the others are downloaded
+func (h HostRequest) Stream(w http.ResponseWriter, r *http.Request, path, accountId string) error {
+	if accountId == "" {
+		return ErrStreamWithoutUser
+	}
+	return h.stream(w, r, path, accountId)
+}
+
+// StreamAsAddon is Stream requesting path as the add-on, any user of the
+// tenant can read what the add-on can read
+func (h HostRequest) StreamAsAddon(w http.ResponseWriter, r *http.Request, path string) error {
+	return h.stream(w, r, path, "")
+}
+
+func (h HostRequest) stream(w http.ResponseWriter, r *http.Request, path, accountId string) error {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, (&url.URL{Path: path}).String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	for _, name := range streamRequestHeaders {
+		if value := r.Header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	if accountId != "" {
+		req, err = h.AsUser(req, accountId)
+	} else {
+		req, err = h.AsAddon(req)
+	}
+	if err != nil {
+		return err
+	}
+	// the response cache is bypassed, attachments are not buffered in memory
+	res, err := h.Send(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode <= 299:
+	case res.StatusCode == http.StatusNotModified, res.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+	default:
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return &Error{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     res.Header,
+			Body:       data,
+		}
+	}
+
+	for _, name := range streamResponseHeaders {
+		if value := res.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	if !streamInline(res.Header.Get("Content-Type")) {
+		w.Header().Set("Content-Disposition", attachmentDisposition(res.Header.Get("Content-Disposition")))
+	}
+	// the attachment is only served to the authenticated user
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(res.StatusCode)
+	if _, err = io.Copy(w, res.Body); err != nil {
+		return fmt.Errorf("%w: %v", ErrStreamInterrupted, err)
+	}
+	return nil
+}
+
+// streamInline reports whether contentType is one of the streamInlineTypes
+func streamInline(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, inline := range streamInlineTypes {
+		if mediaType == inline {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentDisposition returns disposition as an attachment, keeping its
+// filename
+func attachmentDisposition(disposition string) string {
+	if _, params, err := mime.ParseMediaType(disposition); err == nil && len(params) > 0 {
+		if formatted := mime.FormatMediaType("attachment", params); formatted != "" {
+			return formatted
+		}
+	}
+	return "attachment"
+}
+
+// StreamHandler serves the attachments of the host product to the iframes of
+// the add-on, it has to be applied after the authentication middleware.
+// pathOf returns the host path of the requested attachment, e.g.
+//
+//	hostrequest.StreamHandler(func(r *http.Request) (string, error) {
+//		return hostrequest.JiraAttachmentPath(chi.URLParam(r, "id")), nil
+//	})
+//
+// The attachment is requested as the user of the request, so the permissions
+// of the user apply, which requires the ACT_AS_USER scope. Requests without a
+// user are forbidden, see StreamHandlerAsAddon
+func StreamHandler(pathOf func(r *http.Request) (string, error)) http.Handler {
+	return streamHandler(pathOf, true)
+}
+
+// StreamHandlerAsAddon is StreamHandler requesting the attachments as the
+// add-on, pathOf has to check the user may read the attachment
+func StreamHandlerAsAddon(pathOf func(r *http.Request) (string, error)) http.Handler {
+	return streamHandler(pathOf, false)
+}
+
+func streamHandler(pathOf func(r *http.Request) (string, error), asUser bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := FromRequest(r)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		path, err := pathOf(r)
+		if err != nil {
+			util.SendError(w, r, client.Addon, http.StatusBadRequest, err.Error())
+			return
+		}
+		accountId := ""
+		if asUser {
+			accountId, _ = r.Context().Value("userAccountId").(string)
+			if accountId == "" {
+				util.SendError(w, r, client.Addon, http.StatusForbidden, "attachment requested without a user")
+				return
+			}
+		}
+		if err = client.stream(w, r, path, accountId); err != nil {
+			var hostErr *Error
+			switch {
+			case errors.As(err, &hostErr) && (hostErr.StatusCode == http.StatusNotFound || hostErr.StatusCode == http.StatusForbidden):
+				util.SendError(w, r, client.Addon, http.StatusNotFound, "attachment not found")
+			case errors.Is(err, ErrStreamInterrupted):
+				// the client sees a truncated response, usually it went away
+				log.WarnRDF(r, 1, "%v", err)
+			default:
+				util.SendError(w, r, client.Addon, http.StatusBadGateway, "could not fetch the attachment: "+err.Error())
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package hostrequest
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestStream(t *testing.T) {
+	content := []byte("0123456789")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "JWT ") {
+			t.Errorf("Expected the request to be signed as the add-on")
+		}
+		switch r.URL.Path {
+		case JiraAttachmentPath("10"):
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Disposition", `inline; filename="attachment.txt"`)
+		case JiraAttachmentPath("12"):
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Content-Disposition", `inline; filename="image.png"`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "attachment", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	key := "com.example.test"
+	host := New(&gonnect.Addon{Key: &key}, &store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: server.URL})
+
+	testCases := []struct {
+		name                string
+		path                string
+		rangeHeader         string
+		expectedCode        int
+		expectedBody        string
+		expectedType        string
+		expectedDisposition string
+	}{
+		{name: "whole attachment", path: JiraAttachmentPath("10"), expectedCode: http.StatusOK, expectedBody: "0123456789", expectedType: "text/plain", expectedDisposition: "attachment; filename=attachment.txt"},
+		{name: "range", path: JiraAttachmentPath("10"), rangeHeader: "bytes=2-4", expectedCode: http.StatusPartialContent, expectedBody: "234", expectedType: "text/plain", expectedDisposition: "attachment; filename=attachment.txt"},
+		{name: "inline image", path: JiraAttachmentPath("12"), expectedCode: http.StatusOK, expectedBody: "0123456789", expectedType: "image/png", expectedDisposition: `inline; filename="image.png"`},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/attachments/10", nil)
+		if testCase.rangeHeader != "" {
+			req.Header.Set("Range", testCase.rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		if err := host.StreamAsAddon(rec, req, testCase.path); err != nil {
+			t.Errorf("%s: %v", testCase.name, err)
+			continue
+		}
+		if rec.Code != testCase.expectedCode || rec.Body.String() != testCase.expectedBody {
+			t.Errorf("%s: Expected %d %s, but got %d %s", testCase.name, testCase.expectedCode, testCase.expectedBody, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Content-Type") != testCase.expectedType || rec.Header().Get("Cache-Control") != "private, max-age=300" {
+			t.Errorf("%s: Expected the content type %s and a private cache, but got %v", testCase.name, testCase.expectedType, rec.Header())
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != testCase.expectedDisposition {
+			t.Errorf("%s: Expected the disposition %s, but got %s", testCase.name, testCase.expectedDisposition, got)
+		}
+		if got := rec.Header().Get("Content-Security-Policy"); got != "sandbox" {
+			t.Errorf("%s: Expected a sandbox policy, but got %q", testCase.name, got)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	if err := host.Stream(rec, httptest.NewRequest(http.MethodGet, "/attachments/10", nil), JiraAttachmentPath("10"), ""); !errors.Is(err, ErrStreamWithoutUser) {
+		t.Errorf("Expected streams without a user to fail, but got %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	err := host.StreamAsAddon(rec, httptest.NewRequest(http.MethodGet, "/attachments/11", nil), JiraAttachmentPath("11"))
+	var hostErr *Error
+	if !errors.As(err, &hostErr) || hostErr.StatusCode != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Errorf("Expected a not found error without a response, but got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Package i18n loads the translation bundles of an add-on, serves them for
+// the translations block of the descriptor and looks up messages in the
+// locale of the requesting user, so that module names and the strings of
+// iframe pages are localized from the same files
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is the fallback of bundles created by Load
+const DefaultLocale = "en-US"
+
+// LOCALE_PARAM is the query parameter carrying the user locale on iframe
+// urls
+const LOCALE_PARAM = "loc"
+
+// Bundle holds the messages of each locale, all locales use the same flat
+// message keys as the i18n keys of descriptor modules
+type Bundle struct {
+	// Fallback is the locale used when a message is missing in the
+	// requested locale
+	Fallback string
+	mutex    sync.RWMutex
+	messages map[string]map[string]string
+}
+
+func New(fallback string) *Bundle {
+	return &Bundle{Fallback: NormalizeLocale(fallback), messages: make(map[string]map[string]string)}
+}
+
+// Load reads the <locale>.json files in dir of fsys, each holding a flat
+// JSON object of message keys to messages. Locales may be named en-US or
+// en_US.
+func Load(fsys fs.FS, dir string) (*Bundle, error) {
+	b := New(DefaultLocale)
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		messages := map[string]string{}
+		if err = json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("reading translations %s: %w", file, err)
+		}
+		b.Add(strings.TrimSuffix(path.Base(file), ".json"), messages)
+	}
+	return b, nil
+}
+
+// NormalizeLocale returns locale in the language-REGION form used by the
+// descriptor, e.g. en_us becomes en-US
+func NormalizeLocale(locale string) string {
+	parts := strings.FieldsFunc(strings.TrimSpace(locale), func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 {
+		return ""
+	}
+	parts[0] = strings.ToLower(parts[0])
+	if len(parts) > 1 {
+		parts[1] = strings.ToUpper(parts[1])
+	}
+	return strings.Join(parts, "-")
+}
+
+// Add merges messages into the locale
+func (b *Bundle) Add(locale string, messages map[string]string) {
+	locale = NormalizeLocale(locale)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.messages == nil {
+		b.messages = make(map[string]map[string]string)
+	}
+	if b.messages[locale] == nil {
+		b.messages[locale] = make(map[string]string, len(messages))
+	}
+	for key, message := range messages {
+		b.messages[locale][key] = message
+	}
+}
+
+// Locales returns the sorted locales of the bundle
+func (b *Bundle) Locales() []string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	locales := make([]string, 0, len(b.messages))
+	for locale := range b.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Match returns the locale of the bundle best matching locale: the locale
+// itself, another region of its language or the fallback
+func (b *Bundle) Match(locale string) string {
+	locale = NormalizeLocale(locale)
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if _, ok := b.messages[locale]; ok {
+		return locale
+	}
+	language := strings.SplitN(locale, "-", 2)[0]
+	if language != "" {
+		for _, candidate := range []string{language, language + "-" + strings.ToUpper(language)} {
+			if _, ok := b.messages[candidate]; ok {
+				return candidate
+			}
+		}
+		var regional []string
+		for available := range b.messages {
+			if strings.HasPrefix(available, language+"-") {
+				regional = append(regional, available)
+			}
+		}
+		if len(regional) > 0 {
+			sort.Strings(regional)
+			return regional[0]
+		}
+	}
+	return b.Fallback
+}
+
+// Translate returns the message key in locale, falling back to the fallback
+// locale and then the key itself. Messages are formatted with args when any
+// are given.
+func (b *Bundle) Translate(locale, key string, args ...interface{}) string {
+	matched := b.Match(locale)
+	b.mutex.RLock()
+	message, ok := b.messages[matched][key]
+	if !ok {
+		message, ok = b.messages[b.Fallback][key]
+	}
+	b.mutex.RUnlock()
+	if !ok {
+		message = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// T translates key in the locale of the request
+func (b *Bundle) T(r *http.Request, key string, args ...interface{}) string {
+	return b.Translate(RequestLocale(r), key, args...)
+}
+
+// Name returns the i18n property of a descriptor module, e.g. its name,
+// with the fallback message as value
+func (b *Bundle) Name(key string) map[string]interface{} {
+	return map[string]interface{}{"value": b.Translate(b.Fallback, key), "i18n": key}
+}
+
+// Paths returns the translations paths of the descriptor, serving the
+// locales below prefix
+func (b *Bundle) Paths(prefix string) map[string]string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	paths := map[string]string{}
+	for _, locale := range b.Locales() {
+		paths[locale] = prefix + "/" + locale + ".json"
+	}
+	return paths
+}
+
+// ServeHTTP serves the messages of the locale named by the last path
+// segment of the request, e.g. /i18n/en-US.json
+func (b *Bundle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	locale := NormalizeLocale(strings.TrimSuffix(path.Base(r.URL.Path), ".json"))
+	b.mutex.RLock()
+	messages, ok := b.messages[locale]
+	var data []byte
+	if ok {
+		data, _ = json.Marshal(messages)
+	}
+	b.mutex.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// RequestLocale returns the locale of the user of the request: the locale
+// set by the request middleware, the loc parameter of iframe urls or the
+// first Accept-Language
+func RequestLocale(r *http.Request) string {
+	if locale, ok := r.Context().Value("locale").(string); ok && locale != "" {
+		return locale
+	}
+	if locale := r.URL.Query().Get(LOCALE_PARAM); locale != "" {
+		return NormalizeLocale(locale)
+	}
+	if accept := r.Header.Get("Accept-Language"); accept != "" {
+		first := strings.SplitN(strings.SplitN(accept, ",", 2)[0], ";", 2)[0]
+		return NormalizeLocale(first)
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package i18n
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBundle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"i18n/en_US.json": {Data: []byte(`{"page.name":"Overview","page.greeting":"Hello %s","page.footer":"Footer"}`)},
+		"i18n/de-DE.json": {Data: []byte(`{"page.name":"Übersicht","page.greeting":"Hallo %s"}`)},
+		"i18n/fr-CA.json": {Data: []byte(`{"page.name":"Aperçu"}`)},
+	}
+	b, err := Load(fsys, "i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locales := b.Locales(); !reflect.DeepEqual(locales, []string{"de-DE", "en-US", "fr-CA"}) {
+		t.Errorf("Expected the normalized locales of the files, but got %v", locales)
+	}
+
+	testCases := []struct {
+		locale   string
+		key      string
+		args     []interface{}
+		expected string
+	}{
+		{locale: "de-DE", key: "page.name", expected: "Übersicht"},
+		{locale: "de_at", key: "page.name", expected: "Übersicht"},
+		{locale: "fr-FR", key: "page.name", expected: "Aperçu"},
+		{locale: "ja-JP", key: "page.name", expected: "Overview"},
+		{locale: "de-DE", key: "page.footer", expected: "Footer"},
+		{locale: "de-DE", key: "page.greeting", args: []interface{}{"Welt"}, expected: "Hallo Welt"},
+		{locale: "de-DE", key: "missing.key", expected: "missing.key"},
+	}
+	for _, testCase := range testCases {
+		if message := b.Translate(testCase.locale, testCase.key, testCase.args...); message != testCase.expected {
+			t.Errorf("%s %s: Expected %q, but got %q", testCase.locale, testCase.key, testCase.expected, message)
+		}
+	}
+
+	if paths := b.Paths("/i18n/"); paths["en-US"] != "/i18n/en-US.json" || len(paths) != 3 {
+		t.Errorf("Expected the paths of the 3 locales, but got %v", paths)
+	}
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest("GET", "/i18n/de-DE.json", nil))
+	var messages map[string]string
+	if err = json.Unmarshal(w.Body.Bytes(), &messages); err != nil || messages["page.name"] != "Übersicht" {
+		t.Errorf("Expected the messages of de-DE, but got %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest("GET", "/i18n/xx-XX.json", nil))
+	if w.Code != 404 {
+		t.Errorf("Expected 404 for an unknown locale, but got %d", w.Code)
+	}
+}
+
+func TestRequestLocale(t *testing.T) {
+	testCases := []struct {
+		target   string
+		expected string
+	}{
+		{target: "/page?loc=fr_FR", expected: "fr-FR"},
+		{target: "/page", expected: "de-DE"},
+	}
+	for _, testCase := range testCases {
+		r := httptest.NewRequest("GET", testCase.target, nil)
+		r.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+		if locale := RequestLocale(r); locale != testCase.expected {
+			t.Errorf("%s: Expected the locale %s, but got %s", testCase.target, testCase.expected, locale)
+		}
+	}
+}
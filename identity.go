@@ -0,0 +1,38 @@
+package gonnect
+
+import (
+	"context"
+	"errors"
+)
+
+// PrincipalContextKey holds the principal returned by the IdentityLinker of
+// the add-on for the authenticated request
+const PrincipalContextKey = "principal"
+
+// ErrIdentityRejected is returned by IdentityLinker implementations denying
+// the user access to the application, the request is answered with 403
+var ErrIdentityRejected = errors.New("identity rejected")
+
+// IdentityLinker maps the Connect users authenticated by the authentication
+// middleware to the user records of the application, e.g. looking up or
+// provisioning the user of the accountId. The returned principal is stored
+// in the request context, see PrincipalFromContext. The accountId is empty
+// for requests without a user, such as those of anonymous users or of the
+// host product itself
+type IdentityLinker interface {
+	Link(ctx context.Context, clientKey, accountId string, claims map[string]interface{}) (principal interface{}, err error)
+}
+
+// IdentityLinkerFunc is an IdentityLinker function
+type IdentityLinkerFunc func(ctx context.Context, clientKey, accountId string, claims map[string]interface{}) (interface{}, error)
+
+func (f IdentityLinkerFunc) Link(ctx context.Context, clientKey, accountId string, claims map[string]interface{}) (interface{}, error) {
+	return f(ctx, clientKey, accountId, claims)
+}
+
+// PrincipalFromContext returns the principal of the IdentityLinker, false
+// when no principal was linked
+func PrincipalFromContext(ctx context.Context) (principal interface{}, ok bool) {
+	principal = ctx.Value(PrincipalContextKey)
+	return principal, principal != nil
+}
@@ -0,0 +1,13 @@
+package gonnect
+
+import (
+	"context"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// ImpersonationFunc decides whether the add-on may act as the user accountId
+// of the tenant for operation, the method and path of the host request such
+// as "GET /rest/api/3/myself". Returning an error denies the call, see
+// hostrequest.HostRequest.AsUser
+type ImpersonationFunc func(ctx context.Context, tenant *store.Tenant, accountId, operation string) error
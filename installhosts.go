@@ -0,0 +1,88 @@
+package gonnect
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// DefaultInstallHosts are the AllowedHosts of the install host allowlist
+// when none are configured, the hosts of the Atlassian cloud products
+var DefaultInstallHosts = []string{"*.atlassian.net", "*.jira.com", "*.jira-dev.com"}
+
+var ErrInsecureBaseUrl = errors.New("insecure baseUrl")
+var ErrBaseUrlNotAllowed = errors.New("baseUrl host not allowed")
+
+// InstallHostConfiguration restricts the base urls of the install payloads.
+// Without it the base urls have to be https urls of public hosts
+type InstallHostConfiguration struct {
+	// AllowInsecure accepts http base urls and loopback, private or
+	// link-local addresses, for local development against a self-hosted
+	// product
+	AllowInsecure bool
+	// Allowlist rejects base urls whose host matches none of AllowedHosts
+	Allowlist bool
+	// AllowedHosts are host names, or patterns like *.atlassian.net matching
+	// any subdomain, DefaultInstallHosts when empty
+	AllowedHosts []string
+}
+
+// ValidateInstallBaseUrl returns an error wrapping ErrInsecureBaseUrl or
+// ErrBaseUrlNotAllowed when the baseUrl of an install payload violates the
+// InstallHosts configuration of p
+func (p *Profile) ValidateInstallBaseUrl(baseUrl string) error {
+	var config InstallHostConfiguration
+	if p != nil && p.InstallHosts != nil {
+		config = *p.InstallHosts
+	}
+	u, err := url.Parse(baseUrl)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("%w: %q is not an absolute http url", ErrInsecureBaseUrl, baseUrl)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if !config.AllowInsecure {
+		if u.Scheme != "https" {
+			return fmt.Errorf("%w: %s is not https", ErrInsecureBaseUrl, baseUrl)
+		}
+		if isPrivateHost(host) {
+			return fmt.Errorf("%w: %s is a private address", ErrInsecureBaseUrl, host)
+		}
+	}
+	if config.Allowlist {
+		patterns := config.AllowedHosts
+		if len(patterns) == 0 {
+			patterns = DefaultInstallHosts
+		}
+		for _, pattern := range patterns {
+			if matchHost(strings.ToLower(pattern), host) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrBaseUrlNotAllowed, host)
+	}
+	return nil
+}
+
+// isPrivateHost reports whether host is localhost or an IP address which is
+// not publicly routable, host names are not resolved
+func isPrivateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
+
+// matchHost matches host against a host name or a *.domain pattern, which
+// does not match the domain itself
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
@@ -0,0 +1,127 @@
+// Package internaltoken issues and verifies the tokens the services of an
+// add-on authenticate their calls to each other with. The tokens carry the
+// tenant and user of the call and are signed with a key of the add-on
+// instead of the shared secret of a tenant, so they cannot be mistaken for
+// tokens of the host product
+package internaltoken
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Audience is the aud claim of internal tokens
+const Audience = "internal"
+
+const DefaultExpiry = 5 * time.Minute
+
+var (
+	ErrNoSecret     = errors.New("no internal token secret configured")
+	ErrInvalidToken = errors.New("invalid internal token")
+)
+
+// Claims are the claims of an internal token
+type Claims struct {
+	ClientKey string `json:"clientKey"`
+	AccountId string `json:"accountId,omitempty"`
+	jwt.StandardClaims
+}
+
+// Signer issues tokens with the first secret and verifies them with any of
+// the secrets, so that secrets can be rotated without downtime
+type Signer struct {
+	// Issuer is the key of the add-on
+	Issuer  string
+	Secrets []string
+	// Expiry of issued tokens, DefaultExpiry when zero
+	Expiry time.Duration
+}
+
+// Issue returns a token for a call on behalf of the tenant and the optional
+// user account
+func (s Signer) Issue(clientKey, accountId string) (string, error) {
+	if len(s.Secrets) == 0 || s.Secrets[0] == "" {
+		return "", ErrNoSecret
+	}
+	expiry := s.Expiry
+	if expiry <= 0 {
+		expiry = DefaultExpiry
+	}
+	now := time.Now()
+	claims := Claims{
+		ClientKey: clientKey,
+		AccountId: accountId,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    s.Issuer,
+			Audience:  Audience,
+			Subject:   accountId,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiry).Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.Secrets[0]))
+}
+
+// Verify returns the claims of a token issued by a Signer of the add-on
+func (s Signer) Verify(token string) (*Claims, error) {
+	if len(s.Secrets) == 0 {
+		return nil, ErrNoSecret
+	}
+	var lastErr error
+	for _, secret := range s.Secrets {
+		if secret == "" {
+			continue
+		}
+		claims := &Claims{}
+		_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+			if token.Method != jwt.SigningMethodHS256 {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(secret), nil
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch {
+		case claims.Issuer != s.Issuer:
+			return nil, fmt.Errorf("%w: issued by %q", ErrInvalidToken, claims.Issuer)
+		case !claims.VerifyAudience(Audience, true):
+			return nil, fmt.Errorf("%w: not an internal token", ErrInvalidToken)
+		case claims.ClientKey == "":
+			return nil, fmt.Errorf("%w: no clientKey", ErrInvalidToken)
+		}
+		return claims, nil
+	}
+	if lastErr == nil {
+		// every secret is empty
+		return nil, ErrNoSecret
+	}
+	return nil, fmt.Errorf("%w: %w", ErrInvalidToken, lastErr)
+}
+
+// SignRequest adds a token for the tenant and user to the Authorization
+// header of a call to another service of the add-on
+func (s Signer) SignRequest(req *http.Request, clientKey, accountId string) error {
+	token, err := s.Issue(clientKey, accountId)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// FromRequest returns the bearer token of the request
+func FromRequest(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
@@ -0,0 +1,61 @@
+package internaltoken
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestSigner(t *testing.T) {
+	previous := Signer{Issuer: "addon-key", Secrets: []string{"old-secret"}}
+	rotated := Signer{Issuer: "addon-key", Secrets: []string{"new-secret", "old-secret"}}
+
+	token, err := previous.Issue("client-key", "account-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := rotated.Verify(token)
+	if err != nil || claims.ClientKey != "client-key" || claims.AccountId != "account-id" {
+		t.Errorf("Expected the token of the previous secret to verify, but got %+v, %v", claims, err)
+	}
+
+	testCases := []struct {
+		name     string
+		signer   Signer
+		expected error
+	}{
+		{name: "unknown secret", signer: Signer{Issuer: "addon-key", Secrets: []string{"other-secret"}}, expected: ErrInvalidToken},
+		{name: "other add-on", signer: Signer{Issuer: "other-key", Secrets: []string{"old-secret"}}, expected: ErrInvalidToken},
+		{name: "no secrets", signer: Signer{Issuer: "addon-key"}, expected: ErrNoSecret},
+		{name: "empty secrets", signer: Signer{Issuer: "addon-key", Secrets: []string{""}}, expected: ErrNoSecret},
+	}
+	for _, testCase := range testCases {
+		if _, err = testCase.signer.Verify(token); !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: Expected %v, but got %v", testCase.name, testCase.expected, err)
+		}
+	}
+
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		ClientKey:      "client-key",
+		StandardClaims: jwt.StandardClaims{Issuer: "addon-key", Audience: Audience, ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+	}).SignedString([]byte("old-secret"))
+	if _, err = rotated.Verify(expired); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the expired token to be invalid, but got %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://service.internal/jobs", nil)
+	if err = rotated.SignRequest(req, "client-key", ""); err != nil {
+		t.Fatal(err)
+	}
+	if token, ok := FromRequest(req); !ok {
+		t.Errorf("Expected a bearer token")
+	} else if _, err = rotated.Verify(token); err != nil {
+		t.Errorf("Expected the token to verify, but got %v", err)
+	}
+	if _, err = (Signer{}).Issue("client-key", ""); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("Expected ErrNoSecret, but got %v", err)
+	}
+}
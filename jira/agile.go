@@ -0,0 +1,266 @@
+package jira
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+)
+
+const AGILE_API_PATH = "/rest/agile/1.0"
+
+// Agile provides typed helpers for the Jira Software (agile) REST API
+type Agile struct {
+	host *hostrequest.HostRequest
+}
+
+func NewAgile(host *hostrequest.HostRequest) *Agile {
+	return &Agile{host: host}
+}
+
+// Page holds the common pagination options of the agile API
+type Page struct {
+	StartAt    int
+	MaxResults int
+}
+
+func (p Page) values() url.Values {
+	v := url.Values{}
+	if p.StartAt > 0 {
+		v.Set("startAt", strconv.Itoa(p.StartAt))
+	}
+	if p.MaxResults > 0 {
+		v.Set("maxResults", strconv.Itoa(p.MaxResults))
+	}
+	return v
+}
+
+type Board struct {
+	Id       int           `json:"id"`
+	Self     string        `json:"self,omitempty"`
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Location BoardLocation `json:"location,omitempty"`
+}
+
+type BoardLocation struct {
+	ProjectId      int    `json:"projectId,omitempty"`
+	ProjectKey     string `json:"projectKey,omitempty"`
+	ProjectName    string `json:"projectName,omitempty"`
+	DisplayName    string `json:"displayName,omitempty"`
+	ProjectTypeKey string `json:"projectTypeKey,omitempty"`
+}
+
+type BoardList struct {
+	StartAt    int     `json:"startAt"`
+	MaxResults int     `json:"maxResults"`
+	Total      int     `json:"total"`
+	IsLast     bool    `json:"isLast"`
+	Values     []Board `json:"values"`
+}
+
+type BoardListOptions struct {
+	Page
+	Type           string
+	Name           string
+	ProjectKeyOrId string
+}
+
+type Sprint struct {
+	Id            int    `json:"id,omitempty"`
+	Self          string `json:"self,omitempty"`
+	State         string `json:"state,omitempty"`
+	Name          string `json:"name,omitempty"`
+	StartDate     string `json:"startDate,omitempty"`
+	EndDate       string `json:"endDate,omitempty"`
+	CompleteDate  string `json:"completeDate,omitempty"`
+	OriginBoardId int    `json:"originBoardId,omitempty"`
+	Goal          string `json:"goal,omitempty"`
+}
+
+type SprintList struct {
+	StartAt    int      `json:"startAt"`
+	MaxResults int      `json:"maxResults"`
+	IsLast     bool     `json:"isLast"`
+	Values     []Sprint `json:"values"`
+}
+
+type Epic struct {
+	Id      int    `json:"id"`
+	Key     string `json:"key"`
+	Self    string `json:"self,omitempty"`
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+	Done    bool   `json:"done"`
+}
+
+type EpicList struct {
+	StartAt    int    `json:"startAt"`
+	MaxResults int    `json:"maxResults"`
+	IsLast     bool   `json:"isLast"`
+	Values     []Epic `json:"values"`
+}
+
+// Issue is the minimal issue representation returned by the agile API, the
+// requested fields are left as raw json values
+type Issue struct {
+	Id     string                 `json:"id"`
+	Key    string                 `json:"key"`
+	Self   string                 `json:"self,omitempty"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+type IssueList struct {
+	StartAt    int     `json:"startAt"`
+	MaxResults int     `json:"maxResults"`
+	Total      int     `json:"total"`
+	Issues     []Issue `json:"issues"`
+}
+
+type IssueListOptions struct {
+	Page
+	Jql    string
+	Fields []string
+}
+
+func (o IssueListOptions) values() url.Values {
+	v := o.Page.values()
+	if o.Jql != "" {
+		v.Set("jql", o.Jql)
+	}
+	if len(o.Fields) > 0 {
+		v.Set("fields", strings.Join(o.Fields, ","))
+	}
+	return v
+}
+
+// RankRequest ranks the given issues either before or after the given issue
+type RankRequest struct {
+	Issues            []string `json:"issues"`
+	RankBeforeIssue   string   `json:"rankBeforeIssue,omitempty"`
+	RankAfterIssue    string   `json:"rankAfterIssue,omitempty"`
+	RankCustomFieldId int      `json:"rankCustomFieldId,omitempty"`
+}
+
+type issuesRequest struct {
+	Issues []string `json:"issues"`
+}
+
+func agilePath(parts ...string) string {
+	for idx, part := range parts {
+		parts[idx] = url.PathEscape(part)
+	}
+	return AGILE_API_PATH + "/" + strings.Join(parts, "/")
+}
+
+func (a *Agile) GetBoards(ctx context.Context, opts BoardListOptions) (list *BoardList, err error) {
+	query := opts.Page.values()
+	if opts.Type != "" {
+		query.Set("type", opts.Type)
+	}
+	if opts.Name != "" {
+		query.Set("name", opts.Name)
+	}
+	if opts.ProjectKeyOrId != "" {
+		query.Set("projectKeyOrId", opts.ProjectKeyOrId)
+	}
+	list = &BoardList{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("board"), query, nil, list)
+	return
+}
+
+func (a *Agile) GetBoard(ctx context.Context, boardId int) (board *Board, err error) {
+	board = &Board{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("board", strconv.Itoa(boardId)), nil, nil, board)
+	return
+}
+
+// GetBoardSprints lists the sprints of a board, optionally filtered by a comma
+// separated list of states (future, active, closed)
+func (a *Agile) GetBoardSprints(ctx context.Context, boardId int, state string, page Page) (list *SprintList, err error) {
+	query := page.values()
+	if state != "" {
+		query.Set("state", state)
+	}
+	list = &SprintList{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("board", strconv.Itoa(boardId), "sprint"), query, nil, list)
+	return
+}
+
+func (a *Agile) GetBoardEpics(ctx context.Context, boardId int, page Page) (list *EpicList, err error) {
+	list = &EpicList{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("board", strconv.Itoa(boardId), "epic"), page.values(), nil, list)
+	return
+}
+
+func (a *Agile) GetBoardBacklog(ctx context.Context, boardId int, opts IssueListOptions) (list *IssueList, err error) {
+	list = &IssueList{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("board", strconv.Itoa(boardId), "backlog"), opts.values(), nil, list)
+	return
+}
+
+func (a *Agile) GetSprint(ctx context.Context, sprintId int) (sprint *Sprint, err error) {
+	sprint = &Sprint{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("sprint", strconv.Itoa(sprintId)), nil, nil, sprint)
+	return
+}
+
+// CreateSprint creates a new future sprint, sprint.Name and
+// sprint.OriginBoardId are required
+func (a *Agile) CreateSprint(ctx context.Context, sprint Sprint) (created *Sprint, err error) {
+	created = &Sprint{}
+	err = a.host.DoJSON(ctx, http.MethodPost, agilePath("sprint"), nil, sprint, created)
+	return
+}
+
+// UpdateSprint partially updates a sprint, only non-empty fields are sent
+func (a *Agile) UpdateSprint(ctx context.Context, sprintId int, sprint Sprint) (updated *Sprint, err error) {
+	updated = &Sprint{}
+	err = a.host.DoJSON(ctx, http.MethodPost, agilePath("sprint", strconv.Itoa(sprintId)), nil, sprint, updated)
+	return
+}
+
+func (a *Agile) GetSprintIssues(ctx context.Context, sprintId int, opts IssueListOptions) (list *IssueList, err error) {
+	list = &IssueList{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("sprint", strconv.Itoa(sprintId), "issue"), opts.values(), nil, list)
+	return
+}
+
+func (a *Agile) MoveIssuesToSprint(ctx context.Context, sprintId int, issueKeys ...string) error {
+	return a.host.DoJSON(ctx, http.MethodPost, agilePath("sprint", strconv.Itoa(sprintId), "issue"), nil, issuesRequest{issueKeys}, nil)
+}
+
+func (a *Agile) GetEpic(ctx context.Context, epicIdOrKey string) (epic *Epic, err error) {
+	epic = &Epic{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("epic", epicIdOrKey), nil, nil, epic)
+	return
+}
+
+func (a *Agile) GetEpicIssues(ctx context.Context, epicIdOrKey string, opts IssueListOptions) (list *IssueList, err error) {
+	list = &IssueList{}
+	err = a.host.DoJSON(ctx, http.MethodGet, agilePath("epic", epicIdOrKey, "issue"), opts.values(), nil, list)
+	return
+}
+
+func (a *Agile) MoveIssuesToEpic(ctx context.Context, epicIdOrKey string, issueKeys ...string) error {
+	return a.host.DoJSON(ctx, http.MethodPost, agilePath("epic", epicIdOrKey, "issue"), nil, issuesRequest{issueKeys}, nil)
+}
+
+// RemoveIssuesFromEpic removes the issues from any epic they belong to
+func (a *Agile) RemoveIssuesFromEpic(ctx context.Context, issueKeys ...string) error {
+	return a.host.DoJSON(ctx, http.MethodPost, agilePath("epic", "none", "issue"), nil, issuesRequest{issueKeys}, nil)
+}
+
+// MoveIssuesToBacklog removes the issues from any sprint and moves them to
+// the backlog
+func (a *Agile) MoveIssuesToBacklog(ctx context.Context, issueKeys ...string) error {
+	return a.host.DoJSON(ctx, http.MethodPost, agilePath("backlog", "issue"), nil, issuesRequest{issueKeys}, nil)
+}
+
+// RankIssues changes the backlog rank of the given issues
+func (a *Agile) RankIssues(ctx context.Context, rank RankRequest) error {
+	return a.host.DoJSON(ctx, http.MethodPut, agilePath("issue", "rank"), nil, rank, nil)
+}
@@ -0,0 +1,106 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func newTestHost(t *testing.T, handler http.HandlerFunc) *hostrequest.HostRequest {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	key := "com.example.test"
+	return hostrequest.New(&gonnect.Addon{Key: &key}, &store.Tenant{
+		ClientKey:    "client-key",
+		SharedSecret: "shared-secret",
+		BaseURL:      server.URL,
+	})
+}
+
+func TestAgile(t *testing.T) {
+	var lastMethod, lastPath, lastQuery string
+	var lastBody map[string]interface{}
+
+	host := newTestHost(t, func(w http.ResponseWriter, r *http.Request) {
+		lastMethod, lastPath, lastQuery = r.Method, r.URL.EscapedPath(), r.URL.RawQuery
+		lastBody = nil
+		_ = json.NewDecoder(r.Body).Decode(&lastBody)
+		if r.Header.Get("Authorization") == "" {
+			t.Errorf("Expected Authorization header to be set")
+		}
+		switch r.URL.Path {
+		case "/rest/agile/1.0/board":
+			_, _ = w.Write([]byte(`{"total":1,"values":[{"id":1,"name":"Board","type":"scrum"}]}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	agile := NewAgile(host)
+
+	boards, err := agile.GetBoards(context.Background(), BoardListOptions{Type: "scrum", Page: Page{MaxResults: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(boards.Values, []Board{{Id: 1, Name: "Board", Type: "scrum"}}) {
+		t.Errorf("Expected one scrum board, but got %+v", boards.Values)
+	}
+	if lastQuery != "maxResults=10&type=scrum" {
+		t.Errorf("Expected query to be %s, but got %s", "maxResults=10&type=scrum", lastQuery)
+	}
+
+	testCases := []struct {
+		call   func() error
+		method string
+		path   string
+		body   map[string]interface{}
+	}{
+		{
+			call:   func() error { return agile.MoveIssuesToSprint(context.Background(), 5, "TEST-1") },
+			method: http.MethodPost,
+			path:   "/rest/agile/1.0/sprint/5/issue",
+			body:   map[string]interface{}{"issues": []interface{}{"TEST-1"}},
+		},
+		{
+			call:   func() error { return agile.MoveIssuesToBacklog(context.Background(), "TEST-2") },
+			method: http.MethodPost,
+			path:   "/rest/agile/1.0/backlog/issue",
+			body:   map[string]interface{}{"issues": []interface{}{"TEST-2"}},
+		},
+		{
+			call:   func() error { return agile.MoveIssuesToEpic(context.Background(), "TEST/5?", "TEST-6") },
+			method: http.MethodPost,
+			path:   "/rest/agile/1.0/epic/TEST%2F5%3F/issue",
+			body:   map[string]interface{}{"issues": []interface{}{"TEST-6"}},
+		},
+		{
+			call: func() error {
+				return agile.RankIssues(context.Background(), RankRequest{Issues: []string{"TEST-3"}, RankBeforeIssue: "TEST-4"})
+			},
+			method: http.MethodPut,
+			path:   "/rest/agile/1.0/issue/rank",
+			body:   map[string]interface{}{"issues": []interface{}{"TEST-3"}, "rankBeforeIssue": "TEST-4"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		if err := testCase.call(); err != nil {
+			t.Error(err)
+			continue
+		}
+		if lastMethod != testCase.method || lastPath != testCase.path {
+			t.Errorf("Expected %s %s, but got %s %s", testCase.method, testCase.path, lastMethod, lastPath)
+		}
+		if !cmp.Equal(lastBody, testCase.body) {
+			t.Errorf("Expected body to be %+v, but got %+v", testCase.body, lastBody)
+		}
+	}
+}
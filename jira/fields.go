@@ -0,0 +1,243 @@
+package jira
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+)
+
+const PLATFORM_API_PATH = "/rest/api/3"
+
+const (
+	DefaultFieldCacheTTL   = time.Hour
+	DefaultFieldMinRefresh = time.Minute
+)
+
+var (
+	ErrFieldNotFound  = errors.New("field not found")
+	ErrAmbiguousField = errors.New("field name matches several fields")
+)
+
+type FieldSchema struct {
+	Type     string `json:"type"`
+	Items    string `json:"items,omitempty"`
+	System   string `json:"system,omitempty"`
+	Custom   string `json:"custom,omitempty"`
+	CustomId int    `json:"customId,omitempty"`
+}
+
+type Field struct {
+	Id          string       `json:"id"`
+	Key         string       `json:"key"`
+	Name        string       `json:"name"`
+	Custom      bool         `json:"custom"`
+	Orderable   bool         `json:"orderable"`
+	Navigable   bool         `json:"navigable"`
+	Searchable  bool         `json:"searchable"`
+	ClauseNames []string     `json:"clauseNames,omitempty"`
+	Schema      *FieldSchema `json:"schema,omitempty"`
+}
+
+// FieldMetadata is the field metadata of a tenant as fetched at Fetched
+type FieldMetadata struct {
+	Fields  []Field
+	Fetched time.Time
+	byId    map[string]Field
+	byName  map[string][]Field
+}
+
+func newFieldMetadata(fields []Field) *FieldMetadata {
+	m := &FieldMetadata{
+		Fields:  fields,
+		Fetched: time.Now(),
+		byId:    make(map[string]Field, len(fields)),
+		byName:  make(map[string][]Field, len(fields)),
+	}
+	for _, field := range fields {
+		m.byId[field.Id] = field
+		name := strings.ToLower(field.Name)
+		m.byName[name] = append(m.byName[name], field)
+	}
+	return m
+}
+
+// Field returns the field with the id, e.g. "customfield_10010" or
+// "summary", or the name, names are matched case insensitively and are
+// ambiguous when several custom fields share them
+func (m *FieldMetadata) Field(idOrName string) (Field, error) {
+	if field, ok := m.byId[idOrName]; ok {
+		return field, nil
+	}
+	switch fields := m.byName[strings.ToLower(idOrName)]; len(fields) {
+	case 0:
+		return Field{}, fmt.Errorf("%w: %q", ErrFieldNotFound, idOrName)
+	case 1:
+		return fields[0], nil
+	default:
+		return Field{}, fmt.Errorf("%w: %q", ErrAmbiguousField, idOrName)
+	}
+}
+
+type Screen struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type ScreenTab struct {
+	Id     int           `json:"id"`
+	Name   string        `json:"name"`
+	Fields []ScreenField `json:"-"`
+}
+
+type ScreenField struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type screenList struct {
+	StartAt    int      `json:"startAt"`
+	MaxResults int      `json:"maxResults"`
+	IsLast     bool     `json:"isLast"`
+	Values     []Screen `json:"values"`
+}
+
+// FieldCache caches the field metadata and screens of each tenant, Jira
+// apps constantly translate field names to their customfield ids and the
+// metadata rarely changes
+type FieldCache struct {
+	// MinRefresh is the minimum age of the cached metadata before a lookup of
+	// an unknown field fetches it again, to pick up newly created fields
+	MinRefresh time.Duration
+	cache      *cache.Cache
+}
+
+// DefaultFieldCache is the FieldCache shared by the add-on
+var DefaultFieldCache = NewFieldCache(DefaultFieldCacheTTL)
+
+func NewFieldCache(ttl time.Duration) *FieldCache {
+	return &FieldCache{
+		MinRefresh: DefaultFieldMinRefresh,
+		cache:      cache.New(ttl, ttl),
+	}
+}
+
+func fieldsKey(clientKey string) string {
+	return "fields:" + clientKey
+}
+
+func screensKey(clientKey string) string {
+	return "screens:" + clientKey
+}
+
+func screenTabsKey(clientKey string, screenId int) string {
+	return "screen:" + clientKey + ":" + strconv.Itoa(screenId)
+}
+
+// Fields returns the cached field metadata of the tenant of host, fetching
+// it when it is not cached
+func (c *FieldCache) Fields(ctx context.Context, host *hostrequest.HostRequest) (*FieldMetadata, error) {
+	if cached, ok := c.cache.Get(fieldsKey(host.ClientKey)); ok {
+		return cached.(*FieldMetadata), nil
+	}
+	return c.Refresh(ctx, host)
+}
+
+// Refresh fetches the field metadata of the tenant of host
+func (c *FieldCache) Refresh(ctx context.Context, host *hostrequest.HostRequest) (*FieldMetadata, error) {
+	var fields []Field
+	if err := host.DoJSON(ctx, http.MethodGet, PLATFORM_API_PATH+"/field", nil, nil, &fields); err != nil {
+		return nil, err
+	}
+	metadata := newFieldMetadata(fields)
+	c.cache.SetDefault(fieldsKey(host.ClientKey), metadata)
+	return metadata, nil
+}
+
+// Field returns the field with the id or name, unknown fields refresh the
+// metadata once it is older than MinRefresh
+func (c *FieldCache) Field(ctx context.Context, host *hostrequest.HostRequest, idOrName string) (Field, error) {
+	metadata, err := c.Fields(ctx, host)
+	if err != nil {
+		return Field{}, err
+	}
+	field, err := metadata.Field(idOrName)
+	if errors.Is(err, ErrFieldNotFound) && time.Since(metadata.Fetched) >= c.MinRefresh {
+		if metadata, err = c.Refresh(ctx, host); err != nil {
+			return Field{}, err
+		}
+		field, err = metadata.Field(idOrName)
+	}
+	return field, err
+}
+
+// FieldId returns the id of the field with the name, e.g. "customfield_10010"
+// for "Story Points"
+func (c *FieldCache) FieldId(ctx context.Context, host *hostrequest.HostRequest, name string) (string, error) {
+	field, err := c.Field(ctx, host, name)
+	if err != nil {
+		return "", err
+	}
+	return field.Id, nil
+}
+
+// Screens returns the cached screens of the tenant of host
+func (c *FieldCache) Screens(ctx context.Context, host *hostrequest.HostRequest) ([]Screen, error) {
+	if cached, ok := c.cache.Get(screensKey(host.ClientKey)); ok {
+		return cached.([]Screen), nil
+	}
+	var screens []Screen
+	for startAt := 0; ; {
+		list := &screenList{}
+		query := url.Values{"startAt": {strconv.Itoa(startAt)}}
+		if err := host.DoJSON(ctx, http.MethodGet, PLATFORM_API_PATH+"/screens", query, nil, list); err != nil {
+			return nil, err
+		}
+		screens = append(screens, list.Values...)
+		if list.IsLast || len(list.Values) == 0 {
+			break
+		}
+		startAt += len(list.Values)
+	}
+	c.cache.SetDefault(screensKey(host.ClientKey), screens)
+	return screens, nil
+}
+
+// ScreenTabs returns the cached tabs of the screen with their fields
+func (c *FieldCache) ScreenTabs(ctx context.Context, host *hostrequest.HostRequest, screenId int) ([]ScreenTab, error) {
+	key := screenTabsKey(host.ClientKey, screenId)
+	if cached, ok := c.cache.Get(key); ok {
+		return cached.([]ScreenTab), nil
+	}
+	path := fmt.Sprintf("%s/screens/%d/tabs", PLATFORM_API_PATH, screenId)
+	var tabs []ScreenTab
+	if err := host.DoJSON(ctx, http.MethodGet, path, nil, nil, &tabs); err != nil {
+		return nil, err
+	}
+	for i := range tabs {
+		if err := host.DoJSON(ctx, http.MethodGet, fmt.Sprintf("%s/%d/fields", path, tabs[i].Id), nil, nil, &tabs[i].Fields); err != nil {
+			return nil, err
+		}
+	}
+	c.cache.SetDefault(key, tabs)
+	return tabs, nil
+}
+
+// Invalidate drops the cached metadata and screens of the tenant
+func (c *FieldCache) Invalidate(clientKey string) {
+	prefix := "screen:" + clientKey + ":"
+	for key := range c.cache.Items() {
+		if key == fieldsKey(clientKey) || key == screensKey(clientKey) || strings.HasPrefix(key, prefix) {
+			c.cache.Delete(key)
+		}
+	}
+}
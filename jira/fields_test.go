@@ -0,0 +1,68 @@
+package jira
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestFieldCache(t *testing.T) {
+	fieldRequests := 0
+	fields := `[{"id":"summary","name":"Summary"},{"id":"customfield_10010","name":"Story Points","custom":true}]`
+	host := newTestHost(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/3/field":
+			fieldRequests += 1
+			_, _ = w.Write([]byte(fields))
+		case "/rest/api/3/screens":
+			if r.URL.Query().Get("startAt") == "0" {
+				_, _ = w.Write([]byte(`{"isLast":false,"values":[{"id":1,"name":"Default"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"isLast":true,"values":[{"id":2,"name":"Bug"}]}`))
+		case "/rest/api/3/screens/1/tabs":
+			_, _ = w.Write([]byte(`[{"id":10,"name":"Field Tab"}]`))
+		case "/rest/api/3/screens/1/tabs/10/fields":
+			_, _ = w.Write([]byte(`[{"id":"summary","name":"Summary"}]`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+	})
+	c := NewFieldCache(DefaultFieldCacheTTL)
+	c.MinRefresh = 0
+	ctx := context.Background()
+
+	if id, err := c.FieldId(ctx, host, "story points"); err != nil || id != "customfield_10010" {
+		t.Errorf("Expected customfield_10010, but got %s, %v", id, err)
+	}
+	if _, err := c.FieldId(ctx, host, "Summary"); err != nil || fieldRequests != 1 {
+		t.Errorf("Expected the cached metadata, but got %d requests, %v", fieldRequests, err)
+	}
+
+	fields = `[{"id":"customfield_10010","name":"Team","custom":true},{"id":"customfield_10020","name":"Team","custom":true},{"id":"customfield_10030","name":"Sprint","custom":true}]`
+	if id, err := c.FieldId(ctx, host, "Sprint"); err != nil || id != "customfield_10030" || fieldRequests != 2 {
+		t.Errorf("Expected a refresh on miss, but got %s, %v after %d requests", id, err, fieldRequests)
+	}
+	if _, err := c.FieldId(ctx, host, "Team"); !errors.Is(err, ErrAmbiguousField) {
+		t.Errorf("Expected ErrAmbiguousField, but got %v", err)
+	}
+	c.MinRefresh = DefaultFieldMinRefresh
+	if _, err := c.FieldId(ctx, host, "Unknown"); !errors.Is(err, ErrFieldNotFound) || fieldRequests != 2 {
+		t.Errorf("Expected ErrFieldNotFound without a refresh, but got %v after %d requests", err, fieldRequests)
+	}
+
+	screens, err := c.Screens(ctx, host)
+	if err != nil || len(screens) != 2 || screens[1].Name != "Bug" {
+		t.Errorf("Expected both pages of screens, but got %v, %v", screens, err)
+	}
+	tabs, err := c.ScreenTabs(ctx, host, 1)
+	if err != nil || len(tabs) != 1 || len(tabs[0].Fields) != 1 || tabs[0].Fields[0].Id != "summary" {
+		t.Errorf("Expected the screen tab fields, but got %v, %v", tabs, err)
+	}
+
+	c.Invalidate("client-key")
+	if _, err = c.FieldId(ctx, host, "Sprint"); err != nil || fieldRequests != 3 {
+		t.Errorf("Expected the invalidated metadata to be fetched, but got %d requests, %v", fieldRequests, err)
+	}
+}
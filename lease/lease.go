@@ -0,0 +1,120 @@
+// Package lease coordinates background components across replicas of an
+// add-on, a component only runs on the replica holding its named lease.
+//
+// The jobs changing the shared tenant store run under a lease: the stale
+// tenant cleanup of the store and the due deletions of the retention
+// workflow. The other background work runs on every replica as it only
+// touches state of its own process: the in-memory lifecycle retry queue holds
+// the jobs enqueued by its replica, and every replica caches and reloads the
+// install keys it verifies installs with.
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// Leaser grants named, expiring leases to a single holder at a time
+type Leaser interface {
+	// TryAcquire acquires the lease name for holder, or renews it if holder
+	// already holds it, and reports whether holder holds the lease for ttl
+	TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease name if it is held by holder
+	Release(ctx context.Context, name, holder string) error
+}
+
+// Default is the Leaser used by the background components of gonnect, they
+// fall back to a lease row in their tenant store when it is nil. Set it to a
+// Redis leaser to coordinate through Redis instead.
+var Default Leaser
+
+// Holder identifies this process as lease holder, it is unique per process
+var Holder = newHolder()
+
+func newHolder() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Run calls fn every interval until ctx is done, but only while this process
+// holds the lease name of leaser. The lease is renewed before each call and
+// lasts for ttl, which should be longer than interval so the leader keeps it
+// between calls. A nil leaser runs fn unconditionally.
+func Run(ctx context.Context, leaser Leaser, name string, ttl, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	leader := false
+	defer func() {
+		if leader {
+			if err := leaser.Release(context.Background(), name, Holder); err != nil {
+				log.ErrorF("error releasing lease %s: %v", name, err)
+			}
+		}
+	}()
+	for {
+		if leaser == nil {
+			fn(ctx)
+		} else if held, err := leaser.TryAcquire(ctx, name, Holder, ttl); err != nil {
+			log.ErrorF("error acquiring lease %s: %v", name, err)
+			leader = false
+		} else {
+			if held && !leader {
+				log.InfoF("acquired lease %s", name)
+			} else if !held && leader {
+				log.InfoF("lost lease %s", name)
+			}
+			if leader = held; leader {
+				fn(ctx)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type memoryLease struct {
+	holder  string
+	expires time.Time
+}
+
+// Memory is an in-process Leaser, it only coordinates components within a
+// single replica
+type Memory struct {
+	mutex  sync.Mutex
+	leases map[string]memoryLease
+}
+
+func (m *Memory) TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	if current, ok := m.leases[name]; ok && current.holder != holder && now.Before(current.expires) {
+		return false, nil
+	}
+	if m.leases == nil {
+		m.leases = make(map[string]memoryLease)
+	}
+	m.leases[name] = memoryLease{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (m *Memory) Release(ctx context.Context, name, holder string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if current, ok := m.leases[name]; ok && current.holder == holder {
+		delete(m.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package lease
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	leaser := &Memory{}
+	ctx := context.Background()
+	testCases := []struct {
+		holder   string
+		ttl      time.Duration
+		expected bool
+	}{
+		{holder: "first", ttl: time.Hour, expected: true},
+		{holder: "second", ttl: time.Hour, expected: false},
+		{holder: "first", ttl: -time.Second, expected: true},
+		{holder: "second", ttl: time.Hour, expected: true},
+	}
+	for _, testCase := range testCases {
+		held, err := leaser.TryAcquire(ctx, "job", testCase.holder, testCase.ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != testCase.expected {
+			t.Errorf("Expected %s to hold the lease: %v, but got %v", testCase.holder, testCase.expected, held)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	leaser := &Memory{}
+	if _, err := leaser.TryAcquire(context.Background(), "job", "other", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	runs := 0
+	Run(ctx, leaser, "job", time.Hour, time.Millisecond, func(ctx context.Context) { runs++ })
+	if runs != 0 {
+		t.Errorf("Expected no runs while another holder holds the lease, but got %v", runs)
+	}
+
+	if err := leaser.Release(context.Background(), "job", "other"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	Run(ctx, leaser, "job", time.Hour, time.Millisecond, func(ctx context.Context) { runs++ })
+	if runs == 0 {
+		t.Errorf("Expected runs once the lease was released")
+	}
+	if held, _ := leaser.TryAcquire(context.Background(), "job", "other", time.Hour); !held {
+		t.Errorf("Expected the lease to be released when Run returns")
+	}
+}
+
+func TestRedis(t *testing.T) {
+	values := map[string]string{}
+	leaser := Redis{Prefix: "gonnect:", Eval: func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+		current, ok := values[keys[0]]
+		switch script {
+		case redisAcquireScript:
+			if !ok || current == args[0] {
+				values[keys[0]] = args[0].(string)
+				return int64(1), nil
+			}
+		case redisReleaseScript:
+			if current == args[0] {
+				delete(values, keys[0])
+				return int64(1), nil
+			}
+		}
+		return int64(0), nil
+	}}
+	ctx := context.Background()
+	if held, err := leaser.TryAcquire(ctx, "job", "first", time.Hour); err != nil || !held {
+		t.Fatalf("Expected first to acquire the lease, but got %v (%v)", held, err)
+	}
+	if _, ok := values["gonnect:job"]; !ok {
+		t.Errorf("Expected the lease key to be prefixed")
+	}
+	if held, _ := leaser.TryAcquire(ctx, "job", "second", time.Hour); held {
+		t.Errorf("Expected second not to acquire the lease held by first")
+	}
+	if err := leaser.Release(ctx, "job", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if held, _ := leaser.TryAcquire(ctx, "job", "second", time.Hour); !held {
+		t.Errorf("Expected second to acquire the released lease")
+	}
+}
@@ -0,0 +1,54 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RedisEvaluator runs a Lua script on a Redis server, it is satisfied by a
+// small adapter around any Redis client, for example with go-redis:
+//
+//	func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return rdb.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisEvaluator func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+
+const (
+	redisAcquireScript = `
+local current = redis.call("GET", KEYS[1])
+if current == false or current == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0`
+	redisReleaseScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+)
+
+// Redis is a Leaser storing each lease as an expiring Redis key
+type Redis struct {
+	Eval RedisEvaluator
+	// Prefix is prepended to the lease names to form the keys
+	Prefix string
+}
+
+func (r Redis) TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	result, err := r.Eval(ctx, redisAcquireScript, []string{r.Prefix + name}, holder, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+	acquired, ok := result.(int64)
+	if !ok {
+		return false, fmt.Errorf("unexpected redis result %v", result)
+	}
+	return acquired == 1, nil
+}
+
+func (r Redis) Release(ctx context.Context, name, holder string) error {
+	_, err := r.Eval(ctx, redisReleaseScript, []string{r.Prefix + name}, holder)
+	return err
+}
@@ -0,0 +1,129 @@
+package gonnect
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// LifecyclePolicy decides how the lifecycle handlers answer when the
+// OnInstalled or OnUninstalled callback of the application fails
+type LifecyclePolicy int
+
+const (
+	// LifecycleFail rolls back the tenant changes and fails the lifecycle
+	// request, so that the host product reports the failed install
+	LifecycleFail LifecyclePolicy = iota
+	// LifecycleContinue keeps the tenant changes and only logs the failure
+	LifecycleContinue
+	// LifecycleRetryLater keeps the tenant changes and enqueues the callback
+	// on the LifecycleRetries queue, the request fails when it cannot be
+	// enqueued
+	LifecycleRetryLater
+)
+
+func (p LifecyclePolicy) String() string {
+	switch p {
+	case LifecycleFail:
+		return "fail"
+	case LifecycleContinue:
+		return "continue"
+	case LifecycleRetryLater:
+		return "retry-later"
+	}
+	return fmt.Sprintf("LifecyclePolicy(%d)", int(p))
+}
+
+// SignedInstallContextKey is true for install requests verified with the
+// install keys of Atlassian
+const SignedInstallContextKey = "signedInstall"
+
+// SiteCollisionPolicy decides how the installed handler answers an install
+// whose baseUrl is the one of a stored tenant with another clientKey, e.g.
+// after the site was re-provisioned or the add-on was installed overtop a
+// previous installation
+type SiteCollisionPolicy int
+
+const (
+	// CollisionKeepBoth stores the new tenant next to the previous one
+	CollisionKeepBoth SiteCollisionPolicy = iota
+	// CollisionReplace deletes the previous tenants of the site when storing
+	// the new one. Only installs signed with the install keys of Atlassian
+	// replace tenants, see Profile.SignedInstall, the others are stored next
+	// to the previous tenants like with CollisionKeepBoth
+	CollisionReplace
+	// CollisionReject fails the install with 409 and keeps the previous
+	// tenant. Unsigned installs are only rejected when the previous tenant
+	// was installed with a signed install, see Profile.SignedInstall, the
+	// others are stored next to the previous tenants like with
+	// CollisionKeepBoth
+	CollisionReject
+)
+
+func (p SiteCollisionPolicy) String() string {
+	switch p {
+	case CollisionKeepBoth:
+		return "keep-both"
+	case CollisionReplace:
+		return "replace"
+	case CollisionReject:
+		return "reject"
+	}
+	return fmt.Sprintf("SiteCollisionPolicy(%d)", int(p))
+}
+
+// LifecycleRetry is a failed lifecycle callback, it only holds serializable
+// values so it can be stored by persistent job queues
+type LifecycleRetry struct {
+	// EventType is the lifecycle event, "installed" or "uninstalled"
+	EventType string                  `json:"eventType"`
+	ClientKey string                  `json:"clientKey"`
+	Payload   *store.LifecyclePayload `json:"-"`
+	// RawPayload is the lifecycle request body, it holds the shared secret
+	RawPayload []byte `json:"payload,omitempty"`
+	// Error is the message of the failure of the callback
+	Error string `json:"error"`
+}
+
+// LifecycleRetryQueue runs failed lifecycle callbacks later, usually backed
+// by the job queue of the application calling Addon.RetryLifecycle, see
+// lifecycleretry.Queue for an in-memory queue
+type LifecycleRetryQueue interface {
+	Enqueue(ctx context.Context, retry LifecycleRetry) error
+}
+
+// RetryLifecycle calls the lifecycle callback of retry again with the stored
+// tenant and the original payload in the context, in a new store
+// transaction
+func (a *Addon) RetryLifecycle(ctx context.Context, retry LifecycleRetry) error {
+	var callback LifecycleFunc
+	switch retry.EventType {
+	case "installed":
+		callback = a.OnInstalled
+	case "uninstalled":
+		callback = a.OnUninstalled
+	default:
+		return fmt.Errorf("unknown lifecycle event %q", retry.EventType)
+	}
+	if callback == nil {
+		return nil
+	}
+	payload := retry.Payload
+	if payload == nil && len(retry.RawPayload) > 0 {
+		var err error
+		if payload, err = store.NewLifecyclePayloadFromBytes(retry.RawPayload); err != nil {
+			return err
+		}
+	}
+	if payload != nil {
+		ctx = store.WithLifecyclePayload(ctx, payload)
+	}
+	return store.WithTx(ctx, a.Store, func(tx store.TenantStore) error {
+		tenant, err := tx.Get(retry.ClientKey)
+		if err != nil {
+			return err
+		}
+		return callback(ctx, tx, tenant)
+	})
+}
@@ -0,0 +1,211 @@
+// Package lifecycleretry runs the failed lifecycle callbacks of the
+// LifecycleRetryLater policy again in the background, with exponential
+// backoff, so transient failures of downstream provisioning do not leave
+// tenants half-provisioned
+package lifecycleretry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+)
+
+// Job is a pending lifecycle callback of the Queue
+type Job struct {
+	Retry gonnect.LifecycleRetry
+	// Attempts is the number of retries which failed so far
+	Attempts    int
+	NextAttempt time.Time
+}
+
+// Queue is an in-memory gonnect.LifecycleRetryQueue, the jobs are lost when
+// the process exits and are run on the replica which enqueued them.
+// Applications with a persistent job queue implement the interface with it
+// instead. Set it as Addon.LifecycleRetries and call Run in the background:
+//
+//	queue := lifecycleretry.New(addon)
+//	addon.LifecyclePolicy = gonnect.LifecycleRetryLater
+//	addon.LifecycleRetries = queue
+//	go queue.Run(ctx, time.Second)
+type Queue struct {
+	Addon *gonnect.Addon
+	// MaxAttempts is the number of retries before a job is given up on
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles with every
+	// failed retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	mu   sync.Mutex
+	jobs []*Job
+}
+
+// New returns a Queue retrying the callbacks of addon with the defaults
+func New(addon *gonnect.Addon) *Queue {
+	return &Queue{
+		Addon:       addon,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+	}
+}
+
+// Enqueue schedules the first retry after Backoff. A pending job of the same
+// tenant is replaced, the newer lifecycle event supersedes it
+func (q *Queue) Enqueue(ctx context.Context, retry gonnect.LifecycleRetry) error {
+	if retry.ClientKey == "" {
+		return errors.New("lifecycle retry without a clientKey")
+	}
+	job := &Job{Retry: retry, NextAttempt: time.Now().Add(q.backoff(0))}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, pending := range q.jobs {
+		if pending.Retry.ClientKey == retry.ClientKey {
+			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+			break
+		}
+	}
+	q.jobs = append(q.jobs, job)
+	metrics.Set("lifecycle_retries_pending", int64(len(q.jobs)))
+	log.InfoF("retrying %s callback of tenant %s at %s: %s", retry.EventType, retry.ClientKey, job.NextAttempt.UTC().Format(time.RFC3339), retry.Error)
+	return nil
+}
+
+// Pending returns a copy of the pending jobs
+func (q *Queue) Pending() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+// backoff returns the delay after the failed attempts
+func (q *Queue) backoff(attempts int) time.Duration {
+	backoff, max := q.Backoff, q.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	for i := 0; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+func (q *Queue) maxAttempts() int {
+	if q.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return q.MaxAttempts
+}
+
+// due removes the jobs due at now from the queue
+func (q *Queue) due(now time.Time) []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var due []*Job
+	pending := q.jobs[:0]
+	for _, job := range q.jobs {
+		if job.NextAttempt.After(now) {
+			pending = append(pending, job)
+		} else {
+			due = append(due, job)
+		}
+	}
+	q.jobs = pending
+	return due
+}
+
+// requeue adds a job back unless the tenant was enqueued again meanwhile
+func (q *Queue) requeue(job *Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, pending := range q.jobs {
+		if pending.Retry.ClientKey == job.Retry.ClientKey {
+			return
+		}
+	}
+	q.jobs = append(q.jobs, job)
+}
+
+// RunDue retries the due jobs and returns how many succeeded. Failed jobs
+// are retried after the backoff until MaxAttempts, jobs of deleted tenants
+// are dropped
+func (q *Queue) RunDue(ctx context.Context) (succeeded int, err error) {
+	var errs []error
+	for _, job := range q.due(time.Now()) {
+		if ctx.Err() != nil {
+			q.requeue(job)
+			continue
+		}
+		retryErr := q.Addon.RetryLifecycle(ctx, job.Retry)
+		switch {
+		case retryErr == nil:
+			succeeded++
+			metrics.Add("lifecycle_retries_succeeded", 1)
+		case errors.Is(retryErr, store.ErrNotFound):
+			log.WarnF("dropping %s callback retry of deleted tenant %s", job.Retry.EventType, job.Retry.ClientKey)
+		default:
+			job.Attempts++
+			job.Retry.Error = retryErr.Error()
+			if job.Attempts < q.maxAttempts() {
+				job.NextAttempt = time.Now().Add(q.backoff(job.Attempts))
+				q.requeue(job)
+				break
+			}
+			metrics.Add("lifecycle_retries_abandoned", 1)
+			errs = append(errs, fmt.Errorf("tenant %s: %w", job.Retry.ClientKey, retryErr))
+			log.ErrorF("giving up on %s callback of tenant %s after %d retries: %v", job.Retry.EventType, job.Retry.ClientKey, job.Attempts, retryErr)
+			errorreport.Report(ctx, errorreport.Event{
+				Kind:      errorreport.KindLifecycle,
+				Err:       retryErr,
+				ClientKey: job.Retry.ClientKey,
+				Fields: map[string]string{
+					"event":    job.Retry.EventType,
+					"attempts": fmt.Sprint(job.Attempts),
+				},
+			})
+		}
+	}
+	metrics.Set("lifecycle_retries_pending", int64(len(q.Pending())))
+	return succeeded, errors.Join(errs...)
+}
+
+// Run retries the due jobs every interval until ctx is done. It needs no
+// lease, every replica retries the jobs it enqueued itself
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// failures are logged and reported per job
+			_, _ = q.RunDue(ctx)
+		}
+	}
+}
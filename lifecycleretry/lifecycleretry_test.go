@@ -0,0 +1,107 @@
+package lifecycleretry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestQueue(t *testing.T) {
+	addon := &gonnect.Addon{}
+	var err error
+	if addon.Store, err = store.NewStatic(store.Tenant{ClientKey: "client", SharedSecret: "secret", BaseURL: "https://example.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+	failures := 2
+	var calls int
+	addon.OnInstalled = func(ctx context.Context, tx store.TenantStore, tenant *store.Tenant) error {
+		calls++
+		if _, ok := store.LifecyclePayloadFromContext(ctx); !ok {
+			t.Error("retried callback without the lifecycle payload")
+		}
+		if calls <= failures {
+			return errors.New("provisioning unavailable")
+		}
+		return nil
+	}
+
+	q := New(addon)
+	q.Backoff, q.MaxBackoff, q.MaxAttempts = time.Nanosecond, time.Nanosecond, 2
+	retry := gonnect.LifecycleRetry{
+		EventType:  "installed",
+		ClientKey:  "client",
+		RawPayload: []byte(`{"key":"addon","clientKey":"client","sharedSecret":"secret","baseUrl":"https://example.atlassian.net","eventType":"installed"}`),
+	}
+	if err = q.Enqueue(context.Background(), retry); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Enqueue(context.Background(), retry); err != nil {
+		t.Fatal(err)
+	}
+	if pending := q.Pending(); len(pending) != 1 {
+		t.Fatalf("Expected the second enqueue to replace the first, but got %d jobs", len(pending))
+	}
+
+	time.Sleep(time.Millisecond)
+	if succeeded, err := q.RunDue(context.Background()); succeeded != 0 || err != nil {
+		t.Fatalf("Expected the first retry to fail without an error, but got %d succeeded, %v", succeeded, err)
+	}
+	pending := q.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].Retry.Error != "provisioning unavailable" {
+		t.Fatalf("Expected the failed job to be requeued, but got %+v", pending)
+	}
+
+	// the second failure exhausts MaxAttempts
+	time.Sleep(time.Millisecond)
+	if _, err := q.RunDue(context.Background()); err == nil {
+		t.Fatal("Expected the abandoned job to be returned as error")
+	}
+	if pending := q.Pending(); len(pending) != 0 {
+		t.Fatalf("Expected the abandoned job to be dropped, but got %+v", pending)
+	}
+
+	q.MaxAttempts = DefaultMaxAttempts
+	if err = q.Enqueue(context.Background(), retry); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if succeeded, err := q.RunDue(context.Background()); succeeded != 1 || err != nil {
+		t.Fatalf("Expected the third retry to succeed, but got %d succeeded, %v", succeeded, err)
+	}
+
+	// jobs of deleted tenants are dropped
+	if err = q.Enqueue(context.Background(), gonnect.LifecycleRetry{EventType: "installed", ClientKey: "deleted"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := q.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pending := q.Pending(); len(pending) != 0 {
+		t.Fatalf("Expected the job of the deleted tenant to be dropped, but got %+v", pending)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := &Queue{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+	testCases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 0, expected: time.Second},
+		{attempts: 1, expected: 2 * time.Second},
+		{attempts: 2, expected: 4 * time.Second},
+		{attempts: 3, expected: 8 * time.Second},
+		{attempts: 4, expected: 10 * time.Second},
+		{attempts: 5, expected: 10 * time.Second},
+	}
+	for _, testCase := range testCases {
+		if backoff := q.backoff(testCase.attempts); backoff != testCase.expected {
+			t.Errorf("Expected a backoff of %v after %d attempts, but got %v", testCase.expected, testCase.attempts, backoff)
+		}
+	}
+}
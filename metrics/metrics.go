@@ -0,0 +1,105 @@
+// Package metrics publishes the gonnect counters and gauges through expvar,
+// they are served as JSON under the "gonnect" key of /debug/vars
+package metrics
+
+import (
+	"expvar"
+	"sync"
+)
+
+var (
+	vars  = expvar.NewMap("gonnect")
+	mutex sync.Mutex
+)
+
+func intVar(name string) *expvar.Int {
+	if v, ok := vars.Get(name).(*expvar.Int); ok {
+		return v
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if v, ok := vars.Get(name).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	vars.Set(name, v)
+	return v
+}
+
+func mapVar(name string) *expvar.Map {
+	if v, ok := vars.Get(name).(*expvar.Map); ok {
+		return v
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if v, ok := vars.Get(name).(*expvar.Map); ok {
+		return v
+	}
+	v := new(expvar.Map).Init()
+	vars.Set(name, v)
+	return v
+}
+
+// Add increments the counter name by delta
+func Add(name string, delta int64) {
+	intVar(name).Add(delta)
+}
+
+// Set sets the gauge name to value
+func Set(name string, value int64) {
+	intVar(name).Set(value)
+}
+
+// Get returns the current value of the counter or gauge name
+func Get(name string) int64 {
+	return intVar(name).Value()
+}
+
+// AddLabel increments the counter of label within the labelled counter name
+func AddLabel(name, label string, delta int64) {
+	mapVar(name).Add(label, delta)
+}
+
+// GetLabel returns the current value of label within the labelled counter
+// name
+func GetLabel(name, label string) int64 {
+	if v, ok := mapVar(name).Get(label).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// SetLabelFloat sets the gauge of label within the labelled gauge name to
+// value, e.g. a rate
+func SetLabelFloat(name, label string, value float64) {
+	v := new(expvar.Float)
+	v.Set(value)
+	mapVar(name).Set(label, v)
+}
+
+// GetLabelFloat returns the current value of label within the labelled gauge
+// name
+func GetLabelFloat(name, label string) float64 {
+	if v, ok := mapVar(name).Get(label).(*expvar.Float); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// SetExemplar records value as the latest example of label within the
+// labelled counter name, e.g. the request behind a failure, served under
+// name + "_exemplars"
+func SetExemplar(name, label, value string) {
+	v := new(expvar.String)
+	v.Set(value)
+	mapVar(name+"_exemplars").Set(label, v)
+}
+
+// GetExemplar returns the latest example of label within the labelled
+// counter name
+func GetExemplar(name, label string) string {
+	if v, ok := mapVar(name + "_exemplars").Get(label).(*expvar.String); ok {
+		return v.Value()
+	}
+	return ""
+}
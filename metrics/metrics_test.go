@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	Add("test_counter", 2)
+	Add("test_counter", 3)
+	if got := Get("test_counter"); got != 5 {
+		t.Errorf("Expected test_counter to be %v, but got %v", 5, got)
+	}
+	Set("test_gauge", 7)
+	Set("test_gauge", 4)
+	if got := Get("test_gauge"); got != 4 {
+		t.Errorf("Expected test_gauge to be %v, but got %v", 4, got)
+	}
+	AddLabel("test_labelled", "a", 1)
+	AddLabel("test_labelled", "a", 1)
+	AddLabel("test_labelled", "b", 1)
+	if got := GetLabel("test_labelled", "a"); got != 2 {
+		t.Errorf("Expected test_labelled{a} to be %v, but got %v", 2, got)
+	}
+	if got := GetLabel("test_labelled", "missing"); got != 0 {
+		t.Errorf("Expected test_labelled{missing} to be %v, but got %v", 0, got)
+	}
+	SetLabelFloat("test_rates", "a", 0.5)
+	SetLabelFloat("test_rates", "a", 1.5)
+	if got := GetLabelFloat("test_rates", "a"); got != 1.5 {
+		t.Errorf("Expected test_rates{a} to be %v, but got %v", 1.5, got)
+	}
+	if got := GetLabelFloat("test_rates", "missing"); got != 0 {
+		t.Errorf("Expected test_rates{missing} to be %v, but got %v", 0, got)
+	}
+	SetExemplar("test_labelled", "a", "first")
+	SetExemplar("test_labelled", "a", "second")
+	if got := GetExemplar("test_labelled", "a"); got != "second" {
+		t.Errorf("Expected the exemplar of test_labelled{a} to be %v, but got %v", "second", got)
+	}
+}
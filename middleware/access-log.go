@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+)
+
+// statusRecorder records the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+// AccessLogMiddleware logs a line per request with its status, size and
+// duration through the reqlog.Logger of the request
+type AccessLogMiddleware struct {
+	h     http.Handler
+	addon *gonnect.Addon
+}
+
+func (h AccessLogMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w}
+	defer func() {
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		reqlog.FromContext(r.Context()).InfoF("%s %s %d %dB %v", r.Method, r.URL.Path, status, recorder.size, time.Since(started))
+	}()
+	h.h.ServeHTTP(recorder, r)
+}
+
+func NewAccessLogMiddleware(addon *gonnect.Addon) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return AccessLogMiddleware{next, addon}
+	}
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/events"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+)
+
+// AuthReason is a stable, machine-readable code for why a request failed to
+// authenticate, used in error responses, logs and the auth_failures metric
+type AuthReason string
+
+const (
+	AuthMissingToken   AuthReason = "missing_token"
+	AuthMalformedToken AuthReason = "malformed_token"
+	AuthBadIssuer      AuthReason = "bad_issuer"
+	AuthBadAudience    AuthReason = "bad_audience"
+	AuthMissingQsh     AuthReason = "missing_qsh"
+	AuthQshMismatch    AuthReason = "qsh_mismatch"
+	AuthUnknownTenant  AuthReason = "unknown_tenant"
+	AuthMissingSecret  AuthReason = "missing_secret"
+	AuthBadSignature   AuthReason = "bad_signature"
+	AuthExpired        AuthReason = "expired"
+	AuthUnpinnedKey    AuthReason = "unpinned_key"
+	AuthClientMismatch AuthReason = "client_mismatch"
+	AuthRevoked        AuthReason = "revoked"
+	AuthTimeout        AuthReason = "timeout"
+	// AuthContextMismatch are context query parameters differing from the
+	// context claim, see Profile.ValidateContextParams
+	AuthContextMismatch AuthReason = "context_mismatch"
+	// AuthConflictingToken is a request holding different tokens in its
+	// sources, see Profile.StrictTokenSources
+	AuthConflictingToken AuthReason = "conflicting_token"
+)
+
+// AuthError is an authentication failure with its reason code
+type AuthError struct {
+	Reason  AuthReason `json:"reason"`
+	Message string     `json:"message"`
+	// CanonicalRequest, ExpectedQsh and ClaimedQsh explain qsh mismatches
+	// in debug mode, to compare them with the output of Atlassian's JWT
+	// decoder
+	CanonicalRequest string `json:"canonicalRequest,omitempty"`
+	ExpectedQsh      string `json:"expectedQsh,omitempty"`
+	ClaimedQsh       string `json:"claimedQsh,omitempty"`
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+func newAuthError(reason AuthReason, format string, argv ...interface{}) *AuthError {
+	return &AuthError{Reason: reason, Message: fmt.Sprintf(format, argv...)}
+}
+
+// sendAuthError responds with a 401 JSON body holding the reason code of
+// err, errors which are not an AuthError are reported as bad_signature,
+// verifications cut short by the auth deadline with 503 as timeout and
+// conflicting tokens with 400
+func sendAuthError(w http.ResponseWriter, r *http.Request, addon *gonnect.Addon, err error) {
+	var authErr *AuthError
+	switch {
+	case errors.As(err, &authErr):
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		authErr = &AuthError{Reason: AuthTimeout, Message: err.Error()}
+	default:
+		authErr = &AuthError{Reason: AuthBadSignature, Message: err.Error()}
+	}
+	metrics.AddLabel("auth_failures", string(authErr.Reason), 1)
+	log.WarnRDF(r, 1, "auth failure [%s]: %s", authErr.Reason, authErr.Message)
+	if authErr.CanonicalRequest != "" {
+		log.WarnRDF(r, 1, "auth failure [%s]: canonical request %q, expected qsh %s, claimed qsh %s", authErr.Reason, authErr.CanonicalRequest, authErr.ExpectedQsh, authErr.ClaimedQsh)
+		metrics.SetExemplar("auth_failures", string(authErr.Reason), authErr.CanonicalRequest)
+	}
+	events.Publish(r.Context(), events.Event{
+		Topic:  events.TopicAuthFailure,
+		Fields: map[string]string{"reason": string(authErr.Reason), "message": authErr.Message, "path": r.URL.Path},
+	})
+	if authErr.Reason == AuthUnknownTenant && addon != nil && addon.UnknownTenantPolicy == gonnect.UnknownTenantReinstallPage && acceptsHTML(r) {
+		sendReinstallPage(w, r, addon)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if authErr.Reason == AuthTimeout {
+		// the request could not be verified in time, it may be retried
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else if authErr.Reason == AuthConflictingToken {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	_ = json.NewEncoder(w).Encode(authErr)
+}
+
+// acceptsHTML reports whether r is a page request rather than an API call of
+// the page
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// sendReinstallPage responds with 401 and the ReinstallPage of the add-on
+func sendReinstallPage(w http.ResponseWriter, r *http.Request, addon *gonnect.Addon) {
+	tmpl, data := addon.ReinstallPageTemplate()
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		log.ErrorRDF(r, 1, "rendering the reinstall page: %v", err)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	_, _ = buffer.WriteTo(w)
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+)
+
+const redacted = "[redacted]"
+
+// authTrace collects the decision trail of a single authentication, it is
+// only logged when the AuthTrace configuration covers the tenant
+type authTrace struct {
+	config    *gonnect.AuthTraceConfiguration
+	r         *http.Request
+	clientKey string
+	steps     []string
+}
+
+func newAuthTrace(addon *gonnect.Addon, r *http.Request) *authTrace {
+	if addon.Config == nil || addon.Config.AuthTrace == nil || !addon.Config.AuthTrace.Enabled {
+		return nil
+	}
+	return &authTrace{config: addon.Config.AuthTrace, r: r}
+}
+
+func (t *authTrace) add(format string, argv ...interface{}) {
+	if t != nil {
+		t.steps = append(t.steps, fmt.Sprintf(format, argv...))
+	}
+}
+
+func (t *authTrace) setClientKey(clientKey string) {
+	if t != nil {
+		t.clientKey = clientKey
+	}
+}
+
+// claims adds the token claims with secret looking values redacted
+func (t *authTrace) claims(claims map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	safe := make(map[string]interface{}, len(claims))
+	for key, value := range claims {
+		lower := strings.ToLower(key)
+		if strings.Contains(lower, "secret") || strings.Contains(lower, "token") || strings.Contains(lower, "password") {
+			value = redacted
+		}
+		safe[key] = value
+	}
+	data, _ := json.Marshal(safe)
+	t.add("claims: %s", data)
+}
+
+// flush logs the trail with the outcome of the authentication
+func (t *authTrace) flush(outcome string) {
+	if t == nil || !t.config.Traces(t.clientKey) {
+		return
+	}
+	t.add("outcome: %s", outcome)
+	reqlog.FromContext(t.r.Context()).InfoF("auth trace %s %s:\n  %s", t.r.Method, t.r.URL.Path, strings.Join(t.steps, "\n  "))
+}
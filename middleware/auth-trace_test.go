@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+func TestAuthTrace(t *testing.T) {
+	testCases := []struct {
+		config    *gonnect.AuthTraceConfiguration
+		clientKey string
+		traced    bool
+	}{
+		{config: nil, clientKey: "a", traced: false},
+		{config: &gonnect.AuthTraceConfiguration{Enabled: false}, clientKey: "a", traced: false},
+		{config: &gonnect.AuthTraceConfiguration{Enabled: true}, clientKey: "a", traced: true},
+		{config: &gonnect.AuthTraceConfiguration{Enabled: true, ClientKeys: []string{"b"}}, clientKey: "a", traced: false},
+		{config: &gonnect.AuthTraceConfiguration{Enabled: true, ClientKeys: []string{"b"}}, clientKey: "b", traced: true},
+	}
+	for _, testCase := range testCases {
+		if traced := testCase.config.Traces(testCase.clientKey); traced != testCase.traced {
+			t.Errorf("Expected Traces(%s) of %+v to be %v, but got %v", testCase.clientKey, testCase.config, testCase.traced, traced)
+		}
+	}
+
+	addon := &gonnect.Addon{Config: &gonnect.Profile{AuthTrace: &gonnect.AuthTraceConfiguration{Enabled: true}}}
+	trace := newAuthTrace(addon, httptest.NewRequest("GET", "/page", nil))
+	trace.claims(map[string]interface{}{"iss": "client", "accessToken": "abc", "clientSecret": "def"})
+	steps := strings.Join(trace.steps, "\n")
+	if strings.Contains(steps, "abc") || strings.Contains(steps, "def") {
+		t.Errorf("Expected secret claims to be redacted, but got %s", steps)
+	}
+	if !strings.Contains(steps, `"iss":"client"`) {
+		t.Errorf("Expected claims to include the issuer, but got %s", steps)
+	}
+
+	var disabled *authTrace
+	disabled.add("ignored")
+	disabled.flush("ignored")
+}
@@ -1,15 +1,24 @@
 package middleware
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
 	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/patrickmn/go-cache"
 
 	"github.com/go-enjin/be/pkg/log"
 )
@@ -23,45 +32,112 @@ type AuthenticationMiddleware struct {
 	skipQsh bool
 }
 
-func extractUnverifiedClaims(tokenStr string, validator jwt.Keyfunc) (jwt.MapClaims, bool) {
-	token, _ := jwt.Parse(tokenStr, validator)
-	if token == nil {
-		return nil, false
+// tokenParser is shared by all requests, parsers only hold their options
+var tokenParser = &jwt.Parser{}
+
+// parseUnverified decodes the token once, its signature is verified with
+// verifyToken after the tenant was looked up from the unverified claims. The
+// token is nil when it could not be decoded, tokens with an unknown signing
+// method are returned together with the error
+func parseUnverified(tokenStr string) (*jwt.Token, []string, error) {
+	token, parts, err := tokenParser.ParseUnverified(tokenStr, jwt.MapClaims{})
+	if token == nil || len(parts) != 3 {
+		return nil, nil, err
 	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		return claims, true
-	} else {
+	if _, ok := token.Claims.(jwt.MapClaims); !ok {
 		log.ErrorF("Invalid JWT Token")
-		return nil, false
+		return nil, nil, err
 	}
+	return token, parts, err
 }
 
-func ExtractJwt(r *http.Request) (string, bool) {
-	var tokenInQuery = r.URL.Query().Get(JWT_PARAM)
-	if tokenInQuery == "" && r.Body == http.NoBody {
-		return "", false
+// verifyToken verifies the claims and signature of a token decoded by
+// parseUnverified like jwt.Parse, without decoding it again
+func verifyToken(token *jwt.Token, parts []string, parseErr error, keyFunc jwt.Keyfunc) error {
+	if parseErr != nil {
+		return parseErr
+	}
+	key, err := keyFunc(token)
+	if err != nil {
+		return &jwt.ValidationError{Inner: err, Errors: jwt.ValidationErrorUnverifiable}
+	}
+	if err = token.Claims.Valid(); err != nil {
+		return err
+	}
+	if err = token.Method.Verify(strings.Join(parts[0:2], "."), parts[2], key); err != nil {
+		return &jwt.ValidationError{Inner: err, Errors: jwt.ValidationErrorSignatureInvalid}
 	}
+	token.Signature = parts[2]
+	token.Valid = true
+	return nil
+}
 
-	tokenInBody := r.PostFormValue(JWT_PARAM)
+// ExtractJwt returns the token of the request, taken from the first source
+// holding one of the "JWT" authorization header, the jwt query parameter and
+// the jwt field of a form body, false when the request holds none
+func ExtractJwt(r *http.Request) (string, bool) {
+	token, err := extractJwt(r, tokenSources{})
+	return token, err == nil
+}
 
-	if tokenInQuery != "" && tokenInBody != "" {
-		return "", false
-	}
+// maxFormMemory is the memory of multipart form bodies parsed for a token,
+// like http.Request.PostFormValue
+const maxFormMemory = 32 << 20
+
+// tokenSources are the options of extractJwt from the Profile
+type tokenSources struct {
+	// strict rejects conflicting tokens, see Profile.StrictTokenSources
+	strict bool
+	// cookie is the name of the cookie read after the form body, see
+	// Profile.TokenCookie
+	cookie string
+}
 
-	var token string
-	if tokenInBody != "" {
-		token = tokenInBody
-	} else {
-		token = tokenInQuery
+func tokenSourcesOf(addon *gonnect.Addon) tokenSources {
+	if addon == nil || addon.Config == nil {
+		return tokenSources{}
 	}
+	return tokenSources{strict: addon.Config.StrictTokenSources, cookie: addon.Config.TokenCookie}
+}
 
+// extractJwt returns the token of the request by the precedence of
+// ExtractJwt, followed by the token cookie when configured. Tokens of later
+// sources differing from it are ignored, or rejected as AuthConflictingToken
+// when strict. Form bodies are only parsed when strict or without a token in
+// the header and query
+func extractJwt(r *http.Request, options tokenSources) (string, *AuthError) {
+	var token string
 	authHeader := r.Header.Get(AUTH_HEADER)
-	if authHeader != "" && strings.HasPrefix(authHeader, "JWT ") {
-		if token != "" {
+	if strings.HasPrefix(authHeader, "JWT ") {
+		token = strings.TrimPrefix(authHeader, "JWT ")
+	}
 
-		} else {
-			token = strings.TrimPrefix(authHeader, "JWT ")
+	sources := []func() (string, error){
+		func() (string, error) { return r.URL.Query().Get(JWT_PARAM), nil },
+		func() (string, error) { return formToken(r) },
+	}
+	if options.cookie != "" {
+		sources = append(sources, func() (string, error) {
+			if cookie, err := r.Cookie(options.cookie); err == nil {
+				return cookie.Value, nil
+			}
+			return "", nil
+		})
+	}
+	for _, source := range sources {
+		if token != "" && !options.strict {
+			break
+		}
+		next, err := source()
+		if err != nil {
+			return "", newAuthError(AuthMalformedToken, "Could not parse the form body: %v", err)
+		}
+		switch {
+		case next == "" || next == token:
+		case token == "":
+			token = next
+		default:
+			return "", newAuthError(AuthConflictingToken, "Request holds different tokens in the authorization header, query, form body or cookie")
 		}
 	}
 
@@ -70,66 +146,242 @@ func ExtractJwt(r *http.Request) (string, bool) {
 	// and see if it gets removed. For now, this should work
 
 	if token == "" {
-		return "", false
+		return "", newAuthError(AuthMissingToken, "Could not find auth data on request")
 	}
-	return token, true
+	return token, nil
+}
+
+// formToken returns the jwt field of form bodies, other bodies are left
+// unread for the handlers
+func formToken(r *http.Request) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", nil
+	}
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return "", nil
+	}
+	var err error
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/x-www-form-urlencoded":
+		err = r.ParseForm()
+	case "multipart/form-data":
+		err = r.ParseMultipartForm(maxFormMemory)
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.PostForm.Get(JWT_PARAM), nil
 }
 
 func (h AuthenticationMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// TODO: Add better logging here
 	// TODO: Add AC_OPTS no-auth
-	// TODO: Refactor to be more compact
 	// TODO: scoping
 
-	token, ok := ExtractJwt(r)
-	log.DebugF(r.URL.String())
-	if !ok {
-		util.SendError(w, r, h.addon, 401, "Could not find auth data on request")
+	markAuthStarted(r)
+	trace := newAuthTrace(h.addon, r)
+	token, authErr := extractJwt(r, tokenSourcesOf(h.addon))
+	if authErr != nil {
+		trace.flush(string(authErr.Reason))
+		sendAuthError(w, r, h.addon, authErr)
 		return
 	}
 
-	unverifiedClaims, ok := extractUnverifiedClaims(token, nil)
+	tenant, verifiedToken, err := h.verify(r, token, trace)
+	if err != nil {
+		var authErr *AuthError
+		if errors.As(err, &authErr) {
+			trace.flush(string(authErr.Reason) + ": " + authErr.Message)
+			sendAuthError(w, r, h.addon, authErr)
+		} else {
+			trace.flush("error: " + err.Error())
+			sendStoreError(w, r, h.addon, err)
+		}
+		return
+	}
+	trace.flush("authenticated")
+	clientKey := tenant.ClientKey
+
+	reqlog.FromContext(r.Context()).DebugF("Auth successful")
+
+	if err = store.Touch(h.addon.Store, tenant, time.Now()); err != nil {
+		reqlog.FromContext(r.Context()).WarnF("could not update last seen at of tenant %s: %v", clientKey, err)
+	}
 
-	if !ok {
-		util.SendError(w, r, h.addon, 401, "JWT claim did not contain the issuer (iss) claim")
+	createSessionToken := func() (string, error) {
+		verClaims := verifiedToken.Claims.(jwt.MapClaims)
+
+		claims := newSessionClaims(h.addon.TenantKey(tenant), clientKey, verClaims)
+
+		key, err := sessionSigningKey(h.addon)
+		if err != nil {
+			return "", err
+		}
+		var signedToken string
+		if key != nil {
+			signedToken, err = jwt.NewWithClaims(key.method, claims).SignedString(key.sign)
+		} else {
+			secret := tenant.SecretBytes()
+			signedToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+			store.Zero(secret)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		w.Header().Set("X-acpt", signedToken) // TODO: Do we really need to do this?
+
+		return signedToken, nil
+	}
+
+	tokenString, err := createSessionToken()
+	if err != nil {
+		util.SendError(w, r, h.addon, 500, fmt.Sprintf("Could not create new access token %s", err))
 		return
 	}
 
-	if unverifiedClaims["iss"] == "" {
-		util.SendError(w, r, h.addon, 401, "JWT claim did not contain the issuer (iss) claim")
+	oldVerClaims := verifiedToken.Claims.(jwt.MapClaims)
+
+	accountID := ""
+	if oldVerClaims != nil && oldVerClaims["sub"] != nil {
+		accountID = oldVerClaims["sub"].(string)
+	}
+
+	verifiedParams := map[string]string{
+		"clientKey":   clientKey,
+		"hostBaseUrl": tenant.BaseURL,
+		"token":       tokenString,
+		// TODO: We may have to add the context workaround instead of just using sub as userAccountId, but lets ignore it for now
+		"userAccountId": accountID,
+		"tenantContext": tenant.Context.String(),
+		"capabilitySet": tenant.CapabilitySet,
+	}
+
+	if h.addon.IdentityLinker != nil {
+		principal, err := h.addon.IdentityLinker.Link(r.Context(), clientKey, accountID, oldVerClaims)
+		if errors.Is(err, gonnect.ErrIdentityRejected) {
+			util.SendError(w, r, h.addon, http.StatusForbidden, err.Error())
+			return
+		} else if err != nil {
+			util.SendError(w, r, h.addon, http.StatusInternalServerError, fmt.Sprintf("Could not link the identity of the user: %s", err))
+			return
+		}
+		if principal != nil {
+			r = r.WithContext(context.WithValue(r.Context(), gonnect.PrincipalContextKey, principal))
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), authenticatedClientKey{}, clientKey))
+	markAuthDone(r)
+	requestHandler := NewRequestMiddleware(h.addon, verifiedParams)
+
+	requestHandler(h.h).ServeHTTP(w, r)
+}
+
+// authenticatedClientKey holds the clientKey of the tenant whose token the
+// AuthenticationMiddleware verified, unlike the "clientKey" value it cannot
+// be set outside of this package
+type authenticatedClientKey struct{}
+
+// authContext returns the context of the verification of r, which ends with
+// the request or once the AuthTimeout of the configuration passed
+func authContext(addon *gonnect.Addon, r *http.Request) (context.Context, context.CancelFunc) {
+	if addon.Config != nil && addon.Config.AuthTimeout > 0 {
+		return context.WithTimeout(r.Context(), addon.Config.AuthTimeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// sendStoreError responds with 503 and a Retry-After header while the tenant
+// store is unavailable and with 500 otherwise
+func sendStoreError(w http.ResponseWriter, r *http.Request, addon *gonnect.Addon, err error) {
+	if errors.Is(err, store.ErrUnavailable) {
+		w.Header().Set("Retry-After", "1")
+		util.SendError(w, r, addon, http.StatusServiceUnavailable, err.Error())
 		return
 	}
+	util.SendError(w, r, addon, http.StatusInternalServerError, err.Error())
+}
 
-	clientKey := unverifiedClaims["iss"].(string)
+// verify checks the JWT of the request against the shared secret of the
+// tenant it was issued by, failures are returned as *AuthError while other
+// errors are internal failures
+func (h AuthenticationMiddleware) verify(r *http.Request, token string, trace *authTrace) (*store.Tenant, *jwt.Token, error) {
+	parsed, parts, parseErr := parseUnverified(token)
+	if parsed == nil {
+		return nil, nil, newAuthError(AuthMalformedToken, "Could not decode JWT Token")
+	}
+	unverifiedClaims := parsed.Claims.(jwt.MapClaims)
+	trace.claims(unverifiedClaims)
 
-	// if unverifiedClaims["aud"] != nil && unverifiedClaims["aud"] != "" {
-	// clientKey = unverifiedClaims["aud"].(string)
-	// log.DebugF("using aud as clientKey: %v", unverifiedClaims["aud"])
-	// w.WriteHeader(204)
-	// return
-	// }
+	clientKey, _ := unverifiedClaims["iss"].(string)
+	if clientKey == "" {
+		return nil, nil, newAuthError(AuthBadIssuer, "JWT claim did not contain the issuer (iss) claim")
+	}
+	// session tokens are issued by the add-on for the tenant in the audience
+	session := false
+	if audience := sessionAudience(unverifiedClaims); audience != "" && (clientKey == *h.addon.Key || clientKey == h.addon.KeyFor(r)) {
+		clientKey, session = audience, true
+	}
 
-	log.DebugF("using clientKey: %v", clientKey)
+	reqlog.FromContext(r.Context()).DebugF("using clientKey: %v", clientKey)
+	trace.setClientKey(clientKey)
 
-	queryStringHash := unverifiedClaims["qsh"]
-	if queryStringHash == "" && !h.skipQsh {
-		util.SendError(w, r, h.addon, 401, "JWT claim did not contain the query string hash (qsh) claim")
+	if queryStringHash, _ := unverifiedClaims["qsh"].(string); queryStringHash == "" && !h.skipQsh {
+		return nil, nil, newAuthError(AuthMissingQsh, "JWT claim did not contain the query string hash (qsh) claim")
 	}
 
 	tenant, err := h.addon.Store.Get(clientKey)
-
+	if err == nil && h.addon.Config.TenantExpired(tenant, time.Now()) {
+		trace.add("ephemeral tenant expired, last seen %v", tenant.LastSeenAt)
+		tenant, err = nil, store.ErrNotFound
+	}
+	resolved := false
+	if errors.Is(err, store.ErrNotFound) && h.addon.UnknownTenantPolicy == gonnect.UnknownTenantResolve {
+		tenant, err = resolveTenant(r, h.addon, clientKey, unverifiedClaims, trace)
+		resolved = err == nil
+	}
 	if err != nil {
-		util.SendError(w, r, h.addon, 500, "Could not lookup stored client data for clientKey")
-		return
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil, newAuthError(AuthUnknownTenant, "Could not find stored client data for clientKey")
+		}
+		return nil, nil, fmt.Errorf("Could not lookup stored client data for clientKey: %w", err)
 	}
 
-	secret := tenant.SharedSecret
-	if secret == "" {
-		util.SendError(w, r, h.addon, 401, "Could not find JQT sharedSecret in tenant clientKey")
-		return
+	if trace != nil {
+		trace.add("tenant: baseUrl %s, installed %v, secret fingerprint %s", tenant.BaseURL, tenant.AddonInstalled, tenant.SecretFingerprint())
 	}
 
-	verifiedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+	if tenant.SharedSecret == "" {
+		return nil, nil, newAuthError(AuthMissingSecret, "Could not find JWT sharedSecret in tenant clientKey")
+	}
+	if h.addon.Config.FIPS() && len(tenant.SharedSecret) < gonnect.MinFIPSHMACKeyBytes {
+		return nil, nil, newAuthError(AuthMissingSecret, "sharedSecret of the tenant is shorter than FIPS mode allows")
+	}
+	secret := tenant.SecretBytes()
+	defer store.Zero(secret)
+
+	var key *sessionKey
+	if session {
+		if key, err = sessionSigningKey(h.addon); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = verifyToken(parsed, parts, parseErr, func(token *jwt.Token) (interface{}, error) {
+		// session tokens signed with the key of the add-on are only verified
+		// with it, the shared secret of the tenant cannot forge them
+		if key != nil {
+			if token.Method.Alg() != key.method.Alg() {
+				return nil, fmt.Errorf("expected %v session token, actual: %v", key.method.Alg(), token.Header["alg"])
+			}
+			trace.add("verifying %v signature with the session signing key", token.Header["alg"])
+			return key.verify, nil
+		}
 
 		switch token.Header["alg"] {
 		case "none":
@@ -150,103 +402,167 @@ func (h AuthenticationMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Reque
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
-		return []byte(secret), nil
+		trace.add("verifying %v signature with the tenant shared secret", token.Header["alg"])
+		return secret, nil
 	})
 
 	if err != nil {
-		log.ErrorF("JWT Token verification error: %v", err)
-		util.SendError(w, r, h.addon, 500, "Could not verify JWT Token")
-		return
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, nil, newAuthError(AuthExpired, "Auth request has expired")
+		}
+		reqlog.FromContext(r.Context()).ErrorF("JWT Token verification error: %v", err)
+		return nil, nil, newAuthError(AuthBadSignature, "Could not verify JWT Token")
 	}
 
-	err = verifiedToken.Claims.Valid()
-	if err != nil {
-		util.SendError(w, r, h.addon, 500, "Could not find verify JWT Claims; Auth request has expired")
-		return
-	}
+	claims := unverifiedClaims
 
-	claims, ok := verifiedToken.Claims.(jwt.MapClaims)
-	if !ok {
-		util.SendError(w, r, h.addon, 500, "Could not cast Claims")
-		return
+	if trace != nil {
+		if h.skipQsh {
+			trace.add("qsh check skipped")
+		} else {
+			trace.add("canonical request: %q, expected qsh %s, claimed qsh %v",
+				atlasjwt.CreateCanonicalRequest(r, false, h.addon.BaseUrlFor(r)),
+				atlasjwt.CreateQueryStringHash(r, false, h.addon.BaseUrlFor(r)), claims["qsh"])
+		}
 	}
 
-	ok = ValidateQshFromRequest(claims, r, h.addon, h.skipQsh)
-	if !ok {
-		util.SendError(w, r, h.addon, 401, "Auth failure: Query hash mismatch")
-		return
+	if !ValidateQshFromRequest(claims, r, h.addon, h.skipQsh) {
+		authErr := newAuthError(AuthQshMismatch, "Auth failure: Query hash mismatch")
+		if h.debugging(clientKey) {
+			baseUrl := h.addon.BaseUrlFor(r)
+			authErr.CanonicalRequest = atlasjwt.CreateCanonicalRequest(r, false, baseUrl)
+			authErr.ExpectedQsh = atlasjwt.CreateQueryStringHash(r, false, baseUrl)
+			authErr.ClaimedQsh, _ = claims["qsh"].(string)
+		}
+		return nil, nil, authErr
 	}
 
-	log.DebugF("Auth successful")
-
-	createSessionToken := func() (string, error) {
-		verClaims := verifiedToken.Claims.(jwt.MapClaims)
+	if config := h.addon.Config; config != nil && config.ValidateContextParams {
+		if err = validateContextParams(claims, r); err != nil {
+			return nil, nil, err
+		}
+	}
 
-		claims := &jwt.StandardClaims{
-			Issuer: *h.addon.Key,
-			// TODO: Check if subject can be asserted
-			Audience: clientKey,
+	if session {
+		if err = h.verifySession(claims, tenant, trace); err != nil {
+			return nil, nil, err
 		}
-		subject, ok := verClaims["subject"].(string)
-		if ok {
-			claims.Subject = subject
+	}
+
+	// resolved tenants are only stored once a request of theirs was verified
+	if resolved {
+		if tenant, err = h.addon.Store.Set(tenant); err != nil {
+			return nil, nil, fmt.Errorf("Could not store the resolved tenant: %w", err)
 		}
+		reqlog.FromContext(r.Context()).InfoF("resolved unknown tenant %s", tenant.BaseURL)
+	}
 
-		// TODO: We may have to add the context workaround, but lets ignore it for now
+	return tenant, parsed, nil
+}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		signedToken, err := token.SignedString([]byte(tenant.SharedSecret))
-		if err != nil {
-			return "", err
-		}
+// ResolveMissTTL is how long a clientKey the ResolveTenant hook of the add-on
+// did not find is answered as unknown without asking the hook again, so that
+// tokens of arbitrary issuers do not each reach the provisioning service
+var ResolveMissTTL = time.Minute
 
-		w.Header().Set("X-acpt", signedToken) // TODO: Do we really need to do this?
+// resolveMisses are the clientKeys not found by the ResolveTenant hooks,
+// keyed by the add-on and the clientKey
+var resolveMisses = cache.New(cache.NoExpiration, 10*time.Minute)
 
-		return signedToken, nil
+// resolveTenant looks up an unknown tenant with the ResolveTenant hook of the
+// add-on, the request is verified against it afterwards
+func resolveTenant(r *http.Request, addon *gonnect.Addon, clientKey string, claims jwt.MapClaims, trace *authTrace) (*store.Tenant, error) {
+	if addon.ResolveTenant == nil {
+		return nil, store.ErrNotFound
 	}
-
-	tokenString, err := createSessionToken()
-	if err != nil {
-		util.SendError(w, r, h.addon, 500, fmt.Sprintf("Could not create new access token %s", err))
-		return
+	missKey := fmt.Sprintf("%p %s", addon, clientKey)
+	if _, missed := resolveMisses.Get(missKey); missed {
+		trace.add("unknown tenant %s was not resolved recently", clientKey)
+		return nil, store.ErrNotFound
 	}
+	tenant, err := addon.ResolveTenant(r.Context(), clientKey, claims)
+	if errors.Is(err, store.ErrNotFound) {
+		resolveMisses.Set(missKey, true, ResolveMissTTL)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	if tenant == nil || tenant.ClientKey != clientKey {
+		return nil, fmt.Errorf("resolved tenant does not match clientKey %s", clientKey)
+	}
+	trace.add("resolved unknown tenant %s", clientKey)
+	return tenant, nil
+}
 
-	oldVerClaims := verifiedToken.Claims.(jwt.MapClaims)
-
-	tenant, err = h.addon.Store.Get(clientKey)
+// verifySession rejects session tokens older than the configured max age,
+// issued before the last secret rotation of the tenant or revoked
+func (h AuthenticationMiddleware) verifySession(claims jwt.MapClaims, tenant *store.Tenant, trace *authTrace) error {
+	session, err := ParseSessionClaims(claims)
 	if err != nil {
-		util.SendError(w, r, h.addon, 500, fmt.Sprintf("Could not create new access token %s", err))
-		return
+		return newAuthError(AuthMalformedToken, "%v", err)
 	}
-
-	accountID := ""
-	if oldVerClaims != nil && oldVerClaims["sub"] != nil {
-		accountID = oldVerClaims["sub"].(string)
+	jti := session.Id
+	// tokens without an issue time predate the max age and every rotation
+	var issuedAt time.Time
+	if session.IssuedAt > 0 {
+		issuedAt = time.Unix(session.IssuedAt, 0)
 	}
-
-	verifiedParams := map[string]string{
-		"clientKey":   clientKey,
-		"hostBaseUrl": tenant.BaseURL,
-		"token":       tokenString,
-		// TODO: We may have to add the context workaround instead of just using sub as userAccountId, but lets ignore it for now
-		"userAccountId": accountID,
-		"tenantContext": tenant.Context.String(),
+	if config := h.addon.Config; config != nil && config.SessionTokens != nil && config.SessionTokens.MaxAge > 0 {
+		if time.Since(issuedAt) > config.SessionTokens.MaxAge {
+			return newAuthError(AuthExpired, "session token is older than %v", config.SessionTokens.MaxAge)
+		}
+	}
+	if tenant.SecretRotatedAt != nil && issuedAt.Before(tenant.SecretRotatedAt.Truncate(time.Second)) {
+		return newAuthError(AuthRevoked, "session token was issued before the shared secret was rotated")
+	}
+	if revoker, ok := h.addon.Store.(store.TokenRevoker); ok {
+		revoked, err := revoker.TokenRevoked(tenant.ClientKey, jti, issuedAt)
+		if err != nil {
+			return fmt.Errorf("Could not lookup the token revocations: %w", err)
+		}
+		if revoked {
+			return newAuthError(AuthRevoked, "session token has been revoked")
+		}
+		trace.add("session token %s is not revoked", jti)
 	}
+	return nil
+}
 
-	requestHandler := NewRequestMiddleware(h.addon, verifiedParams)
+// debugging reports whether auth failures of the tenant are explained in
+// detail, when the JWT debugging or the auth trace of the tenant is enabled
+func (h AuthenticationMiddleware) debugging(clientKey string) bool {
+	config := h.addon.Config
+	return config != nil && (config.DebugJWT || config.AuthTrace.Traces(clientKey))
+}
 
-	requestHandler(h.h).ServeHTTP(w, r)
+// sessionAudience returns the tenant a session token was issued for by the
+// add-on, the aud claim is a string or a list of strings
+func sessionAudience(claims jwt.MapClaims) string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud
+	case []interface{}:
+		if len(aud) > 0 {
+			audience, _ := aud[0].(string)
+			return audience
+		}
+	}
+	return ""
+}
+
+func newTokenId() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
 }
 
 func ValidateQshFromRequest(claims jwt.MapClaims, r *http.Request, addon *gonnect.Addon, skipQsh bool) bool {
 	if !skipQsh && claims["qsh"] != "" {
-		expectedHash := atlasjwt.CreateQueryStringHash(r, false, addon.Config.BaseUrl)
-		if claims["qsh"] != expectedHash {
-
-			expectedHash := atlasjwt.CreateQueryStringHash(r, true, addon.Config.BaseUrl)
-			if claims["qsh"] != expectedHash {
-				return false
-			}
+		baseUrl := addon.BaseUrlFor(r)
+		qsh, _ := claims["qsh"].(string)
+		if !atlasjwt.VerifyQueryStringHash(r, false, baseUrl, qsh) && !atlasjwt.VerifyQueryStringHash(r, true, baseUrl, qsh) {
+			return false
 		}
 	}
 	return true
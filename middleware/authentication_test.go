@@ -1 +1,577 @@
 package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func newTestAddon(t testing.TB) *gonnect.Addon {
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	s, err := store.NewFrom(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Set(&store.Tenant{ClientKey: "client-key", BaseURL: "https://example.atlassian.net", SharedSecret: "shared-secret", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	key, name := "addon-key", "Addon"
+	return &gonnect.Addon{Config: &gonnect.Profile{BaseUrl: "https://addon.example.com"}, Store: s, Key: &key, Name: &name}
+}
+
+func signTestToken(t testing.TB, claims jwt.MapClaims, secret string) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuthenticationFailureReasons(t *testing.T) {
+	addon := newTestAddon(t)
+	target := "/page?foo=bar"
+	qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", target, nil), false, addon.Config.BaseUrl)
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"iss": "client-key", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	testCases := []struct {
+		token  string
+		reason AuthReason
+	}{
+		{token: "", reason: AuthMissingToken},
+		{token: "not-a-jwt", reason: AuthMalformedToken},
+		{token: signTestToken(t, with("iss", nil), "shared-secret"), reason: AuthBadIssuer},
+		{token: signTestToken(t, with("qsh", nil), "shared-secret"), reason: AuthMissingQsh},
+		{token: signTestToken(t, with("iss", "unknown"), "shared-secret"), reason: AuthUnknownTenant},
+		{token: signTestToken(t, valid(), "wrong-secret"), reason: AuthBadSignature},
+		{token: signTestToken(t, with("exp", time.Now().Add(-time.Minute).Unix()), "shared-secret"), reason: AuthExpired},
+		{token: signTestToken(t, with("qsh", "mismatch"), "shared-secret"), reason: AuthQshMismatch},
+		{token: signTestToken(t, valid(), "shared-secret"), reason: ""},
+	}
+
+	for _, testCase := range testCases {
+		reached := false
+		handler := NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		}))
+		url := target
+		if testCase.token != "" {
+			url += "&jwt=" + testCase.token
+		}
+		req := httptest.NewRequest("GET", url, nil)
+		before := metrics.GetLabel("auth_failures", string(testCase.reason))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if testCase.reason == "" {
+			if !reached {
+				t.Errorf("Expected valid token to reach the handler, but got %d %s", rec.Code, rec.Body.String())
+			}
+			continue
+		}
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status for %s to be %v, but got %v", testCase.reason, http.StatusUnauthorized, rec.Code)
+		}
+		var body AuthError
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Reason != testCase.reason {
+			t.Errorf("Expected reason to be %v, but got %v (%v)", testCase.reason, body.Reason, err)
+		}
+		if got := metrics.GetLabel("auth_failures", string(testCase.reason)); got != before+1 {
+			t.Errorf("Expected auth_failures{%s} to be %v, but got %v", testCase.reason, before+1, got)
+		}
+	}
+}
+
+type unavailableStore struct {
+	store.TenantStore
+}
+
+func (unavailableStore) Get(clientKey string) (*store.Tenant, error) {
+	return nil, fmt.Errorf("%w: circuit open", store.ErrUnavailable)
+}
+
+func TestAuthenticationStoreUnavailable(t *testing.T) {
+	addon := newTestAddon(t)
+	addon.Store = unavailableStore{addon.Store}
+	target := "/page?foo=bar"
+	qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", target, nil), false, addon.Config.BaseUrl)
+	token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+
+	handler := NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the request not to reach the handler")
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", target+"&jwt="+token, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status to be %v, but got %v", http.StatusServiceUnavailable, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header")
+	}
+}
+
+func TestUnknownTenantPolicy(t *testing.T) {
+	target := "/page?foo=bar"
+	request := func(addon *gonnect.Addon, accept string) (*httptest.ResponseRecorder, bool) {
+		qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", target, nil), false, addon.Config.BaseUrl)
+		token := signTestToken(t, jwt.MapClaims{"iss": "unknown-key", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "unknown-secret")
+		reached := false
+		handler := NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = r.Context().Value("clientKey") == "unknown-key"
+		}))
+		r := httptest.NewRequest("GET", target+"&jwt="+token, nil)
+		r.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec, reached
+	}
+
+	addon := newTestAddon(t)
+	if rec, _ := request(addon, "text/html"); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), string(AuthUnknownTenant)) {
+		t.Errorf("Expected a 401 %s error by default, but got %v %s", AuthUnknownTenant, rec.Code, rec.Body.String())
+	}
+
+	addon.UnknownTenantPolicy = gonnect.UnknownTenantReinstallPage
+	rec, _ := request(addon, "text/html,application/xhtml+xml")
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("Content-Type") != "text/html; charset=utf-8" || !strings.Contains(rec.Body.String(), "Addon does not know this site") {
+		t.Errorf("Expected the reinstall page, but got %v %s", rec.Code, rec.Body.String())
+	}
+	if rec, _ = request(addon, "application/json"); !strings.Contains(rec.Body.String(), string(AuthUnknownTenant)) {
+		t.Errorf("Expected a JSON error for API requests, but got %s", rec.Body.String())
+	}
+
+	addon.UnknownTenantPolicy = gonnect.UnknownTenantResolve
+	resolved := 0
+	addon.ResolveTenant = func(ctx context.Context, clientKey string, claims map[string]interface{}) (*store.Tenant, error) {
+		resolved += 1
+		if clientKey != "unknown-key" {
+			return nil, store.ErrNotFound
+		}
+		return &store.Tenant{ClientKey: clientKey, BaseURL: "https://unknown.atlassian.net", SharedSecret: "unknown-secret", AddonInstalled: true}, nil
+	}
+	if rec, reached := request(addon, ""); !reached {
+		t.Errorf("Expected the resolved tenant to reach the handler, but got %v %s", rec.Code, rec.Body.String())
+	}
+	if rec, reached := request(addon, ""); !reached || resolved != 1 {
+		t.Errorf("Expected the resolved tenant to be stored, but got %v %s after %d resolutions", rec.Code, rec.Body.String(), resolved)
+	}
+
+	addon = newTestAddon(t)
+	addon.UnknownTenantPolicy = gonnect.UnknownTenantResolve
+	addon.ResolveTenant = func(ctx context.Context, clientKey string, claims map[string]interface{}) (*store.Tenant, error) {
+		return &store.Tenant{ClientKey: clientKey, BaseURL: "https://unknown.atlassian.net", SharedSecret: "other-secret"}, nil
+	}
+	if rec, reached := request(addon, ""); reached || rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the token to be verified against the resolved tenant, but got %v %s", rec.Code, rec.Body.String())
+	}
+	if _, err := addon.Store.Get("unknown-key"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Expected the unverified tenant not to be stored, but got %v", err)
+	}
+
+	// tenants the hook does not know are not looked up on every request
+	addon = newTestAddon(t)
+	addon.UnknownTenantPolicy = gonnect.UnknownTenantResolve
+	resolved = 0
+	addon.ResolveTenant = func(ctx context.Context, clientKey string, claims map[string]interface{}) (*store.Tenant, error) {
+		resolved += 1
+		return nil, store.ErrNotFound
+	}
+	for i := 0; i < 3; i++ {
+		if rec, reached := request(addon, ""); reached || rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the unresolved tenant to be unknown, but got %v %s", rec.Code, rec.Body.String())
+		}
+	}
+	if resolved != 1 {
+		t.Errorf("Expected the miss to be cached, but the hook was asked %d times", resolved)
+	}
+}
+
+func TestIdentityLinker(t *testing.T) {
+	addon := newTestAddon(t)
+	target := "/page?foo=bar"
+	qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", target, nil), false, addon.Config.BaseUrl)
+	request := func(accountId string) (*httptest.ResponseRecorder, interface{}) {
+		token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "sub": accountId, "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+		var principal interface{}
+		handler := NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ = gonnect.PrincipalFromContext(r.Context())
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", target+"&jwt="+token, nil))
+		return rec, principal
+	}
+
+	type user struct{ id int }
+	addon.IdentityLinker = gonnect.IdentityLinkerFunc(func(ctx context.Context, clientKey, accountId string, claims map[string]interface{}) (interface{}, error) {
+		switch {
+		case clientKey != "client-key" || claims["sub"] != accountId:
+			return nil, fmt.Errorf("unexpected identity %s %s %v", clientKey, accountId, claims)
+		case accountId == "blocked":
+			return nil, gonnect.ErrIdentityRejected
+		case accountId == "broken":
+			return nil, errors.New("user table unavailable")
+		}
+		return &user{id: 42}, nil
+	})
+	if rec, principal := request("account-id"); rec.Code != http.StatusOK || principal == nil || principal.(*user).id != 42 {
+		t.Errorf("Expected the linked principal, but got %v %v", rec.Code, principal)
+	}
+	if rec, principal := request("blocked"); rec.Code != http.StatusForbidden || principal != nil {
+		t.Errorf("Expected a rejected identity to be forbidden, but got %v", rec.Code)
+	}
+	if rec, _ := request("broken"); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a failing linker to fail the request, but got %v", rec.Code)
+	}
+}
+
+func TestQshMismatchDebugging(t *testing.T) {
+	addon := newTestAddon(t)
+	token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "qsh": "mismatch", "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+	handler := NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, debug := range []bool{false, true} {
+		addon.Config.DebugJWT = debug
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/page?b=2&a=1&jwt="+token, nil))
+		var body AuthError
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Reason != AuthQshMismatch {
+			t.Fatalf("Expected a qsh mismatch, but got %s", rec.Body.String())
+		}
+		expected := ""
+		if debug {
+			expected = "GET&/page&a=1&b=2"
+		}
+		if body.CanonicalRequest != expected || (debug && body.ClaimedQsh != "mismatch") {
+			t.Errorf("Expected canonical request %q with debug %v, but got %+v", expected, debug, body)
+		}
+	}
+	if got := metrics.GetExemplar("auth_failures", string(AuthQshMismatch)); got != "GET&/page&a=1&b=2" {
+		t.Errorf("Expected the canonical request as exemplar, but got %q", got)
+	}
+}
+
+// BenchmarkAuthenticationMiddleware measures the overhead of authenticating
+// a page request, the tenant is served from memory to exclude the database
+func BenchmarkAuthenticationMiddleware(b *testing.B) {
+	addon := newTestAddon(b)
+	static, err := store.NewStatic(store.Tenant{ClientKey: "client-key", BaseURL: "https://example.atlassian.net", SharedSecret: "shared-secret"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	addon.Store = static
+	target := "/page?issueKey=TEST-1&projectKey=TEST&lic=active&tz=Europe%2FBerlin&loc=en-US"
+	qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", target, nil), false, addon.Config.BaseUrl)
+	token := signTestToken(b, jwt.MapClaims{
+		"iss": "client-key", "sub": "account-id", "qsh": qsh,
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+	}, "shared-secret")
+	handler := NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	target += "&jwt=" + token
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != http.StatusOK {
+			b.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestValidateContextParams(t *testing.T) {
+	addon := newTestAddon(t)
+	claims := jwt.MapClaims{
+		"iss": "client-key",
+		"qsh": "context-qsh",
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"context": map[string]interface{}{
+			"confluence": map[string]interface{}{
+				"content": map[string]interface{}{"id": "12345"},
+				"space":   map[string]interface{}{"key": "DOCS"},
+			},
+			// numeric ids are decoded as float64
+			"jira": map[string]interface{}{
+				"issue": map[string]interface{}{"id": 2155413505},
+			},
+		},
+	}
+	token := signTestToken(t, claims, "shared-secret")
+	testCases := []struct {
+		query    string
+		validate bool
+		reason   AuthReason
+	}{
+		{"pageId=12345&spaceKey=DOCS", true, ""},
+		{"pageId=99999&spaceKey=DOCS", true, AuthContextMismatch},
+		{"pageId=12345&pageId=99999", true, AuthContextMismatch},
+		{"spaceKey=OTHER", true, AuthContextMismatch},
+		{"issueId=2155413505", true, ""},
+		{"issueId=2155413506", true, AuthContextMismatch},
+		// parameters without a context claim are not checked
+		{"issueKey=TEST-1", true, ""},
+		{"pageId=99999", false, ""},
+	}
+	for _, testCase := range testCases {
+		addon.Config.ValidateContextParams = testCase.validate
+		reached := false
+		handler := NewAuthenticationMiddleware(addon, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/macro?"+testCase.query+"&jwt="+token, nil))
+		if testCase.reason == "" {
+			if !reached {
+				t.Errorf("%s: Expected the request to reach the handler, but got %d %s", testCase.query, rec.Code, rec.Body.String())
+			}
+			continue
+		}
+		var body AuthError
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Reason != testCase.reason || reached {
+			t.Errorf("%s: Expected reason %v, but got %v (%v)", testCase.query, testCase.reason, body.Reason, err)
+		}
+	}
+}
+
+func newFormRequest(method, target, contentType, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return r
+}
+
+func TestExtractJwt(t *testing.T) {
+	const form = "application/x-www-form-urlencoded"
+	var multipartBody bytes.Buffer
+	writer := multipart.NewWriter(&multipartBody)
+	_ = writer.WriteField(JWT_PARAM, "body")
+	_ = writer.Close()
+
+	withHeader := func(r *http.Request, value string) *http.Request {
+		r.Header.Set("Authorization", value)
+		return r
+	}
+	testCases := []struct {
+		name    string
+		request func() *http.Request
+		token   string
+		reason  AuthReason
+		// strictReason is the reason with StrictTokenSources, reason when empty
+		strictReason AuthReason
+	}{
+		{"query", func() *http.Request { return httptest.NewRequest("GET", "/?jwt=query", nil) }, "query", "", ""},
+		{"form body", func() *http.Request { return newFormRequest("POST", "/", form, "jwt=body") }, "body", "", ""},
+		{"multipart body", func() *http.Request {
+			return newFormRequest("POST", "/", writer.FormDataContentType(), multipartBody.String())
+		}, "body", "", ""},
+		{"header without body", func() *http.Request {
+			return withHeader(httptest.NewRequest("GET", "/", http.NoBody), "JWT header")
+		}, "header", "", ""},
+		{"header before query", func() *http.Request {
+			return withHeader(httptest.NewRequest("GET", "/?jwt=query", nil), "JWT header")
+		}, "header", "", AuthConflictingToken},
+		{"header before body", func() *http.Request {
+			return withHeader(newFormRequest("POST", "/", form, "jwt=body"), "JWT header")
+		}, "header", "", AuthConflictingToken},
+		{"query before body", func() *http.Request { return newFormRequest("POST", "/?jwt=query", form, "jwt=body") }, "query", "", AuthConflictingToken},
+		{"same token everywhere", func() *http.Request {
+			return withHeader(newFormRequest("POST", "/?jwt=same", form, "jwt=same"), "JWT same")
+		}, "same", "", ""},
+		{"bearer header", func() *http.Request {
+			return withHeader(httptest.NewRequest("GET", "/", nil), "Bearer header")
+		}, "", AuthMissingToken, ""},
+		// the body is not parsed when a token was found before it
+		{"malformed form after query", func() *http.Request { return newFormRequest("POST", "/?jwt=query", form, "jwt=%zz") }, "query", "", AuthMalformedToken},
+		{"malformed form", func() *http.Request { return newFormRequest("POST", "/", form, "jwt=%zz") }, "", AuthMalformedToken, ""},
+		{"multipart without boundary", func() *http.Request {
+			return newFormRequest("POST", "/", "multipart/form-data", "jwt=body")
+		}, "", AuthMalformedToken, ""},
+		{"json body", func() *http.Request {
+			return newFormRequest("POST", "/?jwt=query", "application/json", `{"jwt":"body"}`)
+		}, "query", "", ""},
+		{"form body of a GET", func() *http.Request { return newFormRequest("GET", "/", form, "jwt=body") }, "", AuthMissingToken, ""},
+		{"none", func() *http.Request { return httptest.NewRequest("GET", "/", nil) }, "", AuthMissingToken, ""},
+	}
+	for _, testCase := range testCases {
+		for _, strict := range []bool{false, true} {
+			reason := testCase.reason
+			if strict && testCase.strictReason != "" {
+				reason = testCase.strictReason
+			}
+			token, err := extractJwt(testCase.request(), tokenSources{strict: strict})
+			if reason == "" {
+				if err != nil || token != testCase.token {
+					t.Errorf("%s (strict %v): Expected token %q, but got %q (%v)", testCase.name, strict, testCase.token, token, err)
+				}
+				continue
+			}
+			if err == nil || err.Reason != reason {
+				t.Errorf("%s (strict %v): Expected reason %v, but got token %q (%v)", testCase.name, strict, reason, token, err)
+			}
+		}
+	}
+}
+
+func TestStrictTokenSources(t *testing.T) {
+	addon := newTestAddon(t)
+	token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+	for _, strict := range []bool{false, true} {
+		addon.Config.StrictTokenSources = strict
+		reached := false
+		handler := NewAuthenticationMiddleware(addon, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		}))
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/macro?jwt=stale", nil)
+		req.Header.Set("Authorization", "JWT "+token)
+		handler.ServeHTTP(rec, req)
+		if !strict {
+			if !reached {
+				t.Errorf("Expected the header token to be used, but got %v: %s", rec.Code, rec.Body.String())
+			}
+			continue
+		}
+		var body AuthError
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || reached || rec.Code != http.StatusBadRequest || body.Reason != AuthConflictingToken {
+			t.Errorf("Expected a %v %v, but got %v: %s", http.StatusBadRequest, AuthConflictingToken, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestTokenCookie(t *testing.T) {
+	addon := newTestAddon(t)
+	addon.Config.TokenCookie = "ac_jwt"
+	now := time.Now()
+	valid := signTestToken(t, jwt.MapClaims{"iss": "client-key", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}, "shared-secret")
+	expired := signTestToken(t, jwt.MapClaims{"iss": "client-key", "iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-time.Minute).Unix()}, "shared-secret")
+
+	testCases := []struct {
+		name   string
+		cookie string
+		query  string
+		strict bool
+		status int
+	}{
+		{"valid cookie", valid, "", false, http.StatusOK},
+		{"expired cookie", expired, "", false, http.StatusUnauthorized},
+		{"query before cookie", expired, valid, false, http.StatusOK},
+		{"conflicting cookie", expired, valid, true, http.StatusBadRequest},
+		{"no cookie", "", "", false, http.StatusUnauthorized},
+	}
+	for _, testCase := range testCases {
+		addon.Config.StrictTokenSources = testCase.strict
+		handler := NewAuthenticationMiddleware(addon, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		target := "/macro"
+		if testCase.query != "" {
+			target += "?jwt=" + testCase.query
+		}
+		req := httptest.NewRequest("GET", target, nil)
+		if testCase.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "ac_jwt", Value: testCase.cookie})
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.status {
+			t.Errorf("%s: Expected %v, but got %v: %s", testCase.name, testCase.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	// the cookie is ignored unless configured
+	if token, ok := ExtractJwt(httptest.NewRequest("GET", "/", nil)); ok {
+		t.Errorf("Expected no token, but got %q", token)
+	}
+}
+
+func FuzzExtractJwt(f *testing.F) {
+	f.Add("POST", "jwt=query", "application/x-www-form-urlencoded", "jwt=body", "", false, "cookie")
+	f.Add("POST", "jwt=same", "application/x-www-form-urlencoded", "jwt=same&jwt=other", "JWT header", true, "")
+	f.Add("POST", "", "multipart/form-data; boundary=x", "--x\r\nContent-Disposition: form-data; name=\"jwt\"\r\n\r\nbody\r\n--x--\r\n", "", true, "")
+	f.Add("PUT", "jwt=%zz", "application/x-www-form-urlencoded", "jwt=%zz;a", "JWT ", false, "")
+	f.Add("GET", "", "application/json", `{"jwt":"body"}`, "JWT header", true, "")
+	f.Fuzz(func(t *testing.T, method, query, contentType, body, header string, strict bool, cookie string) {
+		r, err := http.NewRequest(method, "http://addon.example.com/macro?"+query, strings.NewReader(body))
+		if err != nil {
+			return
+		}
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("Authorization", header)
+		r.Header.Set("Cookie", "jwt="+cookie)
+		tokenInHeader := strings.TrimPrefix(r.Header.Get("Authorization"), "JWT ")
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "JWT ") {
+			tokenInHeader = ""
+		}
+		tokenInQuery := r.URL.Query().Get(JWT_PARAM)
+
+		token, authErr := extractJwt(r, tokenSources{strict: strict, cookie: "jwt"})
+		if authErr != nil {
+			switch authErr.Reason {
+			case AuthMissingToken, AuthMalformedToken:
+				if !strict && (tokenInHeader != "" || tokenInQuery != "") {
+					t.Errorf("Expected the token of the header or query, but got %v", authErr)
+				}
+			case AuthConflictingToken:
+				if !strict {
+					t.Errorf("Expected conflicting tokens to be rejected only when strict")
+				}
+			default:
+				t.Errorf("Expected a missing, malformed or conflicting token, but got %v", authErr.Reason)
+			}
+			return
+		}
+		if token == "" {
+			t.Errorf("empty token without an error")
+		}
+		switch {
+		case tokenInHeader != "" && token != tokenInHeader:
+			t.Errorf("Expected the header token %q, but got %q", tokenInHeader, token)
+		case tokenInHeader == "" && tokenInQuery != "" && token != tokenInQuery:
+			t.Errorf("Expected the query token %q, but got %q", tokenInQuery, token)
+		case strict && tokenInHeader != "" && tokenInQuery != "" && tokenInHeader != tokenInQuery:
+			t.Errorf("Expected conflicting tokens to be rejected when strict")
+		}
+		if r.PostForm == nil {
+			// bodies which are no forms are left to the handlers
+			rest, _ := io.ReadAll(r.Body)
+			if string(rest) != body {
+				t.Errorf("Expected the body to be unread, but got %q of %q", rest, body)
+			}
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+// ChainOption configures the middlewares composed by Chain
+type ChainOption func(c *chainConfig)
+
+type chainConfig struct {
+	anonymous    bool
+	skipQsh      bool
+	accessLog    bool
+	csrf         *CSRFConfig
+	license      *LicenseConfig
+	entitlements []string
+	scopes       []string
+	extra        []func(h http.Handler) http.Handler
+}
+
+// SkipQsh accepts context JWTs without a query string hash, as sent by the
+// AP.context.getToken() calls of page modules
+func SkipQsh() ChainOption {
+	return func(c *chainConfig) { c.skipQsh = true }
+}
+
+// Anonymous omits the authentication, for routes which are not called by
+// Atlassian products, it cannot be combined with the requirements on tenants
+func Anonymous() ChainOption {
+	return func(c *chainConfig) { c.anonymous = true }
+}
+
+// WithoutAccessLog omits the access log line of each request
+func WithoutAccessLog() ChainOption {
+	return func(c *chainConfig) { c.accessLog = false }
+}
+
+// WithCSRF protects state changing requests with CSRF tokens
+func WithCSRF(config CSRFConfig) ChainOption {
+	return func(c *chainConfig) { c.csrf = &config }
+}
+
+// RequireLicense only serves tenants with an active license
+func RequireLicense(config LicenseConfig) ChainOption {
+	return func(c *chainConfig) { c.license = &config }
+}
+
+// RequireEntitlement only serves tenants entitled to the tier or feature
+func RequireEntitlement(required string) ChainOption {
+	return func(c *chainConfig) { c.entitlements = append(c.entitlements, required) }
+}
+
+// RequireScopes only serves tenants which consented to the scopes
+func RequireScopes(scopes ...string) ChainOption {
+	return func(c *chainConfig) { c.scopes = append(c.scopes, scopes...) }
+}
+
+// With appends middlewares applied after the gonnect middlewares, in the
+// given order
+func With(middlewares ...func(h http.Handler) http.Handler) ChainOption {
+	return func(c *chainConfig) { c.extra = append(c.extra, middlewares...) }
+}
+
+// Chain returns the middlewares of a typical authenticated module route
+// composed in the order they depend on each other: the request logger and
+// id, the access log, panic recovery, authentication, CSRF protection, and
+// the license, entitlement and scope requirements, for example
+// mux.With(middleware.Chain(addon, middleware.RequireLicense(config))).Get(...)
+func Chain(addon *gonnect.Addon, opts ...ChainOption) func(h http.Handler) http.Handler {
+	config := &chainConfig{accessLog: true}
+	for _, opt := range opts {
+		opt(config)
+	}
+	middlewares := []func(h http.Handler) http.Handler{NewLoggerMiddleware(addon)}
+	if config.accessLog {
+		middlewares = append(middlewares, NewAccessLogMiddleware(addon))
+	}
+	middlewares = append(middlewares, NewRecoverMiddleware(addon))
+	if !config.anonymous {
+		middlewares = append(middlewares, NewAuthenticationMiddleware(addon, config.skipQsh))
+	}
+	if config.csrf != nil {
+		middlewares = append(middlewares, NewCSRFMiddleware(addon, *config.csrf))
+	}
+	if config.license != nil {
+		middlewares = append(middlewares, NewRequireLicenseMiddleware(addon, *config.license))
+	}
+	for _, required := range config.entitlements {
+		middlewares = append(middlewares, NewRequireEntitlementMiddleware(addon, required))
+	}
+	if len(config.scopes) > 0 {
+		middlewares = append(middlewares, NewRequireScopesMiddleware(addon, config.scopes...))
+	}
+	middlewares = append(middlewares, config.extra...)
+	return func(h http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			h = middlewares[i](h)
+		}
+		return h
+	}
+}
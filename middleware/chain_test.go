@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestChain(t *testing.T) {
+	addon := newTestAddon(t)
+	if _, err := addon.Store.Set(&store.Tenant{ClientKey: "client-key", InstalledScopes: []string{"READ"}}); err != nil {
+		t.Fatal(err)
+	}
+	var prefix string
+	page := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix = reqlog.FromContext(r.Context()).Prefix()
+		if r.URL.Query().Get("panic") != "" {
+			panic("broken page")
+		}
+	})
+
+	testCases := []struct {
+		name         string
+		target       string
+		options      []ChainOption
+		token        bool
+		expectedCode int
+	}{
+		{name: "unauthenticated", target: "/page", expectedCode: http.StatusUnauthorized},
+		{name: "authenticated", target: "/page", token: true, expectedCode: http.StatusOK},
+		{name: "recovered", target: "/page?panic=1", token: true, expectedCode: http.StatusInternalServerError},
+		{name: "consented scope", target: "/page", options: []ChainOption{RequireScopes("read")}, token: true, expectedCode: http.StatusOK},
+		{name: "missing scope", target: "/page", options: []ChainOption{RequireScopes("WRITE")}, token: true, expectedCode: http.StatusForbidden},
+		{name: "unlicensed", target: "/page", options: []ChainOption{RequireLicense(LicenseConfig{})}, token: true, expectedCode: http.StatusPaymentRequired},
+	}
+	for _, testCase := range testCases {
+		prefix = ""
+		req := httptest.NewRequest(http.MethodGet, testCase.target, nil)
+		if testCase.token {
+			qsh := atlasjwt.CreateQueryStringHash(req, false, addon.Config.BaseUrl)
+			token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "sub": "account", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+			query := req.URL.Query()
+			query.Set(JWT_PARAM, token)
+			req = httptest.NewRequest(http.MethodGet, req.URL.Path+"?"+query.Encode(), nil)
+		}
+		rec := httptest.NewRecorder()
+		Chain(addon, testCase.options...)(page).ServeHTTP(rec, req)
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s: Expected status %v, but got %v", testCase.name, testCase.expectedCode, rec.Code)
+		}
+		if rec.Header().Get(REQUEST_ID_HEADER) == "" {
+			t.Errorf("%s: Expected a request id", testCase.name)
+		}
+		if testCase.expectedCode == http.StatusOK {
+			if expected := "[requestId=" + rec.Header().Get(REQUEST_ID_HEADER) + " clientKey=client-key accountId=account] "; prefix != expected {
+				t.Errorf("%s: Expected logger prefix %q, but got %q", testCase.name, expected, prefix)
+			}
+		}
+	}
+}
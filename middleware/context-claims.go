@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ContextClaimParams maps the query parameters of module urls to the path of
+// the value within the context claim of the JWT they have to match when
+// Profile.ValidateContextParams is set
+var ContextClaimParams = map[string][]string{
+	"pageId":     {"confluence", "content", "id"},
+	"contentId":  {"confluence", "content", "id"},
+	"spaceKey":   {"confluence", "space", "key"},
+	"spaceId":    {"confluence", "space", "id"},
+	"issueKey":   {"jira", "issue", "key"},
+	"issueId":    {"jira", "issue", "id"},
+	"projectKey": {"jira", "project", "key"},
+	"projectId":  {"jira", "project", "id"},
+}
+
+// contextClaim returns the value at path of the context claim, numeric ids
+// are formatted like the query parameters
+func contextClaim(claims jwt.MapClaims, path []string) (string, bool) {
+	value := claims["context"]
+	for _, name := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[name]; !ok {
+			return "", false
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// validateContextParams rejects requests whose context query parameters
+// differ from the context claim of their token, parameters without a claim
+// are not checked. Context tokens and routes skipping the qsh check do not
+// bind the query string, so the parameters could be spoofed otherwise
+func validateContextParams(claims jwt.MapClaims, r *http.Request) error {
+	if _, ok := claims["context"]; !ok {
+		return nil
+	}
+	query := r.URL.Query()
+	params := make([]string, 0, len(ContextClaimParams))
+	for param := range ContextClaimParams {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	var mismatched []string
+	for _, param := range params {
+		values, ok := query[param]
+		if !ok {
+			continue
+		}
+		claimed, ok := contextClaim(claims, ContextClaimParams[param])
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			if value != claimed {
+				mismatched = append(mismatched, param)
+				break
+			}
+		}
+	}
+	if len(mismatched) > 0 {
+		return newAuthError(AuthContextMismatch, "context parameters %s do not match the JWT context", strings.Join(mismatched, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+const (
+	CSRF_COOKIE_NAME = "gonnect_csrf"
+	CSRF_HEADER_NAME = "X-CSRF-Token"
+	CSRF_FORM_FIELD  = "csrf_token"
+	CSRF_NONCE_SIZE  = 32
+)
+
+// CSRFConfig configures the double-submit CSRF protection for pages served
+// outside of the Atlassian iframes
+type CSRFConfig struct {
+	// Secret signs issued tokens so that forged cookies are rejected
+	Secret     []byte
+	CookieName string
+	HeaderName string
+	FormField  string
+	CookiePath string
+	MaxAge     time.Duration
+	// Insecure allows the cookie to be sent over plain http (development)
+	Insecure bool
+}
+
+func (c CSRFConfig) withDefaults() CSRFConfig {
+	if c.CookieName == "" {
+		c.CookieName = CSRF_COOKIE_NAME
+	}
+	if c.HeaderName == "" {
+		c.HeaderName = CSRF_HEADER_NAME
+	}
+	if c.FormField == "" {
+		c.FormField = CSRF_FORM_FIELD
+	}
+	if c.CookiePath == "" {
+		c.CookiePath = "/"
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = 12 * time.Hour
+	}
+	return c
+}
+
+func (c CSRFConfig) sign(nonce []byte) []byte {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+func (c CSRFConfig) issue() (string, error) {
+	nonce := make([]byte, CSRF_NONCE_SIZE)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(nonce) + "." + base64.RawURLEncoding.EncodeToString(c.sign(nonce)), nil
+}
+
+func (c CSRFConfig) valid(token string) bool {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(nonce) != CSRF_NONCE_SIZE {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(signature, c.sign(nonce))
+}
+
+// CSRFMiddleware issues a signed CSRF cookie on safe requests and requires
+// the same token in a header or form field on unsafe requests. Requests which
+// the AuthenticationMiddleware verified with a token in the Authorization
+// header are not exposed to CSRF and are passed through unchanged, it has to
+// be applied after the authentication middleware for them.
+type CSRFMiddleware struct {
+	h      http.Handler
+	addon  *gonnect.Addon
+	config CSRFConfig
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func (h CSRFMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := ""
+	if cookie, err := r.Cookie(h.config.CookieName); err == nil && h.config.valid(cookie.Value) {
+		token = cookie.Value
+	}
+
+	if !isSafeMethod(r.Method) && !authenticatedByHeader(r) {
+		submitted := r.Header.Get(h.config.HeaderName)
+		if submitted == "" {
+			submitted = r.PostFormValue(h.config.FormField)
+		}
+		if token == "" || submitted == "" || subtle.ConstantTimeCompare([]byte(token), []byte(submitted)) != 1 {
+			util.SendError(w, r, h.addon, 403, "CSRF token missing or invalid")
+			return
+		}
+	}
+
+	if token == "" {
+		var err error
+		if token, err = h.config.issue(); err != nil {
+			util.SendError(w, r, h.addon, 500, "Could not issue CSRF token")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     h.config.CookieName,
+			Value:    token,
+			Path:     h.config.CookiePath,
+			MaxAge:   int(h.config.MaxAge.Seconds()),
+			Secure:   !h.config.Insecure,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+
+	ctx := context.WithValue(r.Context(), "csrfToken", token)
+	h.h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// authenticatedByHeader reports whether r was authenticated with the token of
+// its Authorization header, which browsers do not attach to forged requests
+func authenticatedByHeader(r *http.Request) bool {
+	clientKey, _ := r.Context().Value(authenticatedClientKey{}).(string)
+	return clientKey != "" && strings.HasPrefix(r.Header.Get(AUTH_HEADER), "JWT ")
+}
+
+// CSRFToken returns the CSRF token to embed in forms or send in the
+// X-CSRF-Token header, it is empty when CSRFMiddleware was not applied
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value("csrfToken").(string)
+	return token
+}
+
+func NewCSRFMiddleware(addon *gonnect.Addon, config CSRFConfig) func(h http.Handler) http.Handler {
+	config = config.withDefaults()
+	if len(config.Secret) == 0 {
+		log.WarnF("no CSRF secret configured, using a random secret; tokens will not survive restarts")
+		config.Secret = make([]byte, CSRF_NONCE_SIZE)
+		if _, err := rand.Read(config.Secret); err != nil {
+			log.FatalDF(1, "could not generate CSRF secret: %v", err)
+		}
+	}
+	return func(handler http.Handler) http.Handler {
+		return CSRFMiddleware{handler, addon, config}
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	addon := newTestAddon(t)
+	csrf := NewCSRFMiddleware(addon, CSRFConfig{Secret: []byte("csrf-secret")})
+	var issued string
+	handler := csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued = CSRFToken(r)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/form", nil))
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Value != issued || issued == "" {
+		t.Fatalf("Expected a CSRF cookie to be issued on safe requests, but got %d %v", rec.Code, cookies)
+	}
+	cookie := cookies[0]
+
+	qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("POST", "/form", nil), false, addon.Config.BaseUrl)
+	token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+	authenticated := NewAuthenticationMiddleware(addon, false)(handler)
+
+	testCases := []struct {
+		name     string
+		handler  http.Handler
+		cookie   bool
+		header   string
+		form     string
+		auth     string
+		expected int
+	}{
+		{name: "missing token", handler: handler, cookie: true, expected: http.StatusForbidden},
+		{name: "missing cookie", handler: handler, header: cookie.Value, expected: http.StatusForbidden},
+		{name: "header token", handler: handler, cookie: true, header: cookie.Value, expected: http.StatusOK},
+		{name: "form token", handler: handler, cookie: true, form: cookie.Value, expected: http.StatusOK},
+		{name: "mismatching token", handler: handler, cookie: true, header: "other." + cookie.Value, expected: http.StatusForbidden},
+		{name: "unverified authorization header", handler: handler, auth: "JWT forged", expected: http.StatusForbidden},
+		{name: "verified authorization header", handler: authenticated, auth: "JWT " + token, expected: http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		body := ""
+		if testCase.form != "" {
+			body = url.Values{CSRF_FORM_FIELD: {testCase.form}}.Encode()
+		}
+		r := httptest.NewRequest("POST", "/form", strings.NewReader(body))
+		if testCase.form != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if testCase.cookie {
+			r.AddCookie(cookie)
+		}
+		if testCase.header != "" {
+			r.Header.Set(CSRF_HEADER_NAME, testCase.header)
+		}
+		if testCase.auth != "" {
+			r.Header.Set(AUTH_HEADER, testCase.auth)
+		}
+		rec := httptest.NewRecorder()
+		testCase.handler.ServeHTTP(rec, r)
+		if rec.Code != testCase.expected {
+			t.Errorf("%s: Expected the status %d, but got %d: %s", testCase.name, testCase.expected, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+// Entitlement returns the capability set of the tenant of the request, it is
+// empty for tenants without entitlement details
+func Entitlement(r *http.Request) string {
+	tier, _ := r.Context().Value("capabilitySet").(string)
+	return tier
+}
+
+// RequireEntitlementMiddleware only serves tenants whose entitlement allows
+// the required tier or feature, it has to be applied after the
+// authentication middleware
+type RequireEntitlementMiddleware struct {
+	h        http.Handler
+	addon    *gonnect.Addon
+	required string
+}
+
+func (h RequireEntitlementMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tier := Entitlement(r)
+	allowed := tier == h.required
+	if plan := h.addon.Entitlements; plan != nil {
+		allowed = plan.Allows(tier, h.required)
+	}
+	if !allowed {
+		util.SendError(w, r, h.addon, http.StatusForbidden, fmt.Sprintf("%s requires the %s entitlement", r.URL.Path, h.required))
+		return
+	}
+	h.h.ServeHTTP(w, r)
+}
+
+// NewRequireEntitlementMiddleware returns a middleware requiring the tier or
+// feature of Addon.Entitlements, e.g. "premium"
+func NewRequireEntitlementMiddleware(addon *gonnect.Addon, required string) func(h http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return RequireEntitlementMiddleware{handler, addon, required}
+	}
+}
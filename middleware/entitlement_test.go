@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/entitlement"
+)
+
+func TestRequireEntitlementMiddleware(t *testing.T) {
+	addon := &gonnect.Addon{Entitlements: entitlement.NewPlan().Tier("standard").Tier("premium", "reports")}
+	handler := NewRequireEntitlementMiddleware(addon, "premium")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testCases := []struct {
+		capabilitySet string
+		expectedCode  int
+	}{
+		{"", http.StatusForbidden},
+		{"standard", http.StatusForbidden},
+		{"premium", http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest("GET", "/reports", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "capabilitySet", testCase.capabilitySet))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("capability set %q: Expected status %v, but got %v", testCase.capabilitySet, testCase.expectedCode, rec.Code)
+		}
+	}
+}
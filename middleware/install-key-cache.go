@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+)
+
+// InstallKeyCache holds the install public keys fetched from the key CDN
+type InstallKeyCache interface {
+	// Get returns the cached key and whether it is still fresh, keys which
+	// are no longer fresh are only used while the key CDN fails
+	Get(keyId string) (key string, fresh, ok bool)
+	Set(keyId, key string)
+	// Items returns the cached key ids and when they expire
+	Items() map[string]time.Time
+	Stats() InstallKeyCacheStats
+}
+
+// InstallKeyCacheStats counts the lookups of an InstallKeyCache, lookups of
+// keys which are no longer fresh count as misses
+type InstallKeyCacheStats struct {
+	Size   int   `json:"size"`
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// InstallKeyFallbackCache caches the keys fetched from the key CDN
+var InstallKeyFallbackCache InstallKeyCache = NewInstallKeyCache(time.Hour, 3*time.Hour, "")
+
+type cachedInstallKey struct {
+	Key       string    `json:"key"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// MemoryInstallKeyCache is an InstallKeyCache kept in memory and, when Path
+// is set, persisted to a JSON file so restarts do not depend on the CDN
+type MemoryInstallKeyCache struct {
+	// TTL is how long a fetched key is used without asking the CDN again
+	TTL time.Duration
+	// MaxStale is how long after the TTL a key is still used while the CDN
+	// fails
+	MaxStale time.Duration
+	Path     string
+	mutex    sync.RWMutex
+	keys     map[string]cachedInstallKey
+	hits     int64
+	misses   int64
+}
+
+// NewInstallKeyCache returns an empty cache, or the cache persisted at path
+// if it is not empty
+func NewInstallKeyCache(ttl, maxStale time.Duration, path string) *MemoryInstallKeyCache {
+	c := &MemoryInstallKeyCache{TTL: ttl, MaxStale: maxStale, Path: path, keys: make(map[string]cachedInstallKey)}
+	if path != "" {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			if err = json.Unmarshal(data, &c.keys); err != nil {
+				log.ErrorF("error reading install key cache %s: %v", path, err)
+			}
+		} else if !os.IsNotExist(err) {
+			log.ErrorF("error reading install key cache %s: %v", path, err)
+		}
+	}
+	return c
+}
+
+func (c *MemoryInstallKeyCache) Get(keyId string) (key string, fresh, ok bool) {
+	c.mutex.RLock()
+	cached, found := c.keys[keyId]
+	c.mutex.RUnlock()
+	age := time.Since(cached.FetchedAt)
+	fresh = found && age < c.TTL
+	ok = found && age < c.TTL+c.MaxStale
+	if fresh {
+		atomic.AddInt64(&c.hits, 1)
+		metrics.Add("install_key_cache_hits", 1)
+	} else {
+		atomic.AddInt64(&c.misses, 1)
+		metrics.Add("install_key_cache_misses", 1)
+	}
+	if ok {
+		key = cached.Key
+	}
+	return
+}
+
+func (c *MemoryInstallKeyCache) Set(keyId, key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for id, cached := range c.keys {
+		if now.Sub(cached.FetchedAt) >= c.TTL+c.MaxStale {
+			delete(c.keys, id)
+		}
+	}
+	c.keys[keyId] = cachedInstallKey{Key: key, FetchedAt: now}
+	metrics.Set("install_key_cache_size", int64(len(c.keys)))
+	if c.Path != "" {
+		if err := c.persist(); err != nil {
+			log.ErrorF("error writing install key cache %s: %v", c.Path, err)
+		}
+	}
+}
+
+// persist replaces the cache file, the mutex has to be held
+func (c *MemoryInstallKeyCache) persist() error {
+	data, err := json.Marshal(c.keys)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.Path), filepath.Base(c.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.Path)
+}
+
+func (c *MemoryInstallKeyCache) Items() map[string]time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	items := make(map[string]time.Time, len(c.keys))
+	for keyId, cached := range c.keys {
+		if expires := cached.FetchedAt.Add(c.TTL + c.MaxStale); time.Now().Before(expires) {
+			items[keyId] = expires
+		}
+	}
+	return items
+}
+
+func (c *MemoryInstallKeyCache) Stats() InstallKeyCacheStats {
+	c.mutex.RLock()
+	size := len(c.keys)
+	c.mutex.RUnlock()
+	return InstallKeyCacheStats{Size: size, Hits: atomic.LoadInt64(&c.hits), Misses: atomic.LoadInt64(&c.misses)}
+}
+
+// installKeyFetch is a fetch of a key from the CDN in progress, it is
+// cancelled once every request waiting for it went away
+type installKeyFetch struct {
+	done    chan struct{}
+	key     string
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+var (
+	installKeyFetchMutex sync.Mutex
+	installKeyFetches    = make(map[string]*installKeyFetch)
+)
+
+// fetchInstallKeyOnce calls fetch once for concurrent lookups of the same
+// key id, so that many installs after a key rotation do not each hit the CDN.
+// Each lookup returns when ctx is done, the fetch is only cancelled when the
+// contexts of all lookups are done
+func fetchInstallKeyOnce(ctx context.Context, keyId string, fetch func(ctx context.Context, keyId string) (string, error)) (string, error) {
+	installKeyFetchMutex.Lock()
+	pending, ok := installKeyFetches[keyId]
+	if !ok {
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		pending = &installKeyFetch{done: make(chan struct{}), cancel: cancel}
+		installKeyFetches[keyId] = pending
+		go func() {
+			key, err := fetch(fetchCtx, keyId)
+			installKeyFetchMutex.Lock()
+			delete(installKeyFetches, keyId)
+			pending.key, pending.err = key, err
+			installKeyFetchMutex.Unlock()
+			cancel()
+			close(pending.done)
+		}()
+	}
+	pending.waiters += 1
+	installKeyFetchMutex.Unlock()
+
+	select {
+	case <-pending.done:
+		return pending.key, pending.err
+	case <-ctx.Done():
+		installKeyFetchMutex.Lock()
+		if pending.waiters -= 1; pending.waiters == 0 {
+			pending.cancel()
+		}
+		installKeyFetchMutex.Unlock()
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInstallKeyCache(t *testing.T) {
+	var requests int64
+	release := make(chan struct{})
+	failing := false
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		<-release
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("key" + r.URL.Path))
+	}))
+	defer cdn.Close()
+
+	path := filepath.Join(t.TempDir(), "install-keys.json")
+	cache := NewInstallKeyCache(time.Hour, time.Hour, path)
+	defer func(url string, cache InstallKeyCache) {
+		InstallKeysCDNURL, InstallKeyFallbackCache = url, cache
+	}(InstallKeysCDNURL, InstallKeyFallbackCache)
+	InstallKeysCDNURL, InstallKeyFallbackCache = cdn.URL, cache
+
+	// concurrent installs after a key rotation share a single CDN request
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if key, err := fetchKeyWithKeyId(context.Background(), nil, "rotated"); err != nil || key != "key/rotated" {
+				t.Errorf("Expected key to be %v, but got %v (%v)", "key/rotated", key, err)
+			}
+		}()
+	}
+	for atomic.LoadInt64(&requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if requests != 1 {
+		t.Errorf("Expected a single CDN request, but got %v", requests)
+	}
+
+	if key, err := fetchKeyWithKeyId(context.Background(), nil, "rotated"); err != nil || key != "key/rotated" || requests != 1 {
+		t.Errorf("Expected the fresh key to be served from the cache, but got %v (%v) after %v requests", key, err, requests)
+	}
+	if stats := cache.Stats(); stats.Size != 1 || stats.Hits < 1 {
+		t.Errorf("Expected the cache to hold one key and count its hits, but got %+v", stats)
+	}
+
+	// a restarted replica reads the persisted keys and serves them while the
+	// CDN fails
+	failing = true
+	restarted := NewInstallKeyCache(0, time.Hour, path)
+	InstallKeyFallbackCache = restarted
+	if key, err := fetchKeyWithKeyId(context.Background(), nil, "rotated"); err != nil || key != "key/rotated" {
+		t.Errorf("Expected the stale key to be served, but got %v (%v)", key, err)
+	}
+	if _, err := fetchKeyWithKeyId(context.Background(), nil, "unknown"); err == nil {
+		t.Errorf("Expected an unknown key to fail while the CDN fails")
+	}
+	if stats := restarted.Stats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("Expected two misses, but got %+v", stats)
+	}
+}
+
+func TestFetchInstallKeyOnceCancellation(t *testing.T) {
+	cancelled := make(chan struct{})
+	release := make(chan struct{})
+	fetch := func(ctx context.Context, keyId string) (string, error) {
+		select {
+		case <-release:
+			return "key", nil
+		case <-ctx.Done():
+			close(cancelled)
+			return "", ctx.Err()
+		}
+	}
+
+	// the fetch continues for the remaining lookup when one request goes away
+	first, cancelFirst := context.WithCancel(context.Background())
+	result := make(chan string)
+	go func() {
+		key, _ := fetchInstallKeyOnce(context.Background(), "shared", fetch)
+		result <- key
+	}()
+	for {
+		installKeyFetchMutex.Lock()
+		pending := installKeyFetches["shared"]
+		waiting := pending != nil && pending.waiters == 1
+		installKeyFetchMutex.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancelFirst()
+	if _, err := fetchInstallKeyOnce(first, "shared", fetch); err != context.Canceled {
+		t.Errorf("Expected the cancelled lookup to return %v, but got %v", context.Canceled, err)
+	}
+	close(release)
+	if key := <-result; key != "key" {
+		t.Errorf("Expected the remaining lookup to get the key, but got %q", key)
+	}
+
+	// the fetch is cancelled once every lookup went away
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := fetchInstallKeyOnce(ctx, "abandoned", func(ctx context.Context, keyId string) (string, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	}); err != context.DeadlineExceeded {
+		t.Errorf("Expected the lookup to time out, but got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the abandoned fetch to be cancelled")
+	}
+}
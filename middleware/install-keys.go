@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+// installKeyBundle holds install public keys preloaded from the local
+// filesystem, it is reloaded whenever the bundle is modified so the keys can
+// be refreshed out-of-band
+type installKeyBundle struct {
+	path    string
+	mutex   sync.RWMutex
+	modTime time.Time
+	keys    map[string]string
+}
+
+var installKeyBundles sync.Map
+
+func getInstallKeyBundle(path string) *installKeyBundle {
+	bundle, _ := installKeyBundles.LoadOrStore(path, &installKeyBundle{path: path})
+	return bundle.(*installKeyBundle)
+}
+
+// bundleModTime returns the latest modification time of the bundle file or
+// of the directory and its key files
+func bundleModTime(path string) (modTime time.Time, err error) {
+	var info os.FileInfo
+	if info, err = os.Stat(path); err != nil {
+		return
+	}
+	modTime = info.ModTime()
+	if !info.IsDir() {
+		return
+	}
+	var entries []os.FileInfo
+	if entries, err = ioutil.ReadDir(path); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.ModTime().After(modTime) {
+			modTime = entry.ModTime()
+		}
+	}
+	return
+}
+
+// loadInstallKeys reads a bundle, either a JSON file mapping key ids to PEM
+// encoded public keys or a directory of PEM files named by key id as served
+// by the key CDN
+func loadInstallKeys(path string) (keys map[string]string, err error) {
+	var info os.FileInfo
+	if info, err = os.Stat(path); err != nil {
+		return
+	}
+	keys = make(map[string]string)
+	if !info.IsDir() {
+		var data []byte
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return
+		}
+		err = json.Unmarshal(data, &keys)
+		return
+	}
+	var entries []os.FileInfo
+	if entries, err = ioutil.ReadDir(path); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		var data []byte
+		if data, err = ioutil.ReadFile(filepath.Join(path, entry.Name())); err != nil {
+			return
+		}
+		keys[strings.TrimSuffix(entry.Name(), ".pem")] = string(data)
+	}
+	return
+}
+
+func (b *installKeyBundle) refresh() error {
+	modTime, err := bundleModTime(b.path)
+	if err != nil {
+		return err
+	}
+	b.mutex.RLock()
+	current := b.keys != nil && !modTime.After(b.modTime)
+	b.mutex.RUnlock()
+	if current {
+		return nil
+	}
+	keys, err := loadInstallKeys(b.path)
+	if err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	b.keys, b.modTime = keys, modTime
+	b.mutex.Unlock()
+	log.DebugF("loaded %d install keys from %s", len(keys), b.path)
+	return nil
+}
+
+func (b *installKeyBundle) get(keyId string) (string, bool, error) {
+	if err := b.refresh(); err != nil {
+		return "", false, err
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	key, ok := b.keys[keyId]
+	return key, ok, nil
+}
+
+// fetchInstallKey returns the install public key with the given id from the
+// configured bundle, falling back to the key CDN unless offline
+func fetchInstallKey(ctx context.Context, config *gonnect.InstallKeysConfiguration, keyId string) (string, error) {
+	if strings.ContainsAny(keyId, `/\`) || keyId == ".." {
+		return "", fmt.Errorf("invalid keyId %q", keyId)
+	}
+	if config != nil && config.BundlePath != "" {
+		key, ok, err := getInstallKeyBundle(config.BundlePath).get(keyId)
+		if err != nil {
+			log.ErrorF("error reading install key bundle %s: %v", config.BundlePath, err)
+		} else if ok {
+			return key, nil
+		}
+		if config.Offline {
+			return "", fmt.Errorf("Install key %s not found in bundle %s", keyId, config.BundlePath)
+		}
+	}
+	return fetchKeyWithKeyId(ctx, config, keyId)
+}
+
+// InstallKeyCacheEntry describes a cached install public key without
+// revealing the key itself
+type InstallKeyCacheEntry struct {
+	KeyId   string     `json:"keyId"`
+	Source  string     `json:"source"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// InstallKeyCacheEntries lists the install keys currently held in memory,
+// both from local bundles and from the CDN fallback cache
+func InstallKeyCacheEntries() (entries []InstallKeyCacheEntry) {
+	installKeyBundles.Range(func(_, value interface{}) bool {
+		bundle := value.(*installKeyBundle)
+		bundle.mutex.RLock()
+		for keyId := range bundle.keys {
+			entries = append(entries, InstallKeyCacheEntry{KeyId: keyId, Source: bundle.path})
+		}
+		bundle.mutex.RUnlock()
+		return true
+	})
+	for keyId, expires := range InstallKeyFallbackCache.Items() {
+		expires := expires
+		entries = append(entries, InstallKeyCacheEntry{KeyId: keyId, Source: InstallKeysCDNURL, Expires: &expires})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Source != entries[j].Source {
+			return entries[i].Source < entries[j].Source
+		}
+		return entries[i].KeyId < entries[j].KeyId
+	})
+	return
+}
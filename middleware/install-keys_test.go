@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+func TestFetchInstallKeyFromBundle(t *testing.T) {
+	dir := t.TempDir()
+	keyDir := filepath.Join(dir, "keys")
+	if err := os.Mkdir(keyDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(keyDir, "first.pem"), []byte("first-key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "keys.json")
+	if err := ioutil.WriteFile(keyFile, []byte(`{"first":"first-key"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{keyDir, keyFile} {
+		config := &gonnect.InstallKeysConfiguration{BundlePath: path, Offline: true}
+		if key, err := fetchInstallKey(context.Background(), config, "first"); err != nil || key != "first-key" {
+			t.Errorf("Expected key first from %s to be %v, but got %v (%v)", path, "first-key", key, err)
+		}
+		if _, err := fetchInstallKey(context.Background(), config, "second"); err == nil {
+			t.Errorf("Expected unknown key from %s to fail offline", path)
+		}
+	}
+
+	// keys added out-of-band are picked up on the next lookup
+	later := time.Now().Add(time.Minute)
+	secondKey := filepath.Join(keyDir, "second.pem")
+	if err := ioutil.WriteFile(secondKey, []byte("second-key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(secondKey, later, later); err != nil {
+		t.Fatal(err)
+	}
+	config := &gonnect.InstallKeysConfiguration{BundlePath: keyDir, Offline: true}
+	if key, err := fetchInstallKey(context.Background(), config, "second"); err != nil || key != "second-key" {
+		t.Errorf("Expected refreshed key second to be %v, but got %v (%v)", "second-key", key, err)
+	}
+
+	if _, err := fetchInstallKey(context.Background(), config, "../keys.json"); err == nil {
+		t.Errorf("Expected key ids containing path separators to be rejected")
+	}
+}
+
+func TestFetchInstallKeyTimeout(t *testing.T) {
+	var requests int64
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt hangs
+		if atomic.AddInt64(&requests, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("key" + r.URL.Path))
+	}))
+	defer cdn.Close()
+	defer func(url string, cache InstallKeyCache) {
+		InstallKeysCDNURL, InstallKeyFallbackCache = url, cache
+	}(InstallKeysCDNURL, InstallKeyFallbackCache)
+	InstallKeysCDNURL, InstallKeyFallbackCache = cdn.URL, NewInstallKeyCache(time.Hour, time.Hour, "")
+
+	config := &gonnect.InstallKeysConfiguration{FetchTimeout: 50 * time.Millisecond, FetchAttempts: 2}
+	if key, err := fetchInstallKey(context.Background(), config, "hung"); err != nil || key != "key/hung" {
+		t.Errorf("Expected the second attempt to fetch the key, but got %v (%v)", key, err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected two attempts, but got %v", requests)
+	}
+
+	// unknown keys are not retried
+	if _, err := fetchInstallKey(context.Background(), config, "missing"); err == nil || requests != 3 {
+		t.Errorf("Expected a single failed attempt for an unknown key, but got %v after %v requests", err, requests)
+	}
+
+	// the fetch ends with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fetchInstallKey(ctx, config, "cancelled"); err == nil || requests != 3 {
+		t.Errorf("Expected a cancelled request not to fetch the key, but got %v after %v requests", err, requests)
+	}
+}
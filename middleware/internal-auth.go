@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/internaltoken"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// InternalAuthMiddleware authenticates calls between the services of the
+// add-on with the internal tokens of Addon.InternalTokens, the request
+// context is populated like for requests of the host product
+type InternalAuthMiddleware struct {
+	h     http.Handler
+	addon *gonnect.Addon
+}
+
+func (h InternalAuthMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	markAuthStarted(r)
+	if h.addon.InternalTokens == nil {
+		sendAuthError(w, r, h.addon, newAuthError(AuthMissingSecret, "internal tokens are not configured"))
+		return
+	}
+	token, ok := internaltoken.FromRequest(r)
+	if !ok {
+		sendAuthError(w, r, h.addon, newAuthError(AuthMissingToken, "Could not find an internal token on request"))
+		return
+	}
+	claims, err := h.addon.InternalTokens.Verify(token)
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			sendAuthError(w, r, h.addon, newAuthError(AuthExpired, "internal token has expired"))
+			return
+		}
+		sendAuthError(w, r, h.addon, newAuthError(AuthBadSignature, "Could not verify internal token: %v", err))
+		return
+	}
+	tenant, err := h.addon.Store.Get(claims.ClientKey)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			sendAuthError(w, r, h.addon, newAuthError(AuthUnknownTenant, "Could not find stored client data for clientKey"))
+			return
+		}
+		sendStoreError(w, r, h.addon, err)
+		return
+	}
+	verifiedParams := map[string]string{
+		"clientKey":     tenant.ClientKey,
+		"hostBaseUrl":   tenant.BaseURL,
+		"token":         token,
+		"userAccountId": claims.AccountId,
+		"tenantContext": tenant.Context.String(),
+		"capabilitySet": tenant.CapabilitySet,
+	}
+	markAuthDone(r)
+	NewRequestMiddleware(h.addon, verifiedParams)(h.h).ServeHTTP(w, r)
+}
+
+func NewInternalAuthMiddleware(addon *gonnect.Addon) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return InternalAuthMiddleware{next, addon}
+	}
+}
+
+// IssueInternalToken returns an internal token for the tenant and user of an
+// authenticated request, to pass them on to another service of the add-on
+func IssueInternalToken(addon *gonnect.Addon, r *http.Request) (string, error) {
+	if addon.InternalTokens == nil {
+		return "", internaltoken.ErrNoSecret
+	}
+	clientKey, _ := r.Context().Value("clientKey").(string)
+	if clientKey == "" {
+		return "", errors.New("request is not authenticated")
+	}
+	accountId, _ := r.Context().Value("userAccountId").(string)
+	return addon.InternalTokens.Issue(clientKey, accountId)
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/internaltoken"
+)
+
+func TestInternalAuthMiddleware(t *testing.T) {
+	addon := newTestAddon(t)
+	addon.InternalTokens = &internaltoken.Signer{Issuer: *addon.Key, Secrets: []string{"internal-secret"}}
+
+	var forwarded string
+	var clientKey, accountId interface{}
+	handler := NewInternalAuthMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientKey, accountId = r.Context().Value("clientKey"), r.Context().Value("userAccountId")
+		forwarded, _ = IssueInternalToken(addon, r)
+	}))
+
+	valid, _ := addon.InternalTokens.Issue("client-key", "account-id")
+	unknown, _ := addon.InternalTokens.Issue("unknown-key", "")
+	expired := signTestToken(t, map[string]interface{}{"iss": *addon.Key, "aud": internaltoken.Audience, "clientKey": "client-key", "exp": time.Now().Add(-time.Minute).Unix()}, "internal-secret")
+	connect := signTestToken(t, map[string]interface{}{"iss": "client-key", "qsh": "context-qsh"}, "shared-secret")
+
+	testCases := []struct {
+		name           string
+		token          string
+		expectedCode   int
+		expectedReason AuthReason
+	}{
+		{name: "valid", token: valid, expectedCode: http.StatusOK},
+		{name: "missing", expectedCode: http.StatusUnauthorized, expectedReason: AuthMissingToken},
+		{name: "unknown tenant", token: unknown, expectedCode: http.StatusUnauthorized, expectedReason: AuthUnknownTenant},
+		{name: "expired", token: expired, expectedCode: http.StatusUnauthorized, expectedReason: AuthExpired},
+		{name: "connect token", token: connect, expectedCode: http.StatusUnauthorized, expectedReason: AuthBadSignature},
+	}
+	for _, testCase := range testCases {
+		clientKey, accountId = nil, nil
+		req := httptest.NewRequest(http.MethodPost, "/internal/jobs", nil)
+		if testCase.token != "" {
+			req.Header.Set("Authorization", "Bearer "+testCase.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s: Expected status %d, but got %d", testCase.name, testCase.expectedCode, rec.Code)
+		}
+		if testCase.expectedReason != "" && !strings.Contains(rec.Body.String(), string(testCase.expectedReason)) {
+			t.Errorf("%s: Expected reason %s, but got %s", testCase.name, testCase.expectedReason, rec.Body.String())
+		}
+		if testCase.expectedCode == http.StatusOK && (clientKey != "client-key" || accountId != "account-id" || forwarded == "") {
+			t.Errorf("%s: Expected the tenant and user in the context, but got %v, %v", testCase.name, clientKey, accountId)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlassianips"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+var ipRanges sync.Map
+
+// getIPRanges returns the ranges published at url, the ranges of Atlassian
+// are atlassianips.Default
+func getIPRanges(url string) *atlassianips.Ranges {
+	if url == "" || url == atlassianips.URL {
+		return atlassianips.Default
+	}
+	ranges, _ := ipRanges.LoadOrStore(url, atlassianips.New(url))
+	return ranges.(*atlassianips.Ranges)
+}
+
+// parseNetwork parses an IP or CIDR range
+func parseNetwork(address string) (*net.IPNet, error) {
+	if strings.Contains(address, "/") {
+		_, network, err := net.ParseCIDR(address)
+		return network, err
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", address)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// clientIP returns the IP of the client, the last X-Forwarded-For address
+// when trustForwardedFor is set and the peer address otherwise
+func clientIP(r *http.Request, trustForwardedFor bool) net.IP {
+	address := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if forwarded := r.Header.Values("X-Forwarded-For"); trustForwardedFor && len(forwarded) > 0 {
+		addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+		address = strings.TrimSpace(addresses[len(addresses)-1])
+	}
+	return net.ParseIP(address)
+}
+
+// LifecycleIPMiddleware rejects requests which do not originate from the IP
+// ranges of the LifecycleIPs configuration of the add-on, requests pass
+// unchecked while it is not enabled
+type LifecycleIPMiddleware struct {
+	h     http.Handler
+	addon *gonnect.Addon
+}
+
+func (h LifecycleIPMiddleware) allowed(r *http.Request, config *gonnect.LifecycleIPConfiguration) (bool, error) {
+	ip := clientIP(r, config.TrustForwardedFor)
+	if ip == nil {
+		return false, nil
+	}
+	for _, address := range config.ExtraRanges {
+		network, err := parseNetwork(address)
+		if err != nil {
+			return false, err
+		}
+		if network.Contains(ip) {
+			return true, nil
+		}
+	}
+	return getIPRanges(config.RangesUrl).Contains(ip)
+}
+
+func (h LifecycleIPMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var config *gonnect.LifecycleIPConfiguration
+	if h.addon.Config != nil {
+		config = h.addon.Config.LifecycleIPs
+	}
+	if config == nil || !config.Enabled {
+		h.h.ServeHTTP(w, r)
+		return
+	}
+	allowed, err := h.allowed(r, config)
+	if err != nil {
+		// failing closed, the lifecycle call is retried by the product
+		util.SendError(w, r, h.addon, http.StatusServiceUnavailable, "could not verify the origin of the lifecycle callback: "+err.Error())
+		return
+	}
+	if !allowed {
+		audit.Record(r.Context(), audit.Event{
+			Type:    "lifecycle_ip_rejected",
+			Message: "lifecycle callback rejected, it does not originate from the allowed IP ranges",
+			Fields:  map[string]string{"remoteAddr": r.RemoteAddr, "path": r.URL.Path, "forwardedFor": r.Header.Get("X-Forwarded-For")},
+		})
+		util.SendError(w, r, h.addon, http.StatusForbidden, "lifecycle callback not allowed from this address")
+		return
+	}
+	h.h.ServeHTTP(w, r)
+}
+
+func NewLifecycleIPMiddleware(addon *gonnect.Addon) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return LifecycleIPMiddleware{next, addon}
+	}
+}
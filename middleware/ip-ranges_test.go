@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+func TestLifecycleIPMiddleware(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_, _ = w.Write([]byte(`{"items":[{"cidr":"104.192.136.0/21"},{"cidr":"2401:1d80::/32"}]}`))
+	}))
+	defer server.Close()
+
+	addon := &gonnect.Addon{Config: &gonnect.Profile{LifecycleIPs: &gonnect.LifecycleIPConfiguration{
+		Enabled:     true,
+		RangesUrl:   server.URL,
+		ExtraRanges: []string{"127.0.0.1"},
+	}}}
+	handler := NewLifecycleIPMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testCases := []struct {
+		remoteAddr        string
+		forwardedFor      string
+		trustForwardedFor bool
+		expectedCode      int
+	}{
+		{remoteAddr: "104.192.137.5:1234", expectedCode: http.StatusOK},
+		{remoteAddr: "[2401:1d80::1]:1234", expectedCode: http.StatusOK},
+		{remoteAddr: "127.0.0.1:1234", expectedCode: http.StatusOK},
+		{remoteAddr: "192.0.2.1:1234", expectedCode: http.StatusForbidden},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: "104.192.137.5", expectedCode: http.StatusForbidden},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: "192.0.2.1, 104.192.137.5", trustForwardedFor: true, expectedCode: http.StatusOK},
+		{remoteAddr: "10.0.0.1:1234", forwardedFor: "104.192.137.5, 192.0.2.1", trustForwardedFor: true, expectedCode: http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		addon.Config.LifecycleIPs.TrustForwardedFor = testCase.trustForwardedFor
+		req := httptest.NewRequest(http.MethodPost, "/installed", nil)
+		req.RemoteAddr = testCase.remoteAddr
+		if testCase.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", testCase.forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s (forwarded for %q): Expected status %v, but got %v", testCase.remoteAddr, testCase.forwardedFor, testCase.expectedCode, rec.Code)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Expected the IP ranges to be fetched once, but got %v", fetches)
+	}
+
+	addon.Config.LifecycleIPs.Enabled = false
+	req := httptest.NewRequest(http.MethodPost, "/installed", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected requests to pass while disabled, but got %v", rec.Code)
+	}
+}
@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+)
+
+// latencyTimingContextKey holds the *latencyTiming of a request tracked by
+// the LatencyBudgetMiddleware
+const latencyTimingContextKey = "latencyTiming"
+
+// latencyTiming is when the authentication of a request started and ended,
+// marked by the authentication middlewares
+type latencyTiming struct {
+	authStarted time.Time
+	authDone    time.Time
+}
+
+// auth returns the authentication time of a request which ended at end, the
+// whole request for failed authentications
+func (t *latencyTiming) auth(end time.Time) time.Duration {
+	switch {
+	case t.authStarted.IsZero():
+		return 0
+	case t.authDone.IsZero():
+		return end.Sub(t.authStarted)
+	}
+	return t.authDone.Sub(t.authStarted)
+}
+
+// markAuthStarted marks the start of the authentication of r, the outermost
+// authentication middleware marks it
+func markAuthStarted(r *http.Request) {
+	if t, _ := r.Context().Value(latencyTimingContextKey).(*latencyTiming); t != nil && t.authStarted.IsZero() {
+		t.authStarted = time.Now()
+	}
+}
+
+// markAuthDone marks the end of the authentication of r, when it is handed to
+// the handler
+func markAuthDone(r *http.Request) {
+	if t, _ := r.Context().Value(latencyTimingContextKey).(*latencyTiming); t != nil && t.authDone.IsZero() {
+		t.authDone = time.Now()
+	}
+}
+
+const burnBuckets = 10
+
+type burnBucket struct {
+	slot, total, over, authOver int64
+}
+
+// burnWindow counts the requests of a route and those over their budgets in
+// the buckets of a rolling window
+type burnWindow struct {
+	mutex   sync.Mutex
+	buckets [burnBuckets]burnBucket
+}
+
+// add counts a request in the bucket of slot and returns the counts of the
+// window ending with it
+func (b *burnWindow) add(slot int64, over, authOver bool) (total, overTotal, authOverTotal int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	bucket := &b.buckets[slot%burnBuckets]
+	if bucket.slot != slot {
+		*bucket = burnBucket{slot: slot}
+	}
+	bucket.total++
+	if over {
+		bucket.over++
+	}
+	if authOver {
+		bucket.authOver++
+	}
+	for _, bucket := range b.buckets {
+		if bucket.slot > slot-burnBuckets {
+			total += bucket.total
+			overTotal += bucket.over
+			authOverTotal += bucket.authOver
+		}
+	}
+	return
+}
+
+// LatencyBudgetMiddleware tracks the latency of the routes against the
+// LatencyBudgets of the configuration, separating the time spent
+// authenticating the request from the time of its handler. It has to be
+// used within the chi router to know the route pattern of the requests.
+//
+// The metrics are labelled with the route pattern:
+//
+//   - latency_requests counts the tracked requests
+//   - latency_auth_ms and latency_handler_ms sum up their durations
+//   - latency_over_budget and latency_auth_over_budget count the requests
+//     over the route and authentication budgets
+//   - latency_burn_rate and latency_auth_burn_rate are the rates the error
+//     budget of the Objective is spent at within the Window, a rate above 1
+//     exhausts it before the end of the window
+type LatencyBudgetMiddleware struct {
+	h       http.Handler
+	addon   *gonnect.Addon
+	windows *sync.Map
+}
+
+func (h LatencyBudgetMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var config *gonnect.LatencyBudgetConfiguration
+	if h.addon.Config != nil {
+		config = h.addon.Config.LatencyBudgets
+	}
+	if config == nil {
+		h.h.ServeHTTP(w, r)
+		return
+	}
+	timing := &latencyTiming{}
+	started := time.Now()
+	h.h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), latencyTimingContextKey, timing)))
+	ended := time.Now()
+
+	route := "unrouted"
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		route = rctx.RoutePattern()
+	}
+	budget, ok := config.Routes[route]
+	if !ok {
+		budget = config.Default
+	}
+	if budget <= 0 {
+		return
+	}
+	elapsed, auth := ended.Sub(started), timing.auth(ended)
+	over := elapsed > budget
+	authOver := config.Auth > 0 && auth > config.Auth
+
+	metrics.AddLabel("latency_requests", route, 1)
+	metrics.AddLabel("latency_auth_ms", route, auth.Milliseconds())
+	metrics.AddLabel("latency_handler_ms", route, (elapsed - auth).Milliseconds())
+	if over {
+		metrics.AddLabel("latency_over_budget", route, 1)
+	}
+	if authOver {
+		metrics.AddLabel("latency_auth_over_budget", route, 1)
+	}
+
+	objective, window := config.Objective, config.Window
+	if objective <= 0 || objective >= 1 {
+		objective = 0.99
+	}
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+	span := window / burnBuckets
+	if span <= 0 {
+		span = 1
+	}
+	value, _ := h.windows.LoadOrStore(route, &burnWindow{})
+	total, overTotal, authOverTotal := value.(*burnWindow).add(ended.UnixNano()/int64(span), over, authOver)
+	errorBudget := (1 - objective) * float64(total)
+	metrics.SetLabelFloat("latency_burn_rate", route, float64(overTotal)/errorBudget)
+	if config.Auth > 0 {
+		metrics.SetLabelFloat("latency_auth_burn_rate", route, float64(authOverTotal)/errorBudget)
+	}
+}
+
+func NewLatencyBudgetMiddleware(addon *gonnect.Addon) func(h http.Handler) http.Handler {
+	windows := &sync.Map{}
+	return func(next http.Handler) http.Handler {
+		return LatencyBudgetMiddleware{next, addon, windows}
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+)
+
+func TestLatencyBudgetMiddleware(t *testing.T) {
+	addon := newTestAddon(t)
+	addon.Config.LatencyBudgets = &gonnect.LatencyBudgetConfiguration{
+		Routes: map[string]time.Duration{
+			"/budget-fast/{id}": time.Second,
+			"/budget-slow":      5 * time.Millisecond,
+			"/budget-page":      time.Second,
+		},
+		Auth:      time.Nanosecond,
+		Objective: 0.5,
+	}
+	mux := chi.NewRouter()
+	mux.Use(NewLatencyBudgetMiddleware(addon))
+	mux.Get("/budget-fast/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Get("/budget-slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	})
+	mux.Get("/budget-untracked", func(w http.ResponseWriter, r *http.Request) {})
+	mux.With(NewAuthenticationMiddleware(addon, false)).Get("/budget-page", func(w http.ResponseWriter, r *http.Request) {})
+
+	fast, slow, authOver := metrics.GetLabel("latency_requests", "/budget-fast/{id}"), metrics.GetLabel("latency_over_budget", "/budget-slow"), metrics.GetLabel("latency_auth_over_budget", "/budget-page")
+	serve := func(target string) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected %s to succeed, but got %v", target, rec.Code)
+		}
+	}
+	serve("/budget-fast/1")
+	serve("/budget-fast/2")
+	serve("/budget-slow")
+	serve("/budget-untracked")
+	qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", "/budget-page", nil), false, addon.Config.BaseUrl)
+	serve("/budget-page?jwt=" + signTestToken(t, jwt.MapClaims{"iss": "client-key", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret"))
+
+	if got := metrics.GetLabel("latency_requests", "/budget-fast/{id}") - fast; got != 2 {
+		t.Errorf("Expected 2 requests of the route pattern, but got %v", got)
+	}
+	if got := metrics.GetLabel("latency_requests", "/budget-untracked"); got != 0 {
+		t.Errorf("Expected routes without a budget not to be tracked, but got %v", got)
+	}
+	if got := metrics.GetLabelFloat("latency_burn_rate", "/budget-fast/{id}"); got != 0 {
+		t.Errorf("Expected no burn within the budget, but got %v", got)
+	}
+	if got := metrics.GetLabel("latency_over_budget", "/budget-slow") - slow; got != 1 {
+		t.Errorf("Expected the slow request over budget, but got %v", got)
+	}
+	// every request is over budget, twice the error budget of the objective
+	if got := metrics.GetLabelFloat("latency_burn_rate", "/budget-slow"); got != 2 {
+		t.Errorf("Expected a burn rate of 2, but got %v", got)
+	}
+	if got := metrics.GetLabel("latency_auth_over_budget", "/budget-page") - authOver; got != 1 {
+		t.Errorf("Expected the authentication over its budget, but got %v", got)
+	}
+	if got := metrics.GetLabel("latency_over_budget", "/budget-page"); got != 0 {
+		t.Errorf("Expected the authenticated request within the route budget, but got %v", got)
+	}
+	if got := metrics.GetLabelFloat("latency_auth_burn_rate", "/budget-fast/{id}"); got != 0 {
+		t.Errorf("Expected no auth burn of unauthenticated routes, but got %v", got)
+	}
+}
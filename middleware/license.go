@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+)
+
+// LicenseState is the license of the add-on for the tenant of a request
+type LicenseState string
+
+const (
+	LicenseActive LicenseState = "active"
+	LicenseTrial  LicenseState = "trial"
+	LicenseNone   LicenseState = "none"
+)
+
+// License returns the license state of the request: the state looked up by
+// RequireLicense when it was applied, otherwise the lic parameter the host
+// product adds to module urls, which cannot tell evaluations apart
+func License(r *http.Request) LicenseState {
+	if state, ok := r.Context().Value("licenseState").(LicenseState); ok {
+		return state
+	}
+	if lic, _ := r.Context().Value("license").(string); lic == string(LicenseActive) {
+		return LicenseActive
+	}
+	if r.URL.Query().Get("lic") == string(LicenseActive) {
+		return LicenseActive
+	}
+	return LicenseNone
+}
+
+// LicenseStateOf returns the state of a license looked up from the host
+func LicenseStateOf(license *hostrequest.License) LicenseState {
+	switch {
+	case license == nil || !license.Active:
+		return LicenseNone
+	case license.Evaluation:
+		return LicenseTrial
+	}
+	return LicenseActive
+}
+
+// DefaultLicenseTemplate is rendered by RequireLicense for unlicensed
+// requests without a configured Template
+var DefaultLicenseTemplate = template.Must(template.New("license").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<link rel="stylesheet" href="{{.hostStylesheetUrl}}">
+<script src="{{.hostScriptUrl}}" data-options="sizeToParent:true"></script>
+</head>
+<body>
+<section class="aui-page-panel-content">
+<h2>{{.title}} is not licensed</h2>
+<p>Please ask an administrator to {{if eq (printf "%v" .licenseState) "none"}}purchase or start a trial of{{else}}renew the license of{{end}} {{.title}} in the Manage apps page.</p>
+</section>
+</body>
+</html>`))
+
+// LicenseConfig configures the pages RequireLicense renders for unlicensed
+// tenants
+type LicenseConfig struct {
+	// AllowTrial admits tenants evaluating the add-on
+	AllowTrial bool
+	// LookupTrial asks the host product for the license of tenants with an
+	// active lic parameter to tell evaluations apart, results are cached for
+	// CacheTTL
+	LookupTrial bool
+	CacheTTL    time.Duration
+	// Template is rendered with TemplateData, DefaultLicenseTemplate is used
+	// when nil
+	Template *template.Template
+	// StatusCode of the license page, http.StatusPaymentRequired when zero
+	StatusCode int
+	// Lookup returns the license of the tenant of the request, the add-on
+	// info of the host product is used when nil
+	Lookup func(r *http.Request) (*hostrequest.License, error)
+}
+
+func (c LicenseConfig) withDefaults() LicenseConfig {
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = 5 * time.Minute
+	}
+	if c.Template == nil {
+		c.Template = DefaultLicenseTemplate
+	}
+	if c.StatusCode == 0 {
+		c.StatusCode = http.StatusPaymentRequired
+	}
+	if c.Lookup == nil {
+		c.Lookup = lookupLicense
+	}
+	return c
+}
+
+func lookupLicense(r *http.Request) (*hostrequest.License, error) {
+	client, err := hostrequest.FromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	info, err := client.AddonInfo(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	return info.License, nil
+}
+
+// RequireLicenseMiddleware renders a license page instead of the page module
+// for tenants without a license, it has to be applied after the
+// authentication middleware
+type RequireLicenseMiddleware struct {
+	h      http.Handler
+	addon  *gonnect.Addon
+	config LicenseConfig
+	states *cache.Cache
+}
+
+func (h RequireLicenseMiddleware) state(r *http.Request) LicenseState {
+	state := License(r)
+	if state != LicenseActive || !h.config.LookupTrial {
+		return state
+	}
+	clientKey, _ := r.Context().Value("clientKey").(string)
+	if cached, ok := h.states.Get(clientKey); ok {
+		return cached.(LicenseState)
+	}
+	license, err := h.config.Lookup(r)
+	if err != nil {
+		reqlog.FromContext(r.Context()).WarnF("could not look up license of tenant %s: %v", clientKey, err)
+		return state
+	}
+	state = LicenseStateOf(license)
+	h.states.SetDefault(clientKey, state)
+	return state
+}
+
+func (h RequireLicenseMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state := h.state(r)
+	r = r.WithContext(context.WithValue(r.Context(), "licenseState", state))
+	if state == LicenseActive || (state == LicenseTrial && h.config.AllowTrial) {
+		h.h.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(h.config.StatusCode)
+	if err := h.config.Template.Execute(w, TemplateData(r)); err != nil {
+		reqlog.FromContext(r.Context()).ErrorF("error rendering license page: %v", err)
+	}
+}
+
+// NewRequireLicenseMiddleware returns a middleware which only serves
+// licensed tenants
+func NewRequireLicenseMiddleware(addon *gonnect.Addon, config LicenseConfig) func(h http.Handler) http.Handler {
+	config = config.withDefaults()
+	states := cache.New(config.CacheTTL, 2*config.CacheTTL)
+	return func(handler http.Handler) http.Handler {
+		return RequireLicenseMiddleware{handler, addon, config, states}
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+)
+
+func TestRequireLicenseMiddleware(t *testing.T) {
+	lookups := 0
+	config := LicenseConfig{
+		LookupTrial: true,
+		Lookup: func(r *http.Request) (*hostrequest.License, error) {
+			lookups++
+			if r.Context().Value("clientKey") == "trial" {
+				return &hostrequest.License{Active: true, Evaluation: true}, nil
+			}
+			return &hostrequest.License{Active: true}, nil
+		},
+	}
+	testCases := []struct {
+		clientKey, lic string
+		allowTrial     bool
+		expectedCode   int
+		expectedState  LicenseState
+	}{
+		{"paid", "active", false, http.StatusOK, LicenseActive},
+		{"trial", "active", false, http.StatusPaymentRequired, LicenseTrial},
+		{"trial", "active", true, http.StatusOK, LicenseTrial},
+		{"free", "none", false, http.StatusPaymentRequired, LicenseNone},
+	}
+	for _, testCase := range testCases {
+		config.AllowTrial = testCase.allowTrial
+		var state LicenseState
+		handler := NewRequireLicenseMiddleware(&gonnect.Addon{}, config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state = License(r)
+		}))
+		req := httptest.NewRequest("GET", "/page?lic="+testCase.lic, nil)
+		ctx := context.WithValue(req.Context(), "clientKey", testCase.clientKey)
+		ctx = context.WithValue(ctx, "license", testCase.lic)
+		ctx = context.WithValue(ctx, "title", "My App")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req.WithContext(ctx))
+
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s: Expected status %v, but got %v", testCase.clientKey, testCase.expectedCode, rec.Code)
+		}
+		if rec.Code == http.StatusOK && state != testCase.expectedState {
+			t.Errorf("%s: Expected state %v, but got %v", testCase.clientKey, testCase.expectedState, state)
+		}
+		if rec.Code != http.StatusOK && !strings.Contains(rec.Body.String(), "My App is not licensed") {
+			t.Errorf("%s: Expected the license page, but got %s", testCase.clientKey, rec.Body.String())
+		}
+	}
+	if lookups != 3 {
+		t.Errorf("Expected a lookup per active request, but got %d", lookups)
+	}
+}
+
+func TestTemplateData(t *testing.T) {
+	req := httptest.NewRequest("GET", "/page?lic=active", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "clientKey", "key"))
+	data := TemplateData(req)
+	if data["clientKey"] != "key" || data["licenseState"] != LicenseActive {
+		t.Errorf("Expected the tenant and license in the template data, but got %v", data)
+	}
+	if _, ok := data["token"]; ok {
+		t.Errorf("Expected unset values to be omitted, but got %v", data)
+	}
+}
+
+func TestRender(t *testing.T) {
+	addon := newTestAddon(t)
+	tmpl := template.Must(template.New("page").Parse(`{{.Title}} {{.Gonnect.Verified}} {{.Gonnect.ClientKey}} {{.Gonnect.HostBaseUrl}} {{.Gonnect.AccountId}} {{.Gonnect.License}} {{if .Gonnect.Token}}token{{end}}`))
+	render := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := gonnect.Render(w, r, tmpl, map[string]interface{}{"Title": "Page"}); err != nil {
+			t.Errorf("Expected the page to render, but got %v", err)
+		}
+	})
+	token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "sub": "account", "iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+
+	testCases := []struct {
+		name     string
+		handler  http.Handler
+		target   string
+		expected string
+	}{
+		{
+			name:     "verified",
+			handler:  NewAuthenticationMiddleware(addon, true)(render),
+			target:   "/page?lic=active&jwt=" + token,
+			expected: "Page true client-key https://example.atlassian.net account active token",
+		},
+		// the query parameters of unauthenticated requests are not exposed
+		{
+			name:     "unverified",
+			handler:  NewRequestMiddleware(addon, nil)(render),
+			target:   "/page?lic=active&xdm_e=https://evil.example.com",
+			expected: "Page false     ",
+		},
+	}
+	for _, testCase := range testCases {
+		rec := httptest.NewRecorder()
+		testCase.handler.ServeHTTP(rec, httptest.NewRequest("GET", testCase.target, nil))
+		if body := rec.Body.String(); body != testCase.expected {
+			t.Errorf("%s: Expected the page %q, but got %q", testCase.name, testCase.expected, body)
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+			t.Errorf("%s: Expected an html content type, but got %q", testCase.name, contentType)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	if err := gonnect.Render(rec, httptest.NewRequest("GET", "/page", nil), tmpl, map[string]interface{}{gonnect.RenderKey: true}); err == nil || rec.Body.Len() != 0 {
+		t.Errorf("Expected the reserved key to be rejected, but got %v %q", err, rec.Body.String())
+	}
+}
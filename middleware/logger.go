@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+)
+
+// REQUEST_ID_HEADER carries the id of a request, it is taken from the
+// request when set by a proxy and returned with the response
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// LoggerMiddleware puts a reqlog.Logger attributed to the request into the
+// request context, the authentication middleware adds the clientKey and
+// accountId once the request is verified
+type LoggerMiddleware struct {
+	h     http.Handler
+	addon *gonnect.Addon
+}
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (h LoggerMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value("requestId").(string); ok {
+		h.h.ServeHTTP(w, r)
+		return
+	}
+	id := r.Header.Get(REQUEST_ID_HEADER)
+	if !validRequestId(id) {
+		id = newRequestId()
+	}
+	w.Header().Set(REQUEST_ID_HEADER, id)
+	ctx := context.WithValue(r.Context(), "requestId", id)
+	ctx = reqlog.NewContext(ctx, reqlog.FromContext(ctx).With("requestId", id))
+	h.h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func NewLoggerMiddleware(addon *gonnect.Addon) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return LoggerMiddleware{next, addon}
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+)
+
+func TestLoggerMiddleware(t *testing.T) {
+	var prefix string
+	handler := NewLoggerMiddleware(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix = reqlog.FromContext(r.Context()).Prefix()
+	}))
+
+	testCases := []struct {
+		requestId string
+		generated bool
+	}{
+		{requestId: "proxy-id"},
+		{requestId: "", generated: true},
+		{requestId: "bad id\n", generated: true},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/page", nil)
+		req.Header.Set(REQUEST_ID_HEADER, testCase.requestId)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		id := rec.Header().Get(REQUEST_ID_HEADER)
+		if testCase.generated && (id == "" || id == testCase.requestId) {
+			t.Errorf("Expected a generated request id instead of %q, but got %q", testCase.requestId, id)
+		} else if !testCase.generated && id != testCase.requestId {
+			t.Errorf("Expected request id to be %q, but got %q", testCase.requestId, id)
+		}
+		if expected := "[requestId=" + id + "] "; prefix != expected {
+			t.Errorf("Expected logger prefix to be %q, but got %q", expected, prefix)
+		}
+	}
+}
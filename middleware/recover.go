@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+)
+
+// RecoverMiddleware recovers panics of the wrapped handler, reports them to
+// the errorreport.DefaultReporter and responds with 500
+type RecoverMiddleware struct {
+	h     http.Handler
+	addon *gonnect.Addon
+}
+
+func (h RecoverMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		} else if recovered == http.ErrAbortHandler {
+			// the server aborts the response without logging
+			panic(recovered)
+		}
+		err, ok := recovered.(error)
+		if !ok {
+			err = fmt.Errorf("%v", recovered)
+		}
+		stack := debug.Stack()
+		log.ErrorRDF(r, 1, "panic serving %s: %v\n%s", r.URL.Path, err, stack)
+		errorreport.Report(r.Context(), errorreport.Event{
+			Kind:    errorreport.KindPanic,
+			Err:     err,
+			Request: r,
+			Stack:   stack,
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(http.StatusText(http.StatusInternalServerError)))
+	}()
+	h.h.ServeHTTP(w, r)
+}
+
+func NewRecoverMiddleware(addon *gonnect.Addon) func(h http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return RecoverMiddleware{handler, addon}
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	var reported []errorreport.Event
+	defer func(reporter errorreport.ErrorReporter) { errorreport.DefaultReporter = reporter }(errorreport.DefaultReporter)
+	errorreport.DefaultReporter = errorreport.ErrorReporterFunc(func(ctx context.Context, event errorreport.Event) {
+		reported = append(reported, event)
+	})
+
+	handler := NewRecoverMiddleware(&gonnect.Addon{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	req := httptest.NewRequest("GET", "/page", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "clientKey", "key"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status to be %v, but got %v", http.StatusInternalServerError, rec.Code)
+	}
+	if len(reported) != 1 {
+		t.Fatalf("Expected %v reported errors, but got %v", 1, len(reported))
+	}
+	if reported[0].Kind != errorreport.KindPanic || reported[0].ClientKey != "key" || len(reported[0].Stack) == 0 {
+		t.Errorf("Expected a panic report for clientKey key with a stack, but got %+v", reported[0])
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"net/http"
 	"net/url"
 
-	"github.com/go-enjin/be/pkg/log"
-
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/i18n"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
 )
 
 type RequestMiddleware struct {
@@ -57,11 +57,12 @@ func (h RequestMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	log.TraceF("Setting Context Variables in Request Middleware")
+	reqlog.FromContext(r.Context()).TraceF("Setting Context Variables in Request Middleware")
 	ctx := context.WithValue(r.Context(), "title", *h.addon.Name)
-	ctx = context.WithValue(ctx, "addonKey", *h.addon.Key)
-	ctx = context.WithValue(ctx, "localBaseUrl", h.addon.Config.BaseUrl)
+	ctx = context.WithValue(ctx, "addonKey", h.addon.KeyFor(r))
+	ctx = context.WithValue(ctx, "localBaseUrl", h.addon.BaseUrlFor(r))
 	ctx = context.WithValue(ctx, "license", getParam("lic"))
+	ctx = context.WithValue(ctx, "locale", i18n.RequestLocale(r))
 
 	// if missing here: if isJira || isConfluence
 	// Since this poc is for confluence only, this should be valid, for now
@@ -74,11 +75,15 @@ func (h RequestMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx = context.WithValue(ctx, "hostBaseUrl", h.verifiedParams["hostBaseUrl"])
 		ctx = context.WithValue(ctx, "token", h.verifiedParams["token"])
 		ctx = context.WithValue(ctx, "tenantContext", h.verifiedParams["tenantContext"])
+		ctx = context.WithValue(ctx, "capabilitySet", h.verifiedParams["capabilitySet"])
+		ctx = reqlog.NewContext(ctx, reqlog.FromContext(ctx).
+			With("clientKey", h.verifiedParams["clientKey"]).
+			With("accountId", h.verifiedParams["userAccountId"]))
 
 		ctx = context.WithValue(ctx, "httpClient", &hostrequest.HostRequest{Addon: h.addon, ClientKey: h.verifiedParams["clientKey"]})
 	} else {
 		if tenant, err := h.addon.Store.GetByUrl(hostBaseUrl); err != nil {
-			log.ErrorF("error getting tenant %v: %v", hostBaseUrl, err)
+			reqlog.FromContext(ctx).ErrorF("error getting tenant %v: %v", hostBaseUrl, err)
 		} else {
 			ctx = context.WithValue(ctx, "tenantContext", tenant.Context.String())
 		}
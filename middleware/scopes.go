@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+// RequireScopesMiddleware only serves tenants which consented to the scopes,
+// tenants installed before their scopes were recorded are served. It has to
+// be applied after the authentication middleware.
+type RequireScopesMiddleware struct {
+	h      http.Handler
+	addon  *gonnect.Addon
+	scopes []string
+}
+
+func (h RequireScopesMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	clientKey, _ := r.Context().Value("clientKey").(string)
+	tenant, err := h.addon.Store.Get(clientKey)
+	if errors.Is(err, store.ErrNotFound) {
+		util.SendError(w, r, h.addon, http.StatusForbidden, "unknown tenant")
+		return
+	} else if err != nil {
+		sendStoreError(w, r, h.addon, err)
+		return
+	}
+	if tenant.InstalledScopes != nil {
+		for _, scope := range h.scopes {
+			if !hasScope(tenant.InstalledScopes, scope) {
+				util.SendError(w, r, h.addon, http.StatusForbidden, fmt.Sprintf("%s requires the %s scope, which the tenant has not consented to", r.URL.Path, strings.ToUpper(scope)))
+				return
+			}
+		}
+	}
+	h.h.ServeHTTP(w, r)
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if strings.EqualFold(s, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRequireScopesMiddleware returns a middleware requiring the tenant to
+// have installed the descriptor with the scopes, e.g. "WRITE"
+func NewRequireScopesMiddleware(addon *gonnect.Addon, scopes ...string) func(h http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return RequireScopesMiddleware{handler, addon, scopes}
+	}
+}
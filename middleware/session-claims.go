@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// SessionClaimsVersion is the version of the SessionClaims issued, it is
+// incremented whenever the meaning of the claims changes
+const SessionClaimsVersion = 1
+
+// SessionClaims are the claims of the session tokens the authentication
+// middleware issues for the AJAX requests of the add-on iframes
+// (X-acpt header and "token" template value):
+//
+//	iss        the key of the add-on as installed by the tenant
+//	aud        the clientKey of the tenant
+//	sub        the account id of the user, empty for anonymous users
+//	clientKey  the clientKey of the tenant
+//	accountId  the account id of the user
+//	ctx        sha256 hex hash of the context claim of the host JWT
+//	ver        SessionClaimsVersion
+//	jti, iat   the id and issue time, see store.TokenRevoker
+//
+// Version 0 are the tokens issued before the schema was versioned, with
+// only the iss, aud and sub claims
+type SessionClaims struct {
+	ClientKey   string `json:"clientKey,omitempty"`
+	AccountId   string `json:"accountId,omitempty"`
+	ContextHash string `json:"ctx,omitempty"`
+	Version     int    `json:"ver,omitempty"`
+	jwt.StandardClaims
+}
+
+// newSessionClaims returns the claims of a session token renewing the
+// verified host or session token of the tenant
+func newSessionClaims(issuer, clientKey string, verified jwt.MapClaims) *SessionClaims {
+	accountId, _ := verified["sub"].(string)
+	contextHash, _ := verified["ctx"].(string)
+	if context, ok := verified["context"]; ok {
+		data, _ := json.Marshal(context)
+		sum := sha256.Sum256(data)
+		contextHash = hex.EncodeToString(sum[:])
+	}
+	return &SessionClaims{
+		ClientKey:   clientKey,
+		AccountId:   accountId,
+		ContextHash: contextHash,
+		Version:     SessionClaimsVersion,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:   issuer,
+			Audience: clientKey,
+			Subject:  accountId,
+			Id:       newTokenId(),
+			IssuedAt: time.Now().Unix(),
+		},
+	}
+}
+
+// ParseSessionClaims returns the claims of a session token, tokens of
+// unknown versions and with a clientKey other than their audience are
+// rejected
+func ParseSessionClaims(claims jwt.MapClaims) (*SessionClaims, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	session := &SessionClaims{}
+	if err = json.Unmarshal(data, session); err != nil {
+		return nil, fmt.Errorf("malformed session claims: %w", err)
+	}
+	if session.Version < 0 || session.Version > SessionClaimsVersion {
+		return nil, fmt.Errorf("unsupported session claims version %d", session.Version)
+	}
+	if audience := sessionAudience(claims); session.Version > 0 && session.ClientKey != audience {
+		return nil, fmt.Errorf("session claims clientKey %q does not match the audience %q", session.ClientKey, audience)
+	}
+	if session.Version == 0 {
+		session.ClientKey = sessionAudience(claims)
+		session.AccountId = session.Subject
+	}
+	return session, nil
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestSessionClaims(t *testing.T) {
+	host := jwt.MapClaims{"iss": "client-key", "sub": "account-id", "context": map[string]interface{}{"jira": map[string]interface{}{"issue": map[string]interface{}{"key": "TEST-1"}}}}
+	issued := newSessionClaims("addon-key", "client-key", host)
+	if issued.Version != SessionClaimsVersion || issued.AccountId != "account-id" || issued.Subject != "account-id" || len(issued.ContextHash) != 64 {
+		t.Errorf("Unexpected session claims %+v", issued)
+	}
+	data, _ := json.Marshal(issued)
+	roundTrip := jwt.MapClaims{}
+	_ = json.Unmarshal(data, &roundTrip)
+	if renewed := newSessionClaims("addon-key", "client-key", roundTrip); renewed.ContextHash != issued.ContextHash || renewed.AccountId != "account-id" {
+		t.Errorf("Expected the renewed session to keep the context hash and account, but got %+v", renewed)
+	}
+
+	testCases := []struct {
+		name              string
+		claims            jwt.MapClaims
+		expectedClientKey string
+		expectedAccountId string
+		expectedError     string
+	}{
+		{name: "current version", claims: roundTrip, expectedClientKey: "client-key", expectedAccountId: "account-id"},
+		{name: "legacy", claims: jwt.MapClaims{"iss": "addon-key", "aud": "client-key", "sub": "account-id"}, expectedClientKey: "client-key", expectedAccountId: "account-id"},
+		{name: "unknown version", claims: jwt.MapClaims{"iss": "addon-key", "aud": "client-key", "clientKey": "client-key", "ver": 2}, expectedError: "unsupported session claims version 2"},
+		{name: "other tenant", claims: jwt.MapClaims{"iss": "addon-key", "aud": "client-key", "clientKey": "other-key", "ver": 1}, expectedError: "does not match the audience"},
+	}
+	for _, testCase := range testCases {
+		session, err := ParseSessionClaims(testCase.claims)
+		if testCase.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Errorf("%s: Expected error %q, but got %v", testCase.name, testCase.expectedError, err)
+			}
+			continue
+		}
+		if err != nil || session.ClientKey != testCase.expectedClientKey || session.AccountId != testCase.expectedAccountId {
+			t.Errorf("%s: Expected the session claims of %s and %s, but got %+v, %v", testCase.name, testCase.expectedClientKey, testCase.expectedAccountId, session, err)
+		}
+	}
+
+	addon := newTestAddon(t)
+	token := signTestToken(t, jwt.MapClaims{"iss": *addon.Key, "aud": "client-key", "clientKey": "client-key", "ver": 2, "iat": time.Now().Unix()}, "shared-secret")
+	rec := httptest.NewRecorder()
+	NewTokenMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, httptest.NewRequest("GET", "/api/items?jwt="+token, nil))
+	var body AuthError
+	if rec.Code != http.StatusUnauthorized || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Reason != AuthMalformedToken {
+		t.Errorf("Expected the unknown session version to be rejected, but got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+// sessionKey is the parsed signing key of the session tokens
+type sessionKey struct {
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+}
+
+// sessionKeys caches the parsed keys by algorithm and key
+var sessionKeys sync.Map
+
+// sessionSigningKey returns the configured signing key of the session
+// tokens, nil when they are signed with the shared secret of the tenant
+func sessionSigningKey(addon *gonnect.Addon) (*sessionKey, error) {
+	if addon.Config == nil || addon.Config.SessionTokens == nil || addon.Config.SessionTokens.SigningKey == "" {
+		return nil, nil
+	}
+	config := addon.Config.SessionTokens
+	cacheKey := config.SigningAlgorithm + "\x00" + config.SigningKey
+	if key, ok := sessionKeys.Load(cacheKey); ok {
+		return key.(*sessionKey), nil
+	}
+	key, err := parseSessionKey(config.SigningAlgorithm, config.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	sessionKeys.Store(cacheKey, key)
+	return key, nil
+}
+
+func parseSessionKey(algorithm, key string) (*sessionKey, error) {
+	switch algorithm {
+	case "", "HS256":
+		return &sessionKey{method: jwt.SigningMethodHS256, sign: []byte(key), verify: []byte(key)}, nil
+	case "RS256":
+		private, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid RS256 session signing key: %w", err)
+		}
+		return &sessionKey{method: jwt.SigningMethodRS256, sign: private, verify: &private.PublicKey}, nil
+	case "ES256":
+		private, err := jwt.ParseECPrivateKeyFromPEM([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ES256 session signing key: %w", err)
+		}
+		return &sessionKey{method: jwt.SigningMethodES256, sign: private, verify: &private.PublicKey}, nil
+	}
+	return nil, fmt.Errorf("unsupported session signing algorithm %q", algorithm)
+}
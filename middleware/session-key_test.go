@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+)
+
+func TestSessionSigningKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDer, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPem := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	ecPem := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDer}))
+
+	addon := newTestAddon(t)
+	issue := func() string {
+		qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", "/page", nil), false, addon.Config.BaseUrl)
+		token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+		var issued string
+		handler := NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			issued, _ = r.Context().Value("token").(string)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/page?jwt="+token, nil))
+		return issued
+	}
+	serve := func(token string) int {
+		handler := NewTokenMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/items?jwt="+token, nil))
+		return rec.Code
+	}
+	forged := signTestToken(t, jwt.MapClaims{"iss": *addon.Key, "aud": "client-key", "iat": time.Now().Unix()}, "shared-secret")
+
+	testCases := []struct {
+		algorithm   string
+		key         string
+		expectedAlg string
+	}{
+		{algorithm: "HS256", key: "session-secret", expectedAlg: "HS256"},
+		{algorithm: "RS256", key: rsaPem, expectedAlg: "RS256"},
+		{algorithm: "ES256", key: ecPem, expectedAlg: "ES256"},
+	}
+	for _, testCase := range testCases {
+		addon.Config.SessionTokens = &gonnect.SessionTokenConfiguration{SigningAlgorithm: testCase.algorithm, SigningKey: testCase.key}
+		token := issue()
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+		if err != nil || parsed.Method.Alg() != testCase.expectedAlg {
+			t.Errorf("%s: Expected a %s session token, but got %v", testCase.algorithm, testCase.expectedAlg, err)
+			continue
+		}
+		if code := serve(token); code != http.StatusOK {
+			t.Errorf("%s: Expected the session token to be accepted, but got %d", testCase.algorithm, code)
+		}
+		if code := serve(forged); code != http.StatusUnauthorized {
+			t.Errorf("%s: Expected a token signed with the shared secret to be rejected, but got %d", testCase.algorithm, code)
+		}
+	}
+
+	if _, err = parseSessionKey("PS256", "key"); err == nil {
+		t.Errorf("Expected an unsupported algorithm to be rejected")
+	}
+}
+
+func TestFIPSCrypto(t *testing.T) {
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakPem := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weakKey)}))
+
+	testCases := []struct {
+		sessionTokens  *gonnect.SessionTokenConfiguration
+		internalTokens *gonnect.InternalTokenConfiguration
+		valid          bool
+	}{
+		{nil, nil, true},
+		{&gonnect.SessionTokenConfiguration{SigningKey: "short"}, nil, false},
+		{&gonnect.SessionTokenConfiguration{SigningAlgorithm: "HS256", SigningKey: "a-long-enough-signing-key"}, nil, true},
+		{&gonnect.SessionTokenConfiguration{SigningAlgorithm: "RS256", SigningKey: weakPem}, nil, false},
+		{nil, &gonnect.InternalTokenConfiguration{Secrets: []string{"a-long-enough-secret", "old"}}, false},
+	}
+	for i, testCase := range testCases {
+		profile := &gonnect.Profile{SessionTokens: testCase.sessionTokens, InternalTokens: testCase.internalTokens}
+		if err := profile.ValidateCrypto(); err != nil {
+			t.Errorf("%d: Expected no validation without FIPS mode, but got %v", i, err)
+		}
+		profile.Crypto = &gonnect.CryptoConfiguration{FIPS: true}
+		if err := profile.ValidateCrypto(); (err == nil) != testCase.valid {
+			t.Errorf("%d: Expected valid %v, but got %v", i, testCase.valid, err)
+		}
+	}
+
+	// the shared secret of the test tenant is shorter than 112 bits
+	addon := newTestAddon(t)
+	addon.Config.Crypto = &gonnect.CryptoConfiguration{FIPS: true}
+	token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+	rec := httptest.NewRecorder()
+	NewAuthenticationMiddleware(addon, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the short shared secret to be rejected")
+	})).ServeHTTP(rec, httptest.NewRequest("GET", "/page?jwt="+token, nil))
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), string(AuthMissingSecret)) {
+		t.Errorf("Expected a %v %v, but got %v: %s", http.StatusUnauthorized, AuthMissingSecret, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// templateKeys are the context values set by the gonnect middlewares which
+// are exposed to page templates
+var templateKeys = []string{
+	"title",
+	"addonKey",
+	"localBaseUrl",
+	"hostBaseUrl",
+	"hostUrl",
+	"hostStylesheetUrl",
+	"hostScriptUrl",
+	"clientKey",
+	"userAccountId",
+	"token",
+	"tenantContext",
+	"locale",
+	"license",
+	"capabilitySet",
+	"csrfToken",
+	"requestId",
+}
+
+// TemplateData returns the request values set by the middlewares keyed by
+// their context key, to render page modules like the locals of
+// atlassian-connect-express. licenseState holds the License of the request.
+func TemplateData(r *http.Request) map[string]interface{} {
+	data := make(map[string]interface{}, len(templateKeys)+1)
+	for _, key := range templateKeys {
+		if value := r.Context().Value(key); value != nil {
+			data[key] = value
+		}
+	}
+	data["licenseState"] = License(r)
+	return data
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
 )
 
 type TokenMiddleware struct {
@@ -12,7 +13,11 @@ type TokenMiddleware struct {
 }
 
 func (h TokenMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// TODO: Add isTokenVerificationDisabled
+	if config := h.addon.Config; config != nil && config.SessionTokens != nil && config.SessionTokens.DisableVerification {
+		reqlog.FromContext(r.Context()).WarnF("session token verification is disabled")
+		h.h.ServeHTTP(w, r)
+		return
+	}
 	authHandler := NewAuthenticationMiddleware(h.addon, true)
 	authHandler(h.h).ServeHTTP(w, r)
 }
@@ -1 +1,127 @@
 package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestTokenMiddlewareRevocation(t *testing.T) {
+	addon := newTestAddon(t)
+	revoker := addon.Store.(store.TokenRevoker)
+
+	// the page request issues the session tokens used by AJAX requests
+	sessionToken := func() string {
+		qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", "/page", nil), false, addon.Config.BaseUrl)
+		token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+		var issued string
+		handler := NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			issued, _ = r.Context().Value("token").(string)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/page?jwt="+token, nil))
+		if issued == "" {
+			t.Fatal("Expected a session token")
+		}
+		return issued
+	}
+	serve := func(token string) *httptest.ResponseRecorder {
+		handler := NewTokenMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/items?jwt="+token, nil))
+		return rec
+	}
+	jtiOf := func(token string) string {
+		claims := jwt.MapClaims{}
+		_, _, _ = new(jwt.Parser).ParseUnverified(token, claims)
+		jti, _ := claims["jti"].(string)
+		return jti
+	}
+
+	first, second := sessionToken(), sessionToken()
+	if rec := serve(first); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the session token to be accepted, but got %d %s", rec.Code, rec.Body.String())
+	}
+	if err := revoker.RevokeToken("client-key", jtiOf(first)); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{name: "revoked token", token: first, expectedCode: http.StatusUnauthorized},
+		{name: "other token", token: second, expectedCode: http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		rec := serve(testCase.token)
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s: Expected status %d, but got %d", testCase.name, testCase.expectedCode, rec.Code)
+		}
+		var body AuthError
+		if testCase.expectedCode == http.StatusUnauthorized && (json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Reason != AuthRevoked) {
+			t.Errorf("%s: Expected reason %s, but got %s", testCase.name, AuthRevoked, rec.Body.String())
+		}
+	}
+
+	if err := revoker.RevokeTokensIssuedBefore("client-key", time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if rec := serve(second); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the tokens issued before to be revoked, but got %d", rec.Code)
+	}
+}
+
+func TestTokenMiddlewareSessionLimits(t *testing.T) {
+	addon := newTestAddon(t)
+	serve := func(token string) *httptest.ResponseRecorder {
+		handler := NewTokenMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		rec := httptest.NewRecorder()
+		url := "/api/items"
+		if token != "" {
+			url += "?jwt=" + token
+		}
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		return rec
+	}
+	session := func(issuedAt time.Time) string {
+		return signTestToken(t, jwt.MapClaims{"iss": *addon.Key, "aud": "client-key", "jti": "jti", "iat": issuedAt.Unix()}, "shared-secret")
+	}
+	rotatedAt := time.Now().Add(-time.Hour)
+	if _, err := addon.Store.Set(&store.Tenant{ClientKey: "client-key", SecretRotatedAt: &rotatedAt, AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name           string
+		token          string
+		config         *gonnect.SessionTokenConfiguration
+		expectedCode   int
+		expectedReason AuthReason
+	}{
+		{name: "fresh token", token: session(time.Now()), expectedCode: http.StatusOK},
+		{name: "token older than max age", token: session(time.Now().Add(-20 * time.Minute)), config: &gonnect.SessionTokenConfiguration{MaxAge: 15 * time.Minute}, expectedCode: http.StatusUnauthorized, expectedReason: AuthExpired},
+		{name: "token within max age", token: session(time.Now().Add(-5 * time.Minute)), config: &gonnect.SessionTokenConfiguration{MaxAge: 15 * time.Minute}, expectedCode: http.StatusOK},
+		{name: "token issued before the rotation", token: session(rotatedAt.Add(-time.Minute)), expectedCode: http.StatusUnauthorized, expectedReason: AuthRevoked},
+		{name: "verification disabled", config: &gonnect.SessionTokenConfiguration{DisableVerification: true}, expectedCode: http.StatusOK},
+	}
+	for _, testCase := range testCases {
+		addon.Config.SessionTokens = testCase.config
+		rec := serve(testCase.token)
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s: Expected status %d, but got %d %s", testCase.name, testCase.expectedCode, rec.Code, rec.Body.String())
+		}
+		var body AuthError
+		if testCase.expectedReason != "" && (json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Reason != testCase.expectedReason) {
+			t.Errorf("%s: Expected reason %s, but got %s", testCase.name, testCase.expectedReason, rec.Body.String())
+		}
+	}
+}
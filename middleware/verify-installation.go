@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,9 +14,11 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"github.com/patrickmn/go-cache"
 
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
 
 	"github.com/go-enjin/be/pkg/log"
@@ -25,7 +28,40 @@ const (
 	CONNECT_INSTALL_KEYS_CDN_URL = "https://connect-install-keys.atlassian.com"
 )
 
-var keyFallbackCache = cache.New(4*time.Hour, 1*time.Hour)
+// InstallKeysCDNURL is the key CDN install public keys are fetched from
+var InstallKeysCDNURL = CONNECT_INSTALL_KEYS_CDN_URL
+
+const (
+	DefaultInstallKeyFetchTimeout  = 5 * time.Second
+	DefaultInstallKeyFetchAttempts = 3
+)
+
+// InstallKeysHTTPClient fetches the install public keys from the key CDN,
+// each attempt is further limited by the FetchTimeout of the InstallKeys
+// configuration
+var InstallKeysHTTPClient = newInstallKeysHTTPClient()
+
+func newInstallKeysHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = 5 * time.Second
+	transport.ResponseHeaderTimeout = 10 * time.Second
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}
+}
+
+// installKeyFetchLimits returns the timeout of each attempt to fetch a key
+// from the key CDN and the number of attempts
+func installKeyFetchLimits(config *gonnect.InstallKeysConfiguration) (timeout time.Duration, attempts int) {
+	timeout, attempts = DefaultInstallKeyFetchTimeout, DefaultInstallKeyFetchAttempts
+	if config != nil {
+		if config.FetchTimeout > 0 {
+			timeout = config.FetchTimeout
+		}
+		if config.FetchAttempts > 0 {
+			attempts = config.FetchAttempts
+		}
+	}
+	return
+}
 
 func isJwtAsymmetric(r *http.Request) bool {
 	tokenStr, ok := ExtractJwt(r)
@@ -33,39 +69,92 @@ func isJwtAsymmetric(r *http.Request) bool {
 		return ok
 	}
 
-	token, _ := jwt.Parse(tokenStr, nil)
-	return token.Method == jwt.SigningMethodRS256
+	token, _, _ := parseUnverified(tokenStr)
+	return token != nil && token.Method == jwt.SigningMethodRS256
 }
 
-func fetchKeyWithKeyId(keyId string) (string, error) {
-	keyCdnUrl, err := url.Parse(CONNECT_INSTALL_KEYS_CDN_URL)
-	if err != nil {
-		return "", err
+// fetchKeyWithKeyId returns the fresh cached key or fetches it from the CDN,
+// falling back to the cached key while the CDN fails
+func fetchKeyWithKeyId(ctx context.Context, config *gonnect.InstallKeysConfiguration, keyId string) (string, error) {
+	// the fetch may outlive the request, it must not read the globals
+	cdnUrl, cache := InstallKeysCDNURL, InstallKeyFallbackCache
+	cachedKey, fresh, cached := cache.Get(keyId)
+	if fresh {
+		return cachedKey, nil
 	}
+	return fetchInstallKeyOnce(ctx, keyId, func(ctx context.Context, keyId string) (string, error) {
+		key, err := fetchKeyFromCDN(ctx, config, cdnUrl, cache, keyId)
+		if err != nil && cached {
+			log.WarnF("using cached install key %s, the key CDN failed: %v", keyId, err)
+			return cachedKey, nil
+		}
+		return key, err
+	})
+}
 
-	keyCdnUrl.Path = path.Join(keyCdnUrl.Path, keyId)
+// installKeyStatusError is returned when the key CDN responds with another
+// status than 200
+type installKeyStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *installKeyStatusError) Error() string {
+	return fmt.Sprintf("Could not retrieve public Key from CDN: %s", e.Status)
+}
 
-	response, err := http.Get(keyCdnUrl.String())
+// fetchKeyFromCDN fetches the key, attempts which fail or time out are
+// retried unless the CDN does not know the key or ctx is done
+func fetchKeyFromCDN(ctx context.Context, config *gonnect.InstallKeysConfiguration, cdnUrl string, cache InstallKeyCache, keyId string) (key string, err error) {
+	keyCdnUrl, err := url.Parse(cdnUrl)
 	if err != nil {
 		return "", err
 	}
-	if response.StatusCode == http.StatusOK {
-		// TODO: somehow return a 404 here
-		body, err := ioutil.ReadAll(response.Body)
-		if err != nil {
+	keyCdnUrl.Path = path.Join(keyCdnUrl.Path, keyId)
+
+	timeout, attempts := installKeyFetchLimits(config)
+	for attempt := 1; ; attempt++ {
+		if key, err = fetchKeyFromCDNOnce(ctx, keyCdnUrl.String(), timeout); err == nil {
+			cache.Set(keyId, key)
+			return key, nil
+		}
+		var statusErr *installKeyStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests {
 			return "", err
 		}
-		bodyString := string(body)
-
-		keyFallbackCache.Add(keyId, bodyString, cache.DefaultExpiration)
-		return bodyString, nil
+		if attempt >= attempts || ctx.Err() != nil {
+			return "", err
+		}
+		log.WarnF("attempt %d to fetch install key %s failed: %v", attempt, keyId, err)
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+		}
 	}
+}
 
-	fallbackKey, ok := keyFallbackCache.Get(keyId)
-	if !ok {
-		return "", fmt.Errorf("Could not retrieve public Key from CDN or fallbackCache")
+func fetchKeyFromCDNOnce(ctx context.Context, keyCdnUrl string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keyCdnUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	response, err := InstallKeysHTTPClient.Do(req)
+	if err != nil {
+		return "", err
 	}
-	return fallbackKey.(string), nil
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		// TODO: somehow return a 404 here
+		return "", &installKeyStatusError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
 }
 
 func decodeAsymmetric(tokenStr string, publicKey string, signedAlgorithm jwt.SigningMethod, noVerify bool) (jwt.MapClaims, error) {
@@ -90,19 +179,30 @@ func decodeAsymmetric(tokenStr string, publicKey string, signedAlgorithm jwt.Sig
 	return claims.(jwt.MapClaims), nil
 }
 
-func decodeAsymmetricToken(tokenStr string, noVerify bool) (jwt.MapClaims, error) {
+func tokenKeyId(tokenStr string) (string, error) {
 	token, _ := jwt.Parse(tokenStr, nil)
+	if token == nil {
+		return "", fmt.Errorf("keyId is missing")
+	}
 
 	keyIdI, ok := token.Header["kid"]
 	if !ok {
-		return nil, fmt.Errorf("keyId is missing")
+		return "", fmt.Errorf("keyId is missing")
 	}
 	keyId, ok := keyIdI.(string)
 	if !ok || keyId == "" {
-		return nil, fmt.Errorf("keyId is missing")
+		return "", fmt.Errorf("keyId is missing")
+	}
+	return keyId, nil
+}
+
+func decodeAsymmetricToken(ctx context.Context, config *gonnect.InstallKeysConfiguration, tokenStr string, noVerify bool) (jwt.MapClaims, error) {
+	keyId, err := tokenKeyId(tokenStr)
+	if err != nil {
+		return nil, err
 	}
 
-	publicKey, err := fetchKeyWithKeyId(keyId)
+	publicKey, err := fetchInstallKey(ctx, config, keyId)
 	if err != nil {
 		return nil, err
 	}
@@ -118,137 +218,212 @@ type signedInstallMiddleware struct {
 func (h signedInstallMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	clientKey, err := h.verifyAsymmetricJwtAndGetClaims(r)
 	if err != nil {
-		util.SendError(w, r, h.addon, 401, err.Error())
+		sendAuthError(w, r, h.addon, err)
 		return
 	}
 
 	ctx := context.WithValue(r.Context(), "clientKey", clientKey)
+	ctx = context.WithValue(ctx, gonnect.SignedInstallContextKey, true)
+	ctx = reqlog.NewContext(ctx, reqlog.FromContext(ctx).With("clientKey", clientKey))
 	r = r.WithContext(ctx)
 
 	h.next.ServeHTTP(w, r)
 }
 
 func (h signedInstallMiddleware) verifyAsymmetricJwtAndGetClaims(r *http.Request) (string, error) {
-	tokenStr, ok := ExtractJwt(r)
-	if !ok {
-		return "", fmt.Errorf("Could not find authentication data on request")
+	// fetching the install keys ends with the request or the auth deadline
+	ctx, cancel := authContext(h.addon, r)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	tokenStr, authErr := extractJwt(r, tokenSourcesOf(h.addon))
+	if authErr != nil {
+		return "", authErr
 	}
 
-	unverifiedClaims, err := decodeAsymmetricToken(tokenStr, true)
+	unverifiedClaims, err := decodeAsymmetricToken(r.Context(), h.addon.Config.InstallKeys, tokenStr, true)
 	if err != nil {
 		return "", err
 	}
 
-	if unverifiedClaims["iss"] == "" {
-		return "", fmt.Errorf("JWT claim did not contain the issuer (iss) claim")
+	clientKey, _ := unverifiedClaims["iss"].(string)
+	if clientKey == "" {
+		return "", newAuthError(AuthBadIssuer, "JWT claim did not contain the issuer (iss) claim")
 	}
 
-	clientKey := unverifiedClaims["iss"].(string)
+	if !unverifiedClaims.VerifyAudience(h.addon.BaseUrlFor(r), true) {
+		return "", newAuthError(AuthBadAudience, "JWT claim did not contain the correct audience (aud) claim")
+	}
 
-	if !unverifiedClaims.VerifyAudience(h.addon.Config.BaseUrl, true) {
-		return "", fmt.Errorf("JWT claim did not contain the correct audience (aud) claim")
+	if queryStringHash, _ := unverifiedClaims["qsh"].(string); queryStringHash == "" {
+		return "", newAuthError(AuthMissingQsh, "JWT claim did not contain the query string hash (qsh) claim")
 	}
 
-	if unverifiedClaims["qsh"] == "" {
-		return "", fmt.Errorf("JWT claim did not contain the query string hash (qsh) claim")
+	if err := h.checkPinnedKey(r, tokenStr, clientKey); err != nil {
+		return "", err
 	}
 
-	verifiedClaims, err := decodeAsymmetricToken(tokenStr, false)
+	verifiedClaims, err := decodeAsymmetricToken(r.Context(), h.addon.Config.InstallKeys, tokenStr, false)
 	if err != nil {
 		return "", err
 	}
 
 	if err := verifiedClaims.Valid(); err != nil {
-		return "", fmt.Errorf("Authentication request has expired.")
+		return "", newAuthError(AuthExpired, "Authentication request has expired.")
 	}
 
-	ok = ValidateQshFromRequest(verifiedClaims, r, h.addon, false)
+	ok := ValidateQshFromRequest(verifiedClaims, r, h.addon, false)
 	if !ok {
-		return "", fmt.Errorf("Auth failure: Query hash mismatch")
+		return "", newAuthError(AuthQshMismatch, "Auth failure: Query hash mismatch")
 	}
 
 	return clientKey, nil
 }
 
+// checkPinnedKey rejects install JWTs signed with keys which are not pinned
+// in the InstallKeys configuration
+func (h signedInstallMiddleware) checkPinnedKey(r *http.Request, tokenStr, clientKey string) error {
+	pins := h.addon.Config.InstallKeys
+	if !pins.Pinned() {
+		return nil
+	}
+	keyId, err := tokenKeyId(tokenStr)
+	if err != nil {
+		return err
+	}
+	for _, pinned := range pins.PinnedKeyIds {
+		if keyId == pinned {
+			return nil
+		}
+	}
+	if len(pins.PinnedPublicKeys) > 0 {
+		publicKey, err := fetchInstallKey(r.Context(), pins, keyId)
+		if err != nil {
+			return err
+		}
+		if isPinnedPublicKey(publicKey, pins.PinnedPublicKeys) {
+			return nil
+		}
+	}
+	audit.Record(r.Context(), audit.Event{
+		Type:      "install_key_not_pinned",
+		ClientKey: clientKey,
+		Message:   "signed install rejected, the signing key is not pinned",
+		Fields:    map[string]string{"kid": keyId},
+	})
+	return newAuthError(AuthUnpinnedKey, "Install key %s is not pinned", keyId)
+}
+
+func isPinnedPublicKey(publicKey string, pinned []string) bool {
+	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
+	if err != nil {
+		return false
+	}
+	for _, pem := range pinned {
+		if pinnedKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pem)); err == nil && key.Equal(pinnedKey) {
+			return true
+		} else if err != nil {
+			log.WarnF("ignoring invalid pinned install public key: %v", err)
+		}
+	}
+	return false
+}
+
 type VerifyInstallationMiddleware struct {
 	next  http.Handler
 	addon *gonnect.Addon
 }
 
 func (h VerifyInstallationMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Body == http.NoBody {
-		util.SendError(w, r, h.addon, 401, "No registration info provided")
+	if r.Body == nil || r.Body == http.NoBody {
+		util.SendLifecycleError(w, r, h.addon, http.StatusBadRequest, util.LifecycleInvalidPayload, "No registration info provided")
 		return
 	}
 
-	b := bytes.NewBuffer(make([]byte, 0))
-	reader := io.TeeReader(r.Body, b)
-	defer r.Body.Close()
+	// the install handler decodes the whole body again, the decoder would
+	// leave the bytes after the first JSON value unread
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		util.SendLifecycleError(w, r, h.addon, http.StatusBadRequest, util.LifecycleInvalidPayload, "Could not read registration info")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
 
 	responseData := map[string]interface{}{}
-	json.NewDecoder(reader).Decode(&responseData)
-
-	r.Body = ioutil.NopCloser(b)
-
-	// TODO: Add whitelist feature
+	json.Unmarshal(body, &responseData)
 
 	baseUrl, ok := responseData["baseUrl"]
 	if !ok {
-		util.SendError(w, r, h.addon, 401, "No baseUrl provided for registration info")
+		util.SendLifecycleError(w, r, h.addon, http.StatusBadRequest, util.LifecycleInvalidPayload, "No baseUrl provided for registration info")
+		return
+	}
+	baseUrlStr, ok := baseUrl.(string)
+	if !ok {
+		util.SendLifecycleError(w, r, h.addon, http.StatusBadRequest, util.LifecycleInvalidPayload, "baseUrl of registration info is not a string")
+		return
+	}
+	if err := h.addon.Config.ValidateInstallBaseUrl(baseUrlStr); err != nil {
+		util.SendLifecycleError(w, r, h.addon, http.StatusForbidden, util.LifecycleBaseUrlRejected, err.Error())
 		return
 	}
 
-	clientKey, ok := responseData["clientKey"]
+	clientKey, ok := responseData["clientKey"].(string)
 	if !ok {
-		log.WarnF("No clientKey provided for host %s", baseUrl)
+		reqlog.FromContext(r.Context()).WarnF("No clientKey provided for host %s", baseUrlStr)
+		util.SendLifecycleError(w, r, h.addon, http.StatusBadRequest, util.LifecycleInvalidPayload, "No clientKey provided for registration info")
 		return
 	}
 
 	if h.addon.Config.SignedInstall && isJwtAsymmetric(r) {
 		signedInstallMiddleware{
 			addon: h.addon,
-			next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				// TODO: add check
-				if r.Context().Value("clientKey") == clientKey {
-					h.next.ServeHTTP(w, r)
-				} else {
-					util.SendError(w, r, h.addon, 401, "clientKey in install payload did not match authenticated client")
-					return
-				}
-			}),
+			next:  h.matchingClient(clientKey),
 		}.ServeHTTP(w, r)
-	} else {
-		if h.addon.Config.SignedInstall {
-			w.Header().Add("x-unexpected-symmetric-hook", "true")
-		}
+		return
+	}
+	if h.addon.Config.SignedInstall {
+		w.Header().Add("x-unexpected-symmetric-hook", "true")
+	}
 
-		// always normal installation, previous way causes errors during enjin
-		// migration processes, for Go-Enjin purposes, tenants are treated as
-		// ephemeral like an auth session table complimenting some other users
-		// table
+	// ephemeral tenants are reinstalled like new ones, e.g. while migrating
+	// deployments whose stores differ, see gonnect.EphemeralTenantConfiguration
+	if h.addon.Config.Ephemeral() || h.addon.Store == nil {
 		h.next.ServeHTTP(w, r)
-
-		// _, err := h.addon.Store.Get(clientKey.(string))
-		// if err != nil {
-		// 	// If err is set here, we serve the normal installation
-		// 	h.next.ServeHTTP(w, r)
-		// } else {
-		// 	authHandler := NewAuthenticationMiddleware(h.addon, false)
-		// 	authHandler(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
-		// 		if req.Context().Value("clientKey") == clientKey {
-		// 			h.next.ServeHTTP(writer, req)
-		// 		} else {
-		// 			util.SendError(w, h.addon, 401, fmt.Sprintf("clientKey in install payload did not match authenticated client; payload: %s, auth: %s", clientKey, r.Context().Value("clientKey")))
-		// 			return
-		// 		}
-		// 	})).ServeHTTP(w, r)
-		// }
+		return
+	}
+	stored, err := h.addon.Store.Get(clientKey)
+	if errors.Is(err, store.ErrNotFound) {
+		h.next.ServeHTTP(w, r)
+		return
+	} else if err != nil {
+		sendStoreError(w, r, h.addon, err)
+		return
+	}
+	// tenants which were uninstalled or whose secret was revoked have no
+	// secret to sign with, they are installed like new ones
+	if stored.SharedSecret == "" || !stored.AddonInstalled {
+		h.next.ServeHTTP(w, r)
+		return
 	}
+	// reinstalls of an installed tenant are signed with its shared secret
+	NewAuthenticationMiddleware(h.addon, false)(h.matchingClient(clientKey)).ServeHTTP(w, r)
+}
 
+// matchingClient serves the install when the authenticated client is the
+// one of the install payload
+func (h VerifyInstallationMiddleware) matchingClient(clientKey string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value("clientKey") != clientKey {
+			sendAuthError(w, r, h.addon, newAuthError(AuthClientMismatch, "clientKey in install payload did not match authenticated client"))
+			return
+		}
+		h.next.ServeHTTP(w, r)
+	})
 }
 
 func NewVerifyInstallationMiddleware(addon *gonnect.Addon) func(h http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return VerifyInstallationMiddleware{next, addon}
 	}
-}
\ No newline at end of file
+}
@@ -1 +1,245 @@
 package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func signInstallToken(t *testing.T, keyId string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": "client-key"})
+	token.Header["kid"] = keyId
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestCheckPinnedKey(t *testing.T) {
+	testCases := []struct {
+		installKeys   *gonnect.InstallKeysConfiguration
+		keyId         string
+		expectedError bool
+	}{
+		{installKeys: nil, keyId: "any", expectedError: false},
+		{installKeys: &gonnect.InstallKeysConfiguration{}, keyId: "any", expectedError: false},
+		{installKeys: &gonnect.InstallKeysConfiguration{PinnedKeyIds: []string{"pinned"}}, keyId: "pinned", expectedError: false},
+		{installKeys: &gonnect.InstallKeysConfiguration{PinnedKeyIds: []string{"pinned"}}, keyId: "rogue", expectedError: true},
+	}
+
+	var recorded []audit.Event
+	defer func(sink audit.Sink) { audit.DefaultSink = sink }(audit.DefaultSink)
+	audit.DefaultSink = audit.SinkFunc(func(ctx context.Context, event audit.Event) {
+		recorded = append(recorded, event)
+	})
+
+	for _, testCase := range testCases {
+		recorded = nil
+		h := signedInstallMiddleware{addon: &gonnect.Addon{Config: &gonnect.Profile{InstallKeys: testCase.installKeys}}}
+		err := h.checkPinnedKey(httptest.NewRequest("POST", "/installed", nil), signInstallToken(t, testCase.keyId), "client-key")
+		if (err != nil) != testCase.expectedError {
+			t.Errorf("Expected error for kid %s to be %v, but got %v", testCase.keyId, testCase.expectedError, err)
+		}
+		if testCase.expectedError && (len(recorded) != 1 || recorded[0].Fields["kid"] != testCase.keyId) {
+			t.Errorf("Expected an audit event for kid %s, but got %+v", testCase.keyId, recorded)
+		}
+		if !testCase.expectedError && len(recorded) != 0 {
+			t.Errorf("Expected no audit events for kid %s, but got %+v", testCase.keyId, recorded)
+		}
+	}
+}
+
+func TestSignedInstallAuthTimeout(t *testing.T) {
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer cdn.Close()
+	defer func(url string, cache InstallKeyCache) {
+		InstallKeysCDNURL, InstallKeyFallbackCache = url, cache
+	}(InstallKeysCDNURL, InstallKeyFallbackCache)
+	InstallKeysCDNURL, InstallKeyFallbackCache = cdn.URL, NewInstallKeyCache(time.Hour, time.Hour, "")
+
+	addon := &gonnect.Addon{Config: &gonnect.Profile{AuthTimeout: 50 * time.Millisecond}}
+	handler := signedInstallMiddleware{addon: addon, next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected the install not to reach the handler")
+	})}
+	rec := httptest.NewRecorder()
+	started := time.Now()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/installed?jwt="+signInstallToken(t, "hung"), nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), string(AuthTimeout)) {
+		t.Errorf("Expected a %v timeout, but got %v: %s", http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected the install to fail after the auth timeout, but it took %v", elapsed)
+	}
+}
+
+func TestVerifyInstallationBaseUrl(t *testing.T) {
+	testCases := []struct {
+		baseUrl      string
+		installHosts *gonnect.InstallHostConfiguration
+		expectedCode int
+	}{
+		{baseUrl: "https://example.atlassian.net", expectedCode: http.StatusOK},
+		{baseUrl: "https://jira.example.com", expectedCode: http.StatusOK},
+		{baseUrl: "http://example.atlassian.net", expectedCode: http.StatusForbidden},
+		{baseUrl: "https://127.0.0.1:2990/jira", expectedCode: http.StatusForbidden},
+		{baseUrl: "https://10.0.0.4", expectedCode: http.StatusForbidden},
+		{baseUrl: "https://[fe80::1]", expectedCode: http.StatusForbidden},
+		{baseUrl: "https://localhost", expectedCode: http.StatusForbidden},
+		{baseUrl: "example.atlassian.net", expectedCode: http.StatusForbidden},
+		{baseUrl: "http://localhost:2990/jira", installHosts: &gonnect.InstallHostConfiguration{AllowInsecure: true}, expectedCode: http.StatusOK},
+		{baseUrl: "https://jira.example.com", installHosts: &gonnect.InstallHostConfiguration{Allowlist: true}, expectedCode: http.StatusForbidden},
+		{baseUrl: "https://example.atlassian.net", installHosts: &gonnect.InstallHostConfiguration{Allowlist: true}, expectedCode: http.StatusOK},
+		{baseUrl: "https://atlassian.net.evil.com", installHosts: &gonnect.InstallHostConfiguration{Allowlist: true}, expectedCode: http.StatusForbidden},
+		{baseUrl: "https://jira.example.com", installHosts: &gonnect.InstallHostConfiguration{Allowlist: true, AllowedHosts: []string{"jira.example.com"}}, expectedCode: http.StatusOK},
+		{baseUrl: "https://sub.jira.example.com", installHosts: &gonnect.InstallHostConfiguration{Allowlist: true, AllowedHosts: []string{"jira.example.com"}}, expectedCode: http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		addon := &gonnect.Addon{Config: &gonnect.Profile{InstallHosts: testCase.installHosts}}
+		handler := NewVerifyInstallationMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		body := `{"baseUrl":"` + testCase.baseUrl + `","clientKey":"client-key"}`
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("POST", "/installed", strings.NewReader(body)))
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("Expected %v for %s with %+v, but got %v: %s", testCase.expectedCode, testCase.baseUrl, testCase.installHosts, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestVerifyReinstallation(t *testing.T) {
+	addon := newTestAddon(t)
+	install := func(clientKey, secret string) (int, bool) {
+		body := `{"baseUrl":"https://example.atlassian.net","clientKey":"` + clientKey + `"}`
+		r := httptest.NewRequest("POST", "/installed", strings.NewReader(body))
+		if secret != "" {
+			qsh := atlasjwt.CreateQueryStringHash(r, false, addon.Config.BaseUrl)
+			r.Header.Set("Authorization", "JWT "+signTestToken(t, jwt.MapClaims{"iss": clientKey, "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, secret))
+		}
+		reached := false
+		rec := httptest.NewRecorder()
+		NewVerifyInstallationMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		})).ServeHTTP(rec, r)
+		return rec.Code, reached
+	}
+
+	if _, reached := install("new-key", ""); !reached {
+		t.Errorf("Expected the install of a new tenant to be accepted")
+	}
+	if code, reached := install("client-key", ""); reached || code != http.StatusUnauthorized {
+		t.Errorf("Expected the unsigned reinstall of a stored tenant to be rejected, but got %v", code)
+	}
+	if code, reached := install("client-key", "forged-secret"); reached || code != http.StatusUnauthorized {
+		t.Errorf("Expected the reinstall signed with another secret to be rejected, but got %v", code)
+	}
+	if code, reached := install("client-key", "shared-secret"); !reached {
+		t.Errorf("Expected the reinstall signed with the stored secret to be accepted, but got %v", code)
+	}
+	if err := addon.Store.(store.SecretRevoker).RevokeSecret("client-key"); err != nil {
+		t.Fatal(err)
+	}
+	if code, reached := install("client-key", ""); !reached {
+		t.Errorf("Expected the unsigned reinstall of a revoked tenant to be accepted, but got %v", code)
+	}
+
+	addon.Config.EphemeralTenants = &gonnect.EphemeralTenantConfiguration{Enabled: true}
+	if code, reached := install("client-key", ""); !reached {
+		t.Errorf("Expected the unsigned reinstall of an ephemeral tenant to be accepted, but got %v", code)
+	}
+}
+
+func TestEphemeralTenantTTL(t *testing.T) {
+	addon := newTestAddon(t)
+	target := "/page?foo=bar"
+	authenticate := func() int {
+		qsh := atlasjwt.CreateQueryStringHash(httptest.NewRequest("GET", target, nil), false, addon.Config.BaseUrl)
+		token := signTestToken(t, jwt.MapClaims{"iss": "client-key", "qsh": qsh, "exp": time.Now().Add(time.Minute).Unix()}, "shared-secret")
+		rec := httptest.NewRecorder()
+		NewAuthenticationMiddleware(addon, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, httptest.NewRequest("GET", target+"&jwt="+token, nil))
+		return rec.Code
+	}
+
+	if _, err := addon.PurgeExpiredTenants(context.Background()); err == nil {
+		t.Errorf("Expected purging to fail without the ephemeral tenant mode")
+	}
+	addon.Config.EphemeralTenants = &gonnect.EphemeralTenantConfiguration{Enabled: true, TTL: time.Hour}
+	if code := authenticate(); code != http.StatusOK {
+		t.Errorf("Expected a tenant seen within the TTL to authenticate, but got %v", code)
+	}
+	if purged, err := addon.PurgeExpiredTenants(context.Background()); err != nil || purged != 0 {
+		t.Errorf("Expected no expired tenants, but purged %d (%v)", purged, err)
+	}
+
+	// the TTL is at least the interval the last request is recorded in
+	addon.Config.EphemeralTenants.TTL = time.Nanosecond
+	if err := addon.Config.ValidateEphemeralTenants(); err == nil {
+		t.Errorf("Expected a TTL shorter than the touch interval to be rejected")
+	}
+	time.Sleep(time.Millisecond)
+	if code := authenticate(); code != http.StatusOK {
+		t.Errorf("Expected a tenant seen within the touch interval to authenticate, but got %v", code)
+	}
+
+	defer func(interval time.Duration) { store.TouchInterval = interval }(store.TouchInterval)
+	store.TouchInterval = 0
+	if err := addon.Config.ValidateEphemeralTenants(); err != nil {
+		t.Errorf("Expected the TTL to be valid without a touch interval, but got %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if code := authenticate(); code != http.StatusUnauthorized {
+		t.Errorf("Expected an expired tenant to be unknown, but got %v", code)
+	}
+	if purged, err := addon.PurgeExpiredTenants(context.Background()); err != nil || purged != 1 {
+		t.Errorf("Expected the expired tenant to be purged, but purged %d (%v)", purged, err)
+	}
+	if _, err := addon.Store.Get("client-key"); err == nil {
+		t.Errorf("Expected the purged tenant to be deleted")
+	}
+}
+
+func FuzzVerifyInstallationBody(f *testing.F) {
+	f.Add([]byte(`{"baseUrl":"https://example.atlassian.net","clientKey":"client-key"}`), "")
+	f.Add([]byte(`{"baseUrl":"https://example.atlassian.net","clientKey":"client-key"} trailing`), "")
+	f.Add([]byte(`{"baseUrl":1,"clientKey":{"nested":[]}}`), "not.a.token")
+	f.Add([]byte(`{"baseUrl":`), "eyJhbGciOiJSUzI1NiJ9")
+	f.Add([]byte{}, "")
+	addon := &gonnect.Addon{Config: &gonnect.Profile{}}
+	f.Fuzz(func(t *testing.T, body []byte, token string) {
+		r := httptest.NewRequest("POST", "/installed", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "JWT "+token)
+		}
+		// the asymmetric check only decodes the token, it must not fail on
+		// malformed tokens
+		isJwtAsymmetric(r)
+
+		handler := NewVerifyInstallationMiddleware(addon)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded, err := io.ReadAll(r.Body)
+			if err != nil || !bytes.Equal(forwarded, body) {
+				t.Errorf("Expected the install handler to read the whole body %q, but got %q (%v)", body, forwarded, err)
+			}
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	})
+}
@@ -0,0 +1,19 @@
+//go:build !fips
+
+package middleware
+
+import (
+	"crypto/sha1"
+)
+
+// SHA1Signature is a generic hex encoded HMAC-SHA1 signature, as still used
+// by some older providers. It is left out of builds with the fips tag
+func SHA1Signature(header, prefix, secret string) SignatureConfig {
+	return SignatureConfig{
+		Header:   header,
+		Prefix:   prefix,
+		Secret:   []byte(secret),
+		Hash:     sha1.New,
+		Encoding: SignatureHex,
+	}
+}
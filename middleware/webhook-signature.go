@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+const MAX_WEBHOOK_BODY_SIZE = 10 << 20
+
+type SignatureEncoding int
+
+const (
+	SignatureHex SignatureEncoding = iota
+	SignatureBase64
+)
+
+// SignatureConfig describes how a third-party webhook provider signs its
+// requests with a shared HMAC secret
+type SignatureConfig struct {
+	// Header holding the signature, e.g. "X-Hub-Signature-256"
+	Header string
+	// Prefix is stripped from the header value, e.g. "sha256="
+	Prefix   string
+	Secret   []byte
+	Hash     func() hash.Hash
+	Encoding SignatureEncoding
+	// SignedPayload builds the signed bytes from the request and its body,
+	// the body alone is signed when nil
+	SignedPayload func(r *http.Request, body []byte) ([]byte, error)
+}
+
+// ErrEmptySignatureSecret is returned for signature configurations without a
+// secret, every payload would verify against the empty key
+var ErrEmptySignatureSecret = errors.New("webhook signature secret is empty")
+
+// GitHubSignature verifies GitHub webhooks signed with X-Hub-Signature-256
+func GitHubSignature(secret string) (SignatureConfig, error) {
+	if secret == "" {
+		return SignatureConfig{}, ErrEmptySignatureSecret
+	}
+	return SignatureConfig{
+		Header:   "X-Hub-Signature-256",
+		Prefix:   "sha256=",
+		Secret:   []byte(secret),
+		Hash:     sha256.New,
+		Encoding: SignatureHex,
+	}, nil
+}
+
+// SlackSignature verifies Slack requests signed with X-Slack-Signature,
+// rejecting requests with a timestamp older than tolerance
+func SlackSignature(secret string, tolerance time.Duration) (SignatureConfig, error) {
+	if secret == "" {
+		return SignatureConfig{}, ErrEmptySignatureSecret
+	}
+	return SignatureConfig{
+		Header:   "X-Slack-Signature",
+		Prefix:   "v0=",
+		Secret:   []byte(secret),
+		Hash:     sha256.New,
+		Encoding: SignatureHex,
+		SignedPayload: func(r *http.Request, body []byte) ([]byte, error) {
+			timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+			seconds, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid request timestamp")
+			}
+			if age := time.Since(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+				return nil, fmt.Errorf("request timestamp outside of tolerance")
+			}
+			return append([]byte("v0:"+timestamp+":"), body...), nil
+		},
+	}, nil
+}
+
+func (c SignatureConfig) decode(signature string) ([]byte, error) {
+	switch c.Encoding {
+	case SignatureBase64:
+		return base64.StdEncoding.DecodeString(signature)
+	default:
+		return hex.DecodeString(signature)
+	}
+}
+
+func (c SignatureConfig) verify(r *http.Request, body []byte) error {
+	if len(c.Secret) == 0 {
+		return ErrEmptySignatureSecret
+	}
+	value := r.Header.Get(c.Header)
+	if value == "" {
+		return fmt.Errorf("missing %s header", c.Header)
+	}
+	if c.Prefix != "" {
+		if !strings.HasPrefix(value, c.Prefix) {
+			return fmt.Errorf("unexpected %s header format", c.Header)
+		}
+		value = strings.TrimPrefix(value, c.Prefix)
+	}
+
+	signature, err := c.decode(value)
+	if err != nil {
+		return fmt.Errorf("could not decode %s header", c.Header)
+	}
+
+	payload := body
+	if c.SignedPayload != nil {
+		if payload, err = c.SignedPayload(r, body); err != nil {
+			return err
+		}
+	}
+
+	hashFn := c.Hash
+	if hashFn == nil {
+		hashFn = sha256.New
+	}
+	mac := hmac.New(hashFn, c.Secret)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// WebhookSignatureMiddleware verifies HMAC signed webhooks of third-party
+// integrations, it does not authenticate Atlassian requests
+type WebhookSignatureMiddleware struct {
+	h      http.Handler
+	addon  *gonnect.Addon
+	config SignatureConfig
+}
+
+func (h WebhookSignatureMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil || r.Body == http.NoBody {
+		util.SendError(w, r, h.addon, 401, "Webhook signature verification failed: empty body")
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_WEBHOOK_BODY_SIZE))
+	_ = r.Body.Close()
+	if err != nil {
+		util.SendError(w, r, h.addon, 400, "Could not read webhook body")
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err = h.config.verify(r, body); err != nil {
+		util.SendError(w, r, h.addon, 401, "Webhook signature verification failed: "+err.Error())
+		return
+	}
+
+	h.h.ServeHTTP(w, r)
+}
+
+func NewWebhookSignatureMiddleware(addon *gonnect.Addon, config SignatureConfig) func(h http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return WebhookSignatureMiddleware{handler, addon, config}
+	}
+}
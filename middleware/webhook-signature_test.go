@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookSignatureMiddleware(t *testing.T) {
+	body := `{"action":"opened"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	must := func(config SignatureConfig, err error) SignatureConfig {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config
+	}
+
+	testCases := []struct {
+		config  SignatureConfig
+		headers map[string]string
+		status  int
+	}{
+		{
+			config:  must(GitHubSignature("secret")),
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign("secret", body)},
+			status:  200,
+		},
+		{
+			config:  must(GitHubSignature("secret")),
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign("other", body)},
+			status:  401,
+		},
+		{
+			config:  must(GitHubSignature("secret")),
+			headers: map[string]string{},
+			status:  401,
+		},
+		{
+			config:  must(SlackSignature("secret", 5*time.Minute)),
+			headers: map[string]string{"X-Slack-Request-Timestamp": now, "X-Slack-Signature": "v0=" + sign("secret", "v0:"+now+":"+body)},
+			status:  200,
+		},
+		{
+			config:  must(SlackSignature("secret", 5*time.Minute)),
+			headers: map[string]string{"X-Slack-Request-Timestamp": old, "X-Slack-Signature": "v0=" + sign("secret", "v0:"+old+":"+body)},
+			status:  401,
+		},
+		{
+			config:  SignatureConfig{Header: "X-Hub-Signature-256", Prefix: "sha256="},
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + sign("", body)},
+			status:  401,
+		},
+	}
+
+	for _, testCase := range testCases {
+		var received string
+		handler := NewWebhookSignatureMiddleware(nil, testCase.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b := new(bytes.Buffer)
+			_, _ = b.ReadFrom(r.Body)
+			received = b.String()
+		}))
+
+		req := httptest.NewRequest("POST", "/webhook", strings.NewReader(body))
+		for k, v := range testCase.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != testCase.status {
+			t.Errorf("Expected status to be %d, but got %d (%s)", testCase.status, rec.Code, rec.Body.String())
+		}
+		if testCase.status == 200 && received != body {
+			t.Errorf("Expected handler to receive body %s, but got %s", body, received)
+		}
+	}
+}
+
+func TestSignatureSecretRequired(t *testing.T) {
+	if _, err := GitHubSignature(""); !errors.Is(err, ErrEmptySignatureSecret) {
+		t.Errorf("Expected ErrEmptySignatureSecret for GitHub, but got %v", err)
+	}
+	if _, err := SlackSignature("", time.Minute); !errors.Is(err, ErrEmptySignatureSecret) {
+		t.Errorf("Expected ErrEmptySignatureSecret for Slack, but got %v", err)
+	}
+}
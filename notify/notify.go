@@ -0,0 +1,210 @@
+// Package notify posts signed JSON events about tenant lifecycle changes to
+// external URLs, such as a Slack webhook or an internal provisioning service
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+)
+
+const (
+	EventInstalled      = "installed"
+	EventUninstalled    = "uninstalled"
+	EventSecretRotated  = "secret_rotated"
+	EventBaseURLChanged = "base_url_changed"
+	EventSiteCollision  = "site_collision"
+)
+
+const (
+	SIGNATURE_HEADER = "X-Gonnect-Signature-256"
+	EVENT_HEADER     = "X-Gonnect-Event"
+	TIMESTAMP_HEADER = "X-Gonnect-Timestamp"
+)
+
+// FormatSlack sends events as Slack incoming webhook messages
+const FormatSlack = "slack"
+
+var (
+	MaxRetries = 3
+	Backoff    = time.Second
+)
+
+// Event is a single lifecycle change of a tenant, the shared secret is never
+// included
+type Event struct {
+	Type            string    `json:"type"`
+	Time            time.Time `json:"time"`
+	ClientKey       string    `json:"clientKey"`
+	BaseURL         string    `json:"baseUrl"`
+	ProductType     string    `json:"productType,omitempty"`
+	PreviousBaseURL string    `json:"previousBaseUrl,omitempty"`
+	// PreviousClientKey is the tenant of the same site an install collided
+	// with, see EventSiteCollision
+	PreviousClientKey string `json:"previousClientKey,omitempty"`
+}
+
+// Target is an external URL receiving lifecycle events
+type Target struct {
+	URL string
+	// Secret signs the request body with HMAC-SHA256, requests are unsigned
+	// when empty
+	Secret string
+	// Events limits the notifications to these event types, all events are
+	// sent when empty
+	Events []string
+	// Format of the request body, the event JSON unless FormatSlack
+	Format string
+}
+
+func (t Target) accepts(eventType string) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, e := range t.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Target) body(event Event) ([]byte, error) {
+	if t.Format == FormatSlack {
+		text := fmt.Sprintf("%s: tenant %s (%s)", event.Type, event.ClientKey, event.BaseURL)
+		if event.PreviousBaseURL != "" {
+			text += fmt.Sprintf(", previously %s", event.PreviousBaseURL)
+		}
+		if event.PreviousClientKey != "" {
+			text += fmt.Sprintf(", previously %s", event.PreviousClientKey)
+		}
+		return json.Marshal(map[string]string{"text": text})
+	}
+	return json.Marshal(event)
+}
+
+// Sign returns the signature header value of body, the hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the body
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier delivers lifecycle events to its targets in the background,
+// retrying failed deliveries with exponential backoff
+type Notifier struct {
+	Targets []Target
+	Client  *http.Client
+	pending sync.WaitGroup
+}
+
+// New returns a Notifier for the targets using the default http client
+func New(targets ...Target) *Notifier {
+	return &Notifier{Targets: targets, Client: http.DefaultClient}
+}
+
+// Notify timestamps the events and queues their delivery to all targets
+// accepting them, it does nothing on a nil Notifier
+func (n *Notifier) Notify(ctx context.Context, events ...Event) {
+	if n == nil {
+		return
+	}
+	for _, event := range events {
+		if event.Time.IsZero() {
+			event.Time = time.Now().UTC()
+		}
+		for _, target := range n.Targets {
+			if !target.accepts(event.Type) {
+				continue
+			}
+			n.pending.Add(1)
+			go func(target Target, event Event) {
+				defer n.pending.Done()
+				n.deliver(target, event)
+			}(target, event)
+		}
+	}
+}
+
+// Flush waits until all events queued so far were delivered or given up on
+func (n *Notifier) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		n.pending.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notifier flush: %w", ctx.Err())
+	}
+}
+
+func (n *Notifier) deliver(target Target, event Event) {
+	backoff := Backoff
+	for attempt := 0; ; attempt++ {
+		err := n.Send(target, event)
+		if err == nil {
+			return
+		}
+		if attempt >= MaxRetries {
+			log.ErrorF("could not notify %s of %s event for tenant %s: %v", target.URL, event.Type, event.ClientKey, err)
+			errorreport.Report(context.Background(), errorreport.Event{
+				Kind:      errorreport.KindBackground,
+				Err:       err,
+				ClientKey: event.ClientKey,
+				Fields:    map[string]string{"job": "notify", "event": event.Type, "url": target.URL},
+			})
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Send posts a single event to target without retrying
+func (n *Notifier) Send(target Target, event Event) error {
+	body, err := target.body(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EVENT_HEADER, event.Type)
+	if target.Secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(TIMESTAMP_HEADER, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SIGNATURE_HEADER, Sign(target.Secret, timestamp, body))
+	}
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return nil
+}
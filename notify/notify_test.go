@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	defer func(retries int, backoff time.Duration) { MaxRetries, Backoff = retries, backoff }(MaxRetries, Backoff)
+	MaxRetries, Backoff = 2, time.Millisecond
+
+	var mutex sync.Mutex
+	var received []Event
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(TIMESTAMP_HEADER), 10, 64)
+		if signature := r.Header.Get(SIGNATURE_HEADER); signature != Sign("secret", timestamp, body) {
+			t.Errorf("Expected a valid signature, but got %q", signature)
+		}
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	notifier := New(Target{URL: server.URL, Secret: "secret", Events: []string{EventInstalled}})
+	notifier.Notify(context.Background(),
+		Event{Type: EventInstalled, ClientKey: "key"},
+		Event{Type: EventSecretRotated, ClientKey: "key"},
+	)
+	if err := notifier.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected %v delivery attempts, but got %v", 2, attempts)
+	}
+	if len(received) != 1 || received[0].Type != EventInstalled || received[0].Time.IsZero() {
+		t.Errorf("Expected one timestamped %s event, but got %+v", EventInstalled, received)
+	}
+}
+
+func TestSlackFormat(t *testing.T) {
+	body, err := Target{Format: FormatSlack}.body(Event{Type: EventBaseURLChanged, ClientKey: "key", BaseURL: "https://new.atlassian.net", PreviousBaseURL: "https://old.atlassian.net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"text":"base_url_changed: tenant key (https://new.atlassian.net), previously https://old.atlassian.net"}`
+	if string(body) != expected {
+		t.Errorf("Expected body to be %s, but got %s", expected, body)
+	}
+}
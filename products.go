@@ -0,0 +1,82 @@
+package gonnect
+
+import (
+	"sort"
+	"strings"
+)
+
+// sharedDescriptorFields identify the app and its lifecycle endpoints, they
+// are the same for every product and not replaced by ProductDescriptors
+var sharedDescriptorFields = map[string]bool{
+	"key":            true,
+	"baseUrl":        true,
+	"lifecycle":      true,
+	"authentication": true,
+}
+
+// Products returns the sorted product types with their own descriptor, in
+// lower case
+func (a *Addon) Products() []string {
+	products := make([]string, 0, len(a.ProductDescriptors))
+	for product := range a.ProductDescriptors {
+		products = append(products, strings.ToLower(product))
+	}
+	sort.Strings(products)
+	return products
+}
+
+// productFields returns the ProductDescriptors entry of the product, product
+// types match regardless of their case
+func (a *Addon) productFields(product string) (map[string]interface{}, bool) {
+	if fields, ok := a.ProductDescriptors[product]; ok {
+		return fields, true
+	}
+	for key, fields := range a.ProductDescriptors {
+		if strings.EqualFold(key, product) {
+			return fields, true
+		}
+	}
+	return nil, false
+}
+
+// ProductDescriptor returns the descriptor served to the host product, the
+// AddonDescriptor with the top level fields of its ProductDescriptors entry
+// replaced. The key, base url, lifecycle and authentication are shared by all
+// products, which install into the same store. It returns false for products
+// without an entry
+func (a *Addon) ProductDescriptor(product string) (map[string]interface{}, bool) {
+	fields, ok := a.productFields(product)
+	if !ok {
+		return nil, false
+	}
+	descriptor := make(map[string]interface{}, len(a.AddonDescriptor)+len(fields))
+	for name, value := range a.AddonDescriptor {
+		descriptor[name] = value
+	}
+	for name, value := range fields {
+		if !sharedDescriptorFields[name] {
+			descriptor[name] = value
+		}
+	}
+	return descriptor, true
+}
+
+// descriptorOf returns the descriptor of the product, the AddonDescriptor
+// for products without their own
+func (a *Addon) descriptorOf(product string) map[string]interface{} {
+	if descriptor, ok := a.ProductDescriptor(product); ok {
+		return descriptor
+	}
+	return a.AddonDescriptor
+}
+
+// Descriptors returns the AddonDescriptor followed by the descriptor of
+// every product, e.g. to check the routes of all their modules
+func (a *Addon) Descriptors() []map[string]interface{} {
+	descriptors := []map[string]interface{}{a.AddonDescriptor}
+	for _, product := range a.Products() {
+		descriptor, _ := a.ProductDescriptor(product)
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors
+}
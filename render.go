@@ -0,0 +1,88 @@
+package gonnect
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// RenderKey is the reserved key of the template data holding the
+// RenderContext of the request, see Render
+const RenderKey = "Gonnect"
+
+// RenderContext holds the context values of a request verified by the
+// authentication middleware, for page templates like
+// {{.Gonnect.HostScriptUrl}} or {{.Gonnect.Token}}
+type RenderContext struct {
+	// Verified is false for requests which were not authenticated, only the
+	// values of the add-on are set then
+	Verified      bool
+	AddonKey      string
+	LocalBaseUrl  string
+	HostScriptUrl string
+	ClientKey     string
+	HostBaseUrl   string
+	AccountId     string
+	// Token is the session token for the requests of the page to the add-on
+	Token     string
+	License   string
+	Locale    string
+	CSRFToken string
+}
+
+// NewRenderContext returns the RenderContext of r
+func NewRenderContext(r *http.Request) RenderContext {
+	value := func(key string) string {
+		v, _ := r.Context().Value(key).(string)
+		return v
+	}
+	rc := RenderContext{
+		AddonKey:      value("addonKey"),
+		LocalBaseUrl:  value("localBaseUrl"),
+		HostScriptUrl: value("hostScriptUrl"),
+		Locale:        value("locale"),
+		CSRFToken:     value("csrfToken"),
+	}
+	// the token is only set by the authentication middleware, the host
+	// values of other requests come from unverified query parameters
+	if token := value("token"); token != "" {
+		rc.Verified = true
+		rc.Token = token
+		rc.ClientKey = value("clientKey")
+		rc.HostBaseUrl = value("hostBaseUrl")
+		rc.AccountId = value("userAccountId")
+		rc.License = value("license")
+	}
+	return rc
+}
+
+// Template is implemented by html/template and text/template
+type Template interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// Render executes tmpl with data and the RenderContext of r under RenderKey,
+// and writes the result as text/html unless a Content-Type was set. Nothing
+// is written when data holds RenderKey or tmpl fails, the error is left to
+// the caller
+func Render(w http.ResponseWriter, r *http.Request, tmpl Template, data map[string]interface{}) error {
+	if _, ok := data[RenderKey]; ok {
+		return fmt.Errorf("template data holds the reserved key %s", RenderKey)
+	}
+	merged := make(map[string]interface{}, len(data)+1)
+	for key, value := range data {
+		merged[key] = value
+	}
+	merged[RenderKey] = NewRenderContext(r)
+
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, merged); err != nil {
+		return err
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	_, err := buffer.WriteTo(w)
+	return err
+}
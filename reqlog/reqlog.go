@@ -0,0 +1,84 @@
+// Package reqlog logs lines attributed to the request they were written for,
+// prefixed with the request id, clientKey and accountId set by the gonnect
+// middlewares, so that the logs of a multi-tenant add-on can be filtered by
+// tenant and request
+package reqlog
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// ContextKey is the request context key of the Logger
+const ContextKey = "logger"
+
+// Logger writes to the application log with its fields prepended
+type Logger struct {
+	fields []string
+}
+
+// Default is the logger without any fields, returned for contexts without a
+// logger
+var Default = &Logger{}
+
+// With returns a copy of the logger with the field added, empty values are
+// omitted and replace a previous value of key
+func (l *Logger) With(key, value string) *Logger {
+	fields := make([]string, 0, len(l.fields)+1)
+	for _, field := range l.fields {
+		if !strings.HasPrefix(field, key+"=") {
+			fields = append(fields, field)
+		}
+	}
+	if value != "" {
+		fields = append(fields, key+"="+value)
+	}
+	return &Logger{fields: fields}
+}
+
+// Prefix returns the fields as they are prepended to every line
+func (l *Logger) Prefix() string {
+	if len(l.fields) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(l.fields, " ") + "] "
+}
+
+func (l *Logger) args(argv []interface{}) []interface{} {
+	return append([]interface{}{l.Prefix()}, argv...)
+}
+
+func (l *Logger) ErrorF(format string, argv ...interface{}) {
+	log.ErrorDF(1, "%s"+format, l.args(argv)...)
+}
+
+func (l *Logger) WarnF(format string, argv ...interface{}) {
+	log.WarnDF(1, "%s"+format, l.args(argv)...)
+}
+
+func (l *Logger) InfoF(format string, argv ...interface{}) {
+	log.InfoDF(1, "%s"+format, l.args(argv)...)
+}
+
+func (l *Logger) DebugF(format string, argv ...interface{}) {
+	log.DebugDF(1, "%s"+format, l.args(argv)...)
+}
+
+func (l *Logger) TraceF(format string, argv ...interface{}) {
+	log.TraceDF(1, "%s"+format, l.args(argv)...)
+}
+
+// NewContext returns a copy of ctx holding the logger
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ContextKey, l)
+}
+
+// FromContext returns the logger of ctx or Default
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(ContextKey).(*Logger); ok {
+		return l
+	}
+	return Default
+}
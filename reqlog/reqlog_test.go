@@ -0,0 +1,21 @@
+package reqlog
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	if FromContext(context.Background()) != Default || Default.Prefix() != "" {
+		t.Fatalf("Expected contexts without a logger to use Default without fields")
+	}
+
+	l := Default.With("requestId", "abc").With("clientKey", "first")
+	ctx := NewContext(context.Background(), l.With("clientKey", "second").With("accountId", ""))
+	if prefix := FromContext(ctx).Prefix(); prefix != "[requestId=abc clientKey=second] " {
+		t.Errorf("Expected prefix to be %q, but got %q", "[requestId=abc clientKey=second] ", prefix)
+	}
+	if prefix := l.Prefix(); prefix != "[requestId=abc clientKey=first] " {
+		t.Errorf("Expected With not to modify the logger, but got %q", prefix)
+	}
+}
@@ -0,0 +1,199 @@
+// Package retention deletes the data of uninstalled tenants once a retention
+// period passed, as expected from Marketplace apps: the tenant is marked as
+// uninstalled by the lifecycle handler, its deletion is scheduled, and when
+// it is due the application data is purged through a callback, the tenant is
+// deleted and the completion is recorded in the audit log. Installing the
+// add-on again within the retention period cancels the deletion.
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/lease"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+const (
+	AuditTenantDeletionScheduled = "tenant.deletion_scheduled"
+	AuditTenantDeletionCanceled  = "tenant.deletion_canceled"
+	AuditTenantPurged            = "tenant.purged"
+)
+
+// Lease is the name of the lease held by the replica running due deletions
+const Lease = "tenant-retention"
+
+// PurgeFunc deletes the application data of the tenant, it is called before
+// the tenant itself is deleted and is retried on the next run when it fails.
+// It runs within the transaction deleting the tenant
+type PurgeFunc func(ctx context.Context, tenant *store.Tenant) error
+
+// Workflow schedules and runs the deletion of uninstalled tenants
+type Workflow struct {
+	Store     store.TenantStore
+	Scheduler store.DeletionScheduler
+	// Period is how long the data of an uninstalled tenant is retained
+	Period time.Duration
+	Purge  PurgeFunc
+}
+
+// New returns the workflow for s, which has to keep the deletion schedule
+func New(s store.TenantStore, period time.Duration, purge PurgeFunc) (*Workflow, error) {
+	scheduler, ok := s.(store.DeletionScheduler)
+	if !ok {
+		return nil, fmt.Errorf("tenant store %T cannot schedule deletions", s)
+	}
+	return &Workflow{Store: s, Scheduler: scheduler, Period: period, Purge: purge}, nil
+}
+
+// scheduler returns the scheduler of the lifecycle transaction tx when it
+// has one, so that the schedule commits with the tenant
+func (w *Workflow) scheduler(tx store.TenantStore) store.DeletionScheduler {
+	if scheduler, ok := tx.(store.DeletionScheduler); ok {
+		return scheduler
+	}
+	return w.Scheduler
+}
+
+// Uninstalled schedules the deletion of the tenant after the retention
+// period, within the lifecycle transaction tx if it is not nil
+func (w *Workflow) Uninstalled(ctx context.Context, tx store.TenantStore, tenant *store.Tenant) error {
+	due := time.Now().Add(w.Period)
+	if err := w.scheduler(tx).ScheduleDeletion(tenant.ClientKey, due); err != nil {
+		return err
+	}
+	audit.Record(ctx, audit.Event{
+		Type:      AuditTenantDeletionScheduled,
+		ClientKey: tenant.ClientKey,
+		Fields:    map[string]string{"baseUrl": tenant.BaseURL, "dueAt": due.UTC().Format(time.RFC3339)},
+	})
+	return nil
+}
+
+// Installed cancels a scheduled deletion of the tenant, within the lifecycle
+// transaction tx if it is not nil
+func (w *Workflow) Installed(ctx context.Context, tx store.TenantStore, tenant *store.Tenant) error {
+	return w.scheduler(tx).CancelDeletion(tenant.ClientKey)
+}
+
+// RunDue purges and deletes all tenants whose deletion is due and returns
+// how many were deleted. Tenants installed again in the meantime are kept.
+func (w *Workflow) RunDue(ctx context.Context) (deleted int, err error) {
+	due, err := w.Scheduler.DueDeletions(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	for _, record := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		purged, err := w.delete(ctx, record)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", record.ClientKey, err))
+		} else if purged {
+			deleted++
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// delete purges and deletes the tenant of record and reports whether it did.
+// The tenant and its schedule are checked again within the transaction of the
+// deletion, a reinstall since the due deletions were listed keeps the tenant
+func (w *Workflow) delete(ctx context.Context, record store.DeletionRecord) (bool, error) {
+	var tenant *store.Tenant
+	var installed bool
+	err := store.WithTx(ctx, w.Store, func(tx store.TenantStore) error {
+		scheduler := w.scheduler(tx)
+		if due, err := scheduled(scheduler, record.ClientKey); err != nil || !due {
+			return err
+		}
+		found, err := tx.Get(record.ClientKey)
+		if errors.Is(err, store.ErrNotFound) {
+			return scheduler.CancelDeletion(record.ClientKey)
+		} else if err != nil {
+			return err
+		}
+		if found.AddonInstalled {
+			installed = true
+			return scheduler.CancelDeletion(record.ClientKey)
+		}
+		if w.Purge != nil {
+			if err = w.Purge(ctx, found); err != nil {
+				return fmt.Errorf("purging application data: %w", err)
+			}
+		}
+		if err = tx.Delete(record.ClientKey); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		if err = scheduler.CancelDeletion(record.ClientKey); err != nil {
+			return err
+		}
+		tenant = found
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if installed {
+		audit.Record(ctx, audit.Event{Type: AuditTenantDeletionCanceled, ClientKey: record.ClientKey, Message: "installed"})
+		return false, nil
+	}
+	if tenant == nil {
+		return false, nil
+	}
+	audit.Record(ctx, audit.Event{
+		Type:      AuditTenantPurged,
+		ClientKey: record.ClientKey,
+		Message:   "application data and tenant deleted after the retention period",
+		Fields: map[string]string{
+			"baseUrl":     tenant.BaseURL,
+			"scheduledAt": record.ScheduledAt.UTC().Format(time.RFC3339),
+		},
+	})
+	return true, nil
+}
+
+// scheduled reports whether the deletion of the tenant is still due, it was
+// not canceled or rescheduled by a lifecycle event
+func scheduled(scheduler store.DeletionScheduler, clientKey string) (bool, error) {
+	due, err := scheduler.DueDeletions(time.Now())
+	if err != nil {
+		return false, err
+	}
+	for _, record := range due {
+		if record.ClientKey == clientKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Run runs the due deletions every interval until ctx is done, on the
+// replica holding the Lease of lease.Default, or of the store when it is nil
+// and the store can grant leases
+func (w *Workflow) Run(ctx context.Context, interval time.Duration) {
+	leaser := lease.Default
+	if leaser == nil {
+		leaser, _ = w.Store.(lease.Leaser)
+	}
+	lease.Run(ctx, leaser, Lease, 2*interval, interval, func(ctx context.Context) {
+		if deleted, err := w.RunDue(ctx); err != nil {
+			log.ErrorF("tenant retention run failed: %v", err)
+			errorreport.Report(ctx, errorreport.Event{
+				Kind:   errorreport.KindBackground,
+				Err:    err,
+				Fields: map[string]string{"job": Lease},
+			})
+		} else if deleted > 0 {
+			log.InfoF("deleted %d tenants uninstalled longer than %v", deleted, w.Period)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/audit"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestWorkflow(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	s, err := store.NewFrom(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recorded []audit.Event
+	defer func(sink audit.Sink) { audit.DefaultSink = sink }(audit.DefaultSink)
+	audit.DefaultSink = audit.SinkFunc(func(ctx context.Context, event audit.Event) {
+		recorded = append(recorded, event)
+	})
+
+	var purged []string
+	failing := true
+	w, err := New(s, -time.Minute, func(ctx context.Context, tenant *store.Tenant) error {
+		if tenant.ClientKey == "failing" && failing {
+			return errors.New("purge failed")
+		}
+		purged = append(purged, tenant.ClientKey)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, clientKey := range []string{"gone", "reinstalled", "failing"} {
+		tenant := &store.Tenant{ClientKey: clientKey, SharedSecret: "secret", BaseURL: "https://" + clientKey + ".atlassian.net"}
+		if _, err = s.Set(tenant); err != nil {
+			t.Fatal(err)
+		}
+		err = store.WithTx(ctx, s, func(tx store.TenantStore) error {
+			return w.Uninstalled(ctx, tx, tenant)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reinstalled, _ := s.Get("reinstalled")
+	reinstalled.AddonInstalled = true
+	if _, err = s.Set(reinstalled); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := w.RunDue(ctx)
+	if deleted != 1 || err == nil {
+		t.Fatalf("Expected one deletion and the purge failure, but got %d, %v", deleted, err)
+	}
+	testCases := []struct {
+		clientKey string
+		expected  error
+	}{
+		{clientKey: "gone", expected: store.ErrNotFound},
+		{clientKey: "reinstalled"},
+	}
+	for _, testCase := range testCases {
+		if _, err = s.Get(testCase.clientKey); !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: Expected %v, but got %v", testCase.clientKey, testCase.expected, err)
+		}
+	}
+
+	failing = false
+	if deleted, err = w.RunDue(ctx); deleted != 1 || err != nil {
+		t.Fatalf("Expected the failed purge to be retried, but got %d, %v", deleted, err)
+	}
+	if due, _ := s.DueDeletions(time.Now()); len(due) != 0 {
+		t.Errorf("Expected an empty schedule, but got %v", due)
+	}
+	if len(purged) != 2 || purged[0] != "gone" || purged[1] != "failing" {
+		t.Errorf("Expected the purges of gone and failing, but got %v", purged)
+	}
+
+	// a deletion canceled after the due deletions were listed is skipped
+	if _, err = s.Set(&store.Tenant{ClientKey: "canceled", SharedSecret: "secret", BaseURL: "https://canceled.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ScheduleDeletion("canceled", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	due, err := s.DueDeletions(time.Now())
+	if err != nil || len(due) != 1 {
+		t.Fatalf("Expected the deletion of canceled to be due, but got %v, %v", due, err)
+	}
+	if err = s.CancelDeletion("canceled"); err != nil {
+		t.Fatal(err)
+	}
+	if purged, err := w.delete(ctx, due[0]); purged || err != nil {
+		t.Errorf("Expected the canceled deletion to be skipped, but got %v, %v", purged, err)
+	}
+	if _, err = s.Get("canceled"); err != nil {
+		t.Errorf("Expected the tenant of the canceled deletion to be kept, but got %v", err)
+	}
+
+	var types []string
+	for _, event := range recorded {
+		types = append(types, event.Type+":"+event.ClientKey)
+	}
+	expected := []string{
+		AuditTenantDeletionScheduled + ":gone",
+		AuditTenantDeletionScheduled + ":reinstalled",
+		AuditTenantDeletionScheduled + ":failing",
+		AuditTenantPurged + ":gone",
+		AuditTenantDeletionCanceled + ":reinstalled",
+		AuditTenantPurged + ":failing",
+	}
+	if len(types) != len(expected) {
+		t.Fatalf("Expected the audit events %v, but got %v", expected, types)
+	}
+	for i := range types {
+		if types[i] != expected[i] {
+			t.Errorf("Expected the audit events %v, but got %v", expected, types)
+			break
+		}
+	}
+}
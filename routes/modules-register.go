@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/descriptor"
+)
+
+// PageModule is the descriptor module of a page served by a route, such as
+// a general page, web panel or dialog
+type PageModule struct {
+	// Type is the module type, generalPages when empty
+	Type     string
+	Key      string
+	Name     string
+	Location string
+	// Context maps query parameters to the context parameters of the host
+	// product passed in them, e.g. "issueKey": "issue.key"
+	Context    map[string]string
+	Conditions []descriptor.Condition
+	// Fields are added to the module as they are, e.g. "weight"
+	Fields map[string]interface{}
+}
+
+// WebhookModule is the descriptor module of a webhook served by a route
+type WebhookModule struct {
+	Event       string
+	Filter      string
+	ExcludeBody bool
+}
+
+// Modules registers routes together with their descriptor modules, so that
+// the descriptor is generated from the router instead of drifting apart
+type Modules struct {
+	addon *gonnect.Addon
+	mux   chi.Router
+}
+
+func NewModules(addon *gonnect.Addon, mux chi.Router) *Modules {
+	return &Modules{addon: addon, mux: mux}
+}
+
+// Page serves GET requests of path with handler and adds its module to the
+// descriptor, replacing a module of the same type and key
+func (m *Modules) Page(path string, handler http.Handler, module PageModule) {
+	m.mux.Method(http.MethodGet, path, handler)
+	if module.Type == "" {
+		module.Type = "generalPages"
+	}
+	url := descriptor.URL(path)
+	params := make([]string, 0, len(module.Context))
+	for param := range module.Context {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		url = url.With(param, module.Context[param])
+	}
+	entry := map[string]interface{}{}
+	for k, v := range module.Fields {
+		entry[k] = v
+	}
+	entry["key"] = module.Key
+	entry["url"] = url.String()
+	if module.Name != "" {
+		entry["name"] = map[string]interface{}{"value": module.Name}
+	}
+	if module.Location != "" {
+		entry["location"] = module.Location
+	}
+	if len(module.Conditions) > 0 {
+		entry["conditions"] = descriptor.Conditions(module.Conditions...)
+	}
+	m.add(module.Type, entry, func(existing map[string]interface{}) bool {
+		return existing["key"] == module.Key
+	})
+}
+
+// Webhook serves POST requests of path with handler and adds the webhook to
+// the descriptor, replacing a webhook of the same event and url
+func (m *Modules) Webhook(path string, handler http.Handler, module WebhookModule) {
+	m.mux.Method(http.MethodPost, path, handler)
+	entry := map[string]interface{}{"event": module.Event, "url": path}
+	if module.Filter != "" {
+		entry["filter"] = module.Filter
+	}
+	if module.ExcludeBody {
+		entry["excludeBody"] = true
+	}
+	m.add("webhooks", entry, func(existing map[string]interface{}) bool {
+		return existing["event"] == module.Event && existing["url"] == path
+	})
+}
+
+// Iframe serves GET requests of path with handler and adds the typed module,
+// such as a descriptor.WebPanel or descriptor.Dialog, to the descriptor
+func (m *Modules) Iframe(path string, handler http.Handler, module descriptor.Module) {
+	m.mux.Method(http.MethodGet, path, handler)
+	m.addModule(path, module)
+}
+
+// Add adds a typed module without a route to the descriptor, such as a
+// descriptor.WebItem opening a dialog module
+func (m *Modules) Add(module descriptor.Module) {
+	m.addModule("", module)
+}
+
+func (m *Modules) addModule(path string, module descriptor.Module) {
+	m.add(module.ModuleType(), module.Entry(path), func(existing map[string]interface{}) bool {
+		return existing["key"] == module.ModuleKey()
+	})
+}
+
+func (m *Modules) add(moduleType string, entry map[string]interface{}, same func(existing map[string]interface{}) bool) {
+	if m.addon.AddonDescriptor == nil {
+		m.addon.AddonDescriptor = map[string]interface{}{}
+	}
+	modules, ok := m.addon.AddonDescriptor["modules"].(map[string]interface{})
+	if !ok {
+		modules = map[string]interface{}{}
+		m.addon.AddonDescriptor["modules"] = modules
+	}
+	entries, _ := modules[moduleType].([]interface{})
+	for i, existing := range entries {
+		if e, ok := existing.(map[string]interface{}); ok && same(e) {
+			entries[i] = entry
+			return
+		}
+	}
+	modules[moduleType] = append(entries, entry)
+}
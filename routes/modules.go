@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/descriptor"
+)
+
+// UnhandledModules returns the module urls of the descriptors of the add-on
+// and its products which mux has no route for
+func UnhandledModules(addon *gonnect.Addon, mux chi.Routes) (unhandled []descriptor.ModuleURL) {
+	seen := map[descriptor.ModuleURL]bool{}
+	for _, d := range addon.Descriptors() {
+		for _, module := range descriptor.ModuleURLs(d) {
+			if seen[module] {
+				continue
+			}
+			seen[module] = true
+			if !mux.Match(chi.NewRouteContext(), module.Method(), module.Path()) {
+				unhandled = append(unhandled, module)
+			}
+		}
+	}
+	return
+}
+
+// VerifyModuleRoutes returns an error listing the module urls of the
+// descriptor which mux has no route for, meant to fail the startup of an
+// add-on whose router and descriptor drifted apart
+func VerifyModuleRoutes(addon *gonnect.Addon, mux chi.Routes) error {
+	unhandled := UnhandledModules(addon, mux)
+	if len(unhandled) == 0 {
+		return nil
+	}
+	lines := make([]string, len(unhandled))
+	for i, module := range unhandled {
+		lines[i] = fmt.Sprintf("%s %s (%s %s)", module.Method(), module.URL, module.Type, module.Key)
+	}
+	return fmt.Errorf("descriptor modules without a route:\n  %s", strings.Join(lines, "\n  "))
+}
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/descriptor"
+)
+
+func TestVerifyModuleRoutes(t *testing.T) {
+	addon := &gonnect.Addon{AddonDescriptor: map[string]interface{}{
+		"baseUrl": "https://addon.example.com",
+		"modules": map[string]interface{}{
+			"generalPages": []interface{}{
+				map[string]interface{}{"key": "main", "url": "/main?project={project.key}"},
+				map[string]interface{}{"key": "absolute", "url": "https://addon.example.com/absolute"},
+				map[string]interface{}{"key": "external", "url": "https://example.org/help"},
+			},
+			"webPanels": []interface{}{
+				map[string]interface{}{"key": "panel", "url": "/issues/{issue.key}/panel"},
+			},
+			"webhooks": []interface{}{
+				map[string]interface{}{"event": "jira:issue_created", "url": "/webhooks/issue-created"},
+			},
+			"dialogs": []interface{}{
+				map[string]interface{}{"key": "confirm", "url": "/dialogs/confirm"},
+			},
+		},
+	}}
+	mux := chi.NewRouter()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux.Get("/main", handler)
+	mux.Get("/issues/{key}/panel", handler)
+	mux.Get("/webhooks/issue-created", handler)
+
+	unhandled := UnhandledModules(addon, mux)
+	var urls []string
+	for _, module := range unhandled {
+		urls = append(urls, module.Method()+" "+module.URL)
+	}
+	expected := "GET /dialogs/confirm GET /absolute POST /webhooks/issue-created"
+	if strings.Join(urls, " ") != expected {
+		t.Errorf("Expected unhandled modules %q, but got %q", expected, strings.Join(urls, " "))
+	}
+
+	mux.Get("/dialogs/confirm", handler)
+	mux.Get("/absolute", handler)
+	mux.Post("/webhooks/issue-created", handler)
+	if err := VerifyModuleRoutes(addon, mux); err != nil {
+		t.Errorf("Expected all modules to be handled, but got %v", err)
+	}
+}
+
+func TestModules(t *testing.T) {
+	addon := &gonnect.Addon{AddonDescriptor: map[string]interface{}{
+		"modules": map[string]interface{}{
+			"generalPages": []interface{}{map[string]interface{}{"key": "main", "url": "/old"}},
+		},
+	}}
+	mux := chi.NewRouter()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	modules := NewModules(addon, mux)
+	modules.Page("/main", handler, PageModule{Key: "main", Name: "Main"})
+	modules.Page("/issues/panel", handler, PageModule{
+		Type:       "webPanels",
+		Key:        "panel",
+		Location:   "atl.jira.view.issue.right.context",
+		Context:    map[string]string{"project": "project.key", "issue": "issue.key"},
+		Conditions: []descriptor.Condition{descriptor.Cond("user_is_logged_in")},
+	})
+	modules.Webhook("/webhooks/issue-created", handler, WebhookModule{Event: "jira:issue_created"})
+
+	data, _ := json.Marshal(addon.AddonDescriptor["modules"])
+	expected := `{"generalPages":[{"key":"main","name":{"value":"Main"},"url":"/main"}],` +
+		`"webPanels":[{"conditions":[{"condition":"user_is_logged_in"}],"key":"panel","location":"atl.jira.view.issue.right.context","url":"/issues/panel?issue={issue.key}\u0026project={project.key}"}],` +
+		`"webhooks":[{"event":"jira:issue_created","url":"/webhooks/issue-created"}]}`
+	if string(data) != expected {
+		t.Errorf("Expected modules %s, but got %s", expected, data)
+	}
+	if err := VerifyModuleRoutes(addon, mux); err != nil {
+		t.Errorf("Expected the registered modules to be routed, but got %v", err)
+	}
+}
+
+func TestModulesIframe(t *testing.T) {
+	addon := &gonnect.Addon{}
+	mux := chi.NewRouter()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	modules := NewModules(addon, mux)
+	modules.Iframe("/issues/panel", handler, descriptor.WebPanel{
+		Key:      "panel",
+		Name:     "Panel",
+		Location: "atl.jira.view.issue.right.context",
+		Layout:   &descriptor.Layout{Height: "100px"},
+		Context:  descriptor.Context{"issue": "issue.key"},
+	})
+	modules.Iframe("/dialogs/edit", handler, descriptor.Dialog{
+		Key:     "edit",
+		Options: descriptor.DialogOptions{Size: descriptor.DialogMedium, Chrome: true, Header: descriptor.DialogHeader("Edit")},
+	})
+	modules.Add(descriptor.WebItem{Key: "open-edit", Name: "Edit", Location: "jira.issue.tools", DialogKey: "edit"})
+	modules.Iframe("/issues/preview", handler, descriptor.WebItem{
+		Key:           "preview",
+		Name:          "Preview",
+		Location:      "jira.issue.tools",
+		Target:        descriptor.TargetInlineDialog,
+		TargetOptions: map[string]interface{}{"onHover": true},
+	})
+
+	data, _ := json.Marshal(addon.AddonDescriptor["modules"])
+	expected := `{"dialogs":[{"key":"edit","options":{"size":"medium","chrome":true,"header":{"value":"Edit"}},"url":"/dialogs/edit"}],` +
+		`"webItems":[{"key":"open-edit","location":"jira.issue.tools","name":{"value":"Edit"},"target":{"options":{"key":"edit"},"type":"dialogmodule"}},` +
+		`{"context":"addon","key":"preview","location":"jira.issue.tools","name":{"value":"Preview"},"target":{"options":{"onHover":true},"type":"inlinedialog"},"url":"/issues/preview"}],` +
+		`"webPanels":[{"key":"panel","layout":{"height":"100px"},"location":"atl.jira.view.issue.right.context","name":{"value":"Panel"},"url":"/issues/panel?issue={issue.key}"}]}`
+	if string(data) != expected {
+		t.Errorf("Expected modules %s, but got %s", expected, data)
+	}
+	if err := VerifyModuleRoutes(addon, mux); err != nil {
+		t.Errorf("Expected the registered modules to be routed, but got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/middleware"
+)
+
+// Requirement is a declarative security requirement of a route, see Protect
+type Requirement struct {
+	name    string
+	tenant  bool
+	options []middleware.ChainOption
+}
+
+// Auth requires a JWT issued by an installed tenant
+func Auth() Requirement {
+	return Requirement{name: "auth", tenant: true}
+}
+
+// ContextAuth requires a context JWT, which has no query string hash, as
+// requested by page modules with AP.context.getToken()
+func ContextAuth() Requirement {
+	return Requirement{name: "context-auth", tenant: true, options: []middleware.ChainOption{middleware.SkipQsh()}}
+}
+
+// Scopes requires the tenant to have consented to the scopes
+func Scopes(scopes ...string) Requirement {
+	return Requirement{
+		name:    "scopes:" + strings.ToUpper(strings.Join(scopes, ",")),
+		tenant:  true,
+		options: []middleware.ChainOption{middleware.RequireScopes(scopes...)},
+	}
+}
+
+// License requires an active license, config is optional and defaults to
+// the zero LicenseConfig
+func License(config ...middleware.LicenseConfig) Requirement {
+	var c middleware.LicenseConfig
+	if len(config) > 0 {
+		c = config[0]
+	}
+	return Requirement{name: "license", tenant: true, options: []middleware.ChainOption{middleware.RequireLicense(c)}}
+}
+
+// Entitlement requires the tier or feature of Addon.Entitlements
+func Entitlement(required string) Requirement {
+	return Requirement{name: "entitlement:" + required, tenant: true, options: []middleware.ChainOption{middleware.RequireEntitlement(required)}}
+}
+
+// CSRF requires a CSRF token on state changing requests
+func CSRF(config middleware.CSRFConfig) Requirement {
+	return Requirement{name: "csrf", options: []middleware.ChainOption{middleware.WithCSRF(config)}}
+}
+
+// ProtectedHandler is a handler wrapped in the middlewares of its
+// requirements
+type ProtectedHandler struct {
+	http.Handler
+	// Requirements names the requirements, e.g. "auth" or "scopes:WRITE"
+	Requirements []string
+}
+
+// Protect wraps the handler in the middleware.Chain enforcing the
+// requirements, requirements on the tenant imply Auth, for example
+//
+//	mux.Handle("/issues", routes.Protect(addon, handler, routes.Auth(), routes.Scopes("WRITE"), routes.License()))
+func Protect(addon *gonnect.Addon, handler http.Handler, requirements ...Requirement) *ProtectedHandler {
+	var options []middleware.ChainOption
+	var names []string
+	tenant, auth := false, false
+	for _, requirement := range requirements {
+		tenant = tenant || requirement.tenant
+		auth = auth || requirement.name == "auth" || requirement.name == "context-auth"
+		names = append(names, requirement.name)
+		options = append(options, requirement.options...)
+	}
+	if !tenant {
+		options = append(options, middleware.Anonymous())
+	} else if !auth {
+		names = append([]string{"auth"}, names...)
+	}
+	return &ProtectedHandler{Handler: middleware.Chain(addon, options...)(handler), Requirements: names}
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+)
+
+func TestProtect(t *testing.T) {
+	key, name := "addon", "Addon"
+	addon := &gonnect.Addon{Config: gonnect.NewProfile("https://addon.example.com", "sqlite3", "", false), Key: &key, Name: &name}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	testCases := []struct {
+		name         string
+		protected    *ProtectedHandler
+		requirements string
+		expectedCode int
+	}{
+		{name: "public", protected: Protect(addon, handler), requirements: "", expectedCode: http.StatusOK},
+		{name: "auth", protected: Protect(addon, handler, Auth()), requirements: "auth", expectedCode: http.StatusUnauthorized},
+		{name: "implied auth", protected: Protect(addon, handler, Scopes("write"), License()), requirements: "auth scopes:WRITE license", expectedCode: http.StatusUnauthorized},
+		{name: "context auth", protected: Protect(addon, handler, ContextAuth(), Entitlement("premium")), requirements: "context-auth entitlement:premium", expectedCode: http.StatusUnauthorized},
+	}
+	for _, testCase := range testCases {
+		if requirements := strings.Join(testCase.protected.Requirements, " "); requirements != testCase.requirements {
+			t.Errorf("%s: Expected requirements %q, but got %q", testCase.name, testCase.requirements, requirements)
+		}
+		rec := httptest.NewRecorder()
+		testCase.protected.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page", nil))
+		if rec.Code != testCase.expectedCode {
+			t.Errorf("%s: Expected status %v, but got %v", testCase.name, testCase.expectedCode, rec.Code)
+		}
+	}
+}
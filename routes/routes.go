@@ -2,30 +2,52 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
-	"github.com/go-enjin/be/pkg/log"
-
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/events"
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/middleware"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/notify"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
 )
 
 type AtlassianConnectHandler struct {
 	Addon *gonnect.Addon
+	// Product serves the descriptor of a product, the product query
+	// parameter selects it when empty
+	Product string
 }
 
 func (h AtlassianConnectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	product := h.Product
+	if product == "" {
+		product = r.URL.Query().Get("product")
+	}
+	if _, ok := h.Addon.ProductDescriptor(product); product != "" && !ok {
+		util.SendError(w, r, h.Addon, http.StatusNotFound, fmt.Sprintf("no descriptor for the product %q", product))
+		return
+	}
 	w.Header().Add("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(h.Addon.AddonDescriptor)
+	_ = json.NewEncoder(w).Encode(h.Addon.DescriptorForProduct(r, product))
 }
 
 func NewAtlassianConnectHandler(addon *gonnect.Addon) http.Handler {
-	return AtlassianConnectHandler{addon}
+	return AtlassianConnectHandler{Addon: addon}
+}
+
+// NewProductDescriptorHandler serves the descriptor of the product, see
+// gonnect.Addon.ProductDescriptor
+func NewProductDescriptorHandler(addon *gonnect.Addon, product string) http.Handler {
+	return AtlassianConnectHandler{Addon: addon, Product: product}
 }
 
 type InstalledHandler struct {
@@ -33,18 +55,231 @@ type InstalledHandler struct {
 }
 
 func (h InstalledHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	tenant, err := store.NewTenantFromReader(r.Body)
+	r, tenant, err := lifecycleRequest(r)
 	if err != nil {
-		util.SendError(w, r, h.Addon, 500, err.Error())
+		util.SendLifecycleError(w, r, h.Addon, http.StatusBadRequest, util.LifecycleInvalidPayload, err.Error())
+		return
+	}
+	// the key of the payload is the app identity the tenant installed, which
+	// has to be the one serving the request
+	if key := h.Addon.KeyFor(r); tenant.AddonKey == "" {
+		tenant.AddonKey = key
+	} else if tenant.AddonKey != key {
+		util.SendLifecycleError(w, r, h.Addon, http.StatusBadRequest, util.LifecycleInvalidPayload, fmt.Sprintf("install payload key %q does not match the app key %q", tenant.AddonKey, key))
+		return
+	}
+	tenant.InstalledScopes = h.Addon.ProductScopes(tenant.ProductType)
+	tenant.InstalledModules = h.Addon.ProductModules(tenant.ProductType)
+	if signed, _ := r.Context().Value(gonnect.SignedInstallContextKey).(bool); signed {
+		signedAt := time.Now().UTC()
+		tenant.SignedInstallAt = &signedAt
+	}
+	var lifecycle []notify.Event
+	var collision *notify.Event
+	err = store.WithTx(r.Context(), h.Addon.Store, func(tx store.TenantStore) error {
+		previous, err := tx.Get(tenant.ClientKey)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		lifecycle = installedEvents(previous, tenant)
+		if collision, err = siteCollision(r, h.Addon, tx, tenant); err != nil {
+			return err
+		}
+		if collision != nil {
+			lifecycle = append(lifecycle, *collision)
+		}
+		if _, err := tx.Set(tenant); err != nil {
+			return err
+		}
+		if h.Addon.Retention != nil {
+			if err := h.Addon.Retention.Installed(r.Context(), tx, tenant); err != nil {
+				return err
+			}
+		}
+		if h.Addon.OnInstalled != nil {
+			if err := h.Addon.OnInstalled(r.Context(), tx, tenant); err != nil {
+				return lifecycleCallbackFailed(r, h.Addon, notify.EventInstalled, tenant, err)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errSiteCollision) {
+		publishLifecycle(r, h.Addon, *collision)
+		util.SendLifecycleError(w, r, h.Addon, http.StatusConflict, util.LifecycleSiteCollision, err.Error())
 		return
 	}
-	_, err = h.Addon.Store.Set(tenant)
 	if err != nil {
-		util.SendError(w, r, h.Addon, 500, err.Error())
+		sendLifecycleFailure(w, r, h.Addon, err)
 		return
 	}
-	log.InfoF("installed new tenant %s", tenant.BaseURL)
-	_, _ = w.Write([]byte("OK"))
+	reqlog.FromContext(r.Context()).InfoF("installed new tenant %s", tenant.BaseURL)
+	publishLifecycle(r, h.Addon, lifecycle...)
+	util.SendLifecycleSuccess(w, h.Addon)
+}
+
+var errSiteCollision = errors.New("site collision")
+
+// siteCollision returns the EventSiteCollision of an install whose baseUrl
+// belongs to a stored tenant with another clientKey and applies the
+// SiteCollisionPolicy of the add-on. The rejected installs fail with
+// errSiteCollision
+func siteCollision(r *http.Request, addon *gonnect.Addon, tx store.TenantStore, tenant *store.Tenant) (*notify.Event, error) {
+	if tenant.BaseURL == "" {
+		return nil, nil
+	}
+	previous, err := tx.GetByUrl(tenant.BaseURL)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && previous.ClientKey == tenant.ClientKey) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	event := lifecycleEvent(notify.EventSiteCollision, tenant)
+	event.PreviousClientKey = previous.ClientKey
+	policy := addon.SiteCollisionPolicy
+	reqlog.FromContext(r.Context()).WarnF("tenant %s installed on the site %s of tenant %s, %v", tenant.ClientKey, tenant.BaseURL, previous.ClientKey, policy)
+	signed, _ := r.Context().Value(gonnect.SignedInstallContextKey).(bool)
+	switch policy {
+	case gonnect.CollisionReject:
+		// the unsigned install of any clientKey could claim a baseUrl first,
+		// only the tenants of signed installs are trusted to hold on to it
+		if !signed && previous.SignedInstallAt == nil {
+			reqlog.FromContext(r.Context()).WarnF("unsigned tenant %s does not block the unsigned install of tenant %s", previous.ClientKey, tenant.ClientKey)
+			break
+		}
+		return &event, fmt.Errorf("%w: %s is installed as %s", errSiteCollision, tenant.BaseURL, previous.ClientKey)
+	case gonnect.CollisionReplace:
+		// the install of any clientKey can claim a baseUrl, only the ones
+		// signed by Atlassian are trusted to remove other tenants
+		if !signed {
+			reqlog.FromContext(r.Context()).WarnF("unsigned install of tenant %s does not replace tenant %s", tenant.ClientKey, previous.ClientKey)
+			break
+		}
+		if err = replaceSiteTenants(tx, tenant, previous); err != nil {
+			return nil, err
+		}
+	}
+	return &event, nil
+}
+
+// replaceSiteTenants deletes the tenants of the site of tenant, starting with
+// previous. The stores find one tenant per baseUrl, the lookup is repeated
+// until it finds none or tenant itself: a stored tenant with the clientKey of
+// tenant hides the further tenants of the site, which are kept
+func replaceSiteTenants(tx store.TenantStore, tenant, previous *store.Tenant) error {
+	for {
+		if err := tx.Delete(previous.ClientKey); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		next, err := tx.GetByUrl(tenant.BaseURL)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && next.ClientKey == tenant.ClientKey) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if next.ClientKey == previous.ClientKey {
+			return fmt.Errorf("tenant %s of the site %s was not deleted", previous.ClientKey, tenant.BaseURL)
+		}
+		previous = next
+	}
+}
+
+// sendLifecycleFailure responds to a lifecycle request whose tenant could not
+// be persisted or whose callbacks failed, store outages are retried by the
+// host product
+func sendLifecycleFailure(w http.ResponseWriter, r *http.Request, addon *gonnect.Addon, err error) {
+	if errors.Is(err, store.ErrUnavailable) {
+		util.SendLifecycleError(w, r, addon, http.StatusServiceUnavailable, util.LifecycleStoreUnavailable, err.Error())
+		return
+	}
+	util.SendLifecycleError(w, r, addon, http.StatusInternalServerError, util.LifecycleProcessingFailure, err.Error())
+}
+
+// lifecycleCallbackFailed applies the LifecyclePolicy of the add-on to a
+// failed lifecycle callback, the error returned fails the request and rolls
+// back the tenant changes
+func lifecycleCallbackFailed(r *http.Request, addon *gonnect.Addon, eventType string, tenant *store.Tenant, err error) error {
+	policy := addon.LifecyclePolicy
+	if policy == gonnect.LifecycleRetryLater && addon.LifecycleRetries == nil {
+		reqlog.FromContext(r.Context()).WarnF("lifecycle policy %v without a retry queue, failing the %s request", policy, eventType)
+		policy = gonnect.LifecycleFail
+	}
+	switch policy {
+	case gonnect.LifecycleContinue:
+		reqlog.FromContext(r.Context()).ErrorF("%s callback of tenant %s failed, continuing: %v", eventType, tenant.ClientKey, err)
+		errorreport.Report(r.Context(), errorreport.Event{
+			Kind:      errorreport.KindLifecycle,
+			Err:       err,
+			Request:   r,
+			ClientKey: tenant.ClientKey,
+			Fields:    map[string]string{"event": eventType, "policy": policy.String()},
+		})
+		return nil
+	case gonnect.LifecycleRetryLater:
+		retry := gonnect.LifecycleRetry{EventType: eventType, ClientKey: tenant.ClientKey, Error: err.Error()}
+		if payload, ok := store.LifecyclePayloadFromContext(r.Context()); ok {
+			retry.Payload, retry.RawPayload = payload, payload.Raw
+		}
+		if enqueueErr := addon.LifecycleRetries.Enqueue(r.Context(), retry); enqueueErr != nil {
+			return fmt.Errorf("%w, retrying it failed: %v", err, enqueueErr)
+		}
+		reqlog.FromContext(r.Context()).WarnF("%s callback of tenant %s failed, retrying later: %v", eventType, tenant.ClientKey, err)
+		return nil
+	}
+	return err
+}
+
+// lifecycleRequest reads the tenant of a lifecycle request, the request is
+// returned with the full payload in its context for the lifecycle callbacks,
+// see store.LifecyclePayloadFromContext
+func lifecycleRequest(r *http.Request) (*http.Request, *store.Tenant, error) {
+	payload, err := store.NewLifecyclePayloadFromReader(r.Body)
+	if err != nil {
+		return r, nil, err
+	}
+	tenant, err := payload.Tenant()
+	if err != nil {
+		return r, nil, err
+	}
+	return r.WithContext(store.WithLifecyclePayload(r.Context(), payload)), tenant, nil
+}
+
+func lifecycleEvent(eventType string, tenant *store.Tenant) notify.Event {
+	return notify.Event{
+		Type:        eventType,
+		ClientKey:   tenant.ClientKey,
+		BaseURL:     tenant.BaseURL,
+		ProductType: tenant.ProductType,
+	}
+}
+
+// publishLifecycle sends the lifecycle events to the notifier of the add-on
+// and publishes them on the events.DefaultBus
+func publishLifecycle(r *http.Request, addon *gonnect.Addon, lifecycle ...notify.Event) {
+	addon.Notifier.Notify(r.Context(), lifecycle...)
+	for _, event := range lifecycle {
+		events.Publish(r.Context(), events.Event{
+			Topic:     "lifecycle." + event.Type,
+			ClientKey: event.ClientKey,
+			Data:      event,
+		})
+	}
+}
+
+// installedEvents returns the lifecycle events of an installation, including
+// the secret rotation and baseUrl change of a reinstalled tenant
+func installedEvents(previous, tenant *store.Tenant) []notify.Event {
+	events := []notify.Event{lifecycleEvent(notify.EventInstalled, tenant)}
+	if previous == nil {
+		return events
+	}
+	if tenant.SharedSecret != "" && tenant.SharedSecret != previous.SharedSecret {
+		events = append(events, lifecycleEvent(notify.EventSecretRotated, tenant))
+	}
+	if tenant.BaseURL != "" && tenant.BaseURL != previous.BaseURL {
+		event := lifecycleEvent(notify.EventBaseURLChanged, tenant)
+		event.PreviousBaseURL = previous.BaseURL
+		events = append(events, event)
+	}
+	return events
 }
 
 func NewInstalledHandler(addon *gonnect.Addon) http.Handler {
@@ -56,18 +291,34 @@ type UninstalledHandler struct {
 }
 
 func (h UninstalledHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	tenant, err := store.NewTenantFromReader(r.Body)
+	r, tenant, err := lifecycleRequest(r)
 	if err != nil {
-		util.SendError(w, r, h.Addon, 500, err.Error())
+		util.SendLifecycleError(w, r, h.Addon, http.StatusBadRequest, util.LifecycleInvalidPayload, err.Error())
 		return
 	}
-	_, err = h.Addon.Store.Set(tenant)
+	err = store.WithTx(r.Context(), h.Addon.Store, func(tx store.TenantStore) error {
+		if _, err := tx.Set(tenant); err != nil {
+			return err
+		}
+		if h.Addon.Retention != nil {
+			if err := h.Addon.Retention.Uninstalled(r.Context(), tx, tenant); err != nil {
+				return err
+			}
+		}
+		if h.Addon.OnUninstalled != nil {
+			if err := h.Addon.OnUninstalled(r.Context(), tx, tenant); err != nil {
+				return lifecycleCallbackFailed(r, h.Addon, notify.EventUninstalled, tenant, err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		util.SendError(w, r, h.Addon, 500, err.Error())
+		sendLifecycleFailure(w, r, h.Addon, err)
 		return
 	}
-	log.InfoF("uninstalled tenant %s", tenant.BaseURL)
-	_, _ = w.Write([]byte("OK"))
+	reqlog.FromContext(r.Context()).InfoF("uninstalled tenant %s", tenant.BaseURL)
+	publishLifecycle(r, h.Addon, lifecycleEvent(notify.EventUninstalled, tenant))
+	util.SendLifecycleSuccess(w, h.Addon)
 }
 
 func NewUninstalledHandler(addon *gonnect.Addon) http.Handler {
@@ -85,14 +336,30 @@ func RegisterRoutes(base string, addon *gonnect.Addon, mux chi.Router, enabled,
 	}
 	RegisteredRoutes = append(RegisteredRoutes, base+"atlassian-connect.json", base+"installed", base+"uninstalled")
 	mux.Route(base, func(r chi.Router) {
+		r.Use(middleware.NewLoggerMiddleware(addon))
 		r.Handle("/atlassian-connect.json", NewAtlassianConnectHandler(addon))
-		r.Handle("/installed", middleware.NewVerifyInstallationMiddleware(addon)(NewInstalledHandler(addon)))
-		r.Handle("/uninstalled", middleware.NewAuthenticationMiddleware(addon, false)(NewUninstalledHandler(addon)))
+		// the products share the lifecycle routes below
+		for _, product := range addon.Products() {
+			r.Handle("/"+product+"/atlassian-connect.json", NewProductDescriptorHandler(addon, product))
+			RegisteredRoutes = append(RegisteredRoutes, strings.TrimSuffix(base, "/")+"/"+product+"/atlassian-connect.json")
+		}
+		lifecycleIPs := middleware.NewLifecycleIPMiddleware(addon)
+		r.Handle("/installed", lifecycleIPs(middleware.NewVerifyInstallationMiddleware(addon)(NewInstalledHandler(addon))))
+		r.Handle("/uninstalled", lifecycleIPs(middleware.NewAuthenticationMiddleware(addon, false)(NewUninstalledHandler(addon))))
 		if enabled != nil {
 			r.Handle("/enabled", middleware.NewAuthenticationMiddleware(addon, false)(enabled))
 		}
 		if disabled != nil {
 			r.Handle("/disabled", middleware.NewAuthenticationMiddleware(addon, false)(disabled))
 		}
+		if addon.Translations != nil {
+			r.Handle("/i18n/{locale}.json", addon.Translations)
+		}
 	})
+	if addon.Translations != nil {
+		RegisteredRoutes = append(RegisteredRoutes, base+"i18n")
+		addon.AddonDescriptor["translations"] = map[string]interface{}{
+			"paths": addon.Translations.Paths(strings.TrimSuffix(base, "/") + "/i18n"),
+		}
+	}
 }
\ No newline at end of file
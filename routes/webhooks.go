@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/descriptor"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/middleware"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/reqlog"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/util"
+)
+
+// WebhookEventContextKey holds the event of a webhook request dispatched by
+// Webhooks, see WebhookEventFromContext
+const WebhookEventContextKey = "webhookEvent"
+
+// WebhookEventFromContext returns the event of a webhook request dispatched
+// by Webhooks
+func WebhookEventFromContext(ctx context.Context) string {
+	event, _ := ctx.Value(WebhookEventContextKey).(string)
+	return event
+}
+
+// Webhooks serves the webhooks declared in the descriptor of the add-on and
+// dispatches them to the handlers registered for their events, e.g.
+//
+//	webhooks := routes.NewWebhooks(addon)
+//	webhooks.HandleFunc("jira:issue_created", issueCreated)
+//	webhooks.Mount(mux)
+type Webhooks struct {
+	addon    *gonnect.Addon
+	mutex    sync.RWMutex
+	handlers map[string]http.Handler
+}
+
+func NewWebhooks(addon *gonnect.Addon) *Webhooks {
+	return &Webhooks{addon: addon, handlers: map[string]http.Handler{}}
+}
+
+// Handle registers the handler of the webhook event, e.g.
+// "jira:issue_created", handlers can be registered after Mount
+func (wh *Webhooks) Handle(event string, handler http.Handler) {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+	wh.handlers[event] = handler
+}
+
+// HandleFunc registers the handler function of the webhook event
+func (wh *Webhooks) HandleFunc(event string, handler http.HandlerFunc) {
+	wh.Handle(event, handler)
+}
+
+func (wh *Webhooks) handler(event string) (http.Handler, bool) {
+	wh.mutex.RLock()
+	defer wh.mutex.RUnlock()
+	handler, ok := wh.handlers[event]
+	return handler, ok
+}
+
+// Mount serves POST requests of every webhook url of the descriptors which
+// mux has no route for yet, authenticated like the other requests of the
+// tenants, and returns the mounted paths. Paths which are not declared in
+// the descriptor are not routed and answered with 404 by mux, urls with
+// context parameters in their path are skipped
+func (wh *Webhooks) Mount(mux chi.Router) (mounted []string) {
+	events := map[string][]string{}
+	var paths []string
+	// the products may declare the same webhooks
+	seen := map[string]bool{}
+	for _, d := range wh.addon.Descriptors() {
+		for _, module := range descriptor.ModuleURLs(d) {
+			if module.Type != "webhooks" || module.Event == "" {
+				continue
+			}
+			path, _, _ := strings.Cut(module.URL, "?")
+			if strings.Contains(path, "{") || seen[path+" "+module.Event] {
+				continue
+			}
+			seen[path+" "+module.Event] = true
+			if _, ok := events[path]; !ok {
+				paths = append(paths, path)
+			}
+			events[path] = append(events[path], module.Event)
+		}
+	}
+	authentication := middleware.NewAuthenticationMiddleware(wh.addon, false)
+	for _, path := range paths {
+		if mux.Match(chi.NewRouteContext(), http.MethodPost, path) {
+			continue
+		}
+		mux.Method(http.MethodPost, path, authentication(wh.dispatcher(events[path])))
+		mounted = append(mounted, path)
+	}
+	RegisteredRoutes = append(RegisteredRoutes, mounted...)
+	return
+}
+
+// dispatcher passes the requests of a webhook url to the handler of its
+// event, urls shared by several events are told apart by the webhookEvent
+// of the Jira payload
+func (wh *Webhooks) dispatcher(events []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := events[0]
+		if len(events) > 1 {
+			var err error
+			if event, err = payloadEvent(r, events); err != nil {
+				util.SendError(w, r, wh.addon, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		handler, ok := wh.handler(event)
+		if !ok {
+			// the host product retries failed webhooks, declared events
+			// without a handler are acknowledged
+			reqlog.FromContext(r.Context()).WarnF("no handler for webhook event %s", event)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), WebhookEventContextKey, event)))
+	})
+}
+
+// payloadEvent returns the webhookEvent of the request body if it is one of
+// events, the body is restored for the handler
+func payloadEvent(r *http.Request, events []string) (string, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var payload struct {
+		WebhookEvent string `json:"webhookEvent"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	for _, event := range events {
+		if event == payload.WebhookEvent {
+			return event, nil
+		}
+	}
+	if payload.WebhookEvent == "" {
+		return "", errors.New("webhook url shared by several events without a webhookEvent in the payload")
+	}
+	return "", fmt.Errorf("webhook event %s is not declared for the url, expected one of %s", payload.WebhookEvent, strings.Join(events, ", "))
+}
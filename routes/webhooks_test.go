@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	atlasjwt "github.com/go-enjin/github-com-craftamap-atlas-gonnect/atlas-jwt"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestWebhooks(t *testing.T) {
+	profile := gonnect.NewProfile("https://addon.example.com", "sqlite3", "", false)
+	addon, err := gonnect.NewCustomAddon(profile, "test", map[string]interface{}{
+		"key":  "addon",
+		"name": "Addon",
+		"modules": map[string]interface{}{
+			"webhooks": []interface{}{
+				map[string]interface{}{"event": "jira:issue_created", "url": "/webhooks/issue"},
+				map[string]interface{}{"event": "jira:issue_updated", "url": "/webhooks/issue"},
+				map[string]interface{}{"event": "comment_created", "url": "/webhooks/comment"},
+				map[string]interface{}{"event": "project_created", "url": "/webhooks/project?key=${project.key}"},
+				map[string]interface{}{"event": "worklog_updated", "url": "/webhooks/worklog"},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addon.Store, err = store.NewStatic(store.Tenant{ClientKey: "client-key", SharedSecret: "secret", BaseURL: "https://example.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var dispatched []string
+	webhooks := NewWebhooks(addon)
+	for _, event := range []string{"jira:issue_created", "jira:issue_updated", "comment_created", "project_created"} {
+		webhooks.HandleFunc(event, func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			dispatched = append(dispatched, WebhookEventFromContext(r.Context())+" "+string(body))
+		})
+	}
+	mux := chi.NewRouter()
+	mux.Post("/webhooks/worklog", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mounted := webhooks.Mount(mux)
+	if strings.Join(mounted, " ") != "/webhooks/comment /webhooks/issue /webhooks/project" {
+		t.Errorf("Expected the webhooks of the descriptor to be mounted, but got %v", mounted)
+	}
+
+	post := func(target, body string, signed bool) int {
+		r := httptest.NewRequest(http.MethodPost, "https://addon.example.com"+target, strings.NewReader(body))
+		if signed {
+			claims := jwt.MapClaims{
+				"iss": "client-key",
+				"iat": time.Now().Unix(),
+				"exp": time.Now().Add(time.Minute).Unix(),
+				"qsh": atlasjwt.CreateQueryStringHash(r, false, "https://addon.example.com"),
+			}
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set("Authorization", "JWT "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	testCases := []struct {
+		target         string
+		body           string
+		signed         bool
+		expectedStatus int
+	}{
+		{target: "/webhooks/comment", body: `{"comment":{}}`, signed: true, expectedStatus: http.StatusOK},
+		{target: "/webhooks/issue", body: `{"webhookEvent":"jira:issue_updated"}`, signed: true, expectedStatus: http.StatusOK},
+		{target: "/webhooks/issue", body: `{"webhookEvent":"jira:issue_deleted"}`, signed: true, expectedStatus: http.StatusBadRequest},
+		{target: "/webhooks/issue", body: `{}`, signed: true, expectedStatus: http.StatusBadRequest},
+		{target: "/webhooks/project?key=TEST", body: `{}`, signed: true, expectedStatus: http.StatusOK},
+		{target: "/webhooks/worklog", body: `{}`, signed: true, expectedStatus: http.StatusAccepted},
+		{target: "/webhooks/comment", body: `{}`, expectedStatus: http.StatusUnauthorized},
+		{target: "/webhooks/unknown", body: `{}`, signed: true, expectedStatus: http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		if status := post(testCase.target, testCase.body, testCase.signed); status != testCase.expectedStatus {
+			t.Errorf("POST %s %s: Expected the status %d, but got %d", testCase.target, testCase.body, testCase.expectedStatus, status)
+		}
+	}
+	expected := []string{
+		`comment_created {"comment":{}}`,
+		`jira:issue_updated {"webhookEvent":"jira:issue_updated"}`,
+		`project_created {}`,
+	}
+	if strings.Join(dispatched, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the dispatched webhooks %q, but got %q", expected, dispatched)
+	}
+
+	// declared events without a handler are acknowledged
+	webhooks.handlers = map[string]http.Handler{}
+	if status := post("/webhooks/comment", `{}`, true); status != http.StatusNoContent {
+		t.Errorf("Expected an unhandled event to be acknowledged, but got %d", status)
+	}
+}
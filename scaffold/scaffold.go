@@ -0,0 +1,120 @@
+// Package scaffold generates a working example app of the add-on framework,
+// a Jira issue glance and a Confluence macro with their descriptors, routes,
+// store configuration and Dockerfile, see the gonnect new command
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// ErrExists is returned by Generate when a file it would write exists
+var ErrExists = errors.New("file exists")
+
+// Options are the values of the generated app
+type Options struct {
+	// Key is the app key of the descriptors
+	Key string
+	// Name defaults to the Key
+	Name string
+	// Module is the Go module path, example.com/<key> when empty
+	Module string
+	// BaseUrl is the public url of the app, http://localhost:8080 when
+	// empty
+	BaseUrl string
+	// GonnectVersion is the required version of the framework, resolved by
+	// go mod tidy when empty
+	GonnectVersion string
+	// Replace replaces the framework module with a local directory, e.g. for
+	// trying out changes of the framework
+	Replace string
+	// Force overwrites existing files
+	Force bool
+}
+
+var validKey = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+func (o *Options) defaults() error {
+	if !validKey.MatchString(o.Key) {
+		return fmt.Errorf("invalid app key %q, use letters, digits, dots, dashes and underscores", o.Key)
+	}
+	if o.Name == "" {
+		o.Name = o.Key
+	}
+	if o.Module == "" {
+		o.Module = "example.com/" + o.Key
+	}
+	if o.BaseUrl == "" {
+		o.BaseUrl = "http://localhost:8080"
+	}
+	o.BaseUrl = strings.TrimSuffix(o.BaseUrl, "/")
+	if o.Replace != "" && o.GonnectVersion == "" {
+		o.GonnectVersion = "v0.0.0"
+	}
+	return nil
+}
+
+// Generate writes the example app into dir and returns the written files,
+// relative to dir. Existing files are only overwritten with Force
+func Generate(dir string, opts Options) (written []string, err error) {
+	if err = opts.defaults(); err != nil {
+		return
+	}
+	files := map[string][]byte{}
+	var names []string
+	// fs.WalkDir visits the templates in lexical order
+	err = fs.WalkDir(templates, "templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "templates/"), ".tmpl")
+		data, err := templates.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// the generated html templates use the default delimiters
+		tmpl, err := template.New(name).Delims("[[", "]]").Parse(string(data))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, opts); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		files[name] = buf.Bytes()
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if !opts.Force {
+		for _, name := range names {
+			if _, statErr := os.Stat(filepath.Join(dir, name)); statErr == nil {
+				return nil, fmt.Errorf("%w: %s", ErrExists, filepath.Join(dir, name))
+			}
+		}
+	}
+	for _, name := range names {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return written, err
+		}
+		if err = os.WriteFile(target, files[name], 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, name)
+	}
+	return written, nil
+}
@@ -0,0 +1,83 @@
+package scaffold
+
+import (
+	"encoding/json"
+	"errors"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/descriptor"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	written, err := Generate(dir, Options{Key: "my-app", Name: "My App", BaseUrl: "https://app.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Dockerfile README.md config.json descriptors/confluence.json descriptors/jira.json go.mod main.go static/icon.svg templates/glance.html templates/macro.html"
+	if strings.Join(written, " ") != expected {
+		t.Errorf("Expected the files %q, but got %q", expected, strings.Join(written, " "))
+	}
+
+	testCases := []struct {
+		product    descriptor.Product
+		moduleType string
+	}{
+		{product: descriptor.Jira, moduleType: "jiraIssueGlances"},
+		{product: descriptor.Confluence, moduleType: "dynamicContentMacros"},
+	}
+	for _, testCase := range testCases {
+		data, err := os.ReadFile(filepath.Join(dir, "descriptors", string(testCase.product)+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := map[string]interface{}{}
+		if err = json.Unmarshal(data, &d); err != nil {
+			t.Fatalf("%s descriptor: %v", testCase.product, err)
+		}
+		if d["key"] != "my-app" || d["name"] != "My App" {
+			t.Errorf("%s: Expected the app key and name in the descriptor, but got %v", testCase.product, d)
+		}
+		if modules, _ := d["modules"].(map[string]interface{}); modules[testCase.moduleType] == nil {
+			t.Errorf("%s: Expected the %s module in the descriptor, but got %v", testCase.product, testCase.moduleType, modules)
+		}
+		if errs := descriptor.Validate(d, testCase.product); len(errs) > 0 {
+			t.Errorf("%s: Expected a valid descriptor, but got %v", testCase.product, errs)
+		}
+	}
+
+	if _, err = parser.ParseFile(token.NewFileSet(), filepath.Join(dir, "main.go"), nil, parser.AllErrors); err != nil {
+		t.Errorf("Expected the generated main.go to parse, but got %v", err)
+	}
+	goMod, _ := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if !strings.HasPrefix(string(goMod), "module example.com/my-app\n") || strings.Contains(string(goMod), "replace") {
+		t.Errorf("Expected the module of the app without a replace directive, but got:\n%s", goMod)
+	}
+	config, _ := os.ReadFile(filepath.Join(dir, "config.json"))
+	if !strings.Contains(string(config), `"baseUrl": "https://app.example.com"`) {
+		t.Errorf("Expected the base url in the configuration, but got:\n%s", config)
+	}
+	glance, _ := os.ReadFile(filepath.Join(dir, "templates", "glance.html"))
+	if !strings.Contains(string(glance), "{{.Values.issueKey}}") {
+		t.Errorf("Expected the html templates to keep their delimiters, but got:\n%s", glance)
+	}
+
+	if _, err = Generate(dir, Options{Key: "my-app"}); !errors.Is(err, ErrExists) {
+		t.Errorf("Expected existing files to be kept, but got %v", err)
+	}
+	if _, err = Generate(dir, Options{Key: "my-app", Replace: "../atlas-gonnect", Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	goMod, _ = os.ReadFile(filepath.Join(dir, "go.mod"))
+	if !strings.Contains(string(goMod), "=> ../atlas-gonnect") {
+		t.Errorf("Expected the replace directive, but got:\n%s", goMod)
+	}
+	if _, err = Generate(dir, Options{Key: "my app"}); err == nil {
+		t.Error("Expected an invalid key to be rejected")
+	}
+}
@@ -0,0 +1,272 @@
+package servicedesk
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+)
+
+const SERVICEDESK_API_PATH = "/rest/servicedeskapi"
+
+const (
+	EXPERIMENTAL_API_HEADER = "X-ExperimentalApi"
+	EXPERIMENTAL_API_OPT_IN = "opt-in"
+)
+
+// ServiceDesk provides typed helpers for the Jira Service Management REST API
+type ServiceDesk struct {
+	host *hostrequest.HostRequest
+}
+
+func New(host *hostrequest.HostRequest) *ServiceDesk {
+	return &ServiceDesk{host: host}
+}
+
+// Page holds the common pagination options of the service desk API
+type Page struct {
+	Start int
+	Limit int
+}
+
+func (p Page) values() url.Values {
+	v := url.Values{}
+	if p.Start > 0 {
+		v.Set("start", strconv.Itoa(p.Start))
+	}
+	if p.Limit > 0 {
+		v.Set("limit", strconv.Itoa(p.Limit))
+	}
+	return v
+}
+
+type PagedResponse struct {
+	Size       int  `json:"size"`
+	Start      int  `json:"start"`
+	Limit      int  `json:"limit"`
+	IsLastPage bool `json:"isLastPage"`
+}
+
+type Date struct {
+	Iso8601     string `json:"iso8601,omitempty"`
+	Jira        string `json:"jira,omitempty"`
+	Friendly    string `json:"friendly,omitempty"`
+	EpochMillis int64  `json:"epochMillis,omitempty"`
+}
+
+type User struct {
+	AccountId    string `json:"accountId"`
+	EmailAddress string `json:"emailAddress,omitempty"`
+	DisplayName  string `json:"displayName,omitempty"`
+	Active       bool   `json:"active"`
+	TimeZone     string `json:"timeZone,omitempty"`
+}
+
+type RequestFieldValue struct {
+	FieldId string      `json:"fieldId"`
+	Label   string      `json:"label"`
+	Value   interface{} `json:"value"`
+}
+
+type CustomerRequest struct {
+	IssueId            string              `json:"issueId"`
+	IssueKey           string              `json:"issueKey"`
+	RequestTypeId      string              `json:"requestTypeId"`
+	ServiceDeskId      string              `json:"serviceDeskId"`
+	CreatedDate        Date                `json:"createdDate"`
+	Reporter           User                `json:"reporter"`
+	RequestFieldValues []RequestFieldValue `json:"requestFieldValues"`
+	CurrentStatus      struct {
+		Status     string `json:"status"`
+		StatusDate Date   `json:"statusDate"`
+	} `json:"currentStatus"`
+}
+
+type CustomerRequestList struct {
+	PagedResponse
+	Values []CustomerRequest `json:"values"`
+}
+
+// CreateRequest is the payload used to raise a new customer request
+type CreateRequest struct {
+	ServiceDeskId       string                 `json:"serviceDeskId"`
+	RequestTypeId       string                 `json:"requestTypeId"`
+	RequestFieldValues  map[string]interface{} `json:"requestFieldValues"`
+	RaiseOnBehalfOf     string                 `json:"raiseOnBehalfOf,omitempty"`
+	RequestParticipants []string               `json:"requestParticipants,omitempty"`
+}
+
+type Queue struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Jql        string   `json:"jql"`
+	Fields     []string `json:"fields"`
+	IssueCount int      `json:"issueCount"`
+}
+
+type QueueList struct {
+	PagedResponse
+	Values []Queue `json:"values"`
+}
+
+// QueueIssue is an issue listed in a queue, the fields are left as raw json
+// values
+type QueueIssue struct {
+	Id     string                 `json:"id"`
+	Key    string                 `json:"key"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+type QueueIssueList struct {
+	PagedResponse
+	Values []QueueIssue `json:"values"`
+}
+
+type SlaDuration struct {
+	Millis   int64  `json:"millis"`
+	Friendly string `json:"friendly"`
+}
+
+type SlaCycle struct {
+	StartTime           Date        `json:"startTime"`
+	StopTime            Date        `json:"stopTime,omitempty"`
+	BreachTime          Date        `json:"breachTime,omitempty"`
+	Breached            bool        `json:"breached"`
+	Paused              bool        `json:"paused,omitempty"`
+	WithinCalendarHours bool        `json:"withinCalendarHours,omitempty"`
+	GoalDuration        SlaDuration `json:"goalDuration"`
+	ElapsedTime         SlaDuration `json:"elapsedTime"`
+	RemainingTime       SlaDuration `json:"remainingTime"`
+}
+
+type Sla struct {
+	Id             string     `json:"id"`
+	Name           string     `json:"name"`
+	OngoingCycle   *SlaCycle  `json:"ongoingCycle,omitempty"`
+	CompletedCycle []SlaCycle `json:"completedCycles,omitempty"`
+}
+
+type SlaList struct {
+	PagedResponse
+	Values []Sla `json:"values"`
+}
+
+type Organization struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type OrganizationList struct {
+	PagedResponse
+	Values []Organization `json:"values"`
+}
+
+type UserList struct {
+	PagedResponse
+	Values []User `json:"values"`
+}
+
+type accountIdsRequest struct {
+	AccountIds []string `json:"accountIds"`
+}
+
+type organizationIdRequest struct {
+	OrganizationId int `json:"organizationId"`
+}
+
+func apiPath(parts ...string) string {
+	for idx, part := range parts {
+		parts[idx] = url.PathEscape(part)
+	}
+	return SERVICEDESK_API_PATH + "/" + strings.Join(parts, "/")
+}
+
+// do sends the request with the experimental api opt-in header set, the
+// header is ignored by endpoints which are not experimental
+func (s *ServiceDesk) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	req, err := s.host.NewRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(EXPERIMENTAL_API_HEADER, EXPERIMENTAL_API_OPT_IN)
+	return s.host.DoRequestJSON(req, out)
+}
+
+func (s *ServiceDesk) GetRequests(ctx context.Context, page Page) (list *CustomerRequestList, err error) {
+	list = &CustomerRequestList{}
+	err = s.do(ctx, http.MethodGet, apiPath("request"), page.values(), nil, list)
+	return
+}
+
+func (s *ServiceDesk) GetRequest(ctx context.Context, issueIdOrKey string) (request *CustomerRequest, err error) {
+	request = &CustomerRequest{}
+	err = s.do(ctx, http.MethodGet, apiPath("request", issueIdOrKey), nil, nil, request)
+	return
+}
+
+func (s *ServiceDesk) CreateRequest(ctx context.Context, create CreateRequest) (request *CustomerRequest, err error) {
+	request = &CustomerRequest{}
+	err = s.do(ctx, http.MethodPost, apiPath("request"), nil, create, request)
+	return
+}
+
+func (s *ServiceDesk) GetRequestSlas(ctx context.Context, issueIdOrKey string, page Page) (list *SlaList, err error) {
+	list = &SlaList{}
+	err = s.do(ctx, http.MethodGet, apiPath("request", issueIdOrKey, "sla"), page.values(), nil, list)
+	return
+}
+
+func (s *ServiceDesk) GetQueues(ctx context.Context, serviceDeskId string, includeCount bool, page Page) (list *QueueList, err error) {
+	query := page.values()
+	if includeCount {
+		query.Set("includeCount", "true")
+	}
+	list = &QueueList{}
+	err = s.do(ctx, http.MethodGet, apiPath("servicedesk", serviceDeskId, "queue"), query, nil, list)
+	return
+}
+
+func (s *ServiceDesk) GetQueueIssues(ctx context.Context, serviceDeskId, queueId string, page Page) (list *QueueIssueList, err error) {
+	list = &QueueIssueList{}
+	err = s.do(ctx, http.MethodGet, apiPath("servicedesk", serviceDeskId, "queue", queueId, "issue"), page.values(), nil, list)
+	return
+}
+
+func (s *ServiceDesk) GetOrganizations(ctx context.Context, page Page) (list *OrganizationList, err error) {
+	list = &OrganizationList{}
+	err = s.do(ctx, http.MethodGet, apiPath("organization"), page.values(), nil, list)
+	return
+}
+
+func (s *ServiceDesk) CreateOrganization(ctx context.Context, name string) (organization *Organization, err error) {
+	organization = &Organization{}
+	err = s.do(ctx, http.MethodPost, apiPath("organization"), nil, map[string]string{"name": name}, organization)
+	return
+}
+
+func (s *ServiceDesk) GetOrganizationUsers(ctx context.Context, organizationId string, page Page) (list *UserList, err error) {
+	list = &UserList{}
+	err = s.do(ctx, http.MethodGet, apiPath("organization", organizationId, "user"), page.values(), nil, list)
+	return
+}
+
+func (s *ServiceDesk) AddOrganizationUsers(ctx context.Context, organizationId string, accountIds ...string) error {
+	return s.do(ctx, http.MethodPost, apiPath("organization", organizationId, "user"), nil, accountIdsRequest{accountIds}, nil)
+}
+
+func (s *ServiceDesk) RemoveOrganizationUsers(ctx context.Context, organizationId string, accountIds ...string) error {
+	return s.do(ctx, http.MethodDelete, apiPath("organization", organizationId, "user"), nil, accountIdsRequest{accountIds}, nil)
+}
+
+func (s *ServiceDesk) GetServiceDeskOrganizations(ctx context.Context, serviceDeskId string, page Page) (list *OrganizationList, err error) {
+	list = &OrganizationList{}
+	err = s.do(ctx, http.MethodGet, apiPath("servicedesk", serviceDeskId, "organization"), page.values(), nil, list)
+	return
+}
+
+func (s *ServiceDesk) AddServiceDeskOrganization(ctx context.Context, serviceDeskId string, organizationId int) error {
+	return s.do(ctx, http.MethodPost, apiPath("servicedesk", serviceDeskId, "organization"), nil, organizationIdRequest{organizationId}, nil)
+}
@@ -0,0 +1,159 @@
+package servicedesk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/hostrequest"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func newTestHost(t *testing.T, handler http.HandlerFunc) *hostrequest.HostRequest {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	key := "com.example.test"
+	return hostrequest.New(&gonnect.Addon{Key: &key}, &store.Tenant{
+		ClientKey:    "client-key",
+		SharedSecret: "shared-secret",
+		BaseURL:      server.URL,
+	})
+}
+
+func TestServiceDesk(t *testing.T) {
+	var lastMethod, lastPath, lastQuery string
+	var lastBody map[string]interface{}
+
+	host := newTestHost(t, func(w http.ResponseWriter, r *http.Request) {
+		lastMethod, lastPath, lastQuery = r.Method, r.URL.EscapedPath(), r.URL.RawQuery
+		lastBody = nil
+		_ = json.NewDecoder(r.Body).Decode(&lastBody)
+		if r.Header.Get("Authorization") == "" {
+			t.Errorf("Expected Authorization header to be set")
+		}
+		if r.Header.Get(EXPERIMENTAL_API_HEADER) != EXPERIMENTAL_API_OPT_IN {
+			t.Errorf("Expected the experimental api opt-in header to be set")
+		}
+		switch r.URL.Path {
+		case "/rest/servicedeskapi/request/SD-1":
+			_, _ = w.Write([]byte(`{"issueId":"10001","issueKey":"SD-1","serviceDeskId":"1","currentStatus":{"status":"Waiting for support"}}`))
+		case "/rest/servicedeskapi/servicedesk/1/queue":
+			_, _ = w.Write([]byte(`{"size":1,"isLastPage":true,"values":[{"id":"2","name":"Open","issueCount":3}]}`))
+		case "/rest/servicedeskapi/organization":
+			if r.Method == http.MethodPost {
+				_, _ = w.Write([]byte(`{"id":"7","name":"Example"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"size":1,"isLastPage":true,"values":[{"id":"7","name":"Example"}]}`))
+		case "/rest/servicedeskapi/request/SD-2":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	sd := New(host)
+
+	request, err := sd.GetRequest(context.Background(), "SD-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.IssueKey != "SD-1" || request.CurrentStatus.Status != "Waiting for support" {
+		t.Errorf("Expected the request SD-1 waiting for support, but got %+v", request)
+	}
+
+	queues, err := sd.GetQueues(context.Background(), "1", true, Page{Start: 50, Limit: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(queues.Values, []Queue{{Id: "2", Name: "Open", IssueCount: 3}}) || !queues.IsLastPage {
+		t.Errorf("Expected the last page with one queue, but got %+v", queues)
+	}
+	if lastQuery != "includeCount=true&limit=25&start=50" {
+		t.Errorf("Expected query to be %s, but got %s", "includeCount=true&limit=25&start=50", lastQuery)
+	}
+
+	organizations, err := sd.GetOrganizations(context.Background(), Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(organizations.Values, []Organization{{Id: "7", Name: "Example"}}) || lastQuery != "" {
+		t.Errorf("Expected one organization without paging, but got %+v and query %s", organizations.Values, lastQuery)
+	}
+
+	if _, err = sd.GetRequest(context.Background(), "SD-2"); err == nil {
+		t.Errorf("Expected an error for a missing request")
+	}
+
+	testCases := []struct {
+		call   func() error
+		method string
+		path   string
+		body   map[string]interface{}
+	}{
+		{
+			call: func() error {
+				_, err := sd.CreateRequest(context.Background(), CreateRequest{
+					ServiceDeskId:      "1",
+					RequestTypeId:      "5",
+					RequestFieldValues: map[string]interface{}{"summary": "Help"},
+				})
+				return err
+			},
+			method: http.MethodPost,
+			path:   "/rest/servicedeskapi/request",
+			body:   map[string]interface{}{"serviceDeskId": "1", "requestTypeId": "5", "requestFieldValues": map[string]interface{}{"summary": "Help"}},
+		},
+		{
+			call: func() error {
+				_, err := sd.CreateOrganization(context.Background(), "Example")
+				return err
+			},
+			method: http.MethodPost,
+			path:   "/rest/servicedeskapi/organization",
+			body:   map[string]interface{}{"name": "Example"},
+		},
+		{
+			call:   func() error { return sd.AddOrganizationUsers(context.Background(), "7", "account-1", "account-2") },
+			method: http.MethodPost,
+			path:   "/rest/servicedeskapi/organization/7/user",
+			body:   map[string]interface{}{"accountIds": []interface{}{"account-1", "account-2"}},
+		},
+		{
+			call:   func() error { return sd.AddOrganizationUsers(context.Background(), "7/../8?", "account-1") },
+			method: http.MethodPost,
+			path:   "/rest/servicedeskapi/organization/7%2F..%2F8%3F/user",
+			body:   map[string]interface{}{"accountIds": []interface{}{"account-1"}},
+		},
+		{
+			call:   func() error { return sd.RemoveOrganizationUsers(context.Background(), "7", "account-1") },
+			method: http.MethodDelete,
+			path:   "/rest/servicedeskapi/organization/7/user",
+			body:   map[string]interface{}{"accountIds": []interface{}{"account-1"}},
+		},
+		{
+			call:   func() error { return sd.AddServiceDeskOrganization(context.Background(), "1", 7) },
+			method: http.MethodPost,
+			path:   "/rest/servicedeskapi/servicedesk/1/organization",
+			body:   map[string]interface{}{"organizationId": float64(7)},
+		},
+	}
+
+	for _, testCase := range testCases {
+		if err := testCase.call(); err != nil {
+			t.Error(err)
+			continue
+		}
+		if lastMethod != testCase.method || lastPath != testCase.path {
+			t.Errorf("Expected %s %s, but got %s %s", testCase.method, testCase.path, lastMethod, lastPath)
+		}
+		if !cmp.Equal(lastBody, testCase.body) {
+			t.Errorf("Expected body to be %+v, but got %+v", testCase.body, lastBody)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package gonnect
+
+import (
+	"errors"
+)
+
+// DevProfile is the profile of local development, the default profile of the
+// config file
+const DevProfile = "dev"
+
+// ErrVerificationDisabledOutsideDev is returned for profiles disabling the
+// session token verification outside of local development
+var ErrVerificationDisabledOutsideDev = errors.New("session token verification can only be disabled in the dev profile or with the dev tunnel or dev install enabled")
+
+// Development reports whether currentProfile with p is a local development
+// setup, the dev profile or one with the dev tunnel or dev install enabled
+func (p *Profile) Development(currentProfile string) bool {
+	if currentProfile == DevProfile {
+		return true
+	}
+	return p != nil && (p.DevTunnel != nil && p.DevTunnel.Enabled || p.DevInstall != nil && p.DevInstall.Enabled)
+}
+
+// ValidateSessionTokens refuses to disable the session token verification
+// outside of local development, any token route would be served without
+// authentication
+func (p *Profile) ValidateSessionTokens(currentProfile string) error {
+	if p == nil || p.SessionTokens == nil || !p.SessionTokens.DisableVerification {
+		return nil
+	}
+	if !p.Development(currentProfile) {
+		return ErrVerificationDisabledOutsideDev
+	}
+	return nil
+}
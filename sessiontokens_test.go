@@ -0,0 +1,46 @@
+package gonnect
+
+import (
+	"testing"
+)
+
+func TestValidateSessionTokens(t *testing.T) {
+	testCases := []struct {
+		name           string
+		currentProfile string
+		disabled       bool
+		devTunnel      bool
+		devInstall     bool
+		expectedError  error
+	}{
+		{name: "verified", currentProfile: "production"},
+		{name: "disabled in production", currentProfile: "production", disabled: true, expectedError: ErrVerificationDisabledOutsideDev},
+		{name: "disabled in dev", currentProfile: DevProfile, disabled: true},
+		{name: "disabled with dev tunnel", currentProfile: "staging", disabled: true, devTunnel: true},
+		{name: "disabled with dev install", currentProfile: "staging", disabled: true, devInstall: true},
+	}
+	for _, testCase := range testCases {
+		profile := NewProfile("https://addon.example.com", "", "", false)
+		profile.SessionTokens = &SessionTokenConfiguration{DisableVerification: testCase.disabled}
+		profile.DevTunnel = &DevTunnelConfiguration{Enabled: testCase.devTunnel}
+		profile.DevInstall = &DevInstallConfiguration{Enabled: testCase.devInstall}
+
+		if err := profile.ValidateSessionTokens(testCase.currentProfile); err != testCase.expectedError {
+			t.Errorf("%s: Expected the error %v, but got %v", testCase.name, testCase.expectedError, err)
+		}
+	}
+}
+
+func TestStartupReportDisabledVerification(t *testing.T) {
+	profile := NewProfile("https://addon.example.com", "", "", false)
+	profile.SessionTokens = &SessionTokenConfiguration{DisableVerification: true}
+	addon := &Addon{Config: profile, CurrentProfile: DevProfile}
+
+	found := false
+	for _, subsystem := range addon.StartupReport(nil).Subsystems {
+		found = found || subsystem == "session token verification disabled"
+	}
+	if !found {
+		t.Errorf("Expected the disabled verification in the startup report, but got %v", addon.StartupReport(nil).Subsystems)
+	}
+}
@@ -0,0 +1,32 @@
+package gonnect
+
+import (
+	"testing"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+func TestNewCustomAddonSingleTenant(t *testing.T) {
+	profile := NewProfile("https://addon.example.com", "", "", false)
+	profile.SingleTenant = &SingleTenantConfiguration{ClientKey: "client-key", SharedSecret: "secret", BaseUrl: "https://example.atlassian.net"}
+
+	addon, err := NewCustomAddon(profile, "test", map[string]interface{}{"key": "addon", "name": "Addon"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := addon.Store.(*store.StaticStore); !ok {
+		t.Fatalf("Expected a static store in single tenant mode, but got %T", addon.Store)
+	}
+	tenant, err := addon.Store.Get("client-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.BaseURL != "https://example.atlassian.net" {
+		t.Errorf("Expected the configured base url, but got %s", tenant.BaseURL)
+	}
+
+	profile.SingleTenant.SharedSecret = ""
+	if _, err = NewCustomAddon(profile, "test", map[string]interface{}{"key": "addon", "name": "Addon"}, nil); err == nil {
+		t.Errorf("Expected an error for an incomplete single tenant")
+	}
+}
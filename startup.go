@@ -0,0 +1,224 @@
+package gonnect
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// StartupReport is the resolved configuration of the add-on with its
+// secrets redacted, for debugging misconfigured deployments
+type StartupReport struct {
+	Profile string `json:"profile"`
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	BaseUrl string `json:"baseUrl"`
+	// Store is the backend of the tenants, database urls without their
+	// password
+	Store         string `json:"store"`
+	SignedInstall bool   `json:"signedInstall"`
+	// Routes are the registered routes, usually routes.RegisteredRoutes
+	Routes []string `json:"routes,omitempty"`
+	// Subsystems are the enabled optional features with a short summary of
+	// their configuration
+	Subsystems   []string `json:"subsystems,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+	Products     []string `json:"products,omitempty"`
+}
+
+var (
+	// dsnPassword is the password of keyword/value DSNs, quoted when it holds
+	// spaces, e.g. password='hun ter2'
+	dsnPassword = regexp.MustCompile(`(?i)(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+	// mysqlPassword is the password of MySQL DSNs, user:password@tcp(host)/db
+	mysqlPassword = regexp.MustCompile(`^([^:@/]*:)(.*)@(\w*(?:\([^)]*\))?/.*)$`)
+)
+
+// redactDatabaseUrl removes the password of url, MySQL and keyword/value DSNs
+func redactDatabaseUrl(databaseUrl string) string {
+	if u, err := url.Parse(databaseUrl); err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+	if mysqlPassword.MatchString(databaseUrl) {
+		return mysqlPassword.ReplaceAllString(databaseUrl, "${1}xxxxx@${3}")
+	}
+	return dsnPassword.ReplaceAllString(databaseUrl, "${1}xxxxx")
+}
+
+// StartupReport returns the resolved configuration of a, routes are the
+// registered routes
+func (a *Addon) StartupReport(routes []string) StartupReport {
+	report := StartupReport{
+		Profile: a.CurrentProfile,
+		Routes:  append([]string(nil), routes...),
+	}
+	if a.Key != nil {
+		report.Key = *a.Key
+	}
+	if a.Name != nil {
+		report.Name = *a.Name
+	}
+	report.Products = a.Products()
+
+	p := a.Config
+	if p == nil {
+		p = &Profile{}
+	}
+	report.BaseUrl = p.BaseUrl
+	report.SignedInstall = p.SignedInstall
+	switch {
+	case p.SingleTenant != nil:
+		report.Store = "single tenant " + p.SingleTenant.ClientKey
+	case p.Store.Type != "":
+		report.Store = strings.TrimSpace(p.Store.Type + " " + redactDatabaseUrl(p.Store.DatabaseUrl))
+	case a.Store != nil:
+		report.Store = fmt.Sprintf("%T", a.Store)
+	}
+	for _, env := range p.Environments {
+		report.Environments = append(report.Environments, env.Host+" "+env.BaseUrl)
+	}
+
+	enabled := func(name, format string, argv ...interface{}) {
+		if format != "" {
+			name += ": " + fmt.Sprintf(format, argv...)
+		}
+		report.Subsystems = append(report.Subsystems, name)
+	}
+	if p.InstallKeys.Pinned() {
+		enabled("pinned install keys", "%d key ids, %d public keys", len(p.InstallKeys.PinnedKeyIds), len(p.InstallKeys.PinnedPublicKeys))
+	}
+	if p.InstallKeys != nil && p.InstallKeys.Offline {
+		enabled("offline install keys", "%s", p.InstallKeys.BundlePath)
+	}
+	if p.InstallHosts != nil && p.InstallHosts.AllowInsecure {
+		enabled("insecure install base urls", "")
+	}
+	if p.InstallHosts != nil && p.InstallHosts.Allowlist {
+		hosts := p.InstallHosts.AllowedHosts
+		if len(hosts) == 0 {
+			hosts = DefaultInstallHosts
+		}
+		enabled("install host allowlist", "%s", strings.Join(hosts, ", "))
+	}
+	if p.Ephemeral() {
+		enabled("ephemeral tenants", "ttl %v", p.EphemeralTenants.TTL)
+	}
+	if p.LatencyBudgets != nil {
+		enabled("latency budgets", "default %v, %d routes, auth %v", p.LatencyBudgets.Default, len(p.LatencyBudgets.Routes), p.LatencyBudgets.Auth)
+	}
+	if p.LifecycleIPs != nil && p.LifecycleIPs.Enabled {
+		enabled("lifecycle IP ranges", "%d extra ranges", len(p.LifecycleIPs.ExtraRanges))
+	}
+	if p.AuthTimeout > 0 {
+		enabled("auth timeout", "%v", p.AuthTimeout)
+	}
+	if p.ValidateContextParams {
+		enabled("context parameter validation", "")
+	}
+	if p.StrictTokenSources {
+		enabled("strict token sources", "")
+	}
+	if p.TokenCookie != "" {
+		enabled("token cookie", "%s", p.TokenCookie)
+	}
+	if p.SessionTokens != nil && p.SessionTokens.DisableVerification {
+		enabled("session token verification disabled", "")
+	}
+	if p.SessionTokens != nil && p.SessionTokens.SigningKey != "" {
+		algorithm := p.SessionTokens.SigningAlgorithm
+		if algorithm == "" {
+			algorithm = "HS256"
+		}
+		enabled("session signing key", "%s", algorithm)
+	}
+	if p.InternalTokens != nil {
+		enabled("internal tokens", "%d secrets", len(p.InternalTokens.Secrets))
+	}
+	if p.FIPS() {
+		enabled("FIPS", "")
+	}
+	if p.DebugJWT {
+		enabled("JWT debugging", "")
+	}
+	if p.AuthTrace != nil && p.AuthTrace.Enabled {
+		enabled("auth trace", "%d tenants", len(p.AuthTrace.ClientKeys))
+	}
+	if p.HostCallAudit != nil && p.HostCallAudit.Enabled {
+		enabled("host call audit", "sample rate %v", p.HostCallAudit.SampleRate)
+	}
+	if len(p.Notifications) > 0 || a.Notifier != nil {
+		enabled("notifications", "%d targets", len(p.Notifications))
+	}
+	if p.Admin != nil || a.AdminAuth != nil {
+		enabled("admin auth", "")
+	}
+	if p.DevTunnel != nil && p.DevTunnel.Enabled {
+		enabled("dev tunnel", "%s", p.DevTunnel.Provider)
+	}
+	if p.DevInstall != nil && p.DevInstall.Enabled {
+		enabled("dev install", "%s", p.DevInstall.SiteUrl)
+	}
+	if a.Translations != nil {
+		enabled("translations", "")
+	}
+	if a.Entitlements != nil {
+		enabled("entitlements", "")
+	}
+	if a.Retention != nil {
+		enabled("retention", "")
+	}
+	if a.LifecycleRetries != nil {
+		enabled("lifecycle retries", "")
+	}
+	if a.SiteCollisionPolicy != CollisionKeepBoth {
+		enabled("site collision policy", "%v", a.SiteCollisionPolicy)
+	}
+	if a.UnknownTenantPolicy != UnknownTenantUnauthorized {
+		enabled("unknown tenant policy", "%v", a.UnknownTenantPolicy)
+	}
+	if a.IdentityLinker != nil {
+		enabled("identity linker", "")
+	}
+	if a.Impersonation != nil {
+		enabled("impersonation policy", "")
+	}
+	sort.Strings(report.Subsystems)
+	return report
+}
+
+// Lines returns the report formatted for the log, one setting per line
+func (r StartupReport) Lines() []string {
+	lines := []string{
+		fmt.Sprintf("add-on %s (%s), profile %q", r.Key, r.Name, r.Profile),
+		"base url: " + r.BaseUrl,
+		"store: " + r.Store,
+		fmt.Sprintf("signed install: %v", r.SignedInstall),
+	}
+	list := func(name string, values []string) {
+		if len(values) == 0 {
+			lines = append(lines, name+": none")
+			return
+		}
+		lines = append(lines, name+":")
+		for _, value := range values {
+			lines = append(lines, "  "+value)
+		}
+	}
+	list("products", r.Products)
+	list("environments", r.Environments)
+	list("subsystems", r.Subsystems)
+	list("routes", r.Routes)
+	return lines
+}
+
+// LogStartupReport logs the StartupReport of a, typically with
+// routes.RegisteredRoutes once all routes are registered
+func (a *Addon) LogStartupReport(routes []string) {
+	for _, line := range a.StartupReport(routes).Lines() {
+		log.InfoF("%s", line)
+	}
+}
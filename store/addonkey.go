@@ -0,0 +1,17 @@
+package store
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 8,
+		Name:    "add tenant addon key",
+		Up: func(s *Store) error {
+			if s.introspect().HasColumn(&Tenant{}, "AddonKey") {
+				return nil
+			}
+			return s.migrator().AddColumn(&Tenant{}, "AddonKey")
+		},
+		Down: func(s *Store) error {
+			return s.migrator().DropColumn(&Tenant{}, "AddonKey")
+		},
+	})
+}
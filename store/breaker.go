@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+)
+
+// ErrUnavailable is returned by BreakerStore when a lookup timed out or while
+// its circuit is open
+var ErrUnavailable = errors.New("tenant store unavailable")
+
+// BreakerStore guards the lookups of its TenantStore used on the
+// authentication path with a timeout and a circuit breaker, so a hung
+// database fails requests fast instead of tying up all http workers. The
+// circuit opens after FailureThreshold consecutive failures and lets a single
+// probe through once CoolDown passed. Writes are not guarded. Wrap it in a
+// CachedStore with ServeStale to keep serving known tenants while it is
+// open.
+type BreakerStore struct {
+	TenantStore
+	// Timeout of a single lookup, lookups are not limited when zero
+	Timeout          time.Duration
+	FailureThreshold int
+	CoolDown         time.Duration
+	mutex            sync.Mutex
+	failures         int
+	openUntil        time.Time
+	probing          bool
+}
+
+func NewBreaker(s TenantStore, timeout time.Duration, failureThreshold int, coolDown time.Duration) *BreakerStore {
+	return &BreakerStore{
+		TenantStore:      s,
+		Timeout:          timeout,
+		FailureThreshold: failureThreshold,
+		CoolDown:         coolDown,
+	}
+}
+
+// allow reports whether a call may be made, letting a single probe through
+// an open circuit once the cool down passed
+func (s *BreakerStore) allow() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.openUntil.IsZero() {
+		return true
+	}
+	if s.probing || time.Now().Before(s.openUntil) {
+		return false
+	}
+	s.probing = true
+	return true
+}
+
+func (s *BreakerStore) record(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.probing = false
+	if err == nil || isNotFound(err) {
+		if !s.openUntil.IsZero() {
+			log.InfoF("tenant store circuit closed")
+			metrics.Set("tenant_store_circuit_open", 0)
+		}
+		s.failures, s.openUntil = 0, time.Time{}
+		return
+	}
+	s.failures++
+	if s.FailureThreshold > 0 && s.failures >= s.FailureThreshold {
+		if s.openUntil.IsZero() {
+			log.ErrorF("tenant store circuit opened after %d failures: %v", s.failures, err)
+			metrics.Set("tenant_store_circuit_open", 1)
+		}
+		s.openUntil = time.Now().Add(s.CoolDown)
+	}
+}
+
+// call runs fn through the circuit breaker, fn keeps running in the
+// background when it exceeds the timeout
+func (s *BreakerStore) call(fn func() error) error {
+	if !s.allow() {
+		return fmt.Errorf("%w: circuit open", ErrUnavailable)
+	}
+	var err error
+	if s.Timeout <= 0 {
+		err = fn()
+	} else {
+		done := make(chan error, 1)
+		go func() { done <- fn() }()
+		timer := time.NewTimer(s.Timeout)
+		select {
+		case err = <-done:
+			timer.Stop()
+		case <-timer.C:
+			metrics.Add("tenant_store_timeouts", 1)
+			err = fmt.Errorf("%w: lookup timed out after %v", ErrUnavailable, s.Timeout)
+		}
+	}
+	s.record(err)
+	return err
+}
+
+func (s *BreakerStore) Get(clientKey string) (*Tenant, error) {
+	var found *Tenant
+	if err := s.call(func() (e error) {
+		found, e = s.TenantStore.Get(clientKey)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (s *BreakerStore) GetByUrl(url string) (*Tenant, error) {
+	var found *Tenant
+	if err := s.call(func() (e error) {
+		found, e = s.TenantStore.GetByUrl(url)
+		return
+	}); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (s *BreakerStore) Touch(tenant *Tenant, at time.Time) error {
+	return s.call(func() error {
+		return Touch(s.TenantStore, tenant, at)
+	})
+}
+
+// WithTx runs fn within a transaction of the store, calls within it are not
+// guarded
+func (s *BreakerStore) WithTx(ctx context.Context, fn func(tx TenantStore) error) error {
+	return WithTx(ctx, s.TenantStore, fn)
+}
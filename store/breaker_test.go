@@ -0,0 +1,51 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// hangingStore blocks every lookup until release is closed
+type hangingStore struct {
+	TenantStore
+	release chan struct{}
+}
+
+func (s *hangingStore) Get(clientKey string) (*Tenant, error) {
+	<-s.release
+	return s.TenantStore.Get(clientKey)
+}
+
+func TestBreakerStore(t *testing.T) {
+	backend := &hangingStore{TenantStore: newMemoryStore(t), release: make(chan struct{})}
+	if _, err := backend.Set(&Tenant{ClientKey: "key", SharedSecret: "secret", BaseURL: "https://example.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+	breaker := NewBreaker(backend, 10*time.Millisecond, 2, 50*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.Get("key"); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("Expected lookup %d to time out, but got %v", i, err)
+		}
+	}
+	started := time.Now()
+	if _, err := breaker.Get("key"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Expected the open circuit to reject the lookup, but got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed >= 10*time.Millisecond {
+		t.Errorf("Expected the open circuit to fail fast, but it took %v", elapsed)
+	}
+
+	close(backend.release)
+	time.Sleep(60 * time.Millisecond)
+	if tenant, err := breaker.Get("key"); err != nil || tenant.SharedSecret != "secret" {
+		t.Fatalf("Expected the probe to close the circuit, but got %+v (%v)", tenant, err)
+	}
+	if _, err := breaker.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound to pass through, but got %v", err)
+	}
+	if _, err := breaker.Get("key"); err != nil {
+		t.Errorf("Expected not found lookups to keep the circuit closed, but got %v", err)
+	}
+}
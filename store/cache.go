@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+)
+
+type cachedTenant struct {
+	tenant  Tenant
+	expires time.Time
+}
+
+// CachedStore keeps the tenants read from its TenantStore in memory for TTL.
+// With ServeStale, a cached tenant is returned even after it expired when the
+// store fails to look it up, so that short database outages do not fail the
+// authentication of every request. Such reads are counted by the
+// tenant_store_degraded_reads metric.
+type CachedStore struct {
+	TenantStore
+	TTL        time.Duration
+	ServeStale bool
+	mutex      sync.RWMutex
+	entries    map[string]cachedTenant
+	// byUrl maps the baseUrls of the entries to their clientKeys
+	byUrl map[string]string
+}
+
+func NewCached(s TenantStore, ttl time.Duration, serveStale bool) *CachedStore {
+	return &CachedStore{
+		TenantStore: s,
+		TTL:         ttl,
+		ServeStale:  serveStale,
+		entries:     make(map[string]cachedTenant),
+		byUrl:       make(map[string]string),
+	}
+}
+
+// cached returns a copy of the cached tenant of clientKey and whether it is
+// still fresh
+func (s *CachedStore) cached(clientKey string) (tenant *Tenant, fresh bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.entry(clientKey)
+}
+
+// cachedByUrl returns a copy of the cached tenant of the baseUrl and whether
+// it is still fresh
+func (s *CachedStore) cachedByUrl(url string) (tenant *Tenant, fresh bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if clientKey, ok := s.byUrl[url]; ok {
+		return s.entry(clientKey)
+	}
+	return nil, false
+}
+
+func (s *CachedStore) entry(clientKey string) (*Tenant, bool) {
+	entry, ok := s.entries[clientKey]
+	if !ok {
+		return nil, false
+	}
+	copied := entry.tenant
+	return &copied, time.Now().Before(entry.expires)
+}
+
+func (s *CachedStore) remember(tenant *Tenant) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.drop(tenant.ClientKey)
+	s.entries[tenant.ClientKey] = cachedTenant{tenant: *tenant, expires: time.Now().Add(s.TTL)}
+	s.byUrl[tenant.BaseURL] = tenant.ClientKey
+}
+
+func (s *CachedStore) forget(clientKey string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.drop(clientKey)
+}
+
+// drop removes the entry of clientKey and its baseUrl, unless the baseUrl
+// was taken over by another entry
+func (s *CachedStore) drop(clientKey string) {
+	if entry, ok := s.entries[clientKey]; ok && s.byUrl[entry.tenant.BaseURL] == clientKey {
+		delete(s.byUrl, entry.tenant.BaseURL)
+	}
+	delete(s.entries, clientKey)
+}
+
+func (s *CachedStore) lookup(key string, cached *Tenant, fresh bool, get func() (*Tenant, error)) (*Tenant, error) {
+	if fresh {
+		return cached, nil
+	}
+	tenant, err := get()
+	if err == nil {
+		s.remember(tenant)
+		return tenant, nil
+	}
+	if isNotFound(err) {
+		if cached != nil {
+			s.forget(cached.ClientKey)
+		}
+		return nil, err
+	}
+	if s.ServeStale && cached != nil {
+		log.WarnF("serving cached tenant %s while the tenant store fails: %v", key, err)
+		metrics.Add("tenant_store_degraded_reads", 1)
+		return cached, nil
+	}
+	return nil, err
+}
+
+func (s *CachedStore) Get(clientKey string) (*Tenant, error) {
+	cached, fresh := s.cached(clientKey)
+	return s.lookup(clientKey, cached, fresh, func() (*Tenant, error) {
+		return s.TenantStore.Get(clientKey)
+	})
+}
+
+func (s *CachedStore) GetByUrl(url string) (*Tenant, error) {
+	cached, fresh := s.cachedByUrl(url)
+	return s.lookup(url, cached, fresh, func() (*Tenant, error) {
+		return s.TenantStore.GetByUrl(url)
+	})
+}
+
+// Set writes the tenant to the store, the cached copy is dropped as the
+// store may merge a partial update. It is dropped again once written, a
+// concurrent lookup may have cached the previous tenant meanwhile
+func (s *CachedStore) Set(tenant *Tenant) (*Tenant, error) {
+	s.forget(tenant.ClientKey)
+	defer s.forget(tenant.ClientKey)
+	return s.TenantStore.Set(tenant)
+}
+
+func (s *CachedStore) Delete(clientKey string) error {
+	s.forget(clientKey)
+	defer s.forget(clientKey)
+	return s.TenantStore.Delete(clientKey)
+}
+
+// cachedTx reads and writes within a transaction of the cached store,
+// bypassing the cache, and records the tenants written
+type cachedTx struct {
+	TenantStore
+	written []string
+}
+
+func (t *cachedTx) Set(tenant *Tenant) (*Tenant, error) {
+	t.written = append(t.written, tenant.ClientKey)
+	return t.TenantStore.Set(tenant)
+}
+
+func (t *cachedTx) Delete(clientKey string) error {
+	t.written = append(t.written, clientKey)
+	return t.TenantStore.Delete(clientKey)
+}
+
+// WithTx runs fn within a transaction of the store, tenants written within
+// it are dropped from the cache once it committed or rolled back, lookups
+// outside of the transaction see the previous tenants until then
+func (s *CachedStore) WithTx(ctx context.Context, fn func(tx TenantStore) error) error {
+	tx := &cachedTx{}
+	err := WithTx(ctx, s.TenantStore, func(ts TenantStore) error {
+		tx.TenantStore = ts
+		return fn(tx)
+	})
+	for _, clientKey := range tx.written {
+		s.forget(clientKey)
+	}
+	return err
+}
+
+func (s *CachedStore) Touch(tenant *Tenant, at time.Time) error {
+	return Touch(s.TenantStore, tenant, at)
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/metrics"
+)
+
+// failingStore fails every lookup while down is set
+type failingStore struct {
+	TenantStore
+	down bool
+}
+
+func (s *failingStore) Get(clientKey string) (*Tenant, error) {
+	if s.down {
+		return nil, errors.New("database unavailable")
+	}
+	return s.TenantStore.Get(clientKey)
+}
+
+func TestCachedStore(t *testing.T) {
+	backend := &failingStore{TenantStore: newMemoryStore(t)}
+	if _, err := backend.Set(&Tenant{ClientKey: "key", SharedSecret: "secret", BaseURL: "https://example.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, serveStale := range []bool{false, true} {
+		cached := NewCached(backend, -time.Second, serveStale)
+		backend.down = false
+		if _, err := cached.Get("key"); err != nil {
+			t.Fatal(err)
+		}
+
+		backend.down = true
+		degraded := metrics.Get("tenant_store_degraded_reads")
+		tenant, err := cached.Get("key")
+		if !serveStale {
+			if err == nil {
+				t.Errorf("Expected the store error without ServeStale, but got %+v", tenant)
+			}
+			continue
+		}
+		if err != nil || tenant.SharedSecret != "secret" {
+			t.Errorf("Expected the expired tenant to be served while the store fails, but got %+v (%v)", tenant, err)
+		}
+		if metrics.Get("tenant_store_degraded_reads") != degraded+1 {
+			t.Errorf("Expected the degraded read to be counted")
+		}
+		if _, err = cached.Get("unknown"); err == nil {
+			t.Errorf("Expected uncached tenants to fail while the store fails")
+		}
+	}
+}
+
+// countingStore counts the lookups reaching the store
+type countingStore struct {
+	TenantStore
+	lookups int
+}
+
+func (s *countingStore) Get(clientKey string) (*Tenant, error) {
+	s.lookups++
+	return s.TenantStore.Get(clientKey)
+}
+
+func (s *countingStore) GetByUrl(url string) (*Tenant, error) {
+	s.lookups++
+	return s.TenantStore.GetByUrl(url)
+}
+
+func TestCachedStoreByUrl(t *testing.T) {
+	backend := &countingStore{TenantStore: newMemoryStore(t)}
+	if _, err := backend.Set(&Tenant{ClientKey: "key", SharedSecret: "secret", BaseURL: "https://old.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+	cached := NewCached(backend, time.Minute, false)
+
+	testCases := []struct {
+		clientKey string
+		url       string
+		found     bool
+		lookups   int
+	}{
+		{clientKey: "key", found: true, lookups: 1},
+		{url: "https://old.atlassian.net", found: true, lookups: 0},
+		{clientKey: "key", found: true, lookups: 0},
+		{url: "https://unknown.atlassian.net", lookups: 1},
+	}
+	for _, testCase := range testCases {
+		backend.lookups = 0
+		var err error
+		if testCase.clientKey != "" {
+			_, err = cached.Get(testCase.clientKey)
+		} else {
+			_, err = cached.GetByUrl(testCase.url)
+		}
+		if (err == nil) != testCase.found || backend.lookups != testCase.lookups {
+			t.Errorf("Expected %s%s to be found %v with %d lookups, but got %v with %d", testCase.clientKey, testCase.url, testCase.found, testCase.lookups, err, backend.lookups)
+		}
+	}
+
+	// the previous baseUrl of a moved tenant is dropped from the cache
+	if _, err := cached.Set(&Tenant{ClientKey: "key", SharedSecret: "secret", BaseURL: "https://new.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if tenant, err := cached.GetByUrl("https://old.atlassian.net"); err == nil {
+		t.Errorf("Expected the previous baseUrl not to be found, but got %+v", tenant)
+	}
+	if tenant, err := cached.GetByUrl("https://new.atlassian.net"); err != nil || tenant.ClientKey != "key" {
+		t.Errorf("Expected the tenant at its new baseUrl, but got %+v (%v)", tenant, err)
+	}
+}
+
+// racingStore looks the tenant up through the cache while it is written, like
+// a concurrent request would
+type racingStore struct {
+	TenantStore
+	lookup func()
+}
+
+func (s *racingStore) Set(tenant *Tenant) (*Tenant, error) {
+	s.lookup()
+	return s.TenantStore.Set(tenant)
+}
+
+func (s *racingStore) Delete(clientKey string) error {
+	s.lookup()
+	return s.TenantStore.Delete(clientKey)
+}
+
+func (s *racingStore) WithTx(ctx context.Context, fn func(tx TenantStore) error) error {
+	return WithTx(ctx, s.TenantStore, func(tx TenantStore) error {
+		return fn(&racingStore{TenantStore: tx, lookup: s.lookup})
+	})
+}
+
+func TestCachedStoreConcurrentWrites(t *testing.T) {
+	backend := &racingStore{TenantStore: newMemoryStore(t)}
+	cached := NewCached(backend, time.Minute, false)
+	backend.lookup = func() { _, _ = cached.Get("key") }
+	if _, err := backend.TenantStore.Set(&Tenant{ClientKey: "key", SharedSecret: "first", BaseURL: "https://example.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		write    func() error
+		expected string
+	}{
+		{write: func() error {
+			_, err := cached.Set(&Tenant{ClientKey: "key", SharedSecret: "second"})
+			return err
+		}, expected: "second"},
+		{write: func() error {
+			return cached.WithTx(context.Background(), func(tx TenantStore) error {
+				_, err := tx.Set(&Tenant{ClientKey: "key", SharedSecret: "third"})
+				return err
+			})
+		}, expected: "third"},
+		{write: func() error { return cached.Delete("key") }},
+	}
+	for _, testCase := range testCases {
+		if err := testCase.write(); err != nil {
+			t.Fatal(err)
+		}
+		tenant, err := cached.Get("key")
+		if testCase.expected == "" {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected the deleted tenant not to be cached, but got %+v (%v)", tenant, err)
+			}
+			continue
+		}
+		if err != nil || tenant.SharedSecret != testCase.expected {
+			t.Errorf("Expected the secret %s, but got %+v (%v)", testCase.expected, tenant, err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package store
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 6,
+		Name:    "add tenant installed scopes and modules",
+		Up: func(s *Store) error {
+			for _, field := range []string{"InstalledScopes", "InstalledModules"} {
+				if s.introspect().HasColumn(&Tenant{}, field) {
+					continue
+				}
+				if err := s.migrator().AddColumn(&Tenant{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(s *Store) error {
+			for _, field := range []string{"InstalledModules", "InstalledScopes"} {
+				if err := s.migrator().DropColumn(&Tenant{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
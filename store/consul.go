@@ -0,0 +1,282 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+const (
+	DefaultConsulAddress = "http://127.0.0.1:8500"
+	DefaultConsulPrefix  = "atlas-gonnect/tenants"
+	consulMaxCasRetries  = 5
+)
+
+type ConsulConfig struct {
+	// Address of the consul agent, defaults to DefaultConsulAddress
+	Address string
+	// Prefix of all keys written by the store, defaults to
+	// DefaultConsulPrefix
+	Prefix     string
+	Token      string
+	Datacenter string
+	HttpClient *http.Client
+}
+
+// ConsulStore keeps tenants in the Consul KV store using its HTTP API. Every
+// tenant is stored as JSON below <prefix>/client/<clientKey> with a
+// <prefix>/url/<hash> index entry for lookups by base url. Writes use
+// check-and-set to avoid lost updates between replicas.
+type ConsulStore struct {
+	config ConsulConfig
+}
+
+func NewConsul(config ConsulConfig) *ConsulStore {
+	if config.Address == "" {
+		config.Address = DefaultConsulAddress
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultConsulPrefix
+	}
+	config.Address = strings.TrimRight(config.Address, "/")
+	config.Prefix = strings.Trim(config.Prefix, "/")
+	if config.HttpClient == nil {
+		config.HttpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &ConsulStore{config: config}
+}
+
+type consulPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+}
+
+func (s *ConsulStore) clientPath(clientKey string) string {
+	return s.config.Prefix + "/client/" + url.PathEscape(clientKey)
+}
+
+func (s *ConsulStore) urlPath(baseUrl string) string {
+	sum := sha256.Sum256([]byte(baseUrl))
+	return s.config.Prefix + "/url/" + hex.EncodeToString(sum[:])
+}
+
+func (s *ConsulStore) request(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if s.config.Datacenter != "" {
+		query.Set("dc", s.config.Datacenter)
+	}
+	uri := s.config.Address + "/v1/kv/" + key
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.config.Token != "" {
+		req.Header.Set("X-Consul-Token", s.config.Token)
+	}
+	return s.config.HttpClient.Do(req)
+}
+
+func (s *ConsulStore) get(key string) (*consulPair, error) {
+	res, err := s.request(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul get %s: %s", key, res.Status)
+	}
+	var pairs []consulPair
+	if err = json.NewDecoder(res.Body).Decode(&pairs); err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &pairs[0], nil
+}
+
+// put writes the value, using check-and-set when cas is not nil; a cas of
+// zero only succeeds if the key does not exist yet
+func (s *ConsulStore) put(key string, value []byte, cas *uint64) (bool, error) {
+	query := url.Values{}
+	if cas != nil {
+		query.Set("cas", strconv.FormatUint(*cas, 10))
+	}
+	res, err := s.request(http.MethodPut, key, query, value)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	data, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("consul put %s: %s", key, res.Status)
+	}
+	return strings.TrimSpace(string(data)) == "true", nil
+}
+
+func (s *ConsulStore) delete(key string) error {
+	res, err := s.request(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul delete %s: %s", key, res.Status)
+	}
+	return nil
+}
+
+func decodeRecord(value []byte) (*Tenant, error) {
+	var record fileRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, err
+	}
+	return record.tenant(), nil
+}
+
+func encodeRecord(tenant *Tenant) ([]byte, error) {
+	return json.Marshal(newFileRecord(tenant))
+}
+
+func (s *ConsulStore) Get(clientKey string) (*Tenant, error) {
+	pair, err := s.get(s.clientPath(clientKey))
+	if err != nil {
+		return nil, err
+	}
+	return decodeRecord(pair.Value)
+}
+
+func (s *ConsulStore) GetByUrl(baseUrl string) (*Tenant, error) {
+	pair, err := s.get(s.urlPath(baseUrl))
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := s.Get(string(pair.Value))
+	if err != nil {
+		return nil, err
+	}
+	if tenant.BaseURL != baseUrl {
+		// stale index entry, the tenant moved to another url
+		return nil, ErrNotFound
+	}
+	return tenant, nil
+}
+
+// modify applies fn to the current record using check-and-set, retrying if
+// the record was changed concurrently
+func (s *ConsulStore) modify(clientKey string, fn func(existing *Tenant) (*Tenant, error)) (stored *Tenant, err error) {
+	key := s.clientPath(clientKey)
+	for attempt := 0; attempt < consulMaxCasRetries; attempt++ {
+		var existing *Tenant
+		cas := uint64(0)
+		pair, e := s.get(key)
+		if e == nil {
+			if existing, err = decodeRecord(pair.Value); err != nil {
+				return
+			}
+			cas = pair.ModifyIndex
+		} else if !isNotFound(e) {
+			return nil, e
+		}
+
+		if stored, err = fn(existing); err != nil {
+			return
+		}
+		var value []byte
+		if value, err = encodeRecord(stored); err != nil {
+			return
+		}
+		var ok bool
+		if ok, err = s.put(key, value, &cas); err != nil {
+			return
+		} else if ok {
+			return
+		}
+		log.DebugF("consul tenant %s changed concurrently, retrying", clientKey)
+	}
+	return nil, fmt.Errorf("could not update tenant %s: too many concurrent modifications", clientKey)
+}
+
+func (s *ConsulStore) Set(tenant *Tenant) (*Tenant, error) {
+	var previousUrl string
+	stored, err := s.modify(tenant.ClientKey, func(existing *Tenant) (*Tenant, error) {
+		now := time.Now()
+		if existing == nil {
+			copied := *tenant
+			copied.CreatedAt = now
+			existing = &copied
+		} else {
+			previousUrl = existing.BaseURL
+			existing.merge(tenant)
+		}
+		existing.UpdatedAt = now
+		return existing, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if previousUrl != stored.BaseURL {
+		if _, err = s.put(s.urlPath(stored.BaseURL), []byte(stored.ClientKey), nil); err != nil {
+			return nil, err
+		}
+		if previousUrl != "" {
+			if err = s.delete(s.urlPath(previousUrl)); err != nil {
+				log.WarnF("could not remove stale consul url index of tenant %s: %v", stored.ClientKey, err)
+			}
+		}
+	}
+	tenant.CreatedAt, tenant.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+	return tenant, nil
+}
+
+func (s *ConsulStore) Delete(clientKey string) error {
+	tenant, err := s.Get(clientKey)
+	if err != nil {
+		return err
+	}
+	log.WarnF("deleting tenant with clientKey %s from consul", clientKey)
+	if err = s.delete(s.clientPath(clientKey)); err != nil {
+		return err
+	}
+	if pair, err := s.get(s.urlPath(tenant.BaseURL)); err == nil && string(pair.Value) == clientKey {
+		return s.delete(s.urlPath(tenant.BaseURL))
+	}
+	return nil
+}
+
+func (s *ConsulStore) Touch(tenant *Tenant, at time.Time) error {
+	if tenant.LastSeenAt != nil && at.Sub(*tenant.LastSeenAt) < TouchInterval {
+		return nil
+	}
+	_, err := s.modify(tenant.ClientKey, func(existing *Tenant) (*Tenant, error) {
+		if existing == nil {
+			return nil, ErrNotFound
+		}
+		existing.LastSeenAt = &at
+		return existing, nil
+	})
+	if err == nil {
+		tenant.LastSeenAt = &at
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeConsul implements the subset of the consul KV api used by ConsulStore
+type fakeConsul struct {
+	sync.Mutex
+	index  uint64
+	values map[string]consulPair
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	key := strings.TrimPrefix(r.URL.EscapedPath(), "/v1/kv/")
+	switch r.Method {
+	case http.MethodGet:
+		pair, ok := f.values[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]consulPair{pair})
+	case http.MethodPut:
+		if cas := r.URL.Query().Get("cas"); cas != "" {
+			expected, _ := strconv.ParseUint(cas, 10, 64)
+			if f.values[key].ModifyIndex != expected {
+				_, _ = w.Write([]byte("false"))
+				return
+			}
+		}
+		value, _ := ioutil.ReadAll(r.Body)
+		f.index += 1
+		f.values[key] = consulPair{Key: key, Value: value, ModifyIndex: f.index}
+		_, _ = w.Write([]byte("true"))
+	case http.MethodDelete:
+		delete(f.values, key)
+		_, _ = w.Write([]byte("true"))
+	}
+}
+
+func TestConsulStore(t *testing.T) {
+	server := httptest.NewServer(&fakeConsul{values: map[string]consulPair{}})
+	defer server.Close()
+
+	s := NewConsul(ConsulConfig{Address: server.URL})
+
+	if _, err := s.Set(&Tenant{ClientKey: "client/key", SharedSecret: "secret", BaseURL: "https://old.atlassian.net", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Set(&Tenant{ClientKey: "client/key", BaseURL: "https://new.atlassian.net", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		lookup   func() (*Tenant, error)
+		notFound bool
+	}{
+		{lookup: func() (*Tenant, error) { return s.Get("client/key") }},
+		{lookup: func() (*Tenant, error) { return s.GetByUrl("https://new.atlassian.net") }},
+		{lookup: func() (*Tenant, error) { return s.GetByUrl("https://old.atlassian.net") }, notFound: true},
+		{lookup: func() (*Tenant, error) { return s.Get("unknown") }, notFound: true},
+	}
+
+	for idx, testCase := range testCases {
+		tenant, err := testCase.lookup()
+		if testCase.notFound {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected lookup %d to return ErrNotFound, but got %v", idx, err)
+			}
+			continue
+		}
+		if err != nil || tenant.SharedSecret != "secret" || !tenant.AddonInstalled {
+			t.Errorf("Expected lookup %d to return the merged tenant, but got %+v (%v)", idx, tenant, err)
+		}
+	}
+
+	if _, err := s.Set(&Tenant{ClientKey: "client/key", SharedSecret: "rotated"}); err != nil {
+		t.Fatal(err)
+	}
+	if tenant, err := s.Get("client/key"); err != nil || tenant.SecretRotatedAt == nil {
+		t.Errorf("Expected the rotation of the secret to be stored, but got %+v (%v)", tenant, err)
+	}
+
+	if err := s.Delete("client/key"); err != nil {
+		t.Error(err)
+	}
+	if _, err := s.GetByUrl("https://new.atlassian.net"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected url index to be removed with the tenant, but got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 10,
+		Name:    "create tenant deletion schedule table",
+		Up: func(s *Store) error {
+			return s.Database.Table(s.DeletionTableName()).AutoMigrate(&DeletionRecord{})
+		},
+		Down: func(s *Store) error {
+			return s.Database.Migrator().DropTable(s.DeletionTableName())
+		},
+	})
+}
+
+// DeletionRecord schedules the deletion of an uninstalled tenant and its
+// application data once DueAt passed
+type DeletionRecord struct {
+	ClientKey   string `gorm:"type:varchar(255);primaryKey"`
+	ScheduledAt time.Time
+	DueAt       time.Time `gorm:"index"`
+}
+
+// DeletionScheduler is implemented by stores which can keep the deletion
+// schedule of uninstalled tenants
+type DeletionScheduler interface {
+	// ScheduleDeletion schedules or reschedules the deletion of the tenant
+	ScheduleDeletion(clientKey string, due time.Time) error
+	// CancelDeletion removes the tenant from the schedule, e.g. when it was
+	// installed again
+	CancelDeletion(clientKey string) error
+	// DueDeletions returns the deletions due at now, oldest first
+	DueDeletions(now time.Time) ([]DeletionRecord, error)
+}
+
+// DeletionTableName returns the name of the table holding the deletion
+// schedule
+func (s *Store) DeletionTableName() string {
+	return s.TableName() + "_deletions"
+}
+
+func (s *Store) deletionTx() *gorm.DB {
+	return s.Database.Table(s.DeletionTableName())
+}
+
+func (s *Store) ScheduleDeletion(clientKey string, due time.Time) error {
+	return s.deletionTx().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "client_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scheduled_at", "due_at"}),
+	}).Create(&DeletionRecord{ClientKey: clientKey, ScheduledAt: time.Now().UTC(), DueAt: due.UTC()}).Error
+}
+
+func (s *Store) CancelDeletion(clientKey string) error {
+	return s.deletionTx().Where("client_key = ?", clientKey).Delete(&DeletionRecord{}).Error
+}
+
+func (s *Store) DueDeletions(now time.Time) (due []DeletionRecord, err error) {
+	err = s.deletionTx().Where("due_at <= ?", now.UTC()).Order("due_at").Find(&due).Error
+	return
+}
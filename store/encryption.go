@@ -0,0 +1,199 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	encryptedPrefix     = "enc:v1:"
+	encryptedContextKey = "$gonnectEncrypted"
+)
+
+// KeyProvider supplies the AES keys used to encrypt tenant columns at rest,
+// keys must be 16, 24 or 32 bytes long
+type KeyProvider interface {
+	// CurrentKey returns the id and key used to encrypt new values
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the given id for decrypting stored values
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider backed by a fixed set of keys, old keys are
+// kept in Keys so values encrypted before a rotation remain readable
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (k StaticKeys) CurrentKey() (id string, key []byte, err error) {
+	key, err = k.Key(k.Current)
+	return k.Current, key, err
+}
+
+func (k StaticKeys) Key(id string) ([]byte, error) {
+	if key, ok := k.Keys[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown encryption key %q", id)
+}
+
+// Encryption configures which tenant columns are encrypted at rest. The
+// SharedSecret is always encrypted, the installation Context only when
+// Context is set. Plaintext values written before encryption was enabled are
+// read as is and encrypted on their next update.
+type Encryption struct {
+	Keys    KeyProvider
+	Context bool
+	// NewAEAD returns the cipher sealing the values with a key of Keys,
+	// AES-GCM of crypto/aes when nil. It allows using the AEAD of a
+	// validated crypto module
+	NewAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+// SetEncryption enables encryption at rest for the tenants of this store,
+// nil disables it for new writes
+func (s *Store) SetEncryption(encryption *Encryption) {
+	s.encryption = encryption
+}
+
+func (e *Encryption) seal(plaintext []byte) (string, error) {
+	id, key, err := e.Keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(id, ":") {
+		return "", fmt.Errorf("invalid encryption key id %q", id)
+	}
+	gcm, err := e.aead(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(id))
+	return encryptedPrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (e *Encryption) open(value string) ([]byte, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !ok {
+		return nil, errors.New("malformed encrypted value")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	key, err := e.Keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := e.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, []byte(id))
+}
+
+func (e *Encryption) aead(key []byte) (cipher.AEAD, error) {
+	if e.NewAEAD != nil {
+		return e.NewAEAD(key)
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt returns a copy of tenant with the configured columns encrypted
+func (e *Encryption) encrypt(tenant *Tenant) (*Tenant, error) {
+	encrypted := *tenant
+	if tenant.SharedSecret != "" && !strings.HasPrefix(tenant.SharedSecret, encryptedPrefix) {
+		secret := tenant.SecretBytes()
+		sealed, err := e.seal(secret)
+		Zero(secret)
+		if err != nil {
+			return nil, err
+		}
+		encrypted.SharedSecret = sealed
+	}
+	if e.Context && len(tenant.Context) > 0 {
+		sealed, err := e.seal(tenant.Context)
+		if err != nil {
+			return nil, err
+		}
+		// the column may be typed as json, so the ciphertext is wrapped
+		if encrypted.Context, err = json.Marshal(map[string]string{encryptedContextKey: sealed}); err != nil {
+			return nil, err
+		}
+	}
+	return &encrypted, nil
+}
+
+// decrypt replaces the encrypted columns of tenant with their plaintext
+func (e *Encryption) decrypt(tenant *Tenant) error {
+	if strings.HasPrefix(tenant.SharedSecret, encryptedPrefix) {
+		plaintext, err := e.open(tenant.SharedSecret)
+		if err != nil {
+			return fmt.Errorf("decrypting shared secret of %s: %w", tenant.ClientKey, err)
+		}
+		tenant.SharedSecret = string(plaintext)
+		Zero(plaintext)
+	}
+	if sealed, ok := encryptedContext(tenant.Context); ok {
+		plaintext, err := e.open(sealed)
+		if err != nil {
+			return fmt.Errorf("decrypting context of %s: %w", tenant.ClientKey, err)
+		}
+		tenant.Context = datatypes.JSON(plaintext)
+	}
+	return nil
+}
+
+func encryptedContext(context datatypes.JSON) (string, bool) {
+	if !strings.Contains(string(context), encryptedContextKey) {
+		return "", false
+	}
+	var wrapped map[string]string
+	if err := json.Unmarshal(context, &wrapped); err != nil || len(wrapped) != 1 {
+		return "", false
+	}
+	sealed, ok := wrapped[encryptedContextKey]
+	return sealed, ok && strings.HasPrefix(sealed, encryptedPrefix)
+}
+
+// decrypt decrypts the tenants read from the database if encryption is
+// enabled or any of them holds encrypted values
+func (s *Store) decrypt(tenants ...*Tenant) error {
+	for _, tenant := range tenants {
+		if s.encryption == nil {
+			if strings.HasPrefix(tenant.SharedSecret, encryptedPrefix) {
+				return fmt.Errorf("tenant %s is encrypted but no encryption keys are configured", tenant.ClientKey)
+			}
+			continue
+		}
+		if err := s.encryption.decrypt(tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"crypto/cipher"
+	"strings"
+	"testing"
+
+	"gorm.io/datatypes"
+)
+
+func TestEncryption(t *testing.T) {
+	testCases := []struct {
+		encryptContext bool
+	}{
+		{encryptContext: false},
+		{encryptContext: true},
+	}
+
+	for _, testCase := range testCases {
+		store := newMemoryStore(t)
+		keys := StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}}
+		store.SetEncryption(&Encryption{Keys: keys, Context: testCase.encryptContext})
+
+		context := datatypes.JSON(`{"oauthClientId":"secret-client"}`)
+		if _, err := store.Set(&Tenant{ClientKey: "key", BaseURL: "https://example.atlassian.net", SharedSecret: "shh", Context: context}); err != nil {
+			t.Fatal(err)
+		}
+
+		var raw Tenant
+		if err := store.Tx().Where("client_key = ?", "key").First(&raw).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(raw.SharedSecret, encryptedPrefix) {
+			t.Errorf("Expected stored shared secret to be encrypted, but got %v", raw.SharedSecret)
+		}
+		if contextEncrypted := strings.Contains(string(raw.Context), encryptedContextKey); contextEncrypted != testCase.encryptContext {
+			t.Errorf("Expected stored context encryption to be %v, but got %v", testCase.encryptContext, string(raw.Context))
+		}
+
+		tenant, err := store.Get("key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tenant.SharedSecret != "shh" {
+			t.Errorf("Expected shared secret to be %v, but got %v", "shh", tenant.SharedSecret)
+		}
+		if string(tenant.Context) != string(context) {
+			t.Errorf("Expected context to be %v, but got %v", string(context), string(tenant.Context))
+		}
+
+		// values written under a rotated key remain readable
+		keys.Keys["k2"] = []byte("fedcba9876543210")
+		keys.Current = "k2"
+		store.SetEncryption(&Encryption{Keys: keys, Context: testCase.encryptContext})
+		if tenant, err = store.GetByUrl("https://example.atlassian.net"); err != nil {
+			t.Fatal(err)
+		} else if tenant.SharedSecret != "shh" {
+			t.Errorf("Expected shared secret after rotation to be %v, but got %v", "shh", tenant.SharedSecret)
+		}
+
+		store.SetEncryption(nil)
+		if _, err = store.Get("key"); err == nil {
+			t.Errorf("Expected reading encrypted tenants without keys to fail")
+		}
+	}
+}
+
+func TestEncryptionAEAD(t *testing.T) {
+	store := newMemoryStore(t)
+	keys := StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}}
+	calls := 0
+	store.SetEncryption(&Encryption{Keys: keys, NewAEAD: func(key []byte) (cipher.AEAD, error) {
+		calls++
+		return newGCM(key)
+	}})
+	if _, err := store.Set(&Tenant{ClientKey: "key", BaseURL: "https://example.atlassian.net", SharedSecret: "shh"}); err != nil {
+		t.Fatal(err)
+	}
+	tenant, err := store.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.SharedSecret != "shh" || calls != 2 {
+		t.Errorf("Expected the secret to be sealed and opened by the AEAD, but got %q after %d calls", tenant.SharedSecret, calls)
+	}
+}
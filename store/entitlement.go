@@ -0,0 +1,29 @@
+package store
+
+var entitlementFields = []string{"EntitlementId", "EntitlementNumber", "CapabilitySet"}
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 9,
+		Name:    "add tenant entitlement details",
+		Up: func(s *Store) error {
+			for _, field := range entitlementFields {
+				if s.introspect().HasColumn(&Tenant{}, field) {
+					continue
+				}
+				if err := s.migrator().AddColumn(&Tenant{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(s *Store) error {
+			for i := len(entitlementFields) - 1; i >= 0; i-- {
+				if err := s.migrator().DropColumn(&Tenant{}, entitlementFields[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// Exporter returns everything a subsystem keeps about a tenant for inclusion
+// in ExportTenant, nil if it holds no data about the tenant
+type Exporter func(s *Store, clientKey string) (interface{}, error)
+
+var exporters = map[string]Exporter{}
+
+// RegisterExporter adds a named section to all tenant exports, subsystems
+// storing per-tenant data (settings, audit events, tokens) register one so
+// data access requests are answered completely
+func RegisterExporter(name string, exporter Exporter) {
+	if _, exists := exporters[name]; exists {
+		log.FatalDF(1, "tenant exporter %s already registered", name)
+		return
+	}
+	exporters[name] = exporter
+}
+
+// TenantExport is the JSON bundle written by ExportTenant
+type TenantExport struct {
+	ClientKey  string                 `json:"clientKey"`
+	ExportedAt time.Time              `json:"exportedAt"`
+	Tenant     fileRecord             `json:"tenant"`
+	Sections   map[string]interface{} `json:"sections"`
+}
+
+// redactedSecret replaces the shared secret in exports, it is credential
+// material of the app rather than data about the site
+const redactedSecret = "[redacted]"
+
+// ExportTenant writes a JSON bundle of everything stored about the tenant
+// with the given client key, including the sections of all registered
+// exporters
+func (s *Store) ExportTenant(clientKey string, w io.Writer) error {
+	tenant, err := s.Get(clientKey)
+	if err != nil {
+		return err
+	}
+	record := newFileRecord(tenant)
+	if record.SharedSecret != "" {
+		record.SharedSecret = redactedSecret
+	}
+	export := TenantExport{
+		ClientKey:  clientKey,
+		ExportedAt: time.Now().UTC(),
+		Tenant:     record,
+		Sections:   make(map[string]interface{}, len(exporters)),
+	}
+
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		section, err := exporters[name](s, clientKey)
+		if err != nil {
+			return fmt.Errorf("exporting %s of %s: %w", name, clientKey, err)
+		}
+		if section != nil {
+			export.Sections[name] = section
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestExportTenant(t *testing.T) {
+	store := newMemoryStore(t)
+	if _, err := store.Set(&Tenant{ClientKey: "key", BaseURL: "https://example.atlassian.net", SharedSecret: "shh", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterExporter("test", func(s *Store, clientKey string) (interface{}, error) {
+		return map[string]string{"clientKey": clientKey}, nil
+	})
+	defer delete(exporters, "test")
+
+	var buf bytes.Buffer
+	if err := store.ExportTenant("key", &buf); err != nil {
+		t.Fatal(err)
+	}
+	var export struct {
+		Tenant struct {
+			BaseURL        string `json:"baseUrl"`
+			SharedSecret   string `json:"sharedSecret"`
+			AddonInstalled bool   `json:"addonInstalled"`
+		} `json:"tenant"`
+		Sections map[string]map[string]string `json:"sections"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Tenant.BaseURL != "https://example.atlassian.net" || !export.Tenant.AddonInstalled {
+		t.Errorf("Expected exported tenant to match the stored tenant, but got %+v", export.Tenant)
+	}
+	if export.Tenant.SharedSecret != redactedSecret {
+		t.Errorf("Expected shared secret to be %v, but got %v", redactedSecret, export.Tenant.SharedSecret)
+	}
+	if got := export.Sections["test"]["clientKey"]; got != "key" {
+		t.Errorf("Expected test section clientKey to be %v, but got %v", "key", got)
+	}
+
+	if err := store.ExportTenant("unknown", &buf); !isNotFound(err) {
+		t.Errorf("Expected exporting an unknown tenant to fail with ErrNotFound, but got %v", err)
+	}
+}
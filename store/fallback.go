@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// FallbackStore reads from Primary and falls back to Secondary for tenants
+// not found in Primary, all writes go to Primary. This allows moving to a new
+// store without downtime, for example a new postgres database falling back to
+// the legacy sqlite file.
+type FallbackStore struct {
+	Primary   TenantStore
+	Secondary TenantStore
+	// Promote copies tenants found in Secondary into Primary on read, so that
+	// Secondary can be retired once all active tenants were seen
+	Promote bool
+}
+
+func NewFallback(primary, secondary TenantStore, promote bool) *FallbackStore {
+	return &FallbackStore{
+		Primary:   primary,
+		Secondary: secondary,
+		Promote:   promote,
+	}
+}
+
+func (s *FallbackStore) fallback(lookup func(TenantStore) (*Tenant, error)) (*Tenant, error) {
+	tenant, err := lookup(s.Primary)
+	if err == nil || !isNotFound(err) {
+		return tenant, err
+	}
+	if tenant, err = lookup(s.Secondary); err != nil {
+		return nil, err
+	}
+	if s.Promote {
+		log.DebugF("promoting tenant %s from secondary store", tenant.ClientKey)
+		if _, err := s.Primary.Set(tenant); err != nil {
+			log.ErrorF("could not promote tenant %s from secondary store: %v", tenant.ClientKey, err)
+		}
+	}
+	return tenant, nil
+}
+
+func (s *FallbackStore) Get(clientKey string) (*Tenant, error) {
+	return s.fallback(func(ts TenantStore) (*Tenant, error) {
+		return ts.Get(clientKey)
+	})
+}
+
+func (s *FallbackStore) GetByUrl(url string) (*Tenant, error) {
+	return s.fallback(func(ts TenantStore) (*Tenant, error) {
+		return ts.GetByUrl(url)
+	})
+}
+
+func (s *FallbackStore) Set(tenant *Tenant) (*Tenant, error) {
+	return s.Primary.Set(tenant)
+}
+
+// Delete removes the tenant from both stores, so that it is not resurrected
+// by the fallback
+func (s *FallbackStore) Delete(clientKey string) error {
+	err := s.Primary.Delete(clientKey)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	if e := s.Secondary.Delete(clientKey); e != nil && !isNotFound(e) {
+		return e
+	} else if e == nil {
+		return nil
+	}
+	return err
+}
+
+// WithTx runs fn within a transaction of Primary, Secondary is only read
+func (s *FallbackStore) WithTx(ctx context.Context, fn func(tx TenantStore) error) error {
+	return WithTx(ctx, s.Primary, func(tx TenantStore) error {
+		return fn(&FallbackStore{Primary: tx, Secondary: s.Secondary, Promote: s.Promote})
+	})
+}
+
+func (s *FallbackStore) Touch(tenant *Tenant, at time.Time) error {
+	return Touch(s.Primary, tenant, at)
+}
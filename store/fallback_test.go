@@ -0,0 +1,59 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFallbackStore(t *testing.T) {
+	primary, secondary := newMemoryStore(t), newMemoryStore(t)
+	for _, s := range []struct {
+		store     *Store
+		clientKey string
+		secret    string
+	}{
+		{primary, "both", "primary"},
+		{secondary, "both", "secondary"},
+		{secondary, "legacy", "secondary"},
+	} {
+		if _, err := s.store.Set(&Tenant{ClientKey: s.clientKey, SharedSecret: s.secret, BaseURL: "https://" + s.clientKey + ".atlassian.net"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fallback := NewFallback(primary, secondary, true)
+
+	testCases := []struct {
+		clientKey string
+		secret    string
+		notFound  bool
+	}{
+		{clientKey: "both", secret: "primary"},
+		{clientKey: "legacy", secret: "secondary"},
+		{clientKey: "unknown", notFound: true},
+	}
+
+	for _, testCase := range testCases {
+		tenant, err := fallback.Get(testCase.clientKey)
+		if testCase.notFound {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound for %s, but got %v", testCase.clientKey, err)
+			}
+			continue
+		}
+		if err != nil || tenant.SharedSecret != testCase.secret {
+			t.Errorf("Expected %s to have secret %s, but got %+v (%v)", testCase.clientKey, testCase.secret, tenant, err)
+		}
+	}
+
+	if _, err := primary.Get("legacy"); err != nil {
+		t.Errorf("Expected legacy tenant to be promoted into the primary store, but got %v", err)
+	}
+
+	if err := fallback.Delete("legacy"); err != nil {
+		t.Error(err)
+	}
+	if _, err := fallback.Get("legacy"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted tenant to be gone from both stores, but got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// fileRecord is the on-disk representation of a tenant, it includes the
+// fields which are hidden from the lifecycle payload json
+type fileRecord struct {
+	Tenant
+	AddonInstalled   bool       `json:"addonInstalled"`
+	LastSeenAt       *time.Time `json:"lastSeenAt,omitempty"`
+	InstalledScopes  []string   `json:"installedScopes,omitempty"`
+	InstalledModules []string   `json:"installedModules,omitempty"`
+	SecretRotatedAt  *time.Time `json:"secretRotatedAt,omitempty"`
+	SignedInstallAt  *time.Time `json:"signedInstallAt,omitempty"`
+}
+
+func newFileRecord(tenant *Tenant) fileRecord {
+	return fileRecord{
+		Tenant:           *tenant,
+		AddonInstalled:   tenant.AddonInstalled,
+		LastSeenAt:       tenant.LastSeenAt,
+		InstalledScopes:  tenant.InstalledScopes,
+		InstalledModules: tenant.InstalledModules,
+		SecretRotatedAt:  tenant.SecretRotatedAt,
+		SignedInstallAt:  tenant.SignedInstallAt,
+	}
+}
+
+func (r fileRecord) tenant() *Tenant {
+	tenant := r.Tenant
+	tenant.AddonInstalled = r.AddonInstalled
+	tenant.LastSeenAt = r.LastSeenAt
+	tenant.InstalledScopes = r.InstalledScopes
+	tenant.InstalledModules = r.InstalledModules
+	tenant.SecretRotatedAt = r.SecretRotatedAt
+	tenant.SignedInstallAt = r.SignedInstallAt
+	return &tenant
+}
+
+// FileStore keeps all tenants in memory and persists them to a single JSON
+// file, replacing it atomically on every write. It is meant for single tenant
+// or self-hosted deployments and CLI tooling, not for large installations.
+type FileStore struct {
+	path    string
+	mutex   sync.RWMutex
+	tenants map[string]*Tenant
+}
+
+// NewFile opens the JSON file store at path, the file is created on the first
+// write if it does not exist
+func NewFile(path string) (s *FileStore, err error) {
+	s = &FileStore{path: path, tenants: make(map[string]*Tenant)}
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	var records []fileRecord
+	if err = json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		tenant := record.tenant()
+		s.tenants[tenant.ClientKey] = tenant
+	}
+	log.TraceF("loaded %d tenants from %s", len(s.tenants), path)
+	return s, nil
+}
+
+func (s *FileStore) save(tenants map[string]*Tenant) (err error) {
+	records := make([]fileRecord, 0, len(tenants))
+	for _, tenant := range tenants {
+		records = append(records, newFileRecord(tenant))
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ClientKey < records[j].ClientKey })
+
+	var data []byte
+	if data, err = json.MarshalIndent(records, "", "  "); err != nil {
+		return
+	}
+
+	var tmp *os.File
+	if tmp, err = ioutil.TempFile(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	if err = os.Chmod(tmp.Name(), 0600); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func getTenant(tenants map[string]*Tenant, clientKey string) (*Tenant, error) {
+	tenant, ok := tenants[clientKey]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *tenant
+	return &copied, nil
+}
+
+func getTenantByUrl(tenants map[string]*Tenant, url string) (*Tenant, error) {
+	for _, tenant := range tenants {
+		if tenant.BaseURL == url {
+			copied := *tenant
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func setTenant(tenants map[string]*Tenant, tenant *Tenant) *Tenant {
+	now := time.Now()
+	stored, ok := tenants[tenant.ClientKey]
+	if ok {
+		stored.merge(tenant)
+	} else {
+		copied := *tenant
+		copied.CreatedAt = now
+		stored = &copied
+		tenants[tenant.ClientKey] = stored
+	}
+	stored.UpdatedAt = now
+	tenant.CreatedAt, tenant.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+	return tenant
+}
+
+func (s *FileStore) Get(clientKey string) (*Tenant, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return getTenant(s.tenants, clientKey)
+}
+
+func (s *FileStore) GetByUrl(url string) (*Tenant, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return getTenantByUrl(s.tenants, url)
+}
+
+func (s *FileStore) Set(tenant *Tenant) (*Tenant, error) {
+	var stored *Tenant
+	err := s.update(func(tenants map[string]*Tenant) error {
+		stored = setTenant(tenants, tenant)
+		return nil
+	})
+	return stored, err
+}
+
+func (s *FileStore) Delete(clientKey string) error {
+	return s.update(func(tenants map[string]*Tenant) error {
+		if _, ok := tenants[clientKey]; !ok {
+			return ErrNotFound
+		}
+		log.WarnF("deleting tenant with clientKey %s from %s", clientKey, s.path)
+		delete(tenants, clientKey)
+		return nil
+	})
+}
+
+func (s *FileStore) Touch(tenant *Tenant, at time.Time) error {
+	if tenant.LastSeenAt != nil && at.Sub(*tenant.LastSeenAt) < TouchInterval {
+		return nil
+	}
+	err := s.update(func(tenants map[string]*Tenant) error {
+		if stored, ok := tenants[tenant.ClientKey]; ok {
+			stored.LastSeenAt = &at
+		}
+		return nil
+	})
+	if err == nil {
+		tenant.LastSeenAt = &at
+	}
+	return err
+}
+
+// update applies fn to a copy of the tenants and only replaces the in-memory
+// state once the file was written successfully
+func (s *FileStore) update(fn func(tenants map[string]*Tenant) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	working := make(map[string]*Tenant, len(s.tenants))
+	for key, tenant := range s.tenants {
+		copied := *tenant
+		working[key] = &copied
+	}
+	if err := fn(working); err != nil {
+		return err
+	}
+	if err := s.save(working); err != nil {
+		return err
+	}
+	s.tenants = working
+	return nil
+}
+
+// fileTx is the TenantStore view of a FileStore transaction
+type fileTx struct {
+	tenants map[string]*Tenant
+}
+
+func (t *fileTx) Get(clientKey string) (*Tenant, error) {
+	return getTenant(t.tenants, clientKey)
+}
+
+func (t *fileTx) GetByUrl(url string) (*Tenant, error) {
+	return getTenantByUrl(t.tenants, url)
+}
+
+func (t *fileTx) Set(tenant *Tenant) (*Tenant, error) {
+	return setTenant(t.tenants, tenant), nil
+}
+
+func (t *fileTx) Delete(clientKey string) error {
+	if _, ok := t.tenants[clientKey]; !ok {
+		return ErrNotFound
+	}
+	delete(t.tenants, clientKey)
+	return nil
+}
+
+// WithTx runs fn with exclusive access to the store, all changes are written
+// at once if fn returns nil and discarded otherwise
+func (s *FileStore) WithTx(ctx context.Context, fn func(tx TenantStore) error) error {
+	return s.update(func(tenants map[string]*Tenant) error {
+		return fn(&fileTx{tenants: tenants})
+	})
+}
+
+// List returns all tenants ordered by client key
+func (s *FileStore) List() []*Tenant {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	tenants := make([]*Tenant, 0, len(s.tenants))
+	for _, tenant := range s.tenants {
+		copied := *tenant
+		tenants = append(tenants, &copied)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ClientKey < tenants[j].ClientKey })
+	return tenants
+}
+
+// ForEach calls fn for every tenant ordered by client key, iteration stops at
+// the first error returned by fn or when ctx is done
+func (s *FileStore) ForEach(ctx context.Context, fn func(tenant *Tenant) error) error {
+	for _, tenant := range s.List() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
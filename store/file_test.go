@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+
+	s, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Set(&Tenant{ClientKey: "a", SharedSecret: "secret", BaseURL: "https://a.atlassian.net", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	// uninstall payloads do not carry the shared secret
+	if _, err = s.Set(&Tenant{ClientKey: "a", BaseURL: "https://a.atlassian.net", AddonInstalled: false}); err != nil {
+		t.Fatal(err)
+	}
+	signedAt := time.Now()
+	if _, err = s.Set(&Tenant{ClientKey: "b", SharedSecret: "other", BaseURL: "https://b.atlassian.net", AddonInstalled: true, SignedInstallAt: &signedAt}); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"first", "second"} {
+		if _, err = s.Set(&Tenant{ClientKey: "c", SharedSecret: secret, BaseURL: "https://c.atlassian.net", AddonInstalled: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := time.Now()
+	if err = s.Touch(&Tenant{ClientKey: "b"}, seen); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.WithTx(context.Background(), func(tx TenantStore) error {
+		_ = tx.Delete("b")
+		return errors.New("rollback")
+	})
+
+	reopened, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		clientKey string
+		secret    string
+		installed bool
+		seen      bool
+		rotated   bool
+		signed    bool
+	}{
+		{clientKey: "a", secret: "secret", installed: false},
+		{clientKey: "b", secret: "other", installed: true, seen: true, signed: true},
+		{clientKey: "c", secret: "second", installed: true, rotated: true},
+	}
+
+	for _, testCase := range testCases {
+		tenant, err := reopened.Get(testCase.clientKey)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if tenant.SharedSecret != testCase.secret || tenant.AddonInstalled != testCase.installed || (tenant.LastSeenAt != nil) != testCase.seen || (tenant.SecretRotatedAt != nil) != testCase.rotated || (tenant.SignedInstallAt != nil) != testCase.signed {
+			t.Errorf("Expected %+v, but got %+v", testCase, tenant)
+		}
+	}
+
+	if tenant, err := reopened.GetByUrl("https://b.atlassian.net"); err != nil || tenant.ClientKey != "b" {
+		t.Errorf("Expected lookup by url to return b, but got %+v (%v)", tenant, err)
+	}
+	if err = reopened.Delete("a"); err != nil {
+		t.Error(err)
+	}
+	if _, err = reopened.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, but got %v", err)
+	}
+}
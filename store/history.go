@@ -0,0 +1,147 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// HistoryLimit is the number of previous records kept per tenant
+var HistoryLimit = 10
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 5,
+		Name:    "create tenant history table",
+		Up: func(s *Store) error {
+			return s.Database.Table(s.HistoryTableName()).AutoMigrate(&TenantSnapshot{})
+		},
+		Down: func(s *Store) error {
+			return s.Database.Migrator().DropTable(s.HistoryTableName())
+		},
+	})
+	RegisterExporter("history", func(s *Store, clientKey string) (interface{}, error) {
+		history, err := s.History(clientKey)
+		if err != nil || len(history) == 0 {
+			return nil, err
+		}
+		return history, nil
+	})
+}
+
+// Historian is implemented by stores which keep previous tenant records
+type Historian interface {
+	History(clientKey string) ([]TenantSnapshot, error)
+}
+
+// TenantSnapshot is a previous record of a tenant, stored whenever an update
+// changes it. Secrets and the installation context are only kept as
+// fingerprints, enough to tell whether they changed.
+type TenantSnapshot struct {
+	ID                 uint      `json:"-" gorm:"primaryKey"`
+	ClientKey          string    `json:"clientKey" gorm:"type:varchar(255);index"`
+	RecordedAt         time.Time `json:"recordedAt"`
+	Changes            []string  `json:"changes" gorm:"serializer:json"`
+	BaseURL            string    `json:"baseUrl" gorm:"type:varchar(255)"`
+	PublicKey          string    `json:"publicKey" gorm:"type:varchar(512)"`
+	OauthClientId      string    `json:"oauthClientId" gorm:"type:varchar(255)"`
+	ProductType        string    `json:"productType" gorm:"type:varchar(255)"`
+	Description        string    `json:"description" gorm:"type:varchar(255)"`
+	AddonInstalled     bool      `json:"addonInstalled"`
+	SecretFingerprint  string    `json:"secretFingerprint" gorm:"type:varchar(64)"`
+	ContextFingerprint string    `json:"contextFingerprint" gorm:"type:varchar(64)"`
+}
+
+// HistoryTableName returns the name of the table holding previous tenant
+// records
+func (s *Store) HistoryTableName() string {
+	return s.TableName() + "_history"
+}
+
+// Fingerprint returns a short hash of a secret value, enough to tell whether
+// it changed without revealing it
+func Fingerprint(value []byte) string {
+	if len(value) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:8])
+}
+
+func contextFingerprint(context datatypes.JSON) string {
+	if string(context) == "{}" {
+		return ""
+	}
+	return Fingerprint(context)
+}
+
+// tenantChanges returns the names of the fields which differ between the
+// previous and the updated record
+func tenantChanges(previous, updated *Tenant) (changes []string) {
+	for _, field := range []struct {
+		name    string
+		changed bool
+	}{
+		{"sharedSecret", previous.SharedSecret != updated.SharedSecret},
+		{"baseUrl", previous.BaseURL != updated.BaseURL},
+		{"publicKey", previous.PublicKey != updated.PublicKey},
+		{"oauthClientId", previous.OauthClientId != updated.OauthClientId},
+		{"productType", previous.ProductType != updated.ProductType},
+		{"description", previous.Description != updated.Description},
+		{"addonInstalled", previous.AddonInstalled != updated.AddonInstalled},
+		{"context", contextFingerprint(previous.Context) != contextFingerprint(updated.Context)},
+	} {
+		if field.changed {
+			changes = append(changes, field.name)
+		}
+	}
+	return
+}
+
+// recordHistory stores the previous record of a tenant if update changes it
+// and prunes the history to HistoryLimit entries
+func (s *Store) recordHistory(previous *Tenant, update *Tenant) error {
+	updated := *previous
+	updated.merge(update)
+	changes := tenantChanges(previous, &updated)
+	if len(changes) == 0 || HistoryLimit <= 0 {
+		return nil
+	}
+	snapshot := TenantSnapshot{
+		ClientKey:          previous.ClientKey,
+		RecordedAt:         time.Now(),
+		Changes:            changes,
+		BaseURL:            previous.BaseURL,
+		PublicKey:          previous.PublicKey,
+		OauthClientId:      previous.OauthClientId,
+		ProductType:        previous.ProductType,
+		Description:        previous.Description,
+		AddonInstalled:     previous.AddonInstalled,
+		SecretFingerprint:  previous.SecretFingerprint(),
+		ContextFingerprint: contextFingerprint(previous.Context),
+	}
+	if err := s.historyTx().Create(&snapshot).Error; err != nil {
+		return err
+	}
+	var expired []uint
+	if err := s.historyTx().Where("client_key = ?", previous.ClientKey).Order("id desc").Offset(HistoryLimit).Pluck("id", &expired).Error; err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	return s.historyTx().Where("id IN ?", expired).Delete(&TenantSnapshot{}).Error
+}
+
+func (s *Store) historyTx() *gorm.DB {
+	return s.Database.Table(s.HistoryTableName())
+}
+
+// History returns the previous records of the tenant, newest first
+func (s *Store) History(clientKey string) (history []TenantSnapshot, err error) {
+	err = s.historyTx().Where("client_key = ?", clientKey).Order("id desc").Find(&history).Error
+	return
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	store := newMemoryStore(t)
+	limit := HistoryLimit
+	HistoryLimit = 2
+	defer func() { HistoryLimit = limit }()
+
+	updates := []*Tenant{
+		{ClientKey: "key", BaseURL: "https://old.atlassian.net", SharedSecret: "first", AddonInstalled: true},
+		{ClientKey: "key", BaseURL: "https://old.atlassian.net", SharedSecret: "first", AddonInstalled: true},
+		{ClientKey: "key", BaseURL: "https://old.atlassian.net", SharedSecret: "second", AddonInstalled: true},
+		{ClientKey: "key", BaseURL: "https://new.atlassian.net", AddonInstalled: false},
+		{ClientKey: "key", BaseURL: "https://new.atlassian.net", AddonInstalled: true},
+	}
+	for _, update := range updates {
+		if _, err := store.Set(update); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := store.History("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected history length to be %v, but got %v", 2, len(history))
+	}
+	expected := [][]string{{"addonInstalled"}, {"baseUrl", "addonInstalled"}}
+	for idx, snapshot := range history {
+		if !reflect.DeepEqual(snapshot.Changes, expected[idx]) {
+			t.Errorf("Expected changes of snapshot %d to be %v, but got %v", idx, expected[idx], snapshot.Changes)
+		}
+	}
+	if history[1].BaseURL != "https://old.atlassian.net" {
+		t.Errorf("Expected oldest snapshot baseUrl to be %v, but got %v", "https://old.atlassian.net", history[1].BaseURL)
+	}
+	if history[1].SecretFingerprint != Fingerprint([]byte("second")) {
+		t.Errorf("Expected oldest snapshot secret fingerprint to be %v, but got %v", Fingerprint([]byte("second")), history[1].SecretFingerprint)
+	}
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"sort"
+	"strings"
+)
+
+// KillSwitchLabelPrefix is prepended to the name of a kill switch to form
+// the tenant label which turns it on
+const KillSwitchLabelPrefix = "kill-switch."
+
+// KillSwitcher is implemented by stores which keep per-tenant kill switches
+type KillSwitcher interface {
+	SetKillSwitch(clientKey, name string, on bool) error
+	KillSwitches(clientKey string) ([]string, error)
+	KillSwitchOn(clientKey, name string) (bool, error)
+}
+
+// SetKillSwitch turns the named kill switch of the tenant on or off
+func (s *Store) SetKillSwitch(clientKey, name string, on bool) error {
+	if on {
+		return s.SetLabel(clientKey, KillSwitchLabelPrefix+name, "on")
+	}
+	return s.DeleteLabel(clientKey, KillSwitchLabelPrefix+name)
+}
+
+// KillSwitches returns the sorted names of the kill switches turned on for
+// the tenant
+func (s *Store) KillSwitches(clientKey string) ([]string, error) {
+	labels, err := s.Labels(clientKey)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for k := range labels {
+		if strings.HasPrefix(k, KillSwitchLabelPrefix) {
+			names = append(names, strings.TrimPrefix(k, KillSwitchLabelPrefix))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// KillSwitchOn reports whether the named kill switch of the tenant is on
+func (s *Store) KillSwitchOn(clientKey, name string) (bool, error) {
+	labels, err := s.Labels(clientKey)
+	if err != nil {
+		return false, err
+	}
+	_, ok := labels[KillSwitchLabelPrefix+name]
+	return ok, nil
+}
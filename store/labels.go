@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 4,
+		Name:    "create tenant label table",
+		Up: func(s *Store) error {
+			return s.Database.Table(s.LabelTableName()).AutoMigrate(&TenantLabel{})
+		},
+		Down: func(s *Store) error {
+			return s.Database.Migrator().DropTable(s.LabelTableName())
+		},
+	})
+	RegisterExporter("labels", func(s *Store, clientKey string) (interface{}, error) {
+		labels, err := s.Labels(clientKey)
+		if err != nil || len(labels) == 0 {
+			return nil, err
+		}
+		return labels, nil
+	})
+}
+
+// TenantLabel is an operator defined key/value annotation of a tenant
+type TenantLabel struct {
+	ClientKey string `gorm:"type:varchar(255);primaryKey"`
+	Name      string `gorm:"type:varchar(255);primaryKey"`
+	Value     string `gorm:"type:varchar(255)"`
+}
+
+// Labeler is implemented by stores which keep tenant labels and can list
+// tenants by them
+type Labeler interface {
+	SetLabel(clientKey, k, v string) error
+	DeleteLabel(clientKey, k string) error
+	Labels(clientKey string) (map[string]string, error)
+	List(filter ListFilter) ([]*Tenant, error)
+}
+
+// ListFilter selects the tenants returned by List, zero values match all
+// tenants
+type ListFilter struct {
+	// Installed limits the result to installed or uninstalled tenants
+	Installed *bool
+	// Labels the tenants must have, an empty value matches any value of the
+	// label
+	Labels map[string]string
+}
+
+// LabelTableName returns the name of the table holding the tenant labels
+func (s *Store) LabelTableName() string {
+	return s.TableName() + "_labels"
+}
+
+func (s *Store) labelTx() *gorm.DB {
+	return s.Database.Table(s.LabelTableName())
+}
+
+// SetLabel sets the label k of the tenant to v, replacing any previous value
+func (s *Store) SetLabel(clientKey, k, v string) error {
+	if k == "" {
+		return errors.New("label name must not be empty")
+	}
+	if _, err := s.Get(clientKey); err != nil {
+		return err
+	}
+	return s.labelTx().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "client_key"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value"}),
+	}).Create(&TenantLabel{ClientKey: clientKey, Name: k, Value: v}).Error
+}
+
+// DeleteLabel removes the label k from the tenant
+func (s *Store) DeleteLabel(clientKey, k string) error {
+	return s.labelTx().Where("client_key = ? AND name = ?", clientKey, k).Delete(&TenantLabel{}).Error
+}
+
+// Labels returns all labels of the tenant
+func (s *Store) Labels(clientKey string) (map[string]string, error) {
+	var rows []TenantLabel
+	if err := s.labelTx().Where("client_key = ?", clientKey).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string, len(rows))
+	for _, row := range rows {
+		labels[row.Name] = row.Value
+	}
+	return labels, nil
+}
+
+// List returns the tenants matching filter ordered by client key
+func (s *Store) List(filter ListFilter) (tenants []*Tenant, err error) {
+	tx := s.Tx()
+	if filter.Installed != nil {
+		tx = tx.Where("addon_installed = ?", *filter.Installed)
+	}
+	for k, v := range filter.Labels {
+		labelled := s.labelTx().Select("client_key").Where("name = ?", k)
+		if v != "" {
+			labelled = labelled.Where("value = ?", v)
+		}
+		tx = tx.Where("client_key IN (?)", labelled)
+	}
+	if err = tx.Order("client_key").Find(&tenants).Error; err != nil {
+		return
+	}
+	err = s.decrypt(tenants...)
+	return
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestLabels(t *testing.T) {
+	store := newMemoryStore(t)
+	for _, tenant := range []*Tenant{
+		{ClientKey: "a", BaseURL: "https://a.atlassian.net", SharedSecret: "a", AddonInstalled: true},
+		{ClientKey: "b", BaseURL: "https://b.atlassian.net", SharedSecret: "b", AddonInstalled: true},
+		{ClientKey: "c", BaseURL: "https://c.atlassian.net", SharedSecret: "c", AddonInstalled: false},
+	} {
+		if _, err := store.Set(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, label := range [][3]string{{"a", "cohort", "beta"}, {"b", "cohort", "ga"}, {"c", "cohort", "beta"}, {"a", "vip", "true"}, {"b", "cohort", "beta"}} {
+		if err := store.SetLabel(label[0], label[1], label[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetLabel("unknown", "cohort", "beta"); !isNotFound(err) {
+		t.Errorf("Expected labelling an unknown tenant to fail with ErrNotFound, but got %v", err)
+	}
+
+	installed := true
+	testCases := []struct {
+		filter   ListFilter
+		expected []string
+	}{
+		{filter: ListFilter{}, expected: []string{"a", "b", "c"}},
+		{filter: ListFilter{Labels: map[string]string{"cohort": "beta"}}, expected: []string{"a", "b", "c"}},
+		{filter: ListFilter{Labels: map[string]string{"cohort": "beta"}, Installed: &installed}, expected: []string{"a", "b"}},
+		{filter: ListFilter{Labels: map[string]string{"cohort": "beta", "vip": ""}}, expected: []string{"a"}},
+		{filter: ListFilter{Labels: map[string]string{"cohort": "ga"}}, expected: nil},
+	}
+	for _, testCase := range testCases {
+		tenants, err := store.List(testCase.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, tenant := range tenants {
+			got = append(got, tenant.ClientKey)
+		}
+		if len(got) != len(testCase.expected) {
+			t.Errorf("Expected List(%+v) to be %v, but got %v", testCase.filter, testCase.expected, got)
+			continue
+		}
+		for idx := range got {
+			if got[idx] != testCase.expected[idx] {
+				t.Errorf("Expected List(%+v) to be %v, but got %v", testCase.filter, testCase.expected, got)
+				break
+			}
+		}
+	}
+
+	if err := store.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if labels, err := store.Labels("a"); err != nil || len(labels) != 0 {
+		t.Errorf("Expected labels of deleted tenant to be removed, but got %v (%v)", labels, err)
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/lease"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 7,
+		Name:    "create lease table",
+		Up: func(s *Store) error {
+			return s.Database.Table(s.LeaseTableName()).AutoMigrate(&LeaseRecord{})
+		},
+		Down: func(s *Store) error {
+			return s.Database.Migrator().DropTable(s.LeaseTableName())
+		},
+	})
+}
+
+// LeaseRecord is a row of the lease table, a lease is held by Holder until
+// ExpiresAt
+type LeaseRecord struct {
+	Name      string `gorm:"type:varchar(255);primaryKey"`
+	Holder    string `gorm:"type:varchar(255)"`
+	ExpiresAt time.Time
+}
+
+// LeaseTableName returns the name of the table holding the leases of
+// background components
+func (s *Store) LeaseTableName() string {
+	return s.TableName() + "_leases"
+}
+
+// leaser returns lease.Default or the store itself when it is nil
+func (s *Store) leaser() lease.Leaser {
+	if lease.Default != nil {
+		return lease.Default
+	}
+	return s
+}
+
+// TryAcquire implements lease.Leaser with a row per lease, replicas should
+// have reasonably synchronized clocks as expiry is decided by the caller
+func (s *Store) TryAcquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	result := s.Database.WithContext(ctx).Table(s.LeaseTableName()).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]interface{}{"holder": holder, "expires_at": now.Add(ttl)})
+	if result.Error != nil {
+		return false, result.Error
+	} else if result.RowsAffected > 0 {
+		return true, nil
+	}
+	result = s.Database.WithContext(ctx).Table(s.LeaseTableName()).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&LeaseRecord{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Release implements lease.Leaser
+func (s *Store) Release(ctx context.Context, name, holder string) error {
+	return s.Database.WithContext(ctx).Table(s.LeaseTableName()).
+		Where("name = ? AND holder = ?", name, holder).
+		Delete(&LeaseRecord{}).Error
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	store := newMemoryStore(t)
+	ctx := context.Background()
+	testCases := []struct {
+		holder   string
+		ttl      time.Duration
+		expected bool
+	}{
+		{holder: "first", ttl: time.Hour, expected: true},
+		{holder: "second", ttl: time.Hour, expected: false},
+		{holder: "first", ttl: -time.Second, expected: true},
+		{holder: "second", ttl: time.Hour, expected: true},
+		{holder: "second", ttl: time.Hour, expected: true},
+	}
+	for _, testCase := range testCases {
+		held, err := store.TryAcquire(ctx, "job", testCase.holder, testCase.ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if held != testCase.expected {
+			t.Errorf("Expected %s to hold the lease: %v, but got %v", testCase.holder, testCase.expected, held)
+		}
+	}
+	if err := store.Release(ctx, "job", "second"); err != nil {
+		t.Fatal(err)
+	}
+	if held, _ := store.TryAcquire(ctx, "job", "first", time.Hour); !held {
+		t.Errorf("Expected first to acquire the released lease")
+	}
+}
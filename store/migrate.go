@@ -0,0 +1,155 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// Migration is a single versioned schema change, Up and Down receive a Store
+// bound to the migration transaction
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(s *Store) error
+	Down    func(s *Store) error
+}
+
+// Migrations is the ordered list of schema changes applied by Migrate
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create tenant table",
+		Up: func(s *Store) error {
+			return s.Tx().AutoMigrate(&Tenant{})
+		},
+		Down: func(s *Store) error {
+			return s.Database.Migrator().DropTable(s.TableName())
+		},
+	},
+}
+
+// RegisterMigration adds a schema change to Migrations, the version must be
+// unique and should be higher than the versions of all released migrations
+func RegisterMigration(m Migration) {
+	for _, existing := range Migrations {
+		if existing.Version == m.Version {
+			log.FatalDF(1, "migration version %d already registered: %s", m.Version, existing.Name)
+			return
+		}
+	}
+	Migrations = append(Migrations, m)
+	sort.Slice(Migrations, func(i, j int) bool { return Migrations[i].Version < Migrations[j].Version })
+}
+
+// MigrationRecord is a row of the migration table
+type MigrationRecord struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"type:varchar(255)"`
+	AppliedAt time.Time
+}
+
+// TableName returns the name of the tenant table
+func (s *Store) TableName() string {
+	if s.table == "" {
+		return DefaultTableName
+	}
+	return s.table
+}
+
+// MigrationTableName returns the name of the table recording the applied
+// migrations of this store
+func (s *Store) MigrationTableName() string {
+	return s.TableName() + "_migrations"
+}
+
+// introspect returns the tenant table migrator used to inspect the current
+// schema, which is always the live database even while recording a dry run
+func (s *Store) introspect() gorm.Migrator {
+	if s.inspect != nil {
+		return s.inspect.Table(s.TableName()).Migrator()
+	}
+	return s.migrator()
+}
+
+// migrator returns the migrator of the tenant table
+func (s *Store) migrator() gorm.Migrator {
+	return s.Database.Table(s.TableName()).Migrator()
+}
+
+func (s *Store) ensureMigrationTable() error {
+	return s.Database.Table(s.MigrationTableName()).AutoMigrate(&MigrationRecord{})
+}
+
+// MigrationVersion returns the highest applied migration version, zero if
+// none were applied yet
+func (s *Store) MigrationVersion() (version int, err error) {
+	if err = s.ensureMigrationTable(); err != nil {
+		return
+	}
+	var record MigrationRecord
+	result := s.Database.Table(s.MigrationTableName()).Order("version desc").Limit(1).Find(&record)
+	err = result.Error
+	version = record.Version
+	return
+}
+
+// Migrate applies all pending migrations in order, each within its own
+// transaction
+func (s *Store) Migrate() (err error) {
+	var current int
+	if current, err = s.MigrationVersion(); err != nil {
+		return
+	}
+	for _, m := range Migrations {
+		if m.Version <= current {
+			continue
+		}
+		log.DebugF("applying %s migration %d: %s", s.TableName(), m.Version, m.Name)
+		err = s.Database.Transaction(func(db *gorm.DB) error {
+			tx := &Store{Database: db, table: s.table}
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return db.Table(s.MigrationTableName()).Create(&MigrationRecord{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+	}
+	return
+}
+
+// MigrateDown reverts all applied migrations above the target version, in
+// reverse order, failing if any of them has no Down step
+func (s *Store) MigrateDown(target int) (err error) {
+	var current int
+	if current, err = s.MigrationVersion(); err != nil {
+		return
+	}
+	for idx := len(Migrations) - 1; idx >= 0; idx-- {
+		m := Migrations[idx]
+		if m.Version <= target || m.Version > current {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("migration %d (%s) cannot be reverted", m.Version, m.Name)
+		}
+		log.DebugF("reverting %s migration %d: %s", s.TableName(), m.Version, m.Name)
+		err = s.Database.Transaction(func(db *gorm.DB) error {
+			tx := &Store{Database: db, table: s.table}
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return db.Table(s.MigrationTableName()).Delete(&MigrationRecord{Version: m.Version}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder collects the statements gorm would execute in dry-run mode,
+// read-only introspection queries are not recorded
+type sqlRecorder struct {
+	logger.Interface
+	sync.Mutex
+	statements []string
+}
+
+func (r *sqlRecorder) LogMode(level logger.LogLevel) logger.Interface {
+	return r
+}
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	sql, _ := fc()
+	sql = strings.TrimSpace(sql)
+	upper := strings.ToUpper(sql)
+	for _, prefix := range []string{"SELECT", "PRAGMA", "SHOW", "WITH", "DESCRIBE", "EXPLAIN"} {
+		if strings.HasPrefix(upper, prefix) {
+			return
+		}
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.statements = append(r.statements, sql)
+}
+
+// MigrateDryRun writes the SQL of all pending migrations to w without
+// applying them, so that the DDL can be reviewed and run manually. The
+// database is still queried to determine the current schema. Note that
+// gorm's AutoMigrate also echoes its DDL to stdout in dry-run mode.
+func (s *Store) MigrateDryRun(w io.Writer) (err error) {
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	dry := &Store{
+		Database: s.Database.Session(&gorm.Session{DryRun: true, Logger: recorder}),
+		table:    s.table,
+		inspect:  s.Database,
+	}
+
+	current := 0
+	if s.Database.Migrator().HasTable(s.MigrationTableName()) {
+		if current, err = s.MigrationVersion(); err != nil {
+			return
+		}
+	} else if err = dry.ensureMigrationTable(); err != nil {
+		return
+	}
+
+	for _, m := range Migrations {
+		if m.Version <= current {
+			continue
+		}
+		recorder.statements = append(recorder.statements, fmt.Sprintf("-- migration %d: %s", m.Version, m.Name))
+		if err = m.Up(dry); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		if err = dry.Database.Table(s.MigrationTableName()).Create(&MigrationRecord{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error; err != nil {
+			return
+		}
+	}
+
+	for _, statement := range recorder.statements {
+		if strings.HasPrefix(statement, "--") {
+			_, err = fmt.Fprintln(w, statement)
+		} else {
+			_, err = fmt.Fprintln(w, statement+";")
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrateDryRun(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	store := OpenTableFrom("dry_run_tenants", db)
+
+	var buffer bytes.Buffer
+	if err = store.MigrateDryRun(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	output := buffer.String()
+	for _, expected := range []string{"CREATE TABLE `dry_run_tenants_migrations`", "CREATE TABLE `dry_run_tenants`", "INSERT INTO `dry_run_tenants_migrations`"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected dry run output to contain %s, but got:\n%s", expected, output)
+		}
+	}
+
+	if db.Migrator().HasTable("dry_run_tenants") || db.Migrator().HasTable("dry_run_tenants_migrations") {
+		t.Errorf("Expected dry run to not create any tables")
+	}
+}
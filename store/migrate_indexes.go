@@ -0,0 +1,78 @@
+package store
+
+import (
+	"gorm.io/gorm/clause"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 2,
+		Name:    "deduplicate tenants and index client key and base url",
+		Up: func(s *Store) (err error) {
+			if err = s.dedupeTenants(); err != nil {
+				return
+			}
+			if err = s.createIndex(s.ClientKeyIndexName(), "client_key", true); err != nil {
+				return
+			}
+			return s.createIndex(s.BaseUrlIndexName(), "base_url", false)
+		},
+		Down: func(s *Store) (err error) {
+			for _, name := range []string{s.BaseUrlIndexName(), s.ClientKeyIndexName()} {
+				if s.introspect().HasIndex(s.TableName(), name) {
+					if err = s.Database.Migrator().DropIndex(s.TableName(), name); err != nil {
+						return
+					}
+				}
+			}
+			return
+		},
+	})
+}
+
+// ClientKeyIndexName is the name of the unique client key index, it is named
+// after the table so that multiple stores can share a database
+func (s *Store) ClientKeyIndexName() string {
+	return "idx_" + s.TableName() + "_client_key"
+}
+
+// BaseUrlIndexName is the name of the index used by GetByUrl lookups
+func (s *Store) BaseUrlIndexName() string {
+	return "idx_" + s.TableName() + "_base_url"
+}
+
+func (s *Store) createIndex(name, column string, unique bool) error {
+	if s.introspect().HasIndex(s.TableName(), name) {
+		return nil
+	}
+	sql := "CREATE INDEX ? ON ? (?)"
+	if unique {
+		sql = "CREATE UNIQUE INDEX ? ON ? (?)"
+	}
+	return s.Database.Exec(sql, clause.Column{Name: name}, clause.Table{Name: s.TableName()}, clause.Column{Name: column}).Error
+}
+
+// dedupeTenants removes duplicate client key rows left by tables created
+// without a primary key, keeping the most recently updated record
+func (s *Store) dedupeTenants() (err error) {
+	var duplicates []string
+	if err = s.Tx().Select("client_key").Group("client_key").Having("count(*) > 1").Pluck("client_key", &duplicates).Error; err != nil {
+		return
+	}
+	for _, clientKey := range duplicates {
+		var newest Tenant
+		if err = s.Tx().Where("client_key = ?", clientKey).Order("updated_at desc").Limit(1).Find(&newest).Error; err != nil {
+			return
+		}
+		log.WarnF("removing duplicate %s rows for clientKey %s", s.TableName(), clientKey)
+		if err = s.Tx().Where("client_key = ?", clientKey).Delete(&Tenant{}).Error; err != nil {
+			return
+		}
+		if err = s.Tx().Create(&newest).Error; err != nil {
+			return
+		}
+	}
+	return
+}
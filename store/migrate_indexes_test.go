@@ -0,0 +1,58 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrateIndexes(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	// a legacy table without primary key, holding duplicate client keys
+	err = db.Exec("CREATE TABLE legacy_tenants (client_key varchar(255), public_key varchar(512), shared_secret varchar(255) NOT NULL, oauth_client_id varchar(255), base_url varchar(255) NOT NULL, product_type varchar(255), description varchar(255), addon_installed numeric NOT NULL, created_at datetime, updated_at datetime, context JSON DEFAULT '{}')").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for idx, secret := range []string{"old", "new", "older"} {
+		updated := now.Add(time.Duration(-idx) * time.Hour)
+		if secret == "new" {
+			updated = now.Add(time.Hour)
+		}
+		row := map[string]interface{}{"client_key": "duplicate", "shared_secret": secret, "base_url": "https://example.atlassian.net", "addon_installed": true, "updated_at": updated}
+		if err = db.Table("legacy_tenants").Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := NewTableFrom("legacy_tenants", db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	store.Tx().Where("client_key = ?", "duplicate").Count(&count)
+	tenant, err := store.Get("duplicate")
+	if err != nil || count != 1 || tenant.SharedSecret != "new" {
+		t.Errorf("Expected one remaining row with the newest secret, but got %d rows and %+v (%v)", count, tenant, err)
+	}
+
+	testCases := []string{store.ClientKeyIndexName(), store.BaseUrlIndexName()}
+	for _, name := range testCases {
+		if !db.Migrator().HasIndex("legacy_tenants", name) {
+			t.Errorf("Expected index %s to exist", name)
+		}
+	}
+
+	if err = store.Tx().Create(&Tenant{ClientKey: "duplicate", SharedSecret: "again", BaseURL: "https://example.atlassian.net"}).Error; err == nil {
+		t.Errorf("Expected unique client key index to reject a duplicate row")
+	}
+}
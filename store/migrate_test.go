@@ -0,0 +1,58 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	original := Migrations
+	defer func() { Migrations = original }()
+
+	store := newMemoryStore(t)
+
+	version, err := store.MigrationVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := original[len(original)-1].Version
+	if version != latest {
+		t.Errorf("Expected version to be %d after NewFrom, but got %d", latest, version)
+	}
+
+	type example struct {
+		Id int
+	}
+	RegisterMigration(Migration{
+		Version: 1000,
+		Name:    "create example table",
+		Up: func(s *Store) error {
+			return s.Database.Table(s.TableName() + "_example").AutoMigrate(&example{})
+		},
+		Down: func(s *Store) error {
+			return s.Database.Migrator().DropTable(s.TableName() + "_example")
+		},
+	})
+
+	testCases := []struct {
+		run         func() error
+		version     int
+		exampleUsed bool
+	}{
+		{run: store.Migrate, version: 1000, exampleUsed: true},
+		{run: store.Migrate, version: 1000, exampleUsed: true},
+		{run: func() error { return store.MigrateDown(latest) }, version: latest, exampleUsed: false},
+	}
+
+	for _, testCase := range testCases {
+		if err := testCase.run(); err != nil {
+			t.Error(err)
+			continue
+		}
+		if version, err = store.MigrationVersion(); err != nil || version != testCase.version {
+			t.Errorf("Expected version to be %d, but got %d (%v)", testCase.version, version, err)
+		}
+		if has := store.Database.Migrator().HasTable(store.TableName() + "_example"); has != testCase.exampleUsed {
+			t.Errorf("Expected example table to exist: %v, but got %v", testCase.exampleUsed, has)
+		}
+	}
+}
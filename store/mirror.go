@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+)
+
+var (
+	MirrorQueueSize  = 1024
+	MirrorMaxRetries = 3
+	MirrorBackoff    = time.Second
+)
+
+type mirrorOp struct {
+	tenant    *Tenant
+	clientKey string
+}
+
+// MirrorStore writes through to its primary TenantStore and asynchronously
+// replicates all tenant writes to a backup store for disaster recovery. Reads
+// are only served by the primary.
+type MirrorStore struct {
+	TenantStore
+	backup  TenantStore
+	queue   chan mirrorOp
+	pending sync.WaitGroup
+	done    chan struct{}
+	closed  bool
+	mutex   sync.RWMutex
+}
+
+func NewMirror(primary, backup TenantStore) *MirrorStore {
+	s := &MirrorStore{
+		TenantStore: primary,
+		backup:      backup,
+		queue:       make(chan mirrorOp, MirrorQueueSize),
+		done:        make(chan struct{}),
+	}
+	go s.replicate()
+	return s
+}
+
+func (s *MirrorStore) replicate() {
+	defer close(s.done)
+	for op := range s.queue {
+		s.apply(op)
+		s.pending.Done()
+	}
+}
+
+func (s *MirrorStore) apply(op mirrorOp) {
+	backoff := MirrorBackoff
+	for attempt := 0; ; attempt++ {
+		var err error
+		if op.tenant != nil {
+			_, err = s.backup.Set(op.tenant)
+		} else if err = s.backup.Delete(op.clientKey); err != nil && isNotFound(err) {
+			err = nil
+		}
+		if err == nil {
+			return
+		}
+		if attempt >= MirrorMaxRetries {
+			log.ErrorF("could not mirror tenant %s to backup store: %v", op.key(), err)
+			errorreport.Report(context.Background(), errorreport.Event{
+				Kind:      errorreport.KindBackground,
+				Err:       err,
+				ClientKey: op.key(),
+				Fields:    map[string]string{"job": "mirror"},
+			})
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (op mirrorOp) key() string {
+	if op.tenant != nil {
+		return op.tenant.ClientKey
+	}
+	return op.clientKey
+}
+
+func (s *MirrorStore) enqueue(ops ...mirrorOp) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		log.WarnF("mirror store closed, not replicating %d tenant writes", len(ops))
+		return
+	}
+	for _, op := range ops {
+		s.pending.Add(1)
+		s.queue <- op
+	}
+}
+
+func (s *MirrorStore) Set(tenant *Tenant) (*Tenant, error) {
+	stored, err := s.TenantStore.Set(tenant)
+	if err == nil {
+		copied := *stored
+		s.enqueue(mirrorOp{tenant: &copied})
+	}
+	return stored, err
+}
+
+func (s *MirrorStore) Delete(clientKey string) error {
+	err := s.TenantStore.Delete(clientKey)
+	if err == nil {
+		s.enqueue(mirrorOp{clientKey: clientKey})
+	}
+	return err
+}
+
+// mirrorTx records the writes of a transaction, they are only replicated
+// once the transaction committed
+type mirrorTx struct {
+	TenantStore
+	ops []mirrorOp
+}
+
+func (t *mirrorTx) Set(tenant *Tenant) (*Tenant, error) {
+	stored, err := t.TenantStore.Set(tenant)
+	if err == nil {
+		copied := *stored
+		t.ops = append(t.ops, mirrorOp{tenant: &copied})
+	}
+	return stored, err
+}
+
+func (t *mirrorTx) Delete(clientKey string) error {
+	err := t.TenantStore.Delete(clientKey)
+	if err == nil {
+		t.ops = append(t.ops, mirrorOp{clientKey: clientKey})
+	}
+	return err
+}
+
+func (s *MirrorStore) WithTx(ctx context.Context, fn func(tx TenantStore) error) error {
+	var recorded *mirrorTx
+	err := WithTx(ctx, s.TenantStore, func(tx TenantStore) error {
+		recorded = &mirrorTx{TenantStore: tx}
+		return fn(recorded)
+	})
+	if err == nil && recorded != nil {
+		s.enqueue(recorded.ops...)
+	}
+	return err
+}
+
+func (s *MirrorStore) Touch(tenant *Tenant, at time.Time) error {
+	return Touch(s.TenantStore, tenant, at)
+}
+
+// Flush waits until all writes queued so far were replicated
+func (s *MirrorStore) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("mirror store flush: %w", ctx.Err())
+	}
+}
+
+// Close stops accepting new writes for replication and drains the queue,
+// it should be called on shutdown
+func (s *MirrorStore) Close(ctx context.Context) error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("mirror store close: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMirrorStore(t *testing.T) {
+	primary, backup := newMemoryStore(t), newMemoryStore(t)
+	mirror := NewMirror(primary, backup)
+
+	if _, err := mirror.Set(&Tenant{ClientKey: "direct", SharedSecret: "secret", BaseURL: "https://direct.atlassian.net"}); err != nil {
+		t.Fatal(err)
+	}
+	_ = mirror.WithTx(context.Background(), func(tx TenantStore) error {
+		_, err := tx.Set(&Tenant{ClientKey: "committed", SharedSecret: "secret", BaseURL: "https://committed.atlassian.net"})
+		return err
+	})
+	_ = mirror.WithTx(context.Background(), func(tx TenantStore) error {
+		_, _ = tx.Set(&Tenant{ClientKey: "rolled-back", SharedSecret: "secret", BaseURL: "https://rolled-back.atlassian.net"})
+		return errors.New("rollback")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := mirror.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		clientKey string
+		mirrored  bool
+	}{
+		{clientKey: "direct", mirrored: true},
+		{clientKey: "committed", mirrored: true},
+		{clientKey: "rolled-back", mirrored: false},
+	}
+	for _, testCase := range testCases {
+		_, err := backup.Get(testCase.clientKey)
+		if mirrored := err == nil; mirrored != testCase.mirrored {
+			t.Errorf("Expected %s mirrored to be %v, but got %v", testCase.clientKey, testCase.mirrored, mirrored)
+		}
+	}
+
+	if err := mirror.Delete("direct"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mirror.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backup.Get("direct"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected delete to be replicated before Close returned, but got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Options configures the gorm connection opened by NewWithOptions, zero
+// values keep the gorm and database/sql defaults
+type Options struct {
+	// LogLevel of the default gorm logger, ignored when Logger is set
+	LogLevel logger.LogLevel
+	// SlowThreshold logs queries slower than this as warnings
+	SlowThreshold time.Duration
+	Logger        logger.Interface
+	// PrepareStmt caches prepared statements for all queries
+	PrepareStmt     bool
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// ParseLogLevel parses the gorm log level names silent, error, warn and info
+func ParseLogLevel(level string) logger.LogLevel {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "warn", "warning":
+		return logger.Warn
+	case "info":
+		return logger.Info
+	}
+	return 0
+}
+
+func (o Options) gormConfig() *gorm.Config {
+	config := &gorm.Config{PrepareStmt: o.PrepareStmt}
+	switch {
+	case o.Logger != nil:
+		config.Logger = o.Logger
+	case o.LogLevel != 0 || o.SlowThreshold != 0:
+		loggerConfig := logger.Config{
+			SlowThreshold: 200 * time.Millisecond,
+			LogLevel:      logger.Warn,
+			Colorful:      true,
+		}
+		if o.LogLevel != 0 {
+			loggerConfig.LogLevel = o.LogLevel
+		}
+		if o.SlowThreshold != 0 {
+			loggerConfig.SlowThreshold = o.SlowThreshold
+		}
+		config.Logger = logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), loggerConfig)
+	}
+	return config
+}
+
+func (o Options) apply(db *gorm.DB) error {
+	if o.MaxOpenConns == 0 && o.MaxIdleConns == 0 && o.ConnMaxLifetime == 0 && o.ConnMaxIdleTime == 0 {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	o.applyPool(sqlDB)
+	return nil
+}
+
+// connPool is the connection pool of a *sql.DB
+type connPool interface {
+	SetMaxOpenConns(n int)
+	SetMaxIdleConns(n int)
+	SetConnMaxLifetime(d time.Duration)
+	SetConnMaxIdleTime(d time.Duration)
+}
+
+func (o Options) applyPool(pool connPool) {
+	if o.MaxOpenConns != 0 {
+		pool.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns != 0 {
+		pool.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime != 0 {
+		pool.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+	if o.ConnMaxIdleTime != 0 {
+		pool.SetConnMaxIdleTime(o.ConnMaxIdleTime)
+	}
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordingPool records the settings applied to a connection pool
+type recordingPool struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+}
+
+func (p *recordingPool) SetMaxOpenConns(n int)              { p.maxOpenConns = n }
+func (p *recordingPool) SetMaxIdleConns(n int)              { p.maxIdleConns = n }
+func (p *recordingPool) SetConnMaxLifetime(d time.Duration) { p.connMaxLifetime = d }
+func (p *recordingPool) SetConnMaxIdleTime(d time.Duration) { p.connMaxIdleTime = d }
+
+func TestParseLogLevel(t *testing.T) {
+	testCases := []struct {
+		level    string
+		expected logger.LogLevel
+	}{
+		{level: "silent", expected: logger.Silent},
+		{level: "error", expected: logger.Error},
+		{level: "Warn", expected: logger.Warn},
+		{level: "warning", expected: logger.Warn},
+		{level: "info", expected: logger.Info},
+		{level: "", expected: 0},
+		{level: "debug", expected: 0},
+	}
+	for _, testCase := range testCases {
+		if level := ParseLogLevel(testCase.level); level != testCase.expected {
+			t.Errorf("Expected the log level of %q to be %v, but got %v", testCase.level, testCase.expected, level)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	custom := logger.Default.LogMode(logger.Silent)
+	testCases := []struct {
+		name           string
+		options        Options
+		expectedLogger string
+		expectedPool   recordingPool
+	}{
+		{name: "defaults", expectedLogger: "default"},
+		{name: "log level", options: Options{LogLevel: logger.Info}, expectedLogger: "configured"},
+		{name: "slow threshold", options: Options{SlowThreshold: time.Second}, expectedLogger: "configured"},
+		{name: "custom logger", options: Options{Logger: custom, LogLevel: logger.Info}, expectedLogger: "custom"},
+		{name: "prepared statements", options: Options{PrepareStmt: true}, expectedLogger: "default"},
+		{name: "max open connections", options: Options{MaxOpenConns: 10}, expectedLogger: "default", expectedPool: recordingPool{maxOpenConns: 10}},
+		{name: "max idle connections", options: Options{MaxIdleConns: 5}, expectedLogger: "default", expectedPool: recordingPool{maxIdleConns: 5}},
+		{name: "connection lifetime", options: Options{ConnMaxLifetime: time.Hour}, expectedLogger: "default", expectedPool: recordingPool{connMaxLifetime: time.Hour}},
+		{name: "connection idle time", options: Options{ConnMaxIdleTime: time.Minute}, expectedLogger: "default", expectedPool: recordingPool{connMaxIdleTime: time.Minute}},
+	}
+	for _, testCase := range testCases {
+		config := testCase.options.gormConfig()
+		var gormLogger string
+		switch config.Logger {
+		case nil:
+			gormLogger = "default"
+		case custom:
+			gormLogger = "custom"
+		default:
+			gormLogger = "configured"
+		}
+		if gormLogger != testCase.expectedLogger {
+			t.Errorf("%s: Expected the %s logger, but got the %s logger", testCase.name, testCase.expectedLogger, gormLogger)
+		}
+		if config.PrepareStmt != testCase.options.PrepareStmt {
+			t.Errorf("%s: Expected PrepareStmt to be %v, but got %v", testCase.name, testCase.options.PrepareStmt, config.PrepareStmt)
+		}
+
+		var pool recordingPool
+		testCase.options.applyPool(&pool)
+		if pool != testCase.expectedPool {
+			t.Errorf("%s: Expected the pool settings %+v, but got %+v", testCase.name, testCase.expectedPool, pool)
+		}
+	}
+
+	// the options reach the database connection
+	db, err := gorm.Open(sqlite.Open(":memory:"), Options{PrepareStmt: true}.gormConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = (Options{MaxOpenConns: 3}).apply(db); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	if open := sqlDB.Stats().MaxOpenConnections; open != 3 || !db.PrepareStmt {
+		t.Errorf("Expected 3 open connections with prepared statements, but got %d and %v", open, db.PrepareStmt)
+	}
+}
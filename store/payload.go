@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// LifecyclePayloadContextKey is the context key of the LifecyclePayload of
+// the lifecycle callbacks
+const LifecyclePayloadContextKey = "lifecyclePayload"
+
+// LifecyclePayload is the body of an installed or uninstalled lifecycle
+// request, including the fields which are not stored with the Tenant. Raw is
+// the complete body for fields the struct does not know, it holds the shared
+// secret and must not be logged
+type LifecyclePayload struct {
+	Key                             string          `json:"key"`
+	ClientKey                       string          `json:"clientKey"`
+	PublicKey                       string          `json:"publicKey,omitempty"`
+	SharedSecret                    string          `json:"sharedSecret,omitempty"`
+	OauthClientId                   string          `json:"oauthClientId,omitempty"`
+	ServerVersion                   string          `json:"serverVersion,omitempty"`
+	PluginsVersion                  string          `json:"pluginsVersion,omitempty"`
+	BaseURL                         string          `json:"baseUrl"`
+	DisplayURL                      string          `json:"displayUrl,omitempty"`
+	DisplayURLServicedeskHelpCenter string          `json:"displayUrlServicedeskHelpCenter,omitempty"`
+	ProductType                     string          `json:"productType"`
+	Description                     string          `json:"description,omitempty"`
+	ServiceEntitlementNumber        string          `json:"serviceEntitlementNumber,omitempty"`
+	EntitlementId                   string          `json:"entitlementId,omitempty"`
+	EntitlementNumber               string          `json:"entitlementNumber,omitempty"`
+	CapabilitySet                   string          `json:"capabilitySet,omitempty"`
+	CloudId                         string          `json:"cloudId,omitempty"`
+	InstallationId                  string          `json:"installationId,omitempty"`
+	EventType                       string          `json:"eventType"`
+	Raw                             json.RawMessage `json:"-"`
+}
+
+// NewLifecyclePayloadFromReader reads a lifecycle request body, the Tenant
+// it describes is returned by Tenant
+func NewLifecyclePayloadFromReader(r io.Reader) (*LifecyclePayload, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewLifecyclePayloadFromBytes(raw)
+}
+
+// NewLifecyclePayloadFromBytes parses a lifecycle request body
+func NewLifecyclePayloadFromBytes(raw []byte) (*LifecyclePayload, error) {
+	payload := &LifecyclePayload{Raw: raw}
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return nil, err
+	}
+	if payload.ClientKey == "" {
+		return nil, fmt.Errorf("tenant missing ClientKey")
+	}
+	return payload, nil
+}
+
+// Tenant returns the tenant of the payload like NewTenantFromReader
+func (p *LifecyclePayload) Tenant() (*Tenant, error) {
+	tenant := &Tenant{}
+	if err := json.Unmarshal(p.Raw, tenant); err != nil {
+		return nil, err
+	}
+	if tenant.EventType == "installed" {
+		tenant.AddonInstalled = true
+	} else if tenant.EventType == "uninstalled" {
+		tenant.AddonInstalled = false
+	}
+	log.TraceF("Created new Tenant instance from reader; tenant: %+v\n", *tenant)
+	return tenant, nil
+}
+
+// WithLifecyclePayload returns a copy of ctx holding the payload
+func WithLifecyclePayload(ctx context.Context, payload *LifecyclePayload) context.Context {
+	return context.WithValue(ctx, LifecyclePayloadContextKey, payload)
+}
+
+// LifecyclePayloadFromContext returns the payload of the lifecycle request
+// of ctx, e.g. in Addon.OnInstalled
+func LifecyclePayloadFromContext(ctx context.Context) (*LifecyclePayload, bool) {
+	payload, ok := ctx.Value(LifecyclePayloadContextKey).(*LifecyclePayload)
+	return payload, ok
+}
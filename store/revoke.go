@@ -0,0 +1,88 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/events"
+)
+
+// SecretRevoker is implemented by stores which can invalidate the shared
+// secret of a tenant, e.g. when it is suspected to have leaked. Requests of
+// the tenant fail to authenticate until the add-on is installed again.
+type SecretRevoker interface {
+	RevokeSecret(clientKey string) error
+}
+
+// RevokeSecret clears the shared secret of the tenant and marks it as not
+// installed, the next installation stores a new secret
+func (s *Store) RevokeSecret(clientKey string) error {
+	result := s.Tx().Model(&Tenant{}).Where("client_key = ?", clientKey).
+		Updates(map[string]interface{}{"shared_secret": "", "addon_installed": false, "secret_rotated_at": time.Now().UTC()})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	s.publish(events.Event{Topic: events.TopicSecretRevoked, ClientKey: clientKey})
+	return nil
+}
+
+// revokeSecret revokes the secret in s, which fails when s cannot revoke
+// secrets
+func revokeSecret(s TenantStore, clientKey string) error {
+	revoker, ok := s.(SecretRevoker)
+	if !ok {
+		return fmt.Errorf("tenant store %T cannot revoke secrets", s)
+	}
+	return revoker.RevokeSecret(clientKey)
+}
+
+// RevokeSecret drops the cached tenant and revokes its secret in the
+// underlying store
+func (s *CachedStore) RevokeSecret(clientKey string) error {
+	revoker, ok := s.TenantStore.(SecretRevoker)
+	if !ok {
+		return fmt.Errorf("tenant store %T cannot revoke secrets", s.TenantStore)
+	}
+	s.forget(clientKey)
+	defer s.forget(clientKey)
+	return revoker.RevokeSecret(clientKey)
+}
+
+func (s *BreakerStore) RevokeSecret(clientKey string) error {
+	return revokeSecret(s.TenantStore, clientKey)
+}
+
+// RevokeSecret revokes the secret in Primary, a tenant only found in
+// Secondary is copied to Primary first so that the fallback does not serve
+// its secret anymore
+func (s *FallbackStore) RevokeSecret(clientKey string) error {
+	err := revokeSecret(s.Primary, clientKey)
+	if err == nil || !isNotFound(err) {
+		return err
+	}
+	tenant, err := s.Secondary.Get(clientKey)
+	if err != nil {
+		return err
+	}
+	if _, err = s.Primary.Set(tenant); err != nil {
+		return err
+	}
+	return revokeSecret(s.Primary, clientKey)
+}
+
+// RevokeSecret revokes the secret in the primary store and replicates the
+// revoked tenant to the backup
+func (s *MirrorStore) RevokeSecret(clientKey string) error {
+	if err := revokeSecret(s.TenantStore, clientKey); err != nil {
+		return err
+	}
+	revoked, err := s.TenantStore.Get(clientKey)
+	if err != nil {
+		return err
+	}
+	copied := *revoked
+	s.enqueue(mirrorOp{tenant: &copied})
+	return nil
+}
@@ -0,0 +1,17 @@
+package store
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 12,
+		Name:    "add tenant secret rotation time",
+		Up: func(s *Store) error {
+			if s.introspect().HasColumn(&Tenant{}, "SecretRotatedAt") {
+				return nil
+			}
+			return s.migrator().AddColumn(&Tenant{}, "SecretRotatedAt")
+		},
+		Down: func(s *Store) error {
+			return s.migrator().DropColumn(&Tenant{}, "SecretRotatedAt")
+		},
+	})
+}
@@ -0,0 +1,17 @@
+package store
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 13,
+		Name:    "add tenant signed install time",
+		Up: func(s *Store) error {
+			if s.introspect().HasColumn(&Tenant{}, "SignedInstallAt") {
+				return nil
+			}
+			return s.migrator().AddColumn(&Tenant{}, "SignedInstallAt")
+		},
+		Down: func(s *Store) error {
+			return s.migrator().DropColumn(&Tenant{}, "SignedInstallAt")
+		},
+	})
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/lease"
+)
+
+// TouchInterval limits how often Touch writes the LastSeenAt of a tenant, so
+// that authenticated requests do not each cause a database write
+var TouchInterval = time.Hour
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 3,
+		Name:    "add tenant last seen at",
+		Up: func(s *Store) error {
+			if s.introspect().HasColumn(&Tenant{}, "LastSeenAt") {
+				return nil
+			}
+			return s.migrator().AddColumn(&Tenant{}, "LastSeenAt")
+		},
+		Down: func(s *Store) error {
+			return s.migrator().DropColumn(&Tenant{}, "LastSeenAt")
+		},
+	})
+}
+
+// Touch records that the tenant was seen at the given time, unless it was
+// already seen within TouchInterval
+func (s *Store) Touch(tenant *Tenant, at time.Time) error {
+	if tenant.LastSeenAt != nil && at.Sub(*tenant.LastSeenAt) < TouchInterval {
+		return nil
+	}
+	if result := s.Tx().Where("client_key = ?", tenant.ClientKey).Update("last_seen_at", at); result.Error != nil {
+		return result.Error
+	}
+	tenant.LastSeenAt = &at
+	return nil
+}
+
+// ListStale returns the installed tenants not seen within maxAge, tenants
+// which were never seen are stale once they were installed longer than
+// maxAge ago
+func (s *Store) ListStale(maxAge time.Duration) (tenants []*Tenant, err error) {
+	cutoff := time.Now().Add(-maxAge)
+	err = s.Tx().
+		Where("addon_installed = ?", true).
+		Where("(last_seen_at < ?) OR (last_seen_at IS NULL AND created_at < ?)", cutoff, cutoff).
+		Order("client_key").
+		Find(&tenants).Error
+	if err == nil {
+		err = s.decrypt(tenants...)
+	}
+	return
+}
+
+// MarkStaleUninstalled marks all tenants not seen within maxAge as
+// uninstalled and returns how many were changed
+func (s *Store) MarkStaleUninstalled(maxAge time.Duration) (count int64, err error) {
+	cutoff := time.Now().Add(-maxAge)
+	result := s.Tx().
+		Where("addon_installed = ?", true).
+		Where("(last_seen_at < ?) OR (last_seen_at IS NULL AND created_at < ?)", cutoff, cutoff).
+		Update("addon_installed", false)
+	return result.RowsAffected, result.Error
+}
+
+// StaleCleanupLease is the name of the lease held by the replica running the
+// stale tenant cleanup
+const StaleCleanupLease = "stale-cleanup"
+
+// RunStaleCleanup marks stale tenants as uninstalled every interval until
+// ctx is done. Only the replica holding the StaleCleanupLease of
+// lease.Default, or of the store when it is nil, runs the cleanup.
+func (s *Store) RunStaleCleanup(ctx context.Context, interval, maxAge time.Duration) {
+	lease.Run(ctx, s.leaser(), StaleCleanupLease, 2*interval, interval, func(ctx context.Context) {
+		if count, err := s.MarkStaleUninstalled(maxAge); err != nil {
+			log.ErrorF("stale tenant cleanup failed: %v", err)
+			errorreport.Report(ctx, errorreport.Event{
+				Kind:   errorreport.KindBackground,
+				Err:    err,
+				Fields: map[string]string{"job": "stale-cleanup"},
+			})
+		} else if count > 0 {
+			log.InfoF("marked %d tenants not seen within %v as uninstalled", count, maxAge)
+		}
+	})
+}
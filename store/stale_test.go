@@ -0,0 +1,54 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStale(t *testing.T) {
+	store := newMemoryStore(t)
+	now := time.Now()
+	old := now.Add(-72 * time.Hour)
+
+	for _, tenant := range []*Tenant{
+		{ClientKey: "recent", AddonInstalled: true, CreatedAt: old},
+		{ClientKey: "stale", AddonInstalled: true, CreatedAt: old},
+		{ClientKey: "never-seen", AddonInstalled: true, CreatedAt: old},
+		{ClientKey: "new", AddonInstalled: true, CreatedAt: now},
+		{ClientKey: "uninstalled", AddonInstalled: false, CreatedAt: old},
+	} {
+		tenant.SharedSecret, tenant.BaseURL = "secret", "https://"+tenant.ClientKey+".atlassian.net"
+		if _, err := store.Set(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recent, _ := store.Get("recent")
+	if err := store.Touch(recent, now); err != nil {
+		t.Fatal(err)
+	}
+	stale, _ := store.Get("stale")
+	if err := store.Touch(stale, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tenants, err := store.ListStale(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, tenant := range tenants {
+		keys = append(keys, tenant.ClientKey)
+	}
+	if len(keys) != 2 || keys[0] != "never-seen" || keys[1] != "stale" {
+		t.Errorf("Expected never-seen and stale to be stale, but got %v", keys)
+	}
+
+	count, err := store.MarkStaleUninstalled(24 * time.Hour)
+	if err != nil || count != 2 {
+		t.Errorf("Expected 2 tenants to be marked uninstalled, but got %d (%v)", count, err)
+	}
+	if tenant, _ := store.Get("stale"); tenant.AddonInstalled {
+		t.Errorf("Expected stale tenant to be marked uninstalled")
+	}
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-enjin/be/pkg/log"
+)
+
+// StaticStore serves a single tenant configured up front, for self-hosted
+// deployments with one customer which do not run a database. The tenant is
+// kept in memory: installs and secret rotations of the configured clientKey
+// are accepted until restart, while writes of any other tenant fail.
+type StaticStore struct {
+	mutex  sync.RWMutex
+	tenant Tenant
+}
+
+// NewStatic returns a store serving tenant, which needs at least a ClientKey,
+// SharedSecret and BaseURL
+func NewStatic(tenant Tenant) (*StaticStore, error) {
+	if tenant.ClientKey == "" || tenant.SharedSecret == "" || tenant.BaseURL == "" {
+		return nil, fmt.Errorf("static tenant requires a clientKey, sharedSecret and baseUrl")
+	}
+	tenant.AddonInstalled = true
+	return &StaticStore{tenant: tenant}, nil
+}
+
+func (s *StaticStore) Get(clientKey string) (*Tenant, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if clientKey != s.tenant.ClientKey {
+		return nil, ErrNotFound
+	}
+	tenant := s.tenant
+	return &tenant, nil
+}
+
+func (s *StaticStore) GetByUrl(url string) (*Tenant, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if url != s.tenant.BaseURL {
+		return nil, ErrNotFound
+	}
+	tenant := s.tenant
+	return &tenant, nil
+}
+
+func (s *StaticStore) Set(tenant *Tenant) (*Tenant, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if tenant.ClientKey != s.tenant.ClientKey {
+		return nil, fmt.Errorf("static store only serves clientKey %s, not %s", s.tenant.ClientKey, tenant.ClientKey)
+	}
+	s.tenant.merge(tenant)
+	stored := s.tenant
+	return &stored, nil
+}
+
+// Delete marks the configured tenant as uninstalled, it is served again
+// after a restart
+func (s *StaticStore) Delete(clientKey string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if clientKey != s.tenant.ClientKey {
+		return ErrNotFound
+	}
+	log.WarnF("marking static tenant %s as uninstalled", clientKey)
+	s.tenant.AddonInstalled = false
+	return nil
+}
+
+func (s *StaticStore) Touch(tenant *Tenant, at time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if tenant.ClientKey == s.tenant.ClientKey {
+		s.tenant.LastSeenAt = &at
+	}
+	tenant.LastSeenAt = &at
+	return nil
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStaticStore(t *testing.T) {
+	if _, err := NewStatic(Tenant{ClientKey: "a"}); err == nil {
+		t.Fatal("Expected an error for a tenant without secret and baseUrl")
+	}
+
+	s, err := NewStatic(Tenant{ClientKey: "a", SharedSecret: "secret", BaseURL: "https://a.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		get      func() (*Tenant, error)
+		expected error
+	}{
+		{name: "clientKey", get: func() (*Tenant, error) { return s.Get("a") }},
+		{name: "baseUrl", get: func() (*Tenant, error) { return s.GetByUrl("https://a.example.com") }},
+		{name: "other clientKey", get: func() (*Tenant, error) { return s.Get("b") }, expected: ErrNotFound},
+		{name: "other baseUrl", get: func() (*Tenant, error) { return s.GetByUrl("https://b.example.com") }, expected: ErrNotFound},
+	}
+	for _, testCase := range testCases {
+		tenant, err := testCase.get()
+		if !errors.Is(err, testCase.expected) {
+			t.Errorf("%s: Expected the error %v, but got %v", testCase.name, testCase.expected, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !tenant.AddonInstalled || tenant.SharedSecret != "secret" {
+			t.Errorf("%s: Expected the installed tenant with its secret, but got %+v", testCase.name, tenant)
+		}
+		// the returned tenants do not share memory with the store
+		tenant.SharedSecret = "changed"
+	}
+
+	if _, err = s.Set(&Tenant{ClientKey: "b", SharedSecret: "other"}); err == nil {
+		t.Error("Expected writing another tenant to fail")
+	}
+	if _, err = s.Set(&Tenant{ClientKey: "a", SharedSecret: "rotated", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	seen := time.Now()
+	if err = s.Touch(&Tenant{ClientKey: "a"}, seen); err != nil {
+		t.Fatal(err)
+	}
+	if tenant, _ := s.Get("a"); tenant.SharedSecret != "rotated" || tenant.BaseURL != "https://a.example.com" || tenant.LastSeenAt == nil {
+		t.Errorf("Expected the rotated secret to be stored, but got %+v", tenant)
+	}
+
+	if err = s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if tenant, _ := s.Get("a"); tenant.AddonInstalled {
+		t.Errorf("Expected the tenant to be uninstalled, but got %+v", tenant)
+	}
+}
@@ -1,8 +1,15 @@
 package store
 
 import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
 	"github.com/go-enjin/be/pkg/log"
 
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/events"
+
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -11,12 +18,28 @@ import (
 
 var DefaultTableName = "atlas_gonnect_tenants"
 
+// ForEachBatchSize is the number of tenants loaded per query by ForEach
+var ForEachBatchSize = 500
+
 type Store struct {
 	Database *gorm.DB
 	table    string
+	// inspect is the live database used for schema introspection while
+	// Database is a dry-run session
+	inspect *gorm.DB
+	// encryption of tenant columns at rest, nil when disabled
+	encryption *Encryption
+	// pending events of a transaction, published once it is committed
+	pending *[]events.Event
 }
 
 func New(dbType string, databaseUrl string) (store *Store, err error) {
+	return NewWithOptions(dbType, databaseUrl, Options{})
+}
+
+// NewWithOptions opens the database like New, configuring the gorm logger,
+// statement caching and connection pool with the given options
+func NewWithOptions(dbType string, databaseUrl string, options Options) (store *Store, err error) {
 	log.TraceF("Initializing Database Connection")
 	var dialect gorm.Dialector
 	switch dbType {
@@ -29,7 +52,10 @@ func New(dbType string, databaseUrl string) (store *Store, err error) {
 	}
 
 	var db *gorm.DB
-	if db, err = gorm.Open(dialect); err != nil {
+	if db, err = gorm.Open(dialect, options.gormConfig()); err != nil {
+		return
+	}
+	if err = options.apply(db); err != nil {
 		return
 	}
 
@@ -42,19 +68,28 @@ func NewFrom(db *gorm.DB) (store *Store, err error) {
 	return
 }
 
+// NewTableFrom opens the store on the given table and applies all pending
+// migrations
 func NewTableFrom(table string, db *gorm.DB) (store *Store, err error) {
-	store = &Store{
-		table:    table,
-		Database: db,
-	}
+	store = OpenTableFrom(table, db)
 	log.TraceF("Migrating Database Schemas")
-	if err = store.Tx().AutoMigrate(&Tenant{}); err != nil {
+	if err = store.Migrate(); err != nil {
 		return
 	}
 	log.TraceF("Database Connection initialized")
 	return
 }
 
+// OpenTableFrom opens the store on the given table without applying any
+// migrations, for deployments which run Migrate separately from startup
+func OpenTableFrom(table string, db *gorm.DB) (store *Store) {
+	store = &Store{
+		table:    table,
+		Database: db,
+	}
+	return
+}
+
 func NewMustTableFrom(table string, db *gorm.DB) (store *Store) {
 	var err error
 	if store, err = NewTableFrom(table, db); err != nil {
@@ -80,16 +115,71 @@ func (s *Store) Get(clientKey string) (*Tenant, error) {
 	if result := s.Tx().Where(&Tenant{ClientKey: clientKey}).First(&tenant); result.Error != nil {
 		return nil, result.Error
 	}
+	if err := s.decrypt(&tenant); err != nil {
+		return nil, err
+	}
 	log.TraceF("Got Tenant from Database: %+v", tenant)
 	return &tenant, nil
 }
 
+// GetMany returns the tenants with the given client keys in a single query,
+// keyed by client key. Unknown client keys are not present in the result.
+func (s *Store) GetMany(clientKeys []string) (map[string]*Tenant, error) {
+	tenants := make(map[string]*Tenant, len(clientKeys))
+	if len(clientKeys) == 0 {
+		return tenants, nil
+	}
+	log.TraceF("%d Tenants requested from database", len(clientKeys))
+	var found []*Tenant
+	if result := s.Tx().Where("client_key IN ?", clientKeys).Find(&found); result.Error != nil {
+		return nil, result.Error
+	}
+	if err := s.decrypt(found...); err != nil {
+		return nil, err
+	}
+	for _, tenant := range found {
+		tenants[tenant.ClientKey] = tenant
+	}
+	return tenants, nil
+}
+
+// ForEach calls fn for every tenant ordered by client key, loading the
+// tenants in batches using keyset pagination. Iteration stops at the first
+// error returned by fn or when ctx is done.
+func (s *Store) ForEach(ctx context.Context, fn func(tenant *Tenant) error) error {
+	lastKey := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var batch []*Tenant
+		if result := s.Tx().WithContext(ctx).Where("client_key > ?", lastKey).Order("client_key").Limit(ForEachBatchSize).Find(&batch); result.Error != nil {
+			return result.Error
+		}
+		if err := s.decrypt(batch...); err != nil {
+			return err
+		}
+		for _, tenant := range batch {
+			if err := fn(tenant); err != nil {
+				return err
+			}
+		}
+		if len(batch) < ForEachBatchSize {
+			return nil
+		}
+		lastKey = batch[len(batch)-1].ClientKey
+	}
+}
+
 func (s *Store) GetByUrl(url string) (*Tenant, error) {
 	tenant := Tenant{}
 	log.TraceF("Tenant with clientKey %s requested from database", url)
 	if result := s.Tx().Where(&Tenant{BaseURL: url}).First(&tenant); result.Error != nil {
 		return nil, result.Error
 	}
+	if err := s.decrypt(&tenant); err != nil {
+		return nil, err
+	}
 	log.TraceF("Got Tenant from Database: %+v", tenant)
 	return &tenant, nil
 }
@@ -97,20 +187,44 @@ func (s *Store) GetByUrl(url string) (*Tenant, error) {
 func (s *Store) Set(tenant *Tenant) (*Tenant, error) {
 	log.DebugF("Tenant %+v will be inserted or updated in database", tenant)
 
+	row := tenant
+	if s.encryption != nil {
+		var err error
+		if row, err = s.encryption.encrypt(tenant); err != nil {
+			return nil, err
+		}
+	}
+
 	optionalExistingRecord := Tenant{}
 	if result := s.Tx().Where(&Tenant{ClientKey: tenant.ClientKey}).First(&optionalExistingRecord); result.Error != nil {
 		// If no entry matching the clientKey exists, insert the tenant,
 		// otherwise update the tenant
 		log.DebugF("Tenant %+v will be inserted in database", tenant)
-		if result := s.Tx().Create(tenant); result.Error != nil {
+		if result := s.Tx().Create(row); result.Error != nil {
 			return nil, result.Error
 		}
 	} else {
 		log.DebugF("Tenant %+v will be updated in database", tenant)
-		if result := s.Tx().Model(tenant).Where(&Tenant{ClientKey: tenant.ClientKey}).Updates(tenant).Update("AddonInstalled", tenant.AddonInstalled); result.Error != nil {
+		if err := s.decrypt(&optionalExistingRecord); err != nil {
+			return nil, err
+		}
+		if tenant.SharedSecret != "" && tenant.SharedSecret != optionalExistingRecord.SharedSecret {
+			rotatedAt := time.Now().UTC()
+			tenant.SecretRotatedAt, row.SecretRotatedAt = &rotatedAt, &rotatedAt
+		}
+		if err := s.recordHistory(&optionalExistingRecord, tenant); err != nil {
+			return nil, err
+		}
+		if result := s.Tx().Model(row).Where(&Tenant{ClientKey: tenant.ClientKey}).Updates(row).Update("AddonInstalled", tenant.AddonInstalled); result.Error != nil {
 			return nil, result.Error
 		}
 	}
+	tenant.CreatedAt, tenant.UpdatedAt = row.CreatedAt, row.UpdatedAt
+	s.publish(events.Event{
+		Topic:     events.TopicTenantSaved,
+		ClientKey: tenant.ClientKey,
+		Fields:    map[string]string{"baseUrl": tenant.BaseURL, "addonInstalled": strconv.FormatBool(tenant.AddonInstalled)},
+	})
 
 	log.TraceF("Tenant %+v successfully inserted or updated", tenant)
 	return tenant, nil
@@ -122,5 +236,46 @@ func (s *Store) Delete(clientKey string) (err error) {
 		return result.Error
 	}
 	log.WarnF("deleting tenant with clientKey %s from database", clientKey)
-	return s.Tx().Delete(&tenant).Error
+	if err = s.labelTx().Where("client_key = ?", clientKey).Delete(&TenantLabel{}).Error; err != nil {
+		return
+	}
+	if err = s.historyTx().Where("client_key = ?", clientKey).Delete(&TenantSnapshot{}).Error; err != nil {
+		return
+	}
+	if err = s.deletionTx().Where("client_key = ?", clientKey).Delete(&DeletionRecord{}).Error; err != nil {
+		return
+	}
+	if err = s.tokenRevocationTx().Where("client_key = ?", clientKey).Delete(&TokenRevocation{}).Error; err != nil {
+		return
+	}
+	if err = s.Tx().Delete(&tenant).Error; err != nil {
+		return
+	}
+	s.publish(events.Event{Topic: events.TopicTenantDeleted, ClientKey: clientKey})
+	return
+}
+
+// publish publishes event on the events.DefaultBus, events of transactions
+// are held back until the transaction is committed
+func (s *Store) publish(event events.Event) {
+	if s.pending != nil {
+		*s.pending = append(*s.pending, event)
+		return
+	}
+	events.Publish(context.Background(), event)
+}
+
+// PoolStatter is implemented by stores backed by a database connection pool
+type PoolStatter interface {
+	PoolStats() (sql.DBStats, error)
+}
+
+// PoolStats returns the statistics of the underlying connection pool
+func (s *Store) PoolStats() (stats sql.DBStats, err error) {
+	var db *sql.DB
+	if db, err = s.Database.DB(); err != nil {
+		return
+	}
+	stats = db.Stats()
+	return
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+var errStop = errors.New("stop")
+
+func TestForEach(t *testing.T) {
+	store := newMemoryStore(t)
+	for _, clientKey := range []string{"e", "a", "d", "b", "c"} {
+		if _, err := store.Set(&Tenant{ClientKey: clientKey, SharedSecret: "secret", BaseURL: "https://" + clientKey + ".atlassian.net"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	original := ForEachBatchSize
+	defer func() { ForEachBatchSize = original }()
+
+	testCases := []struct {
+		batchSize int
+		stopAt    string
+		expected  string
+	}{
+		{batchSize: 2, expected: "abcde"},
+		{batchSize: 5, expected: "abcde"},
+		{batchSize: 100, expected: "abcde"},
+		{batchSize: 2, stopAt: "c", expected: "abc"},
+	}
+
+	for _, testCase := range testCases {
+		ForEachBatchSize = testCase.batchSize
+		visited := ""
+		err := store.ForEach(context.Background(), func(tenant *Tenant) error {
+			visited += tenant.ClientKey
+			if tenant.ClientKey == testCase.stopAt {
+				return errStop
+			}
+			return nil
+		})
+		if testCase.stopAt != "" && err != errStop {
+			t.Errorf("Expected ForEach to return the callback error, but got %v", err)
+		} else if testCase.stopAt == "" && err != nil {
+			t.Error(err)
+		}
+		if visited != testCase.expected {
+			t.Errorf("Expected to visit %s with batch size %d, but got %s", testCase.expected, testCase.batchSize, visited)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestGetMany(t *testing.T) {
+	store := newMemoryStore(t)
+	for _, clientKey := range []string{"a", "b", "c"} {
+		if _, err := store.Set(&Tenant{ClientKey: clientKey, SharedSecret: "secret", BaseURL: "https://" + clientKey + ".atlassian.net"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		clientKeys []string
+		expected   []string
+	}{
+		{clientKeys: nil, expected: nil},
+		{clientKeys: []string{"a", "c"}, expected: []string{"a", "c"}},
+		{clientKeys: []string{"b", "unknown"}, expected: []string{"b"}},
+	}
+
+	for _, testCase := range testCases {
+		tenants, err := store.GetMany(testCase.clientKeys)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if len(tenants) != len(testCase.expected) {
+			t.Errorf("Expected %d tenants, but got %d", len(testCase.expected), len(tenants))
+		}
+		for _, clientKey := range testCase.expected {
+			if tenant, ok := tenants[clientKey]; !ok || tenant.ClientKey != clientKey {
+				t.Errorf("Expected tenant %s to be returned, but got %+v", clientKey, tenant)
+			}
+		}
+	}
+}
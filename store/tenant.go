@@ -1,14 +1,10 @@
 package store
 
 import (
-	"encoding/json"
-	"fmt"
 	"io"
 	"time"
 
 	"gorm.io/datatypes"
-
-	"github.com/go-enjin/be/pkg/log"
 )
 
 type Tenant struct {
@@ -22,24 +18,93 @@ type Tenant struct {
 	AddonInstalled bool   `json:"-" gorm:"type:bool;NOT NULL"`
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
+	LastSeenAt     *time.Time     `json:"-"`
 	EventType      string         `json:"eventType" gorm:"-"`
 	Context        datatypes.JSON `json:"context" gorm:"default:'{}'"`
+	// InstalledScopes and InstalledModules record the descriptor the tenant
+	// consented to when installing the add-on
+	InstalledScopes  []string `json:"-" gorm:"type:text;serializer:json"`
+	InstalledModules []string `json:"-" gorm:"type:text;serializer:json"`
+	// AddonKey is the key of the app identity the tenant installed, it only
+	// differs from the descriptor key when environments override it
+	AddonKey string `json:"key" gorm:"type:varchar(255)"`
+	// EntitlementId, EntitlementNumber and CapabilitySet are the
+	// entitlement details of lifecycle payloads of paid apps, CapabilitySet
+	// is the purchased edition
+	EntitlementId     string `json:"entitlementId,omitempty" gorm:"type:varchar(255)"`
+	EntitlementNumber string `json:"entitlementNumber,omitempty" gorm:"type:varchar(255)"`
+	CapabilitySet     string `json:"capabilitySet,omitempty" gorm:"type:varchar(255)"`
+	// SecretRotatedAt is when the shared secret last changed, session tokens
+	// issued before are rejected
+	SecretRotatedAt *time.Time `json:"-"`
+	// SignedInstallAt is when the tenant was last installed with a lifecycle
+	// request signed by Atlassian, it is nil for tenants only installed with
+	// unsigned requests
+	SignedInstallAt *time.Time `json:"-"`
 }
 
 func NewTenantFromReader(r io.Reader) (*Tenant, error) {
-	tenant := &Tenant{}
-	err := json.NewDecoder(r).Decode(tenant)
+	payload, err := NewLifecyclePayloadFromReader(r)
 	if err != nil {
 		return nil, err
 	}
-	if tenant.ClientKey == "" {
-		return nil, fmt.Errorf("tenant missing ClientKey")
+	return payload.Tenant()
+}
+
+// merge applies the non-empty fields of update onto t, matching the partial
+// update semantics of Store.Set for stores which keep whole records
+func (t *Tenant) merge(update *Tenant) {
+	if update.PublicKey != "" {
+		t.PublicKey = update.PublicKey
+	}
+	if update.SharedSecret != "" {
+		if t.SharedSecret != "" && t.SharedSecret != update.SharedSecret {
+			rotatedAt := time.Now().UTC()
+			t.SecretRotatedAt = &rotatedAt
+		}
+		t.SharedSecret = update.SharedSecret
+	}
+	if update.SecretRotatedAt != nil {
+		t.SecretRotatedAt = update.SecretRotatedAt
+	}
+	if update.SignedInstallAt != nil {
+		t.SignedInstallAt = update.SignedInstallAt
+	}
+	if update.OauthClientId != "" {
+		t.OauthClientId = update.OauthClientId
+	}
+	if update.BaseURL != "" {
+		t.BaseURL = update.BaseURL
+	}
+	if update.ProductType != "" {
+		t.ProductType = update.ProductType
 	}
-	if tenant.EventType == "installed" {
-		tenant.AddonInstalled = true
-	} else if tenant.EventType == "uninstalled" {
-		tenant.AddonInstalled = false
+	if update.Description != "" {
+		t.Description = update.Description
 	}
-	log.TraceF("Created new Tenant instance from reader; tenant: %+v\n", *tenant)
-	return tenant, nil
-}
\ No newline at end of file
+	if len(update.Context) > 0 {
+		t.Context = update.Context
+	}
+	if update.LastSeenAt != nil {
+		t.LastSeenAt = update.LastSeenAt
+	}
+	if update.InstalledScopes != nil {
+		t.InstalledScopes = update.InstalledScopes
+	}
+	if update.InstalledModules != nil {
+		t.InstalledModules = update.InstalledModules
+	}
+	if update.AddonKey != "" {
+		t.AddonKey = update.AddonKey
+	}
+	if update.EntitlementId != "" {
+		t.EntitlementId = update.EntitlementId
+	}
+	if update.EntitlementNumber != "" {
+		t.EntitlementNumber = update.EntitlementNumber
+	}
+	if update.CapabilitySet != "" {
+		t.CapabilitySet = update.CapabilitySet
+	}
+	t.AddonInstalled = update.AddonInstalled
+}
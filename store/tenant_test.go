@@ -24,6 +24,7 @@ func TestNewTenantFromReader(t *testing.T) {
 				Description:    "AtlassianJiraathttps://example.atlassian.net",
 				AddonInstalled: true,
 				EventType:      "installed",
+				AddonKey:       "installed-addon-key",
 			},
 			expectError: false,
 		},
@@ -35,6 +36,7 @@ func TestNewTenantFromReader(t *testing.T) {
 				Description:    "AtlassianJiraathttps://example.atlassian.net",
 				AddonInstalled: false,
 				EventType:      "uninstalled",
+				AddonKey:       "installed-addon-key",
 			},
 			expectError: false,
 		},
@@ -64,3 +66,21 @@ func TestNewTenantFromReader(t *testing.T) {
 		}
 	}
 }
+
+func TestSecretBytes(t *testing.T) {
+	tenant := &Tenant{SharedSecret: "shared-secret"}
+	secret := tenant.SecretBytes()
+	fingerprint := tenant.SecretFingerprint()
+	if fingerprint != Fingerprint([]byte("shared-secret")) {
+		t.Errorf("Expected the fingerprint of the secret, but got %s", fingerprint)
+	}
+	Zero(secret)
+	for _, b := range secret {
+		if b != 0 {
+			t.Fatalf("Expected the secret to be zeroed, but got %q", secret)
+		}
+	}
+	if tenant.SharedSecret != "shared-secret" || tenant.SecretFingerprint() != fingerprint {
+		t.Errorf("Expected the tenant secret to be unchanged by zeroing the copy, but got %q", tenant.SharedSecret)
+	}
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func init() {
+	RegisterMigration(Migration{
+		Version: 11,
+		Name:    "create token revocation table",
+		Up: func(s *Store) error {
+			return s.Database.Table(s.TokenRevocationTableName()).AutoMigrate(&TokenRevocation{})
+		},
+		Down: func(s *Store) error {
+			return s.Database.Migrator().DropTable(s.TokenRevocationTableName())
+		},
+	})
+}
+
+// TokenRevocation revokes the session token Jti of a tenant, or all of its
+// session tokens issued before IssuedBefore when Jti is empty
+type TokenRevocation struct {
+	ClientKey    string `gorm:"type:varchar(255);primaryKey"`
+	Jti          string `gorm:"type:varchar(255);primaryKey"`
+	IssuedBefore time.Time
+	RevokedAt    time.Time
+}
+
+// TokenRevoker is implemented by stores which keep the revoked session
+// tokens the add-on issued, so that sessions can be invalidated without
+// rotating the shared secret of the tenant
+type TokenRevoker interface {
+	// RevokeToken revokes the session token with the jti claim
+	RevokeToken(clientKey, jti string) error
+	// RevokeTokensIssuedBefore revokes the session tokens of the tenant
+	// issued before the time
+	RevokeTokensIssuedBefore(clientKey string, before time.Time) error
+	// TokenRevoked reports whether the session token with the jti and iat
+	// claims was revoked
+	TokenRevoked(clientKey, jti string, issuedAt time.Time) (bool, error)
+}
+
+// TokenRevocationTableName returns the name of the table holding the token
+// revocations
+func (s *Store) TokenRevocationTableName() string {
+	return s.TableName() + "_token_revocations"
+}
+
+func (s *Store) tokenRevocationTx() *gorm.DB {
+	return s.Database.Table(s.TokenRevocationTableName())
+}
+
+func (s *Store) RevokeToken(clientKey, jti string) error {
+	if jti == "" {
+		return fmt.Errorf("revoking a token requires its jti")
+	}
+	return s.tokenRevocationTx().Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&TokenRevocation{ClientKey: clientKey, Jti: jti, RevokedAt: time.Now().UTC()}).Error
+}
+
+func (s *Store) RevokeTokensIssuedBefore(clientKey string, before time.Time) error {
+	return s.tokenRevocationTx().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "client_key"}, {Name: "jti"}},
+		DoUpdates: clause.AssignmentColumns([]string{"issued_before", "revoked_at"}),
+	}).Create(&TokenRevocation{ClientKey: clientKey, IssuedBefore: before.UTC(), RevokedAt: time.Now().UTC()}).Error
+}
+
+func (s *Store) TokenRevoked(clientKey, jti string, issuedAt time.Time) (bool, error) {
+	var revocations []TokenRevocation
+	err := s.tokenRevocationTx().Where("client_key = ? AND jti IN ?", clientKey, []string{"", jti}).Find(&revocations).Error
+	if err != nil {
+		return false, err
+	}
+	for _, revocation := range revocations {
+		if revocation.Jti != "" || issuedAt.Before(revocation.IssuedBefore) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// revokeToken revokes the token in s, which fails when s cannot revoke
+// tokens
+func revokeToken(s TenantStore, clientKey, jti string) error {
+	revoker, ok := s.(TokenRevoker)
+	if !ok {
+		return fmt.Errorf("tenant store %T cannot revoke tokens", s)
+	}
+	return revoker.RevokeToken(clientKey, jti)
+}
+
+// revokeTokensIssuedBefore revokes the tokens in s, which fails when s cannot
+// revoke tokens
+func revokeTokensIssuedBefore(s TenantStore, clientKey string, before time.Time) error {
+	revoker, ok := s.(TokenRevoker)
+	if !ok {
+		return fmt.Errorf("tenant store %T cannot revoke tokens", s)
+	}
+	return revoker.RevokeTokensIssuedBefore(clientKey, before)
+}
+
+// tokenRevoked looks the token up in s, no token is revoked when s cannot
+// revoke tokens
+func tokenRevoked(s TenantStore, clientKey, jti string, issuedAt time.Time) (bool, error) {
+	revoker, ok := s.(TokenRevoker)
+	if !ok {
+		return false, nil
+	}
+	return revoker.TokenRevoked(clientKey, jti, issuedAt)
+}
+
+// RevokeToken revokes the token in the underlying store
+func (s *CachedStore) RevokeToken(clientKey, jti string) error {
+	return revokeToken(s.TenantStore, clientKey, jti)
+}
+
+// RevokeTokensIssuedBefore revokes the tokens in the underlying store
+func (s *CachedStore) RevokeTokensIssuedBefore(clientKey string, before time.Time) error {
+	return revokeTokensIssuedBefore(s.TenantStore, clientKey, before)
+}
+
+// TokenRevoked looks the token up in the underlying store, no token is
+// revoked when it cannot revoke tokens
+func (s *CachedStore) TokenRevoked(clientKey, jti string, issuedAt time.Time) (bool, error) {
+	return tokenRevoked(s.TenantStore, clientKey, jti, issuedAt)
+}
+
+func (s *BreakerStore) RevokeToken(clientKey, jti string) error {
+	return revokeToken(s.TenantStore, clientKey, jti)
+}
+
+func (s *BreakerStore) RevokeTokensIssuedBefore(clientKey string, before time.Time) error {
+	return revokeTokensIssuedBefore(s.TenantStore, clientKey, before)
+}
+
+// TokenRevoked is guarded like the other lookups of the authentication path
+func (s *BreakerStore) TokenRevoked(clientKey, jti string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := s.call(func() (e error) {
+		revoked, e = tokenRevoked(s.TenantStore, clientKey, jti, issuedAt)
+		return
+	})
+	return revoked, err
+}
+
+// RevokeToken revokes the token in Primary, which holds all revocations
+func (s *FallbackStore) RevokeToken(clientKey, jti string) error {
+	return revokeToken(s.Primary, clientKey, jti)
+}
+
+func (s *FallbackStore) RevokeTokensIssuedBefore(clientKey string, before time.Time) error {
+	return revokeTokensIssuedBefore(s.Primary, clientKey, before)
+}
+
+func (s *FallbackStore) TokenRevoked(clientKey, jti string, issuedAt time.Time) (bool, error) {
+	return tokenRevoked(s.Primary, clientKey, jti, issuedAt)
+}
+
+// RevokeToken revokes the token in the primary store, revocations are not
+// replicated to the backup
+func (s *MirrorStore) RevokeToken(clientKey, jti string) error {
+	return revokeToken(s.TenantStore, clientKey, jti)
+}
+
+func (s *MirrorStore) RevokeTokensIssuedBefore(clientKey string, before time.Time) error {
+	return revokeTokensIssuedBefore(s.TenantStore, clientKey, before)
+}
+
+func (s *MirrorStore) TokenRevoked(clientKey, jti string, issuedAt time.Time) (bool, error) {
+	return tokenRevoked(s.TenantStore, clientKey, jti, issuedAt)
+}
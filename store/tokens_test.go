@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenRevocation(t *testing.T) {
+	store := newMemoryStore(t)
+	now := time.Now()
+
+	if err := store.RevokeToken("a", "revoked-jti"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeToken("a", "revoked-jti"); err != nil {
+		t.Errorf("Expected revoking a token twice to succeed, but got %v", err)
+	}
+	if err := store.RevokeTokensIssuedBefore("b", now); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		clientKey string
+		jti       string
+		issuedAt  time.Time
+		expected  bool
+	}{
+		{clientKey: "a", jti: "revoked-jti", issuedAt: now, expected: true},
+		{clientKey: "a", jti: "other-jti", issuedAt: now, expected: false},
+		{clientKey: "c", jti: "revoked-jti", issuedAt: now, expected: false},
+		{clientKey: "b", jti: "old-jti", issuedAt: now.Add(-time.Minute), expected: true},
+		{clientKey: "b", jti: "", issuedAt: time.Time{}, expected: true},
+		{clientKey: "b", jti: "new-jti", issuedAt: now.Add(time.Minute), expected: false},
+	}
+	for _, testCase := range testCases {
+		revoked, err := store.TokenRevoked(testCase.clientKey, testCase.jti, testCase.issuedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != testCase.expected {
+			t.Errorf("Expected token %s of %s revoked to be %v, but got %v", testCase.jti, testCase.clientKey, testCase.expected, revoked)
+		}
+	}
+}
+
+func TestSecretRotatedAt(t *testing.T) {
+	store := newMemoryStore(t)
+	tenant := &Tenant{ClientKey: "a", BaseURL: "https://a.atlassian.net", SharedSecret: "first", AddonInstalled: true}
+	for _, secret := range []string{"first", "first"} {
+		tenant.SharedSecret = secret
+		if _, err := store.Set(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stored, err := store.Get("a"); err != nil || stored.SecretRotatedAt != nil {
+		t.Errorf("Expected no rotation while the secret is unchanged, but got %v, %v", stored.SecretRotatedAt, err)
+	}
+	if _, err := store.Set(&Tenant{ClientKey: "a", SharedSecret: "second", AddonInstalled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Get("a"); err != nil || stored.SecretRotatedAt == nil || time.Since(*stored.SecretRotatedAt) > time.Minute {
+		t.Errorf("Expected the rotation to be recorded, but got %+v, %v", stored, err)
+	}
+}
+
+func TestWrappedStoreRevocation(t *testing.T) {
+	tenant := &Tenant{ClientKey: "a", BaseURL: "https://a.atlassian.net", SharedSecret: "secret", AddonInstalled: true}
+	testCases := []struct {
+		name  string
+		store func(inner *Store) TenantStore
+	}{
+		{name: "breaker", store: func(inner *Store) TenantStore { return NewBreaker(inner, time.Second, 3, time.Minute) }},
+		{name: "fallback", store: func(inner *Store) TenantStore { return NewFallback(newMemoryStore(t), inner, false) }},
+		{name: "mirror", store: func(inner *Store) TenantStore { return NewMirror(inner, newMemoryStore(t)) }},
+	}
+	for _, testCase := range testCases {
+		inner := newMemoryStore(t)
+		if _, err := inner.Set(tenant); err != nil {
+			t.Fatal(err)
+		}
+		wrapped := testCase.store(inner)
+		tokens, ok := wrapped.(TokenRevoker)
+		if !ok {
+			t.Errorf("%s: Expected the store to revoke tokens", testCase.name)
+			continue
+		}
+		if err := tokens.RevokeToken("a", "revoked-jti"); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := tokens.TokenRevoked("a", "revoked-jti", time.Now()); err != nil || !revoked {
+			t.Errorf("%s: Expected the token to be revoked, but got %v, %v", testCase.name, revoked, err)
+		}
+		secrets, ok := wrapped.(SecretRevoker)
+		if !ok {
+			t.Errorf("%s: Expected the store to revoke secrets", testCase.name)
+			continue
+		}
+		if err := secrets.RevokeSecret("a"); err != nil {
+			t.Fatal(err)
+		}
+		if stored, err := wrapped.Get("a"); err != nil || stored.SharedSecret != "" || stored.AddonInstalled {
+			t.Errorf("%s: Expected the secret to be revoked, but got %+v, %v", testCase.name, stored, err)
+		}
+		if mirror, ok := wrapped.(*MirrorStore); ok {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := mirror.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+			cancel()
+			if stored, err := mirror.backup.Get("a"); err != nil || stored.SharedSecret != "" {
+				t.Errorf("%s: Expected the revoked secret to be mirrored, but got %+v, %v", testCase.name, stored, err)
+			}
+		}
+	}
+}
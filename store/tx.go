@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/events"
+)
+
+// ErrNotFound is returned by TenantStore implementations when no tenant
+// matches the lookup
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// TenantStore is the set of tenant operations every store implementation
+// provides, both on its own and within a transaction
+type TenantStore interface {
+	Get(clientKey string) (*Tenant, error)
+	GetByUrl(url string) (*Tenant, error)
+	Set(tenant *Tenant) (*Tenant, error)
+	Delete(clientKey string) error
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// Transactor is implemented by stores which support transactions
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(tx TenantStore) error) error
+}
+
+// Toucher is implemented by stores which track when tenants were last seen
+type Toucher interface {
+	Touch(tenant *Tenant, at time.Time) error
+}
+
+// Iterator is implemented by stores which can enumerate all their tenants
+type Iterator interface {
+	ForEach(ctx context.Context, fn func(tenant *Tenant) error) error
+}
+
+// WithTx runs fn within a database transaction, the transaction is committed
+// if fn returns nil and rolled back otherwise
+func (s *Store) WithTx(ctx context.Context, fn func(tx TenantStore) error) error {
+	var pending []events.Event
+	err := s.Database.WithContext(ctx).Transaction(func(db *gorm.DB) error {
+		return fn(&Store{Database: db, table: s.table, encryption: s.encryption, pending: &pending})
+	})
+	if err == nil {
+		for _, event := range pending {
+			s.publish(event)
+		}
+	}
+	return err
+}
+
+// WithTx runs fn within a transaction of s if it is a Transactor, otherwise
+// fn is called with s directly
+func WithTx(ctx context.Context, s TenantStore, fn func(tx TenantStore) error) error {
+	if t, ok := s.(Transactor); ok {
+		return t.WithTx(ctx, fn)
+	}
+	return fn(s)
+}
+
+// Touch records that the tenant was seen if s is a Toucher
+func Touch(s TenantStore, tenant *Tenant, at time.Time) error {
+	if t, ok := s.(Toucher); ok {
+		return t.Touch(tenant, at)
+	}
+	return nil
+}
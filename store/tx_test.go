@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/events"
+)
+
+func newMemoryStore(t *testing.T) *Store {
+	db, err := gorm.Open(sqlite.Open(":memory:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every new connection would open a new, empty in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	store, err := NewFrom(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestWithTx(t *testing.T) {
+	testCases := []struct {
+		clientKey   string
+		fnError     error
+		expectFound bool
+	}{
+		{clientKey: "committed", fnError: nil, expectFound: true},
+		{clientKey: "rolled-back", fnError: errors.New("OnInstalled failed"), expectFound: false},
+	}
+
+	store := newMemoryStore(t)
+	for _, testCase := range testCases {
+		err := store.WithTx(context.Background(), func(tx TenantStore) error {
+			if _, err := tx.Set(&Tenant{ClientKey: testCase.clientKey, SharedSecret: "secret", BaseURL: "https://example.atlassian.net"}); err != nil {
+				return err
+			}
+			if _, err := tx.Get(testCase.clientKey); err != nil {
+				t.Errorf("Expected tenant to be visible within the transaction, but got %s", err)
+			}
+			return testCase.fnError
+		})
+		if err != testCase.fnError {
+			t.Errorf("Expected error to be %v, but got %v", testCase.fnError, err)
+		}
+
+		_, err = store.Get(testCase.clientKey)
+		if found := err == nil; found != testCase.expectFound {
+			t.Errorf("Expected tenant %s found to be %v, but got %v", testCase.clientKey, testCase.expectFound, found)
+		}
+	}
+}
+
+func TestWithTxPublishesOnCommit(t *testing.T) {
+	var published []string
+	unsubscribe := events.Subscribe("tenant.*", func(ctx context.Context, event events.Event) {
+		published = append(published, event.ClientKey)
+	})
+	defer unsubscribe()
+
+	store := newMemoryStore(t)
+	for _, clientKey := range []string{"committed", "rolled-back"} {
+		before := len(published)
+		_ = store.WithTx(context.Background(), func(tx TenantStore) error {
+			if _, err := tx.Set(&Tenant{ClientKey: clientKey, SharedSecret: "secret", BaseURL: "https://example.atlassian.net"}); err != nil {
+				return err
+			}
+			if len(published) != before {
+				t.Errorf("Expected no events to be published within the transaction, but got %v", published)
+			}
+			if clientKey == "rolled-back" {
+				return errors.New("rollback")
+			}
+			return nil
+		})
+	}
+	if len(published) != 1 || published[0] != "committed" {
+		t.Errorf("Expected only the committed tenant to be published, but got %v", published)
+	}
+}
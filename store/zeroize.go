@@ -0,0 +1,24 @@
+package store
+
+// Zero overwrites b with zeros once a secret or token was used. It only
+// shortens the life of the byte slice copies: the decrypted
+// Tenant.SharedSecret stays in memory as a string for as long as the tenant
+// is, and copies made by the runtime or by libraries, e.g. the padded keys of
+// crypto/hmac or the header values of requests, are not reached
+func Zero(b []byte) {
+	clear(b)
+}
+
+// SecretBytes returns a copy of the shared secret to sign or verify with,
+// the caller zeroes it with Zero after use. The SharedSecret string it is
+// copied from is not affected
+func (t *Tenant) SecretBytes() []byte {
+	return []byte(t.SharedSecret)
+}
+
+// SecretFingerprint returns the Fingerprint of the shared secret
+func (t *Tenant) SecretFingerprint() string {
+	secret := t.SecretBytes()
+	defer Zero(secret)
+	return Fingerprint(secret)
+}
@@ -0,0 +1,81 @@
+package gonnect
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/store"
+)
+
+// UnknownTenantPolicy decides how the authentication middleware answers
+// requests signed by a clientKey missing from the store, e.g. after the
+// tenants were dropped or the app was moved to another deployment
+type UnknownTenantPolicy int
+
+const (
+	// UnknownTenantUnauthorized responds with 401 and the unknown_tenant
+	// reason
+	UnknownTenantUnauthorized UnknownTenantPolicy = iota
+	// UnknownTenantReinstallPage responds to page requests accepting html
+	// with the ReinstallPage of the add-on, asking to reinstall the app, and
+	// to other requests with 401
+	UnknownTenantReinstallPage
+	// UnknownTenantResolve looks the tenant up with the ResolveTenant hook
+	// of the add-on, verifies the request against the resolved tenant and
+	// then stores it
+	UnknownTenantResolve
+)
+
+func (p UnknownTenantPolicy) String() string {
+	switch p {
+	case UnknownTenantUnauthorized:
+		return "unauthorized"
+	case UnknownTenantReinstallPage:
+		return "reinstall-page"
+	case UnknownTenantResolve:
+		return "resolve"
+	}
+	return fmt.Sprintf("UnknownTenantPolicy(%d)", int(p))
+}
+
+// TenantResolver returns the tenant of clientKey for the UnknownTenantResolve
+// policy, e.g. from the provisioning service of an app treating its tenants
+// as ephemeral. The claims are not verified yet, the request is verified
+// against the shared secret of the returned tenant. Resolvers return
+// store.ErrNotFound for unknown tenants, which are not resolved again for a
+// while, see middleware.ResolveMissTTL
+type TenantResolver func(ctx context.Context, clientKey string, claims map[string]interface{}) (*store.Tenant, error)
+
+// ReinstallPageData is the data of the ReinstallPage
+type ReinstallPageData struct {
+	AddonKey  string
+	AddonName string
+}
+
+// DefaultReinstallPage is the ReinstallPage of add-ons without one
+var DefaultReinstallPage = template.Must(template.New("reinstall").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.AddonName}}</title></head>
+<body>
+<p>{{.AddonName}} does not know this site anymore. Please ask an administrator to reinstall the app.</p>
+</body>
+</html>
+`))
+
+// ReinstallPageTemplate returns the ReinstallPage of a, DefaultReinstallPage
+// when it is nil, and its data
+func (a *Addon) ReinstallPageTemplate() (Template, ReinstallPageData) {
+	data := ReinstallPageData{}
+	if a.Key != nil {
+		data.AddonKey = *a.Key
+	}
+	data.AddonName = data.AddonKey
+	if a.Name != nil && *a.Name != "" {
+		data.AddonName = *a.Name
+	}
+	if a.ReinstallPage != nil {
+		return a.ReinstallPage, data
+	}
+	return DefaultReinstallPage, data
+}
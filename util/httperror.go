@@ -1,9 +1,12 @@
 package util
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
 
 	"github.com/go-enjin/be/pkg/log"
 )
@@ -12,4 +15,12 @@ func SendError(w http.ResponseWriter, r *http.Request, addon *gonnect.Addon, err
 	w.WriteHeader(errorCode)
 	_, _ = w.Write([]byte(message))
 	log.ErrorRDF(r, 1, "%s", message)
-}
\ No newline at end of file
+	if errorCode >= http.StatusInternalServerError {
+		errorreport.Report(r.Context(), errorreport.Event{
+			Kind:    errorreport.KindResponse,
+			Err:     errors.New(message),
+			Request: r,
+			Fields:  map[string]string{"status": strconv.Itoa(errorCode)},
+		})
+	}
+}
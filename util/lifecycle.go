@@ -0,0 +1,67 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-enjin/be/pkg/log"
+
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect"
+	"github.com/go-enjin/github-com-craftamap-atlas-gonnect/errorreport"
+)
+
+// LifecycleError is the body of a failed lifecycle callback, UPM shows the
+// message for failed installs
+type LifecycleError struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Reason codes of LifecycleError
+const (
+	LifecycleInvalidPayload    = "invalid_payload"
+	LifecycleStoreUnavailable  = "store_unavailable"
+	LifecycleProcessingFailure = "processing_failed"
+	LifecycleBaseUrlRejected   = "base_url_rejected"
+	LifecycleSiteCollision     = "site_collision"
+)
+
+func legacyLifecycle(addon *gonnect.Addon) bool {
+	return addon.Config != nil && addon.Config.LegacyLifecycleResponses
+}
+
+// SendLifecycleSuccess responds to a lifecycle callback with 204, or with
+// 200 "OK" for LegacyLifecycleResponses
+func SendLifecycleSuccess(w http.ResponseWriter, addon *gonnect.Addon) {
+	if legacyLifecycle(addon) {
+		_, _ = w.Write([]byte("OK"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendLifecycleError responds to a lifecycle callback with the status and a
+// LifecycleError body, LegacyLifecycleResponses respond like SendError
+func SendLifecycleError(w http.ResponseWriter, r *http.Request, addon *gonnect.Addon, errorCode int, reason, message string) {
+	if legacyLifecycle(addon) {
+		SendError(w, r, addon, errorCode, message)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if errorCode == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(errorCode)
+	_ = json.NewEncoder(w).Encode(LifecycleError{Reason: reason, Message: message})
+	log.ErrorRDF(r, 1, "lifecycle failure [%s]: %s", reason, message)
+	if errorCode >= http.StatusInternalServerError {
+		errorreport.Report(r.Context(), errorreport.Event{
+			Kind:    errorreport.KindResponse,
+			Err:     errors.New(message),
+			Request: r,
+			Fields:  map[string]string{"status": strconv.Itoa(errorCode), "reason": reason},
+		})
+	}
+}